@@ -0,0 +1,163 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+// accessFileName is the name of the files declaring access rules for a directory and its subdirectories.
+const accessFileName = ".janusaccess"
+
+// Permissions, which can be granted in access files.
+const (
+	permRead  = "read"
+	permWrite = "write"
+	permList  = "list"
+)
+
+// accessRules maps permissions to the principals they are granted to.
+type accessRules map[string][]string
+
+// readAccessFile parses the access file in dir, if present.
+// Each line has the form "<read|write|list>: <principal>...", where a principal is either
+// a user name, a group name prefixed with '@', or "public".
+func readAccessFile(dir string) (accessRules, error) {
+	f, err := os.Open(filepath.Join(dir, accessFileName))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+
+	rules := accessRules{}
+	s := bufio.NewScanner(f)
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		perm, principals, ok := strings.Cut(line, ":")
+		perm = strings.TrimSpace(perm)
+		if !ok || perm != permRead && perm != permWrite && perm != permList {
+			return nil, fmt.Errorf("%s:%d: invalid rule", f.Name(), n)
+		}
+		rules[perm] = append(rules[perm], strings.Fields(principals)...)
+	}
+	return rules, s.Err()
+}
+
+// grants reports whether the permission is granted to the identity (nil means anonymous).
+func (ar accessRules) grants(perm string, id *identity) bool {
+	for _, p := range ar[perm] {
+		if id.is(p) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkAccess evaluates the access files from the server root down to dir (relative to the root).
+// The deepest file declaring the permission decides, hence subdirectories can override their parents.
+// If no file declares the permission, declared is false.
+// Access files, which cannot be parsed, deny all access.
+func checkAccess(root, dir, perm string, id *identity) (allowed, declared bool) {
+	p := root
+	elems := strings.FieldsFunc(path.Clean("/"+dir), func(c rune) bool { return c == '/' })
+	for i := 0; i <= len(elems); i++ {
+		if i > 0 {
+			p = filepath.Join(p, elems[i-1])
+		}
+		rules, err := readAccessFile(p)
+		if err != nil {
+			log.Error().Err(err).Msg("Invalid access file")
+			return false, true
+		} else if _, ok := rules[perm]; ok {
+			allowed, declared = rules.grants(perm, id), true
+		}
+	}
+	return allowed, declared
+}
+
+// requiredPermission determines the permission needed for a request and the directory it applies to.
+func requiredPermission(a app, r *http.Request) (dir, perm string) {
+	_, upload := r.URL.Query()["upload"]
+	_, tus := r.URL.Query()["tus"]
+	if r.Method == http.MethodDelete || r.Method == http.MethodPut || r.Method == http.MethodPatch ||
+		r.Method == "LOCK" || r.Method == "UNLOCK" || tus {
+		return path.Dir(path.Clean(r.URL.Path)), permWrite
+	} else if uploadEnabled(a) && (r.Method == http.MethodPost || upload) {
+		return r.URL.Path, permWrite
+	}
+
+	p := filepath.Join(rootDir(a, r), r.URL.Path)
+	if fi, err := os.Stat(p); err != nil || !fi.IsDir() {
+		return path.Dir(r.URL.Path), permRead
+	} else if exists(filepath.Join(p, "index.html")) {
+		return r.URL.Path, permRead
+	}
+	return r.URL.Path, permList
+}
+
+// publicAccess reports whether the access files explicitly permit the request for anonymous clients.
+func publicAccess(a app, r *http.Request) bool {
+	if !a.EnableAccessFiles {
+		return false
+	}
+	dir, perm := requiredPermission(a, r)
+	allowed, declared := checkAccess(rootDir(a, r), dir, perm, nil)
+	return allowed && declared
+}
+
+// authorizeAccessFiles permits requests according to the access files of the requested directory and its parents.
+// Access files themselves are never served.
+// If access files are disabled, h is returned as is.
+func authorizeAccessFiles(a app, h http.Handler) http.Handler {
+	if !a.EnableAccessFiles {
+		return h
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if path.Base(r.URL.Path) == accessFileName {
+			http.NotFound(w, r)
+			return
+		}
+
+		id := identityFrom(r.Context())
+		dir, perm := requiredPermission(a, r)
+		if allowed, declared := checkAccess(rootDir(a, r), dir, perm, id); allowed || !declared {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		name := ""
+		if id != nil {
+			name = id.name
+		}
+		log.Warn().Str("request-id", requestIDFrom(r.Context())).Str("user", name).Str("permission", perm).
+			Str("path", r.URL.Path).Msg("Access denied by access file")
+		renderError(w, r, errAccessDenied, "access denied", http.StatusForbidden)
+	})
+}
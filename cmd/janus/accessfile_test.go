@@ -0,0 +1,123 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/stretchr/testify/require"
+)
+
+// writeAccessTree creates a directory tree with access files:
+//
+//	/            read: public
+//	/team/       read: @staff, list: alice, write: alice
+//	/team/priv/  read: alice
+func writeAccessTree(t *testing.T) string {
+	t.Helper()
+	d := t.TempDir()
+	NoError(t, os.MkdirAll(filepath.Join(d, "team", "priv"), 0700))
+	for name, content := range map[string]string{
+		accessFileName:                                "# everyone may download\nread: public\n",
+		"a.txt":                                       "a",
+		filepath.Join("team", accessFileName):         "read: @staff\nlist: alice\nwrite: alice\n",
+		filepath.Join("team", "b.txt"):                "b",
+		filepath.Join("team", "priv", accessFileName): "read: alice",
+		filepath.Join("team", "priv", "c.txt"):        "c",
+	} {
+		NoError(t, os.WriteFile(filepath.Join(d, name), []byte(content), 0600))
+	}
+	return d
+}
+
+func Test_readAccessFile(t *testing.T) {
+	d := t.TempDir()
+	rules, err := readAccessFile(d)
+	NoError(t, err)
+	Nil(t, rules)
+
+	NoError(t, os.WriteFile(filepath.Join(d, accessFileName), []byte("read: alice @staff\nread: bob\nlist: public"), 0600))
+	rules, err = readAccessFile(d)
+	NoError(t, err)
+	Equal(t, accessRules{permRead: {"alice", "@staff", "bob"}, permList: {"public"}}, rules)
+
+	NoError(t, os.WriteFile(filepath.Join(d, accessFileName), []byte("delete: alice"), 0600))
+	_, err = readAccessFile(d)
+	Error(t, err)
+}
+
+func Test_checkAccess(t *testing.T) {
+	d := writeAccessTree(t)
+	alice := &identity{name: "alice"}
+	bob := &identity{name: "bob", groups: []string{"staff"}}
+
+	tests := []struct {
+		dir      string
+		perm     string
+		id       *identity
+		allowed  bool
+		declared bool
+	}{
+		{"/", permRead, nil, true, true},
+		{"/", permList, nil, false, false},
+		{"/team", permRead, nil, false, true},
+		{"/team", permRead, bob, true, true},
+		{"/team", permList, bob, false, true},
+		{"/team", permList, alice, true, true},
+		{"/team/priv", permRead, bob, false, true},
+		{"/team/priv", permRead, alice, true, true},
+		{"/team/priv", permWrite, alice, true, true},
+	}
+	for _, tt := range tests {
+		allowed, declared := checkAccess(d, tt.dir, tt.perm, tt.id)
+		Equal(t, tt.allowed, allowed, "%s %s", tt.dir, tt.perm)
+		Equal(t, tt.declared, declared, "%s %s", tt.dir, tt.perm)
+	}
+}
+
+func Test_authorizeAccessFiles(t *testing.T) {
+	groups := filepath.Join(t.TempDir(), "groups")
+	NoError(t, os.WriteFile(groups, []byte("staff: bob\n"), 0600))
+	as, err := loadAccounts(writeUsersFile(t, "alice", "bob"), groups)
+	NoError(t, err)
+	a := app{ServerRoot: writeAccessTree(t), Prefix: "/", EnableAccessFiles: true, accounts: as, sessions: newSessionStore(time.Hour)}
+	h := requireLogin(a, authorizeAccessFiles(a, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})))
+
+	serve := func(p, user string) int {
+		r := httptest.NewRequest(http.MethodGet, p, nil)
+		if user != "" {
+			r.SetBasicAuth(user, user)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	Equal(t, http.StatusOK, serve("/a.txt", ""))
+	Equal(t, http.StatusNotFound, serve("/"+accessFileName, ""))
+	Equal(t, http.StatusUnauthorized, serve("/", ""))
+	Equal(t, http.StatusOK, serve("/", "bob"))
+	Equal(t, http.StatusUnauthorized, serve("/team/b.txt", ""))
+	Equal(t, http.StatusOK, serve("/team/b.txt", "bob"))
+	Equal(t, http.StatusForbidden, serve("/team/b.txt", "alice"))
+	Equal(t, http.StatusOK, serve("/team/", "alice"))
+	Equal(t, http.StatusForbidden, serve("/team/", "bob"))
+	Equal(t, http.StatusForbidden, serve("/team/priv/c.txt", "bob"))
+}
@@ -0,0 +1,257 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// realm is sent to clients when asking for credentials.
+const realm = "janus"
+
+// errUnknownUser indicates that a user does not exist in the users file.
+var errUnknownUser = errors.New("unknown user")
+
+// dummyHash is compared against if a user does not exist, so that the response time does not reveal valid user names.
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("janus"), bcrypt.DefaultCost)
+
+// account holds the credentials of a local user.
+type account struct {
+	hash []byte
+	totp []byte
+}
+
+// accounts holds the local users, who log in with a password and optionally a TOTP code.
+type accounts struct {
+	users  map[string]account
+	groups map[string][]string
+	// verified caches successfully verified passwords, because bcrypt is deliberately slow.
+	verified *lru[[sha256.Size]byte, struct{}]
+}
+
+// loadAccounts reads a users file, in which each line has the form "<user>:<hash>[:<TOTP secret>]".
+// This is compatible with files created by "htpasswd -B" (bcrypt) and "htpasswd -m" (APR1).
+// Empty lines and lines starting with '#' are ignored.
+// The optional groups file assigns users to groups (see loadGroups).
+// If name is empty, nil is returned.
+func loadAccounts(name, groupsFile string) (*accounts, error) {
+	if name == "" {
+		return nil, nil
+	}
+
+	f, err := os.Open(filepath.Clean(name))
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+
+	as := &accounts{users: map[string]account{}, verified: newLRU[[sha256.Size]byte, struct{}](1024, nil)}
+	s := bufio.NewScanner(f)
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fs := strings.Split(line, ":")
+		if len(fs) < 2 || len(fs) > 3 || fs[0] == "" {
+			return nil, fmt.Errorf("%s:%d: invalid entry", name, n)
+		} else if err = checkHash(fs[1]); err != nil {
+			return nil, fmt.Errorf("%s:%d: unsupported password hash (must be bcrypt or APR1): %w", name, n, err)
+		}
+
+		acc := account{hash: []byte(fs[1])}
+		if len(fs) == 3 && fs[2] != "" {
+			if acc.totp, err = totpEncoding.DecodeString(strings.ToUpper(fs[2])); err != nil {
+				return nil, fmt.Errorf("%s:%d: invalid TOTP secret: %w", name, n, err)
+			}
+		}
+		as.users[fs[0]] = acc
+	}
+	if err = s.Err(); err != nil {
+		return nil, err
+	}
+
+	as.groups, err = loadGroups(groupsFile)
+	return as, err
+}
+
+// loadGroups reads a groups file, in which each line has the form "<group>: <user> <user>...".
+// This is the format of the Apache HTTP Server's AuthGroupFile.
+// It returns the groups of each user.
+func loadGroups(name string) (map[string][]string, error) {
+	groups := map[string][]string{}
+	if name == "" {
+		return groups, nil
+	}
+
+	b, err := os.ReadFile(filepath.Clean(name))
+	if err != nil {
+		return nil, err
+	}
+	for n, line := range strings.Split(string(b), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		g, members, ok := strings.Cut(line, ":")
+		if !ok || strings.TrimSpace(g) == "" {
+			return nil, fmt.Errorf("%s:%d: invalid entry", name, n+1)
+		}
+		for _, u := range strings.Fields(members) {
+			groups[u] = append(groups[u], strings.TrimSpace(g))
+		}
+	}
+	return groups, nil
+}
+
+// checkHash returns an error, if the password hash is neither bcrypt nor APR1.
+func checkHash(hash string) error {
+	if strings.HasPrefix(hash, apr1Prefix) {
+		_, err := parseAPR1(hash)
+		return err
+	}
+	_, err := bcrypt.Cost([]byte(hash))
+	return err
+}
+
+// compareHash reports whether the password matches the bcrypt or APR1 hash.
+func compareHash(hash []byte, pass string) bool {
+	if bytes.HasPrefix(hash, []byte(apr1Prefix)) {
+		return compareAPR1(string(hash), pass)
+	}
+	return bcrypt.CompareHashAndPassword(hash, []byte(pass)) == nil
+}
+
+// identity returns the identity of a local user.
+func (as *accounts) identity(user string) *identity {
+	return &identity{name: user, groups: as.groups[user]}
+}
+
+// authenticate verifies the password of a user.
+// If the user enrolled a TOTP secret, the current code must be appended to the password.
+func (as *accounts) authenticate(user, pass string, now time.Time) bool {
+	acc, ok := as.users[user]
+	if !ok {
+		_ = bcrypt.CompareHashAndPassword(dummyHash, []byte(pass))
+		return false
+	}
+
+	code := ""
+	if acc.totp != nil {
+		if len(pass) < 6 {
+			return false
+		}
+		pass, code = pass[:len(pass)-6], pass[len(pass)-6:]
+	}
+
+	key := sha256.Sum256(append(append(append([]byte(user), 0), acc.hash...), pass...))
+	if _, cached := as.verified.Get(key); !cached {
+		if !compareHash(acc.hash, pass) {
+			return false
+		}
+		as.verified.Add(key, struct{}{})
+	}
+
+	if acc.totp != nil {
+		_, ok = verifyTOTP(acc.totp, code, now)
+	}
+	return ok
+}
+
+// requireLogin permits requests with a valid session or credentials sent via HTTP Basic authentication.
+// Browsers are redirected to the login page, whereas other clients are asked for credentials.
+// If there are no local users, h is returned as is.
+func requireLogin(a app, h http.Handler) http.Handler {
+	if a.accounts == nil {
+		return h
+	}
+
+	login := path.Join(a.Prefix, apiPrefix, "login")
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, ok := sessionUser(a.sessions, r); ok {
+			h.ServeHTTP(w, withIdentity(r, a.accounts.identity(user)))
+			return
+		}
+
+		user, pass, ok := r.BasicAuth()
+		if ok && a.accounts.authenticate(user, pass, time.Now()) {
+			h.ServeHTTP(w, withIdentity(r, a.accounts.identity(user)))
+			return
+		} else if ok {
+			log.Warn().Str("request-id", requestIDFrom(r.Context())).Str("user", user).
+				Str("client", clientIP(r)).Msg("Login failed")
+		} else if publicAccess(a, r) || publicRole(a, r) {
+			h.ServeHTTP(w, r)
+			return
+		} else if r.Method == http.MethodGet && strings.Contains(r.Header.Get("Accept"), "text/html") {
+			http.Redirect(w, r, login+"?next="+url.QueryEscape(r.RequestURI), http.StatusSeeOther)
+			return
+		}
+
+		w.Header().Set("WWW-Authenticate", `Basic realm="`+realm+`", charset="UTF-8"`)
+		renderError(w, r, errAccessDenied, "authentication required", http.StatusUnauthorized)
+	})
+}
+
+// enrollTOTP generates a new TOTP secret for a user and stores it in the users file.
+// It returns the otpauth URI to be imported into an authenticator app.
+func enrollTOTP(name, user string) (string, error) {
+	b, err := os.ReadFile(filepath.Clean(name))
+	if err != nil {
+		return "", err
+	}
+	secret, err := newTOTPSecret()
+	if err != nil {
+		return "", err
+	}
+
+	lines := bytes.Split(b, []byte("\n"))
+	found := false
+	for i, l := range lines {
+		fs := strings.Split(strings.TrimSpace(string(l)), ":")
+		if len(fs) >= 2 && fs[0] == user {
+			lines[i] = []byte(fs[0] + ":" + fs[1] + ":" + totpEncoding.EncodeToString(secret))
+			found = true
+		}
+	}
+	if !found {
+		return "", fmt.Errorf("%w: %s", errUnknownUser, user)
+	}
+
+	fi, err := os.Stat(name)
+	if err != nil {
+		return "", err
+	}
+	tmp := name + ".tmp"
+	if err = os.WriteFile(tmp, bytes.Join(lines, []byte("\n")), fi.Mode().Perm()); err != nil {
+		return "", err
+	}
+	return totpURI(realm, user, secret), os.Rename(tmp, name)
+}
@@ -0,0 +1,125 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// writeUsersFile creates a users file with the given users, whose password equals their name.
+func writeUsersFile(t *testing.T, users ...string) string {
+	t.Helper()
+	var lines []string
+	for _, u := range users {
+		h, err := bcrypt.GenerateFromPassword([]byte(u), bcrypt.MinCost)
+		NoError(t, err)
+		lines = append(lines, u+":"+string(h))
+	}
+
+	name := filepath.Join(t.TempDir(), "users")
+	NoError(t, os.WriteFile(name, []byte("# users\n\n"+strings.Join(lines, "\n")+"\n"), 0600))
+	return name
+}
+
+func Test_loadAccounts(t *testing.T) {
+	as, err := loadAccounts("", "")
+	NoError(t, err)
+	Nil(t, as)
+
+	as, err = loadAccounts(writeUsersFile(t, "alice", "bob"), "")
+	NoError(t, err)
+	Len(t, as.users, 2)
+
+	name := filepath.Join(t.TempDir(), "users")
+	NoError(t, os.WriteFile(name, []byte("alice:{SHA}secret\n"), 0600))
+	_, err = loadAccounts(name, "")
+	Error(t, err)
+}
+
+func Test_accounts_authenticate(t *testing.T) {
+	name := writeUsersFile(t, "alice", "bob")
+	uri, err := enrollTOTP(name, "bob")
+	NoError(t, err)
+	True(t, strings.HasPrefix(uri, "otpauth://totp/janus:bob?"))
+	_, err = enrollTOTP(name, "carol")
+	ErrorIs(t, err, errUnknownUser)
+
+	as, err := loadAccounts(name, "")
+	NoError(t, err)
+	now := time.Now()
+	code := totpCode(as.users["bob"].totp, now.Unix()/totpPeriod)
+
+	True(t, as.authenticate("alice", "alice", now))
+	True(t, as.authenticate("alice", "alice", now))
+	False(t, as.authenticate("alice", "bob", now))
+	False(t, as.authenticate("carol", "carol", now))
+	True(t, as.authenticate("bob", "bob"+code, now))
+	False(t, as.authenticate("bob", "bob", now))
+	False(t, as.authenticate("bob", "bob"+code, now.Add(2*time.Minute)))
+}
+
+func Test_requireLogin(t *testing.T) {
+	as, err := loadAccounts(writeUsersFile(t, "alice"), "")
+	NoError(t, err)
+	a := app{Prefix: "/pre", accounts: as, sessions: newSessionStore(time.Hour)}
+	h := requireLogin(a, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	Equal(t, http.StatusUnauthorized, w.Code)
+	Equal(t, `Basic realm="janus", charset="UTF-8"`, w.Header().Get("WWW-Authenticate"))
+
+	r := httptest.NewRequest(http.MethodGet, "/pre/a.txt", nil)
+	r.Header.Set("Accept", "text/html,*/*")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	Equal(t, http.StatusSeeOther, w.Code)
+	Equal(t, "/pre/_janus/login?next=%2Fpre%2Fa.txt", w.Header().Get("Location"))
+
+	r = httptest.NewRequest(http.MethodGet, "/", nil)
+	r.SetBasicAuth("alice", "alice")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	Equal(t, http.StatusOK, w.Code)
+
+	id, err := a.sessions.create("alice", time.Now())
+	NoError(t, err)
+	r = httptest.NewRequest(http.MethodGet, "/", nil)
+	r.AddCookie(&http.Cookie{Name: sessionCookie, Value: id})
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	Equal(t, http.StatusOK, w.Code)
+}
+
+func Test_loadGroups(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "groups")
+	NoError(t, os.WriteFile(name, []byte("# groups\nstaff: alice bob\nadmins:alice\n"), 0600))
+	groups, err := loadGroups(name)
+	NoError(t, err)
+	Equal(t, map[string][]string{"alice": {"staff", "admins"}, "bob": {"staff"}}, groups)
+
+	NoError(t, os.WriteFile(name, []byte("staff alice"), 0600))
+	_, err = loadGroups(name)
+	Error(t, err)
+}
@@ -0,0 +1,94 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// newACMEManager creates a manager, which obtains certificates for the configured hosts from an ACME CA
+// (Let's Encrypt by default) and renews them before they expire.
+// Certificates and the account key are kept in the cache directory, so that they survive restarts.
+//
+// If ACME is disabled, nil is returned.
+func newACMEManager(a app) (*autocert.Manager, error) {
+	if !a.ACME {
+		return nil, nil
+	} else if len(a.TLSCerts) > 0 {
+		return nil, errors.New("ACME cannot be combined with TLS certificates")
+	} else if len(a.ACMEHosts) == 0 {
+		return nil, errors.New("ACME requires at least one host")
+	} else if a.ACMECache == "" {
+		return nil, errors.New("ACME requires a cache directory")
+	}
+	// the cache holds the private keys, which must not be served
+	root, _ := filepath.Abs(a.ServerRoot)
+	if dir, _ := filepath.Abs(a.ACMECache); dir == root || within(root, dir) {
+		return nil, errors.New("ACME cache directory must be outside the server root")
+	}
+
+	m := &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		Cache:      autocert.DirCache(a.ACMECache),
+		HostPolicy: autocert.HostWhitelist(a.ACMEHosts...),
+		Client:     &acme.Client{DirectoryURL: a.ACMEDirectory, HTTPClient: &http.Client{Transport: outboundTransport}},
+		Email:      a.ACMEEmail,
+	}
+	log.Info().Strs("hosts", a.ACMEHosts).Str("cache", a.ACMECache).Str("directory", a.ACMEDirectory).
+		Msg("Obtaining TLS certificates via ACME")
+	return m, nil
+}
+
+// serveACMEChallenges answers HTTP-01 challenges of the ACME CA on the given Listener and redirects all other
+// requests to HTTPS. It does not return, unless the Listener fails.
+func serveACMEChallenges(m *autocert.Manager, l net.Listener, httpsAddr string) error {
+	s := &http.Server{
+		Handler:           m.HTTPHandler(redirectHTTPS(httpsAddr)),
+		ReadHeaderTimeout: 10 * time.Second,
+		IdleTimeout:       time.Minute,
+	}
+	return s.Serve(l)
+}
+
+// redirectHTTPS permanently redirects GET and HEAD requests to the same URL using HTTPS on the port of the given
+// address. Other requests are rejected, because clients would not repeat them with their body.
+func redirectHTTPS(httpsAddr string) http.Handler {
+	_, port, _ := net.SplitHostPort(httpsAddr)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			http.Error(w, "Use HTTPS", http.StatusBadRequest)
+			return
+		}
+		host, _, err := net.SplitHostPort(r.Host)
+		if err != nil {
+			host = strings.Trim(r.Host, "[]")
+		}
+		if port != "" && port != "443" {
+			host = net.JoinHostPort(host, port)
+		} else if strings.Contains(host, ":") {
+			host = "[" + host + "]"
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusMovedPermanently)
+	})
+}
@@ -0,0 +1,72 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	. "github.com/stretchr/testify/require"
+	"golang.org/x/crypto/acme"
+)
+
+func Test_newACMEManager(t *testing.T) {
+	m, err := newACMEManager(app{})
+	NoError(t, err)
+	Nil(t, m)
+
+	a := app{ACME: true, ACMEHosts: []string{"files.example.com"}, ACMECache: t.TempDir(), ServerRoot: t.TempDir(), TLSMinVersion: "1.2"}
+	m, err = newACMEManager(a)
+	NoError(t, err)
+	NoError(t, m.HostPolicy(context.Background(), "files.example.com"))
+	Error(t, m.HostPolicy(context.Background(), "evil.example.com"))
+
+	a.acme = m
+	cfg, err := newTLSConfig(a, nil)
+	NoError(t, err)
+	Contains(t, cfg.NextProtos, acme.ALPNProto)
+
+	_, err = newACMEManager(app{ACME: true})
+	Error(t, err)
+	_, err = newACMEManager(app{ACME: true, ACMEHosts: []string{"files.example.com"}, ServerRoot: a.ACMECache, ACMECache: a.ACMECache})
+	Error(t, err)
+	_, err = newACMEManager(app{ACME: true, ACMEHosts: []string{"files.example.com"}, TLSCerts: []string{"a.crt"}})
+	Error(t, err)
+}
+
+func Test_redirectHTTPS(t *testing.T) {
+	tests := []struct {
+		addr, host, target string
+	}{
+		{":443", "files.example.com", "https://files.example.com/a?b=c"},
+		{":443", "files.example.com:80", "https://files.example.com/a?b=c"},
+		{"0.0.0.0:8443", "files.example.com", "https://files.example.com:8443/a?b=c"},
+		{":443", "[::1]", "https://[::1]/a?b=c"},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/a?b=c", nil)
+		r.Host = tt.host
+		w := httptest.NewRecorder()
+		redirectHTTPS(tt.addr).ServeHTTP(w, r)
+		Equal(t, http.StatusMovedPermanently, w.Code)
+		Equal(t, tt.target, w.Header().Get("Location"))
+	}
+
+	w := httptest.NewRecorder()
+	redirectHTTPS(":443").ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/a", nil))
+	Equal(t, http.StatusBadRequest, w.Code)
+}
@@ -0,0 +1,65 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+// errMethodNotAllowed indicates that an API endpoint does not support the request method.
+var errMethodNotAllowed = errors.New("method not allowed")
+
+// adminPrefix is the path prefix of the admin API.
+const adminPrefix = apiPrefix + "admin/"
+
+// registerAdmin adds the admin API to the mux, if an admin token is configured.
+func registerAdmin(a app, mux *http.ServeMux) {
+	if a.AdminToken == "" {
+		return
+	}
+	if a.maint != nil {
+		mux.Handle(adminPrefix+"maintenance", requireAdmin(a.AdminToken, handleMaintenanceMode(a.maint)))
+	}
+	if a.history != nil {
+		mux.Handle(adminPrefix+"history", requireAdmin(a.AdminToken, handleHistory(a.history)))
+	}
+	if a.quarantine != nil {
+		mux.Handle(adminPrefix+"quarantine", requireAdmin(a.AdminToken, handleQuarantineList(a.quarantine)))
+		mux.Handle(adminPrefix+"quarantine/", requireAdmin(a.AdminToken, handleQuarantineReview(a)))
+	}
+}
+
+// requireAdmin permits requests, which carry the admin token in the Authorization header (bearer scheme).
+// Otherwise, "401 Unauthorized" is sent.
+func requireAdmin(token string, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth := r.Header.Get("Authorization")
+		if strings.HasPrefix(auth, "Bearer ") &&
+			subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(auth, "Bearer ")), []byte(token)) == 1 {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		log.Warn().Str("request-id", requestIDFrom(r.Context())).Str("client", clientIP(r)).
+			Str("path", r.URL.Path).Msg("Invalid admin token")
+		w.Header().Set("WWW-Authenticate", `Bearer realm="`+realm+`"`)
+		renderError(w, r, errAccessDenied, "admin token required", http.StatusUnauthorized)
+	})
+}
@@ -0,0 +1,54 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	. "github.com/stretchr/testify/require"
+)
+
+func Test_requireAdmin(t *testing.T) {
+	h := requireAdmin("secret", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	serve := func(auth string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/_janus/admin/maintenance", nil)
+		if auth != "" {
+			r.Header.Set("Authorization", auth)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	Equal(t, http.StatusOK, serve("Bearer secret").Code)
+	Equal(t, http.StatusUnauthorized, serve("Bearer wrong").Code)
+	Equal(t, http.StatusUnauthorized, serve("Basic c2VjcmV0").Code)
+	w := serve("")
+	Equal(t, http.StatusUnauthorized, w.Code)
+	Equal(t, `Bearer realm="janus"`, w.Header().Get("WWW-Authenticate"))
+}
+
+func Test_registerAdmin(t *testing.T) {
+	m, err := newMaintenance(false, "")
+	NoError(t, err)
+
+	h := handleAPI(app{maint: m}, http.NotFoundHandler())
+	HTTPStatusCode(t, h.ServeHTTP, http.MethodGet, "http://localhost/_janus/admin/maintenance", nil, http.StatusNotFound)
+
+	h = handleAPI(app{AdminToken: "secret", maint: m}, http.NotFoundHandler())
+	HTTPStatusCode(t, h.ServeHTTP, http.MethodGet, "http://localhost/_janus/admin/maintenance", nil, http.StatusUnauthorized)
+}
@@ -0,0 +1,85 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"expvar"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+// apiPrefix is the path (relative to the URL prefix), under which internal endpoints are served.
+const apiPrefix = "/_janus/"
+
+// handleAPI serves internal endpoints and delegates all other requests to h.
+func handleAPI(a app, h http.Handler) http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle(apiPrefix+"health", handleHealth(a))
+	if a.EnableMetrics {
+		mux.Handle(apiPrefix+"metrics", expvar.Handler())
+	}
+	a.saml.register(mux)
+	a.oidc.register(mux)
+	a.brand.register(mux)
+	registerAdmin(a, mux)
+	if a.accounts != nil {
+		mux.Handle(apiPrefix+"login", handleLogin(a))
+		mux.Handle(apiPrefix+"logout", handleLogout(a))
+	}
+	if a.signer != nil {
+		mux.Handle(apiPrefix+"signing-key", handleSigningKey(a.signer))
+	}
+	if a.shares != nil {
+		mux.Handle(apiPrefix+"share/", handleSharedFile(a))
+	}
+	if a.progress != nil {
+		mux.Handle(apiPrefix+"progress/", handleProgress(a))
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, apiPrefix) {
+			mux.ServeHTTP(w, r)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// health describes the state of the server.
+type health struct {
+	Status    string   `json:"status"`
+	Version   string   `json:"version"`
+	Addresses []string `json:"addresses"`
+}
+
+// handleHealth reports whether the server root is accessible along with version and listen addresses.
+func handleHealth(a app) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		h := health{Status: "ok", Version: version, Addresses: a.addrs}
+		w.Header().Set("Content-Type", "application/json")
+		if _, err := os.Stat(a.ServerRoot); err != nil {
+			log.Err(err).Msg("server root not accessible")
+			h.Status = "unavailable"
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		if err := json.NewEncoder(w).Encode(h); err != nil {
+			log.Err(err).Msg("cannot render message")
+		}
+	}
+}
@@ -0,0 +1,38 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	. "github.com/stretchr/testify/require"
+)
+
+func Test_handleAPI_Metrics(t *testing.T) {
+	h := handleAPI(app{EnableMetrics: true}, http.NotFoundHandler())
+	HTTPBodyContains(t, h.ServeHTTP, http.MethodGet, "http://localhost/_janus/metrics", nil, `"listing_cache"`)
+
+	h = handleAPI(app{}, http.NotFoundHandler())
+	HTTPStatusCode(t, h.ServeHTTP, http.MethodGet, "http://localhost/_janus/metrics", nil, http.StatusNotFound)
+}
+
+func Test_handleHealth(t *testing.T) {
+	h := handleAPI(app{ServerRoot: ".", addrs: []string{"127.0.0.1:1234"}}, http.NotFoundHandler())
+	HTTPBodyContains(t, h.ServeHTTP, http.MethodGet, "http://localhost/_janus/health", nil, `"addresses":["127.0.0.1:1234"]`)
+
+	h = handleAPI(app{ServerRoot: "/nonexistent"}, http.NotFoundHandler())
+	HTTPStatusCode(t, h.ServeHTTP, http.MethodGet, "http://localhost/_janus/health", nil, http.StatusServiceUnavailable)
+}
@@ -0,0 +1,188 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	errInvalidRange  = errors.New("invalid content range")
+	errRangeMismatch = errors.New("content range does not start at the end of the file")
+)
+
+// appendConflict returns the reason, why appending cannot be combined with the other options, or nil if it can.
+// It is shared by the startup and the check command, so that both accept the same configurations.
+func appendConflict(a app) error {
+	switch {
+	case !a.Append:
+		return nil
+	case !uploadEnabled(a):
+		return errors.New("appending requires enable-upload or roles")
+	case a.DropBox:
+		return errors.New("appending cannot be combined with drop box mode")
+	case a.CAS:
+		// appending to a link would change the blob shared by all paths with the same content
+		return errors.New("appending cannot be combined with content-addressable storage")
+	}
+	return nil
+}
+
+// parseContentRange parses a Content-Range header e.g., "bytes 100-199/*", and returns the first and the last byte.
+func parseContentRange(s string) (first, last int64, err error) {
+	rng, length, ok := strings.Cut(strings.TrimPrefix(s, "bytes "), "/")
+	f, l, ok2 := strings.Cut(rng, "-")
+	if !strings.HasPrefix(s, "bytes ") || !ok || !ok2 {
+		return 0, 0, fmt.Errorf("%w %q", errInvalidRange, s)
+	}
+	if first, err = strconv.ParseInt(f, 10, 64); err == nil {
+		last, err = strconv.ParseInt(l, 10, 64)
+	}
+	if err != nil || first < 0 || last < first {
+		return 0, 0, fmt.Errorf("%w %q", errInvalidRange, s)
+	}
+	if length != "*" {
+		if n, err := strconv.ParseInt(length, 10, 64); err != nil || n <= last {
+			return 0, 0, fmt.Errorf("%w %q", errInvalidRange, s)
+		}
+	}
+	return first, last, nil
+}
+
+// fileMutexes serializes writes to the same file, while writes to different files proceed concurrently.
+type fileMutexes struct {
+	mu    sync.Mutex
+	locks map[string]*fileMutex
+}
+
+// fileMutex is the mutex of a file along with the number of goroutines holding or waiting for it.
+type fileMutex struct {
+	sync.Mutex
+	refs int
+}
+
+// lock acquires the mutex of the named file and returns a function, which releases it.
+func (fm *fileMutexes) lock(name string) (unlock func()) {
+	fm.mu.Lock()
+	if fm.locks == nil {
+		fm.locks = map[string]*fileMutex{}
+	}
+	m := fm.locks[name]
+	if m == nil {
+		m = &fileMutex{}
+		fm.locks[name] = m
+	}
+	m.refs++
+	fm.mu.Unlock()
+
+	m.Lock()
+	return func() {
+		m.Unlock()
+		fm.mu.Lock()
+		if m.refs--; m.refs == 0 {
+			delete(fm.locks, name)
+		}
+		fm.mu.Unlock()
+	}
+}
+
+// handleAppend appends the request body to a file, which is created if it does not exist.
+// With a Content-Range header, the range must start at the end of the file, so that retried or reordered
+// requests do not corrupt it. Otherwise, "416 Range Not Satisfiable" is sent along with the current size.
+func handleAppend(a app, fm *fileMutexes) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := filepath.Join(rootDir(a, r), r.URL.Path)
+		first, last := int64(-1), int64(-1)
+		if cr := r.Header.Get("Content-Range"); cr != "" {
+			var err error
+			if first, last, err = parseContentRange(cr); err != nil {
+				renderError(w, r, err, "invalid content range", http.StatusBadRequest)
+				return
+			}
+		}
+
+		if strings.HasSuffix(r.URL.Path, "/") {
+			renderError(w, r, errNotAFile, "only files can be appended to", http.StatusBadRequest)
+			return
+		} else if a.EnableAccessFiles && filepath.Base(name) == accessFileName {
+			renderError(w, r, errAccessDenied, "access files cannot be uploaded", http.StatusForbidden)
+			return
+		} else if retained(name, a.Retention, time.Now()) {
+			audit(r, "append").Str("result", "denied").Msg("Append denied by retention")
+			renderError(w, r, errRetained, "file cannot be modified during its retention period", http.StatusForbidden)
+			return
+		}
+
+		defer fm.lock(name)()
+		f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0666)
+		if err != nil {
+			renderError(w, r, err, "cannot open file", http.StatusConflict)
+			return
+		}
+		defer f.Close()
+
+		fi, err := f.Stat()
+		if err != nil || !fi.Mode().IsRegular() {
+			renderError(w, r, errNotAFile, "only files can be appended to", http.StatusBadRequest)
+			return
+		}
+		size := fi.Size()
+		body := io.Reader(r.Body)
+		if first >= 0 {
+			if first != size {
+				w.Header().Set("Content-Range", "bytes */"+strconv.FormatInt(size, 10))
+				renderError(w, r, errRangeMismatch, "content range does not start at the end of the file", http.StatusRequestedRangeNotSatisfiable)
+				return
+			}
+			body = io.LimitReader(r.Body, last-first+1)
+		}
+
+		n, err := io.Copy(f, body)
+		if err == nil && first >= 0 && n != last-first+1 {
+			err = fmt.Errorf("%w: received %d bytes", errInvalidRange, n)
+		}
+		if err != nil {
+			// do not leave a partial write behind, so that the client can retry
+			_ = f.Truncate(size)
+			status := http.StatusInternalServerError
+			if errors.Is(err, errInvalidRange) {
+				status = http.StatusBadRequest
+			}
+			renderError(w, r, err, "cannot append to file", status)
+			return
+		} else if err = f.Close(); err != nil {
+			renderError(w, r, err, "cannot append to file", http.StatusInternalServerError)
+			return
+		}
+
+		if fi, err = os.Stat(name); err == nil {
+			w.Header().Set("ETag", fileETag(fi))
+		}
+		audit(r, "append").Int64("offset", size).Int64("size", n).Str("result", "ok").Msg("File appended")
+		if size == 0 {
+			a.sitemap.changed()
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,122 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/stretchr/testify/require"
+)
+
+func Test_parseContentRange(t *testing.T) {
+	first, last, err := parseContentRange("bytes 100-199/*")
+	NoError(t, err)
+	Equal(t, []int64{100, 199}, []int64{first, last})
+
+	first, last, err = parseContentRange("bytes 0-9/10")
+	NoError(t, err)
+	Equal(t, []int64{0, 9}, []int64{first, last})
+
+	for _, s := range []string{"100-199/*", "bytes 100/*", "bytes 100-199", "bytes 9-0/*", "bytes -1-5/*", "bytes 0-9/9", "bytes a-b/*"} {
+		_, _, err = parseContentRange(s)
+		ErrorIs(t, err, errInvalidRange, s)
+	}
+}
+
+func Test_appendConflict(t *testing.T) {
+	NoError(t, appendConflict(app{}))
+	NoError(t, appendConflict(app{Append: true, EnableUpload: true}))
+	EqualError(t, appendConflict(app{Append: true}), "appending requires enable-upload or roles")
+	EqualError(t, appendConflict(app{Append: true, DropBox: true}), "appending cannot be combined with drop box mode")
+	EqualError(t, appendConflict(app{Append: true, EnableUpload: true, CAS: true}),
+		"appending cannot be combined with content-addressable storage")
+}
+
+func Test_fileMutexes(t *testing.T) {
+	fm := &fileMutexes{}
+	n := 0
+	wg := sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer fm.lock("a")()
+			n++
+		}()
+	}
+	wg.Wait()
+	Equal(t, 10, n)
+	Empty(t, fm.locks)
+}
+
+func Test_handleAppend(t *testing.T) {
+	dir := t.TempDir()
+	h := handleRequest(app{ServerRoot: dir, EnableUpload: true, Append: true})
+	appendData := func(p, data, contentRange string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPatch, p, bytes.NewBufferString(data))
+		if contentRange != "" {
+			r.Header.Set("Content-Range", contentRange)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	w := appendData("/app.log", "one\n", "")
+	Equal(t, http.StatusNoContent, w.Code)
+	etag := w.Header().Get("ETag")
+	NotEmpty(t, etag)
+
+	w = appendData("/app.log", "two\n", "bytes 4-7/*")
+	Equal(t, http.StatusNoContent, w.Code)
+	NotEqual(t, etag, w.Header().Get("ETag"))
+
+	w = appendData("/app.log", "two\n", "bytes 4-7/*")
+	Equal(t, http.StatusRequestedRangeNotSatisfiable, w.Code)
+	Equal(t, "bytes */8", w.Header().Get("Content-Range"))
+	Equal(t, string(codeOffsetMismatch), w.Header().Get("X-Janus-Error"))
+
+	w = appendData("/app.log", "thr", "bytes 8-13/*")
+	Equal(t, http.StatusBadRequest, w.Code)
+	Equal(t, http.StatusBadRequest, appendData("/app.log", "x", "bytes x").Code)
+	Equal(t, http.StatusBadRequest, appendData("/", "x", "").Code)
+
+	data, err := os.ReadFile(filepath.Join(dir, "app.log"))
+	NoError(t, err)
+	Equal(t, "one\ntwo\n", string(data))
+
+	// appending is an upload, hence anonymous clients cannot append without enable-upload or roles
+	h = handleRequest(app{ServerRoot: dir, Append: true})
+	NotEqual(t, http.StatusNoContent, appendData("/other.log", "one\n", "").Code)
+	NoFileExists(t, filepath.Join(dir, "other.log"))
+	NotContains(t, routedMethods(app{Append: true}), http.MethodPatch)
+}
+
+func Test_handleAppend_Retained(t *testing.T) {
+	dir := t.TempDir()
+	NoError(t, os.WriteFile(filepath.Join(dir, "app.log"), []byte("one\n"), 0600))
+	h := handleRequest(app{ServerRoot: dir, EnableUpload: true, Append: true, Retention: time.Hour})
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodPatch, "/app.log", bytes.NewBufferString("two\n")))
+	Equal(t, http.StatusForbidden, w.Code)
+}
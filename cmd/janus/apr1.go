@@ -0,0 +1,112 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/md5" //nolint:gosec
+	"crypto/subtle"
+	"errors"
+	"strings"
+)
+
+// apr1Prefix marks password hashes created by "htpasswd -m" (the default of htpasswd on most platforms).
+const apr1Prefix = "$apr1$"
+
+// apr1Alphabet is the alphabet of the modified Base64 encoding used by crypt(3).
+const apr1Alphabet = "./0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// errInvalidAPR1 indicates that a password hash is not in the form "$apr1$<salt>$<hash>".
+var errInvalidAPR1 = errors.New("invalid APR1 hash")
+
+// parseAPR1 returns the salt of an APR1 hash.
+func parseAPR1(hash string) (string, error) {
+	salt, sum, ok := strings.Cut(strings.TrimPrefix(hash, apr1Prefix), "$")
+	if !strings.HasPrefix(hash, apr1Prefix) || !ok || len(salt) > 8 || len(sum) != 22 {
+		return "", errInvalidAPR1
+	}
+	return salt, nil
+}
+
+// compareAPR1 reports whether the password matches the APR1 hash.
+func compareAPR1(hash, pass string) bool {
+	salt, err := parseAPR1(hash)
+	if err != nil {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(apr1(pass, salt)), []byte(hash)) == 1
+}
+
+// apr1 hashes the password with the MD5-based algorithm of the Apache HTTP Server.
+// MD5 is broken, hence APR1 is only supported for compatibility with existing htpasswd files.
+func apr1(pass, salt string) string {
+	p, s := []byte(pass), []byte(salt)
+
+	alt := md5.Sum(append(append(append([]byte{}, p...), s...), p...)) //nolint:gosec
+	h := md5.New()                                                     //nolint:gosec
+	h.Write(p)
+	h.Write([]byte(apr1Prefix))
+	h.Write(s)
+	for n := len(p); n > 0; n -= 16 {
+		if n > 16 {
+			h.Write(alt[:])
+		} else {
+			h.Write(alt[:n])
+		}
+	}
+	for n := len(p); n > 0; n >>= 1 {
+		if n&1 == 1 {
+			h.Write([]byte{0})
+		} else {
+			h.Write(p[:1])
+		}
+	}
+	sum := h.Sum(nil)
+
+	// the iterations are meant to slow down brute-force attacks
+	for i := 0; i < 1000; i++ {
+		h.Reset()
+		if i&1 == 1 {
+			h.Write(p)
+		} else {
+			h.Write(sum)
+		}
+		if i%3 != 0 {
+			h.Write(s)
+		}
+		if i%7 != 0 {
+			h.Write(p)
+		}
+		if i&1 == 1 {
+			h.Write(sum)
+		} else {
+			h.Write(p)
+		}
+		sum = h.Sum(sum[:0])
+	}
+
+	b := strings.Builder{}
+	b.WriteString(apr1Prefix + salt + "$")
+	encode := func(v uint32, n int) {
+		for ; n > 0; n-- {
+			b.WriteByte(apr1Alphabet[v&0x3f])
+			v >>= 6
+		}
+	}
+	for _, i := range [][3]int{{0, 6, 12}, {1, 7, 13}, {2, 8, 14}, {3, 9, 15}, {4, 10, 5}} {
+		encode(uint32(sum[i[0]])<<16|uint32(sum[i[1]])<<8|uint32(sum[i[2]]), 4)
+	}
+	encode(uint32(sum[11]), 2)
+	return b.String()
+}
@@ -0,0 +1,48 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/stretchr/testify/require"
+)
+
+func Test_apr1(t *testing.T) {
+	// generated by "openssl passwd -apr1 -salt <salt> <password>"
+	Equal(t, "$apr1$r31....$gnsoqlxyxQQ0Ot5JCwiei.", apr1("secret", "r31...."))
+	Equal(t, "$apr1$abcdefgh$Grzjm4pQ3kEu84RHincrN.", apr1("a much longer password with more than 16 bytes", "abcdefgh"))
+	Equal(t, "$apr1$x$tMwYqBfQwi3FYAr0aJc8M/", apr1("", "x"))
+
+	True(t, compareAPR1("$apr1$r31....$gnsoqlxyxQQ0Ot5JCwiei.", "secret"))
+	False(t, compareAPR1("$apr1$r31....$gnsoqlxyxQQ0Ot5JCwiei.", "Secret"))
+	False(t, compareAPR1("$apr1$r31....", "secret"))
+}
+
+func Test_accounts_authenticate_APR1(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "users")
+	NoError(t, os.WriteFile(name, []byte("alice:$apr1$r31....$gnsoqlxyxQQ0Ot5JCwiei.\n"), 0600))
+	as, err := loadAccounts(name, "")
+	NoError(t, err)
+	True(t, as.authenticate("alice", "secret", time.Now()))
+	False(t, as.authenticate("alice", "alice", time.Now()))
+
+	NoError(t, os.WriteFile(name, []byte("alice:$apr1$r31....$short\n"), 0600))
+	_, err = loadAccounts(name, "")
+	ErrorIs(t, err, errInvalidAPR1)
+}
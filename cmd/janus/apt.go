@@ -0,0 +1,318 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/rs/zerolog/log"
+	"github.com/ulikunitz/xz"
+)
+
+// errNoControl indicates that a Debian package does not contain a control file.
+var errNoControl = errors.New("control file not found")
+
+// aptRepo generates the metadata of flat APT repositories i.e., directories containing .deb files.
+type aptRepo struct {
+	mu      sync.Mutex
+	signer  signer
+	indexes map[string]*aptIndex
+}
+
+// aptIndex holds the generated metadata files of a directory.
+type aptIndex struct {
+	// stamp identifies the .deb files, from which the index was generated.
+	stamp   string
+	modTime time.Time
+	files   map[string][]byte
+}
+
+// newAPTRepo creates the generator of APT repository metadata.
+// If s is not nil, the Release file is signed.
+func newAPTRepo(s signer) *aptRepo {
+	return &aptRepo{signer: s, indexes: map[string]*aptIndex{}}
+}
+
+// serveAPT serves the generated Packages and Release files of directories containing .deb files.
+// Metadata files, which exist in the directory, take precedence.
+// If APT mode is disabled, h is returned as is.
+func serveAPT(a app, h http.Handler) http.Handler {
+	if a.apt == nil {
+		return h
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := path.Base(r.URL.Path)
+		p := filepath.Join(rootDir(a, r), filepath.FromSlash(r.URL.Path))
+		if (r.Method != http.MethodGet && r.Method != http.MethodHead) || !isAPTFile(name) || exists(p) {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		release, ok := a.pools.acquire(w, r, poolMetadata)
+		if !ok {
+			return
+		}
+		idx, err := a.apt.index(filepath.Dir(p))
+		release()
+		if err != nil {
+			renderError(w, r, err, "cannot generate APT metadata", http.StatusInternalServerError)
+			return
+		}
+		b, ok := idx.files[name]
+		if idx.stamp == "" || !ok {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("Content-Type", aptContentType(name))
+		http.ServeContent(w, r, "", idx.modTime, bytes.NewReader(b))
+	})
+}
+
+// isAPTFile reports whether the file name denotes metadata of a flat APT repository.
+func isAPTFile(name string) bool {
+	switch name {
+	case "Packages", "Packages.gz", "Release", "InRelease", "Release.gpg":
+		return true
+	}
+	return false
+}
+
+// aptContentType returns the media type of an APT metadata file.
+func aptContentType(name string) string {
+	switch name {
+	case "Packages.gz":
+		return "application/gzip"
+	case "Release.gpg":
+		return "application/pgp-signature"
+	default:
+		return "text/plain; charset=utf-8"
+	}
+}
+
+// index returns the metadata of the directory, which is regenerated whenever a .deb file changes.
+func (ar *aptRepo) index(dir string) (*aptIndex, error) {
+	es, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var debs []os.FileInfo
+	stamp := &strings.Builder{}
+	for _, e := range es {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".deb") {
+			continue
+		}
+		fi, err := e.Info()
+		if err != nil {
+			return nil, err
+		}
+		debs = append(debs, fi)
+		_, _ = fmt.Fprintf(stamp, "%s:%d:%d\n", fi.Name(), fi.Size(), fi.ModTime().UnixNano())
+	}
+
+	ar.mu.Lock()
+	defer ar.mu.Unlock()
+	if idx, ok := ar.indexes[dir]; ok && idx.stamp == stamp.String() {
+		return idx, nil
+	}
+
+	idx := &aptIndex{stamp: stamp.String(), files: map[string][]byte{}}
+	if len(debs) == 0 {
+		delete(ar.indexes, dir)
+		return idx, nil
+	}
+	pkgs := &bytes.Buffer{}
+	for _, fi := range debs {
+		entry, err := packagesEntry(filepath.Join(dir, fi.Name()))
+		if err != nil {
+			log.Warn().Str("file", filepath.Join(dir, fi.Name())).Err(err).Msg("Skipping invalid Debian package")
+			continue
+		}
+		pkgs.WriteString(entry + "\n")
+		if fi.ModTime().After(idx.modTime) {
+			idx.modTime = fi.ModTime()
+		}
+	}
+	idx.files["Packages"] = pkgs.Bytes()
+
+	gz := &bytes.Buffer{}
+	zw := gzip.NewWriter(gz)
+	_, _ = zw.Write(pkgs.Bytes())
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	idx.files["Packages.gz"] = gz.Bytes()
+	idx.files["Release"] = release(idx.files, idx.modTime)
+
+	if ar.signer != nil {
+		if err := ar.sign(idx.files); err != nil {
+			return nil, err
+		}
+	}
+	ar.indexes[dir] = idx
+	return idx, nil
+}
+
+// sign creates the clear-signed InRelease and the detached Release.gpg signature of the Release file.
+func (ar *aptRepo) sign(files map[string][]byte) error {
+	in, sig := &bytes.Buffer{}, &bytes.Buffer{}
+	if err := ar.signer.clearSign(in, files["Release"]); err != nil {
+		return err
+	} else if err := ar.signer.detachSign(sig, files["Release"]); err != nil {
+		return err
+	}
+	files["InRelease"], files["Release.gpg"] = in.Bytes(), sig.Bytes()
+	return nil
+}
+
+// release generates the Release file listing the checksums of the Packages files.
+func release(files map[string][]byte, date time.Time) []byte {
+	b := &bytes.Buffer{}
+	_, _ = fmt.Fprintf(b, "Date: %s\n", date.UTC().Format(time.RFC1123))
+	for _, alg := range []struct {
+		name string
+		new  func() hash.Hash
+	}{{"MD5Sum", md5.New}, {"SHA1", sha1.New}, {"SHA256", sha256.New}} {
+		_, _ = fmt.Fprintf(b, "%s:\n", alg.name)
+		for _, name := range []string{"Packages", "Packages.gz"} {
+			h := alg.new()
+			_, _ = h.Write(files[name])
+			_, _ = fmt.Fprintf(b, " %x %d %s\n", h.Sum(nil), len(files[name]), name)
+		}
+	}
+	return b.Bytes()
+}
+
+// packagesEntry generates the paragraph of a Debian package in the Packages file.
+// It consists of the control file of the package and its file name, size and checksums.
+func packagesEntry(name string) (string, error) {
+	f, err := os.Open(filepath.Clean(name))
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	md5h, sha1h, sha256h := md5.New(), sha1.New(), sha256.New()
+	size, err := io.Copy(io.MultiWriter(md5h, sha1h, sha256h), f)
+	if err != nil {
+		return "", err
+	} else if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+
+	control, err := debControl(f)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s\nFilename: ./%s\nSize: %d\nMD5sum: %s\nSHA1: %s\nSHA256: %s\n",
+		strings.TrimRight(control, "\n"), filepath.Base(name), size,
+		hex.EncodeToString(md5h.Sum(nil)), hex.EncodeToString(sha1h.Sum(nil)), hex.EncodeToString(sha256h.Sum(nil))), nil
+}
+
+// debControl extracts the control file from a Debian package, which is an ar archive
+// containing a (possibly compressed) tar archive named "control.tar".
+func debControl(r io.Reader) (string, error) {
+	br := bufio.NewReader(r)
+	magic := make([]byte, 8)
+	if _, err := io.ReadFull(br, magic); err != nil || string(magic) != "!<arch>\n" {
+		return "", errors.New("not a Debian package")
+	}
+
+	hdr := make([]byte, 60)
+	for {
+		if _, err := io.ReadFull(br, hdr); errors.Is(err, io.EOF) {
+			return "", errNoControl
+		} else if err != nil {
+			return "", err
+		}
+		name := strings.TrimRight(strings.TrimSpace(string(hdr[:16])), "/")
+		size, err := strconv.ParseInt(strings.TrimSpace(string(hdr[48:58])), 10, 64)
+		if err != nil {
+			return "", fmt.Errorf("invalid size of %s", name)
+		}
+
+		if strings.HasPrefix(name, "control.tar") {
+			return controlFromTar(name, io.LimitReader(br, size))
+		}
+		// members are aligned to even offsets
+		if _, err := br.Discard(int(size + size%2)); err != nil {
+			return "", err
+		}
+	}
+}
+
+// controlFromTar extracts the control file from the control archive, decompressing it according to its name.
+func controlFromTar(name string, r io.Reader) (string, error) {
+	switch path.Ext(name) {
+	case ".tar":
+	case ".gz":
+		zr, err := gzip.NewReader(r)
+		if err != nil {
+			return "", err
+		}
+		defer zr.Close()
+		r = zr
+	case ".xz":
+		xr, err := xz.NewReader(r)
+		if err != nil {
+			return "", err
+		}
+		r = xr
+	case ".zst":
+		zr, err := zstd.NewReader(r)
+		if err != nil {
+			return "", err
+		}
+		defer zr.Close()
+		r = zr
+	default:
+		return "", fmt.Errorf("unsupported compression of %s", name)
+	}
+
+	tr := tar.NewReader(r)
+	for {
+		th, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return "", errNoControl
+		} else if err != nil {
+			return "", err
+		}
+		if path.Clean(th.Name) == "control" {
+			b, err := io.ReadAll(io.LimitReader(tr, 1<<20))
+			return string(b), err
+		}
+	}
+}
@@ -0,0 +1,177 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	. "github.com/stretchr/testify/require"
+	"github.com/ulikunitz/xz"
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/clearsign"
+)
+
+// writeDeb creates a Debian package with the given control file and control.tar compression.
+func writeDeb(t *testing.T, name, control, ext string) {
+	t.Helper()
+	ctl := &bytes.Buffer{}
+	tw := tar.NewWriter(ctl)
+	NoError(t, tw.WriteHeader(&tar.Header{Name: "./", Typeflag: tar.TypeDir, Mode: 0755}))
+	NoError(t, tw.WriteHeader(&tar.Header{Name: "./control", Mode: 0644, Size: int64(len(control))}))
+	_, err := tw.Write([]byte(control))
+	NoError(t, err)
+	NoError(t, tw.Close())
+
+	compressed := &bytes.Buffer{}
+	switch ext {
+	case ".gz":
+		zw := gzip.NewWriter(compressed)
+		_, _ = zw.Write(ctl.Bytes())
+		NoError(t, zw.Close())
+	case ".xz":
+		xw, err := xz.NewWriter(compressed)
+		NoError(t, err)
+		_, _ = xw.Write(ctl.Bytes())
+		NoError(t, xw.Close())
+	default:
+		compressed = ctl
+	}
+
+	b := &bytes.Buffer{}
+	b.WriteString("!<arch>\n")
+	for _, m := range []struct {
+		name string
+		data []byte
+	}{{"debian-binary", []byte("2.0\n")}, {"control.tar" + ext, compressed.Bytes()}, {"data.tar", []byte("x")}} {
+		_, _ = fmt.Fprintf(b, "%-16s%-12d%-6d%-6d%-8s%-10d`\n", m.name, 0, 0, 0, "100644", len(m.data))
+		b.Write(m.data)
+		if len(m.data)%2 == 1 {
+			b.WriteByte('\n')
+		}
+	}
+	NoError(t, os.WriteFile(name, b.Bytes(), 0600))
+}
+
+func Test_debControl(t *testing.T) {
+	d := t.TempDir()
+	for _, ext := range []string{"", ".gz", ".xz"} {
+		name := filepath.Join(d, "p"+ext+".deb")
+		writeDeb(t, name, "Package: p\nVersion: 1\n", ext)
+		f, err := os.Open(name)
+		NoError(t, err)
+		c, err := debControl(f)
+		NoError(t, f.Close())
+		NoError(t, err, ext)
+		Equal(t, "Package: p\nVersion: 1\n", c)
+	}
+
+	_, err := debControl(strings.NewReader("not an archive"))
+	Error(t, err)
+	_, err = debControl(strings.NewReader("!<arch>\n"))
+	ErrorIs(t, err, errNoControl)
+}
+
+func Test_packagesEntry(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "p_1_all.deb")
+	writeDeb(t, name, "Package: p\nVersion: 1\nDescription: test\n more\n", ".gz")
+
+	e, err := packagesEntry(name)
+	NoError(t, err)
+	True(t, strings.HasPrefix(e, "Package: p\nVersion: 1\nDescription: test\n more\nFilename: ./p_1_all.deb\nSize: "))
+	Regexp(t, "\nSHA256: [0-9a-f]{64}\n$", e)
+}
+
+func Test_aptRepo_index(t *testing.T) {
+	d := t.TempDir()
+	ar := newAPTRepo(nil)
+
+	idx, err := ar.index(d)
+	NoError(t, err)
+	Empty(t, idx.stamp)
+
+	writeDeb(t, filepath.Join(d, "a_1_all.deb"), "Package: a\n", "")
+	NoError(t, os.WriteFile(filepath.Join(d, "broken.deb"), []byte("broken"), 0600))
+	idx, err = ar.index(d)
+	NoError(t, err)
+	Contains(t, string(idx.files["Packages"]), "Package: a\nFilename: ./a_1_all.deb\n")
+	NotContains(t, string(idx.files["Packages"]), "broken")
+	Contains(t, string(idx.files["Release"]), " Packages.gz\n")
+	NotContains(t, idx.files, "InRelease")
+
+	cached, err := ar.index(d)
+	NoError(t, err)
+	Same(t, idx, cached)
+
+	writeDeb(t, filepath.Join(d, "b_1_all.deb"), "Package: b\n", "")
+	idx, err = ar.index(d)
+	NoError(t, err)
+	Contains(t, string(idx.files["Packages"]), "Package: b\n")
+}
+
+func Test_aptRepo_index_Signed(t *testing.T) {
+	keyFile, e := writeSigningKey(t)
+	ks, err := newKeySigner(keyFile)
+	NoError(t, err)
+	ar := newAPTRepo(ks)
+
+	d := t.TempDir()
+	writeDeb(t, filepath.Join(d, "a_1_all.deb"), "Package: a\n", ".gz")
+	idx, err := ar.index(d)
+	NoError(t, err)
+
+	b, _ := clearsign.Decode(idx.files["InRelease"])
+	NotNil(t, b)
+	Equal(t, idx.files["Release"], b.Plaintext)
+	_, err = openpgp.CheckDetachedSignature(openpgp.EntityList{e}, bytes.NewReader(b.Bytes), b.ArmoredSignature.Body)
+	NoError(t, err)
+	_, err = openpgp.CheckArmoredDetachedSignature(openpgp.EntityList{e}, bytes.NewReader(idx.files["Release"]), bytes.NewReader(idx.files["Release.gpg"]))
+	NoError(t, err)
+}
+
+func Test_serveAPT(t *testing.T) {
+	d := t.TempDir()
+	NoError(t, os.Mkdir(filepath.Join(d, "debs"), 0700))
+	writeDeb(t, filepath.Join(d, "debs", "a_1_all.deb"), "Package: a\n", ".gz")
+	ar := newAPTRepo(nil)
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusTeapot) })
+	h := serveAPT(app{ServerRoot: d, apt: ar}, next)
+	serve := func(p string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, p, nil))
+		return w
+	}
+
+	w := serve("/debs/Packages")
+	Equal(t, http.StatusOK, w.Code)
+	Contains(t, w.Body.String(), "Package: a\n")
+	Equal(t, "application/gzip", serve("/debs/Packages.gz").Header().Get("Content-Type"))
+	Equal(t, http.StatusOK, serve("/debs/Release").Code)
+	Equal(t, http.StatusTeapot, serve("/debs/InRelease").Code)
+	Equal(t, http.StatusTeapot, serve("/Packages").Code)
+	Equal(t, http.StatusTeapot, serve("/debs/a_1_all.deb").Code)
+
+	NoError(t, os.WriteFile(filepath.Join(d, "debs", "Release"), []byte("custom"), 0600))
+	Equal(t, http.StatusTeapot, serve("/debs/Release").Code)
+}
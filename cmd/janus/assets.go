@@ -0,0 +1,155 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// assetManifest is the name of the file, which maps the original names of assets in a directory to their hashed names.
+const assetManifest = "manifest.json"
+
+// assetHashLen is the number of hex digits of the content hash inserted into the names of assets.
+const assetHashLen = 12
+
+// hashedNameRegex matches file names containing a content hash e.g., "app.3f2a9c1b4d5e.js".
+var hashedNameRegex = regexp.MustCompile(`\.[0-9a-f]{12}(\.[^.]+)?$`)
+
+// assets publishes uploads below the configured paths as hashed assets.
+type assets struct {
+	patterns []string
+	mu       sync.Mutex
+}
+
+// newAssets returns the asset publisher for the given path patterns, or nil if there are none.
+func newAssets(patterns []string) *assets {
+	if len(patterns) == 0 {
+		return nil
+	}
+	return &assets{patterns: patterns}
+}
+
+// applies reports whether uploads to the directory p are published as hashed assets.
+func (as *assets) applies(p string) bool {
+	return as != nil && matchPath(as.patterns, p)
+}
+
+// immutable reports whether p refers to a hashed asset, which can be cached forever.
+func (as *assets) immutable(p string) bool {
+	return as.applies(p) && hashedNameRegex.MatchString(path.Base(p))
+}
+
+// hashedName inserts the content hash into a file name before its extension e.g., "app.js" becomes "app.<hash>.js".
+func hashedName(name, digest string) string {
+	ext := filepath.Ext(name)
+	return strings.TrimSuffix(name, ext) + "." + digest[:assetHashLen] + ext
+}
+
+// publish writes the content to a file named after its hash in dir and records it in the manifest of dir.
+// Previously published versions are kept, so that pages referring to them keep working.
+func (as *assets) publish(a app, root, dir, name string, src io.Reader) (string, error) {
+	var digest string
+	var err error
+	if a.CAS {
+		if digest, err = storeBlob(root, src); err == nil {
+			err = linkBlob(root, digest, filepath.Join(dir, hashedName(name, digest)))
+		}
+	} else {
+		digest, err = writeHashed(dir, name, src)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	hashed := hashedName(name, digest)
+	return hashed, as.record(dir, name, hashed)
+}
+
+// writeHashed writes the content to a temporary file in dir and renames it after its SHA-256 digest.
+func writeHashed(dir, name string, src io.Reader) (string, error) {
+	f, err := os.CreateTemp(dir, ".janus-asset-*")
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = os.Remove(f.Name()) }()
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(f, h), src); err != nil {
+		return "", err
+	} else if err := f.Close(); err != nil {
+		return "", err
+	}
+	digest := hex.EncodeToString(h.Sum(nil))
+	return digest, os.Rename(f.Name(), filepath.Join(dir, hashedName(name, digest)))
+}
+
+// record maps the original name to the hashed name in the manifest of dir, which is replaced atomically.
+func (as *assets) record(dir, name, hashed string) error {
+	as.mu.Lock()
+	defer as.mu.Unlock()
+
+	m := map[string]string{}
+	if data, err := os.ReadFile(filepath.Join(dir, assetManifest)); err == nil {
+		if err := json.Unmarshal(data, &m); err != nil {
+			return err
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	m[name] = hashed
+
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(dir, ".janus-asset-*")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.Remove(f.Name()) }()
+	defer f.Close()
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		return err
+	} else if err := f.Chmod(0644); err != nil {
+		return err
+	} else if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), filepath.Join(dir, assetManifest))
+}
+
+// cacheAsset allows clients and proxies to cache hashed assets forever, since their content never changes.
+func cacheAsset(a app, w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead || !a.assets.immutable(r.URL.Path) {
+		return
+	}
+	if fi, err := os.Stat(filepath.Join(rootDir(a, r), r.URL.Path)); err != nil || !fi.Mode().IsRegular() {
+		return
+	}
+	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	w.Header().Del("Pragma")
+	w.Header().Del("Expires")
+}
@@ -0,0 +1,82 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/stretchr/testify/require"
+)
+
+func Test_hashedName(t *testing.T) {
+	digest := "3f2a9c1b4d5e6f708192a3b4c5d6e7f8091a2b3c4d5e6f708192a3b4c5d6e7f8"
+	Equal(t, "app.3f2a9c1b4d5e.js", hashedName("app.js", digest))
+	Equal(t, "app.min.3f2a9c1b4d5e.css", hashedName("app.min.css", digest))
+	Equal(t, "LICENSE.3f2a9c1b4d5e", hashedName("LICENSE", digest))
+}
+
+func Test_assets_immutable(t *testing.T) {
+	as := newAssets([]string{"/static/"})
+	True(t, as.immutable("/static/app.3f2a9c1b4d5e.js"))
+	True(t, as.immutable("/static/img/LICENSE.3f2a9c1b4d5e"))
+	False(t, as.immutable("/static/app.js"))
+	False(t, as.immutable("/static/manifest.json"))
+	False(t, as.immutable("/other/app.3f2a9c1b4d5e.js"))
+	False(t, (*assets)(nil).immutable("/static/app.3f2a9c1b4d5e.js"))
+}
+
+func Test_handleFileUpload_Assets(t *testing.T) {
+	for _, cas := range []bool{false, true} {
+		dir := t.TempDir()
+		NoError(t, os.Mkdir(filepath.Join(dir, "static"), 0700))
+		a := app{ServerRoot: dir, EnableUpload: true, CAS: cas, assets: newAssets([]string{"/static/"})}
+		h := handleRequest(a)
+		upload := func(name, data string) int {
+			r := httptest.NewRequest(http.MethodPost, "/static/", bytes.NewBufferString(
+				"--xxx\r\nContent-Disposition: form-data; name=\"file\"; filename=\""+name+"\"\r\n\r\n"+data+"\r\n--xxx--\r\n"))
+			r.Header.Set("Content-Type", "multipart/form-data; boundary=xxx")
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			return w.Code
+		}
+		Equal(t, http.StatusOK, upload("app.js", "v1"))
+		Equal(t, http.StatusOK, upload("app.js", "v2"))
+		Equal(t, http.StatusOK, upload("app.css", "v1"))
+		NoFileExists(t, filepath.Join(dir, "static", "app.js"))
+
+		data, err := os.ReadFile(filepath.Join(dir, "static", assetManifest))
+		NoError(t, err)
+		m := map[string]string{}
+		NoError(t, json.Unmarshal(data, &m))
+		Equal(t, map[string]string{"app.js": "app.fb04dcb6970e.js", "app.css": "app.3bfc269594ef.css"}, m)
+		FileExists(t, filepath.Join(dir, "static", "app.3bfc269594ef.js"), "previous version must be kept")
+
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/static/"+m["app.js"], nil))
+		Equal(t, http.StatusOK, w.Code)
+		Equal(t, "v2", w.Body.String())
+		Equal(t, "public, max-age=31536000, immutable", w.Header().Get("Cache-Control"))
+
+		w = httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/static/"+assetManifest, nil))
+		Equal(t, "no-cache, no-store, must-revalidate", w.Header().Get("Cache-Control"))
+	}
+}
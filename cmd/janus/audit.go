@@ -0,0 +1,53 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// auditLog records file modifications and denied attempts.
+var auditLog = log.Logger
+
+// openAuditLog directs audit events to the named file in JSON format.
+// If name is empty, audit events are written to the regular log.
+func openAuditLog(name string) error {
+	if name == "" {
+		auditLog = log.Logger.With().Bool("audit", true).Logger()
+		return nil
+	}
+
+	f, err := os.OpenFile(filepath.Clean(name), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	auditLog = zerolog.New(f).With().Timestamp().Logger()
+	return nil
+}
+
+// audit starts an audit event for an action performed by the client.
+func audit(r *http.Request, action string) *zerolog.Event {
+	name := ""
+	if id := identityFrom(r.Context()); id != nil {
+		name = id.name
+	}
+	return auditLog.Info().Str("request-id", requestIDFrom(r.Context())).Str("action", action).
+		Str("user", name).Str("client", clientIP(r)).Str("path", r.URL.Path)
+}
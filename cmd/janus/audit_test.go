@@ -0,0 +1,44 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/stretchr/testify/require"
+)
+
+func Test_audit(t *testing.T) {
+	orig := auditLog
+	t.Cleanup(func() { auditLog = orig })
+
+	name := filepath.Join(t.TempDir(), "audit.log")
+	NoError(t, openAuditLog(name))
+	r := withIdentity(httptest.NewRequest(http.MethodDelete, "/a.txt", nil), &identity{name: "alice"})
+	audit(r, "delete").Str("result", "denied").Msg("Deletion denied by retention")
+
+	b, err := os.ReadFile(name)
+	NoError(t, err)
+	Contains(t, string(b), `"action":"delete"`)
+	Contains(t, string(b), `"user":"alice"`)
+	Contains(t, string(b), `"path":"/a.txt"`)
+	Contains(t, string(b), `"result":"denied"`)
+
+	Error(t, openAuditLog(filepath.Join(name, "invalid")))
+}
@@ -0,0 +1,312 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// errChangedDuringBackup indicates that a file was modified while it was archived.
+var errChangedDuringBackup = errors.New("file changed during backup (consider --pause)")
+
+// backupOptions holds the options of the backup command.
+type backupOptions struct {
+	Pause string `long:"pause" description:"URL of the running instance including the prefix e.g., \"http://localhost:8080\", which is kept in maintenance mode during the backup (requires admin-token)"`
+	Args  struct {
+		Dest string `positional-arg-name:"dest" description:"archive (tar.gz) to write, or \"-\" for stdout"`
+	} `positional-args:"true" required:"true"`
+}
+
+// backupFiles names the options, whose files are archived along with the server root.
+// Private keys are deliberately left out.
+var backupFiles = []string{"config", "users-file", "groups-file", "tenants-file", "maintenance-page", "brand-logo", "brand-css"}
+
+// backupStats summarizes an archive.
+type backupStats struct {
+	files int
+	bytes int64
+}
+
+// runBackup writes a snapshot of the server root and the metadata of janus to the destination,
+// and returns the exit code.
+func runBackup(a app, stdout, stderr io.Writer) int {
+	o := a.backup
+	if o.Pause != "" {
+		resume, err := pause(o.Pause, a.AdminToken)
+		if err != nil {
+			_, _ = fmt.Fprintln(stderr, "cannot enable maintenance mode:", err)
+			return 1
+		}
+		defer func() {
+			if err := resume(); err != nil {
+				_, _ = fmt.Fprintln(stderr, "cannot restore maintenance mode:", err)
+			}
+		}()
+	}
+
+	var st backupStats
+	var err error
+	if o.Args.Dest == "-" {
+		st, err = backup(a, stdout)
+	} else {
+		st, err = backupFile(a, o.Args.Dest)
+	}
+	if err != nil {
+		_, _ = fmt.Fprintln(stderr, err)
+		return 1
+	}
+	_, _ = fmt.Fprintf(stderr, "Backed up %d files (%d bytes) to %s\n", st.files, st.bytes, o.Args.Dest)
+	return 0
+}
+
+// backupFile writes the archive to a temporary file, which replaces the named file once it is complete.
+func backupFile(a app, name string) (backupStats, error) {
+	f, err := os.CreateTemp(filepath.Dir(name), ".janus-backup-*")
+	if err != nil {
+		return backupStats{}, err
+	}
+	defer func() { _ = os.Remove(f.Name()) }()
+	defer f.Close()
+
+	st, err := backup(a, f, f.Name(), name)
+	if err != nil {
+		return st, err
+	} else if err := f.Close(); err != nil {
+		return st, err
+	}
+	return st, os.Rename(f.Name(), name)
+}
+
+// backup writes a gzip compressed tar archive containing the server root below "root/",
+// as well as the configuration and the files referenced by it below "janus/".
+// The named files (the archive itself) are skipped, if they are located in the server root.
+func backup(a app, w io.Writer, skip ...string) (backupStats, error) {
+	zw := gzip.NewWriter(w)
+	tw := tar.NewWriter(zw)
+	st, err := archiveTree(tw, a.ServerRoot, "root", skip)
+	if err != nil {
+		return st, err
+	}
+
+	cfg := &bytes.Buffer{}
+	if err := showConfig(a, cfg); err != nil {
+		return st, err
+	} else if err := addBytes(tw, "janus/config.txt", cfg.Bytes()); err != nil {
+		return st, err
+	}
+	p := newParser(&a)
+	for _, opt := range backupFiles {
+		name, _ := p.FindOptionByLongName(opt).Value().(string)
+		if name == "" {
+			continue
+		}
+		fi, err := os.Stat(name)
+		if err != nil {
+			return st, fmt.Errorf("%s: %w", opt, err)
+		} else if err := addFile(tw, "janus/"+opt+"/"+filepath.Base(name), name, fi); err != nil {
+			return st, err
+		}
+		st.files++
+		st.bytes += fi.Size()
+	}
+
+	if err := tw.Close(); err != nil {
+		return st, err
+	}
+	return st, zw.Close()
+}
+
+// archiveTree adds the directory tree to the archive below the given prefix.
+// Hard links (e.g., created by the content-addressable storage) are archived as links.
+func archiveTree(tw *tar.Writer, root, prefix string, skip []string) (backupStats, error) {
+	var st backupStats
+	seen := map[int64][]linkTarget{}
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		name := prefix
+		if rel != "." {
+			name += "/" + filepath.ToSlash(rel)
+		}
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+		for _, s := range skip {
+			if sameFile(s, fi) {
+				return nil
+			}
+		}
+
+		switch {
+		case d.IsDir():
+			return addHeader(tw, name+"/", fi, "")
+		case d.Type()&fs.ModeSymlink != 0:
+			target, err := os.Readlink(p)
+			if err != nil {
+				return err
+			}
+			return addHeader(tw, name, fi, target)
+		case !d.Type().IsRegular():
+			return nil
+		}
+
+		for _, t := range seen[fi.Size()] {
+			if os.SameFile(t.fi, fi) {
+				hdr, err := tar.FileInfoHeader(fi, "")
+				if err != nil {
+					return err
+				}
+				hdr.Name, hdr.Typeflag, hdr.Linkname, hdr.Size = name, tar.TypeLink, t.name, 0
+				return tw.WriteHeader(hdr)
+			}
+		}
+		seen[fi.Size()] = append(seen[fi.Size()], linkTarget{name, fi})
+		st.files++
+		st.bytes += fi.Size()
+		return addFile(tw, name, p, fi)
+	})
+	return st, err
+}
+
+// linkTarget is an archived file, which later hard links refer to.
+type linkTarget struct {
+	name string
+	fi   os.FileInfo
+}
+
+// sameFile reports whether the named file and fi describe the same file.
+func sameFile(name string, fi os.FileInfo) bool {
+	sfi, err := os.Stat(name)
+	return err == nil && os.SameFile(sfi, fi)
+}
+
+// addHeader adds a directory or a symbolic link to the archive.
+func addHeader(tw *tar.Writer, name string, fi os.FileInfo, link string) error {
+	hdr, err := tar.FileInfoHeader(fi, link)
+	if err != nil {
+		return err
+	}
+	hdr.Name = name
+	return tw.WriteHeader(hdr)
+}
+
+// addFile adds the content of a regular file to the archive.
+// It fails, if the file is modified while it is read.
+func addFile(tw *tar.Writer, name, p string, fi os.FileInfo) error {
+	f, err := os.Open(p)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	hdr, err := tar.FileInfoHeader(fi, "")
+	if err != nil {
+		return err
+	}
+	hdr.Name = name
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	} else if _, err := io.CopyN(tw, f, fi.Size()); errors.Is(err, io.EOF) {
+		return fmt.Errorf("%s: %w", p, errChangedDuringBackup)
+	} else if err != nil {
+		return err
+	}
+
+	after, err := f.Stat()
+	if err != nil {
+		return err
+	} else if after.Size() != fi.Size() || !after.ModTime().Equal(fi.ModTime()) {
+		return fmt.Errorf("%s: %w", p, errChangedDuringBackup)
+	}
+	return nil
+}
+
+// addBytes adds a generated file to the archive.
+func addBytes(tw *tar.Writer, name string, b []byte) error {
+	if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0600, Size: int64(len(b)), ModTime: time.Now()}); err != nil {
+		return err
+	}
+	_, err := tw.Write(b)
+	return err
+}
+
+// pause enables the maintenance mode of the instance at the given URL via the admin API.
+// The returned function restores the previous state.
+func pause(base, token string) (func() error, error) {
+	u := strings.TrimRight(base, "/") + adminPrefix + "maintenance"
+	was, err := setMaintenance(u, token, nil)
+	if err != nil {
+		return nil, err
+	}
+	on := true
+	if _, err := setMaintenance(u, token, &on); err != nil {
+		return nil, err
+	}
+	return func() error {
+		_, err := setMaintenance(u, token, &was)
+		return err
+	}, nil
+}
+
+// setMaintenance changes the maintenance mode, unless enabled is nil, and returns the current state.
+func setMaintenance(u, token string, enabled *bool) (bool, error) {
+	method, body := http.MethodGet, ""
+	if enabled != nil {
+		method, body = http.MethodPost, url.Values{"enabled": {fmt.Sprint(*enabled)}}.Encode()
+	}
+	req, err := http.NewRequest(method, u, strings.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	if enabled != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("unexpected status %s", res.Status)
+	}
+	var state struct {
+		Enabled bool `json:"enabled"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&state); err != nil {
+		return false, err
+	}
+	return state.Enabled, nil
+}
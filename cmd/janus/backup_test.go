@@ -0,0 +1,125 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/stretchr/testify/require"
+)
+
+// readArchive returns the entries of a tar.gz archive mapped to their content or link target.
+func readArchive(t *testing.T, r io.Reader) map[string]string {
+	zr, err := gzip.NewReader(r)
+	NoError(t, err)
+	tr := tar.NewReader(zr)
+	es := map[string]string{}
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return es
+		}
+		NoError(t, err)
+		b, err := io.ReadAll(tr)
+		NoError(t, err)
+		switch hdr.Typeflag {
+		case tar.TypeLink:
+			es[hdr.Name] = "link:" + hdr.Linkname
+		case tar.TypeSymlink:
+			es[hdr.Name] = "symlink:" + hdr.Linkname
+		default:
+			es[hdr.Name] = string(b)
+		}
+	}
+}
+
+func Test_backup(t *testing.T) {
+	root := t.TempDir()
+	NoError(t, os.MkdirAll(filepath.Join(root, "docs"), 0700))
+	NoError(t, os.WriteFile(filepath.Join(root, "docs", "a.txt"), []byte("data"), 0600))
+	NoError(t, os.Link(filepath.Join(root, "docs", "a.txt"), filepath.Join(root, "docs", "b.txt")))
+	NoError(t, os.Symlink("a.txt", filepath.Join(root, "docs", "c.txt")))
+	users := filepath.Join(t.TempDir(), "users")
+	NoError(t, os.WriteFile(users, []byte("alice:hash\n"), 0600))
+
+	a := loadConfig("-d", root, "--users-file", users, "--admin-token", "s3cr3t-t0k3n")
+	buf := &bytes.Buffer{}
+	st, err := backup(a, buf)
+	NoError(t, err)
+	Equal(t, backupStats{files: 2, bytes: 15}, st)
+
+	es := readArchive(t, buf)
+	Equal(t, "", es["root/"])
+	Equal(t, "", es["root/docs/"])
+	Equal(t, "data", es["root/docs/a.txt"])
+	Equal(t, "link:root/docs/a.txt", es["root/docs/b.txt"])
+	Equal(t, "symlink:a.txt", es["root/docs/c.txt"])
+	Equal(t, "alice:hash\n", es["janus/users-file/users"])
+	Contains(t, es["janus/config.txt"], "users-file")
+	NotContains(t, es["janus/config.txt"], "s3cr3t-t0k3n")
+}
+
+func Test_runBackup(t *testing.T) {
+	root := t.TempDir()
+	NoError(t, os.WriteFile(filepath.Join(root, "a.txt"), []byte("data"), 0600))
+	a := app{ServerRoot: root}
+	a.backup.Args.Dest = filepath.Join(root, "backup.tar.gz")
+
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	Equal(t, 0, runBackup(a, stdout, stderr))
+	Equal(t, "Backed up 1 files (4 bytes) to "+a.backup.Args.Dest+"\n", stderr.String())
+
+	stderr.Reset()
+	Equal(t, 0, runBackup(a, stdout, stderr), "the previous archive is skipped")
+	Contains(t, stderr.String(), "Backed up 1 files")
+	f, err := os.Open(a.backup.Args.Dest)
+	NoError(t, err)
+	defer f.Close()
+	NotContains(t, readArchive(t, f), "root/backup.tar.gz")
+	es, err := os.ReadDir(root)
+	NoError(t, err)
+	Len(t, es, 2, "temporary files must be removed")
+
+	a.backup.Args.Dest = "-"
+	Equal(t, 0, runBackup(a, stdout, stderr))
+	Equal(t, "data", readArchive(t, stdout)["root/a.txt"])
+
+	a.backup.Args.Dest = filepath.Join(root, "missing", "backup.tar.gz")
+	Equal(t, 1, runBackup(a, stdout, stderr))
+}
+
+func Test_pause(t *testing.T) {
+	m, err := newMaintenance(false, "")
+	NoError(t, err)
+	srv := httptest.NewServer(requireAdmin("secret", handleMaintenanceMode(m)))
+	defer srv.Close()
+
+	resume, err := pause(srv.URL+"/", "secret")
+	NoError(t, err)
+	True(t, m.enabled.Load())
+	NoError(t, resume())
+	False(t, m.enabled.Load())
+
+	_, err = pause(srv.URL, "wrong")
+	ErrorContains(t, err, "401")
+	False(t, m.enabled.Load())
+}
@@ -0,0 +1,60 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// parseBaseURL parses the external URL of janus.
+// If s is empty, nil is returned, i.e., URLs are derived from the request.
+func parseBaseURL(s string) (*url.URL, error) {
+	if s == "" {
+		return nil, nil
+	}
+	u, err := url.Parse(s)
+	if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") || u.RawQuery != "" {
+		return nil, fmt.Errorf("invalid base URL %q", s)
+	}
+	return u, nil
+}
+
+// publicPath returns the path, under which clients reach the file at p (relative to the prefix).
+// If a base URL is configured (e.g., behind a reverse proxy), its path replaces the prefix.
+func publicPath(a app, p string) string {
+	if a.baseURL != nil {
+		return path.Join("/", a.baseURL.Path, p)
+	}
+	return path.Join(a.Prefix, p)
+}
+
+// externalURL returns the absolute URL of the file at p (relative to the prefix).
+// Unless a base URL is configured, the scheme and the host are taken from the request.
+func externalURL(a app, r *http.Request, p string) string {
+	u := url.URL{Scheme: "http", Host: r.Host, Path: publicPath(a, p)}
+	if a.baseURL != nil {
+		u.Scheme, u.Host = a.baseURL.Scheme, a.baseURL.Host
+	} else if r.TLS != nil {
+		u.Scheme = "https"
+	}
+	if strings.HasSuffix(p, "/") && !strings.HasSuffix(u.Path, "/") {
+		u.Path += "/"
+	}
+	return u.String()
+}
@@ -0,0 +1,55 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	. "github.com/stretchr/testify/require"
+)
+
+func Test_parseBaseURL(t *testing.T) {
+	u, err := parseBaseURL("")
+	NoError(t, err)
+	Nil(t, u)
+
+	u, err = parseBaseURL("https://files.example.com/downloads/")
+	NoError(t, err)
+	Equal(t, "/downloads/", u.Path)
+
+	for _, s := range []string{"files.example.com", "ftp://files.example.com", "https://files.example.com/?a=b"} {
+		_, err := parseBaseURL(s)
+		EqualError(t, err, `invalid base URL "`+s+`"`)
+	}
+}
+
+func Test_externalURL(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "http://localhost:8080/a", nil)
+	a := app{Prefix: "/files/"}
+	Equal(t, "/files/a b.txt", publicPath(a, "/a b.txt"))
+	Equal(t, "http://localhost:8080/files/a%20b.txt", externalURL(a, r, "/a b.txt"))
+	Equal(t, "http://localhost:8080/files/dir/", externalURL(a, r, "/dir/"))
+
+	r.TLS = &tls.ConnectionState{}
+	Equal(t, "https://localhost:8080/files/a", externalURL(a, r, "/a"))
+
+	a.baseURL, _ = parseBaseURL("https://files.example.com/downloads")
+	Equal(t, "/downloads/a", publicPath(a, "/a"))
+	Equal(t, "https://files.example.com/downloads/a", externalURL(a, r, "/a"))
+	Equal(t, "https://files.example.com/downloads/", externalURL(a, r, "/"))
+}
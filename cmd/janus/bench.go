@@ -0,0 +1,186 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// benchOptions holds the options of the bench command.
+type benchOptions struct {
+	Concurrency int           `long:"concurrency" description:"number of requests sent simultaneously" default:"10"`
+	Requests    int           `long:"requests" description:"total number of requests (0 means unlimited within the duration)" default:"0"`
+	Duration    time.Duration `long:"duration" description:"maximum duration of the benchmark" default:"10s"`
+	UploadKB    int           `long:"upload" description:"upload files of the given number of kilobytes to the URL instead of downloading it" default:"0"`
+	Args        struct {
+		URL string `positional-arg-name:"url" description:"URL of the file to download or the directory to upload to"`
+	} `positional-args:"true" required:"true"`
+}
+
+// benchResult summarizes the responses of a benchmark.
+type benchResult struct {
+	elapsed   time.Duration
+	latencies []time.Duration
+	bytes     int64
+	failed    int
+	statuses  map[int]int
+}
+
+// runBench sends requests according to the options, reports latency percentiles and throughput,
+// and returns the exit code, which is non-zero, if any request failed.
+func runBench(o benchOptions, stdout, stderr io.Writer) int {
+	if o.Concurrency <= 0 {
+		_, _ = fmt.Fprintln(stderr, "concurrency must be positive")
+		return 1
+	}
+	res := bench(o)
+	res.report(stdout)
+	if res.failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+// bench sends requests with the given concurrency until the number of requests or the duration is reached.
+func bench(o benchOptions) benchResult {
+	c := &http.Client{Transport: &http.Transport{MaxIdleConnsPerHost: o.Concurrency}}
+	defer c.CloseIdleConnections()
+
+	var data []byte
+	if o.UploadKB > 0 {
+		data = make([]byte, o.UploadKB*1024)
+		_, _ = rand.Read(data)
+	}
+
+	var (
+		mu  sync.Mutex
+		wg  sync.WaitGroup
+		n   int64
+		res = benchResult{statuses: map[int]int{}}
+	)
+	start := time.Now()
+	deadline := start.Add(o.Duration)
+	for i := 0; i < o.Concurrency; i++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			for (o.Requests <= 0 || atomic.AddInt64(&n, 1) <= int64(o.Requests)) && time.Now().Before(deadline) {
+				t := time.Now()
+				status, size, err := benchRequest(c, o.Args.URL, data, worker)
+				d := time.Since(t)
+
+				mu.Lock()
+				res.latencies = append(res.latencies, d)
+				res.bytes += size
+				if err != nil || status >= 400 {
+					res.failed++
+				}
+				res.statuses[status]++
+				mu.Unlock()
+			}
+		}(i)
+	}
+	wg.Wait()
+	res.elapsed = time.Since(start)
+	return res
+}
+
+// benchRequest downloads the URL, or uploads the data, if any, and returns the status code and
+// the number of bytes transferred. If the request fails, the status code is 0.
+func benchRequest(c *http.Client, url string, data []byte, worker int) (int, int64, error) {
+	var r *http.Request
+	var err error
+	if data == nil {
+		r, err = http.NewRequest(http.MethodGet, url, nil)
+	} else {
+		body := &bytes.Buffer{}
+		mw := multipart.NewWriter(body)
+		fw, _ := mw.CreateFormFile("file", "janus-bench-"+strconv.Itoa(worker)+".bin")
+		_, _ = fw.Write(data)
+		_ = mw.Close()
+		r, err = http.NewRequest(http.MethodPost, url, body)
+		if err == nil {
+			r.Header.Set("Content-Type", mw.FormDataContentType())
+		}
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+
+	res, err := c.Do(r)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer res.Body.Close()
+	n, err := io.Copy(io.Discard, res.Body)
+	return res.StatusCode, n + int64(len(data)), err
+}
+
+// percentile returns the latency, which p percent of the requests did not exceed.
+// The latencies must be sorted.
+func percentile(latencies []time.Duration, p float64) time.Duration {
+	if len(latencies) == 0 {
+		return 0
+	}
+	i := int(float64(len(latencies))*p/100+0.5) - 1
+	if i < 0 {
+		i = 0
+	} else if i >= len(latencies) {
+		i = len(latencies) - 1
+	}
+	return latencies[i]
+}
+
+// report prints the number of requests, throughput, latency percentiles and status codes.
+func (res benchResult) report(w io.Writer) {
+	sort.Slice(res.latencies, func(i, j int) bool { return res.latencies[i] < res.latencies[j] })
+	secs := res.elapsed.Seconds()
+	if secs <= 0 {
+		secs = 1
+	}
+	lat := func(p float64) time.Duration { return percentile(res.latencies, p).Round(time.Microsecond) }
+
+	var statuses []int
+	for s := range res.statuses {
+		statuses = append(statuses, s)
+	}
+	sort.Ints(statuses)
+	var codes []string
+	for _, s := range statuses {
+		name := strconv.Itoa(s)
+		if s == 0 {
+			name = "error"
+		}
+		codes = append(codes, fmt.Sprintf("%s: %d", name, res.statuses[s]))
+	}
+
+	_, _ = fmt.Fprintf(w, "Requests:     %d (%d failed)\n", len(res.latencies), res.failed)
+	_, _ = fmt.Fprintf(w, "Duration:     %s\n", res.elapsed.Round(time.Millisecond))
+	_, _ = fmt.Fprintf(w, "Throughput:   %.1f requests/s, %.2f MB/s\n",
+		float64(len(res.latencies))/secs, float64(res.bytes)/secs/(1<<20))
+	_, _ = fmt.Fprintf(w, "Latency:      p50 %s, p90 %s, p99 %s, max %s\n", lat(50), lat(90), lat(99), lat(100))
+	_, _ = fmt.Fprintf(w, "Status codes: %s\n", strings.Join(codes, ", "))
+}
@@ -0,0 +1,115 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "github.com/stretchr/testify/require"
+)
+
+func Test_runBench(t *testing.T) {
+	var gets, posts int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			atomic.AddInt64(&posts, 1)
+			f, h, err := r.FormFile("file")
+			NoError(t, err)
+			defer f.Close()
+			True(t, strings.HasPrefix(h.Filename, "janus-bench-"))
+			Equal(t, int64(2048), h.Size)
+			return
+		}
+		atomic.AddInt64(&gets, 1)
+		_, _ = w.Write([]byte("data"))
+	}))
+	defer srv.Close()
+
+	o := benchOptions{Concurrency: 4, Requests: 20, Duration: time.Minute}
+	o.Args.URL = srv.URL
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	Equal(t, 0, runBench(o, stdout, stderr))
+	Equal(t, int64(20), gets)
+	Contains(t, stdout.String(), "Requests:     20 (0 failed)\n")
+	Contains(t, stdout.String(), "Status codes: 200: 20\n")
+	Empty(t, stderr.String())
+
+	o.UploadKB, o.Requests = 2, 5
+	stdout.Reset()
+	Equal(t, 0, runBench(o, stdout, stderr))
+	Equal(t, int64(5), posts)
+
+	o.UploadKB, o.Requests = 0, 3
+	o.Args.URL = srv.URL + "\x00"
+	stdout.Reset()
+	Equal(t, 1, runBench(o, stdout, stderr))
+	Contains(t, stdout.String(), "Requests:     3 (3 failed)\n")
+	Contains(t, stdout.String(), "Status codes: error: 3\n")
+
+	o.Concurrency = 0
+	Equal(t, 1, runBench(o, stdout, stderr))
+	Contains(t, stderr.String(), "concurrency must be positive")
+}
+
+func Test_bench_duration(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer srv.Close()
+
+	o := benchOptions{Concurrency: 2, Duration: 50 * time.Millisecond}
+	o.Args.URL = srv.URL
+	res := bench(o)
+	Greater(t, len(res.latencies), 0)
+	Equal(t, len(res.latencies), res.failed)
+	Equal(t, len(res.latencies), res.statuses[http.StatusNotFound])
+	GreaterOrEqual(t, res.elapsed, 50*time.Millisecond)
+}
+
+func Test_percentile(t *testing.T) {
+	Equal(t, time.Duration(0), percentile(nil, 50))
+	var ls []time.Duration
+	for i := 1; i <= 100; i++ {
+		ls = append(ls, time.Duration(i)*time.Millisecond)
+	}
+	Equal(t, 50*time.Millisecond, percentile(ls, 50))
+	Equal(t, 99*time.Millisecond, percentile(ls, 99))
+	Equal(t, 100*time.Millisecond, percentile(ls, 100))
+	Equal(t, time.Millisecond, percentile(ls, 0))
+	Equal(t, 2*time.Millisecond, percentile(ls[:2], 90))
+}
+
+func Test_benchResult_report(t *testing.T) {
+	res := benchResult{
+		elapsed:   2 * time.Second,
+		latencies: []time.Duration{3 * time.Millisecond, time.Millisecond, 2 * time.Millisecond, 4 * time.Millisecond},
+		bytes:     4 << 20,
+		failed:    2,
+		statuses:  map[int]int{200: 2, 500: 1, 0: 1},
+	}
+	b := &bytes.Buffer{}
+	res.report(b)
+	Equal(t, "Requests:     4 (2 failed)\n"+
+		"Duration:     2s\n"+
+		"Throughput:   2.0 requests/s, 2.00 MB/s\n"+
+		"Latency:      p50 2ms, p90 4ms, p99 4ms, max 4ms\n"+
+		"Status codes: error: 1, 200: 2, 500: 1\n", b.String())
+}
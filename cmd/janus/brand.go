@@ -0,0 +1,119 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"html/template"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// themeCSS is the built-in style sheet of all pages, which follows the color scheme preferred by the client.
+// The colors are defined as custom properties, so that they can be overridden by the brand style sheet.
+const themeCSS = `:root {
+  --janus-fg: #1f2328;
+  --janus-bg: #ffffff;
+  --janus-link: #0969da;
+  --janus-border: #d0d7de;
+}
+@media (prefers-color-scheme: dark) {
+  :root {
+    --janus-fg: #e6edf3;
+    --janus-bg: #0d1117;
+    --janus-link: #4493f8;
+    --janus-border: #30363d;
+  }
+}
+body { max-width: 60em; margin: 0 auto; padding: 1em; font-family: system-ui, sans-serif; color: var(--janus-fg); background: var(--janus-bg); }
+a { color: var(--janus-link); }
+header { display: flex; align-items: center; gap: .5em; margin-bottom: 1em; padding-bottom: .5em; border-bottom: 1px solid var(--janus-border); font-size: 1.25em; }
+header img { max-height: 2em; }
+`
+
+// headTmpl renders the beginning of every page including the theme and the brand.
+var headTmpl = template.Must(template.New("head").Parse(`<!DOCTYPE html>
+<meta charset="UTF-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta name="color-scheme" content="light dark">
+<title>{{.Title}}{{if .Brand}} - {{.Brand}}{{end}}</title>
+{{if .Icon}}<link rel="icon" href="{{.Icon}}">
+<link rel="manifest" href="{{.Manifest}}">
+{{end}}<style>
+{{.CSS}}</style>
+{{if or .Logo .Brand}}<header>{{if .Logo}}<img src="{{.Logo}}" alt="">{{end}}{{.Brand}}</header>
+{{end}}`))
+
+// brand describes how the UI presents itself.
+type brand struct {
+	title    string
+	css      string
+	logoURL  string
+	logo     []byte
+	logoName string
+	logoTime time.Time
+	icon     string
+	manifest string
+}
+
+// newBrand creates the brand from the title, the (optional) logo image and the (optional) style sheet.
+func newBrand(a app) (*brand, error) {
+	b := &brand{title: a.BrandTitle, css: themeCSS,
+		icon: publicPath(a, "/favicon.ico"), manifest: publicPath(a, "/manifest.webmanifest")}
+	if a.BrandCSS != "" {
+		css, err := os.ReadFile(filepath.Clean(a.BrandCSS))
+		if err != nil {
+			return nil, err
+		}
+		b.css += string(css)
+	}
+	if a.BrandLogo != "" {
+		fi, err := os.Stat(a.BrandLogo)
+		if err != nil {
+			return nil, err
+		}
+		if b.logo, err = os.ReadFile(filepath.Clean(a.BrandLogo)); err != nil {
+			return nil, err
+		}
+		b.logoURL = publicPath(a, apiPrefix+"brand/logo")
+		b.logoName, b.logoTime = fi.Name(), fi.ModTime()
+	}
+	return b, nil
+}
+
+// register adds the logo endpoint to mux, if a logo is configured.
+func (b *brand) register(mux *http.ServeMux) {
+	if b == nil || b.logo == nil {
+		return
+	}
+	mux.HandleFunc(apiPrefix+"brand/logo", func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, b.logoName, b.logoTime, bytes.NewReader(b.logo))
+	})
+}
+
+// writeHead renders the beginning of a page with the given title.
+// If b is nil, the page is rendered with the built-in theme only.
+func (b *brand) writeHead(w io.Writer, title string) error {
+	if b == nil {
+		b = &brand{css: themeCSS}
+	}
+	return headTmpl.Execute(w, struct {
+		Title, Brand, Logo, Icon, Manifest string
+		CSS                                template.CSS
+	}{title, b.title, b.logoURL, b.icon, b.manifest, template.CSS(b.css)})
+}
@@ -0,0 +1,85 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/stretchr/testify/require"
+)
+
+func Test_newBrand(t *testing.T) {
+	b, err := newBrand(app{Prefix: "/"})
+	NoError(t, err)
+	Equal(t, &brand{css: themeCSS, icon: "/favicon.ico", manifest: "/manifest.webmanifest"}, b)
+
+	d := t.TempDir()
+	css, logo := filepath.Join(d, "brand.css"), filepath.Join(d, "logo.svg")
+	NoError(t, os.WriteFile(css, []byte(":root { --janus-link: orange; }"), 0600))
+	NoError(t, os.WriteFile(logo, []byte("<svg/>"), 0600))
+
+	b, err = newBrand(app{Prefix: "/files", BrandTitle: "ACME", BrandCSS: css, BrandLogo: logo})
+	NoError(t, err)
+	Equal(t, "ACME", b.title)
+	Equal(t, themeCSS+":root { --janus-link: orange; }", b.css)
+	Equal(t, "/files/_janus/brand/logo", b.logoURL)
+	Equal(t, "/files/favicon.ico", b.icon)
+	Equal(t, []byte("<svg/>"), b.logo)
+
+	_, err = newBrand(app{BrandCSS: filepath.Join(d, "missing.css")})
+	Error(t, err)
+	_, err = newBrand(app{BrandLogo: filepath.Join(d, "missing.png")})
+	Error(t, err)
+}
+
+func Test_brand_writeHead(t *testing.T) {
+	w := &bytes.Buffer{}
+	var b *brand
+	NoError(t, b.writeHead(w, "Upload"))
+	Contains(t, w.String(), "<title>Upload</title>")
+	Contains(t, w.String(), "prefers-color-scheme: dark")
+	NotContains(t, w.String(), "<header>")
+
+	w.Reset()
+	b = &brand{title: "A&B", css: themeCSS, logoURL: "/_janus/brand/logo"}
+	NoError(t, b.writeHead(w, "Login"))
+	Contains(t, w.String(), "<title>Login - A&amp;B</title>")
+	NotContains(t, w.String(), `<link rel="icon"`)
+
+	w.Reset()
+	b.icon, b.manifest = "/files/favicon.ico", "/files/manifest.webmanifest"
+	NoError(t, b.writeHead(w, "Login"))
+	Contains(t, w.String(), "<link rel=\"icon\" href=\"/files/favicon.ico\">\n<link rel=\"manifest\" href=\"/files/manifest.webmanifest\">\n")
+	Contains(t, w.String(), `<header><img src="/_janus/brand/logo" alt="">A&amp;B</header>`)
+}
+
+func Test_brand_register(t *testing.T) {
+	mux := http.NewServeMux()
+	(&brand{}).register(mux)
+	_, pattern := mux.Handler(httptest.NewRequest(http.MethodGet, apiPrefix+"brand/logo", nil))
+	Empty(t, pattern)
+
+	(&brand{logo: []byte("<svg/>"), logoName: "logo.svg"}).register(mux)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, apiPrefix+"brand/logo", nil))
+	Equal(t, http.StatusOK, w.Code)
+	Equal(t, "image/svg+xml", w.Header().Get("Content-Type"))
+	Equal(t, "<svg/>", w.Body.String())
+}
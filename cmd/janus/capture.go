@@ -0,0 +1,144 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httputil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// captureTruncatedHeader marks captured requests, whose body was not recorded completely.
+const captureTruncatedHeader = "X-Janus-Capture-Truncated"
+
+// capture records requests including their headers and (bounded) bodies as files for replaying them later.
+type capture struct {
+	dir      string
+	rate     uint64
+	patterns []string
+	prefix   string
+	maxBody  int64
+	n        uint64
+}
+
+// newCapture creates a capture, which records every Nth request for paths (relative to the prefix)
+// matching any of the patterns (or all paths, if there are none) to files in the given directory.
+// If dir is empty, capturing is disabled and nil is returned.
+func newCapture(dir string, rate sampleRate, patterns []string, prefix string, maxBody int64) *capture {
+	if dir == "" {
+		return nil
+	}
+	return &capture{dir: dir, rate: uint64(rate), patterns: patterns, prefix: strings.TrimRight(prefix, "/"), maxBody: maxBody}
+}
+
+// keep reports whether the request for the given path is captured.
+func (c *capture) keep(p string) bool {
+	if len(c.patterns) > 0 && !matchPath(c.patterns, strings.TrimPrefix(p, c.prefix)) {
+		return false
+	}
+	return c.rate <= 1 || (atomic.AddUint64(&c.n, 1)-1)%c.rate == 0
+}
+
+// captureRequests records sampled requests after they have been handled.
+// The body is recorded as far as it was read by the handler, up to the maximum size.
+// If c is nil, h is returned as is.
+func captureRequests(c *capture, h http.Handler) http.Handler {
+	if c == nil {
+		return h
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !c.keep(r.URL.Path) {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		now := time.Now()
+		cr := r.Clone(r.Context())
+		var body *captureBody
+		if r.Body != nil && r.Body != http.NoBody {
+			body = &captureBody{ReadCloser: r.Body, max: c.maxBody}
+			r.Body = body
+		}
+		h.ServeHTTP(w, r)
+
+		if err := c.write(cr, body, now); err != nil {
+			log.Warn().Err(err).Str("request-id", requestIDFrom(r.Context())).Msg("Cannot capture request")
+		}
+	})
+}
+
+// write saves the request in HTTP/1.1 wire format to a file named after the time and ID of the request.
+func (c *capture) write(r *http.Request, body *captureBody, t time.Time) error {
+	r.TransferEncoding = nil
+	r.Header.Del("Content-Length")
+	r.Body = http.NoBody
+	var b []byte
+	if body != nil {
+		b = body.buf.Bytes()
+		r.Header.Set("Content-Length", strconv.Itoa(len(b)))
+		if body.truncated || !body.eof {
+			r.Header.Set(captureTruncatedHeader, "true")
+		}
+	}
+
+	dump, err := httputil.DumpRequest(r, false)
+	if err != nil {
+		return err
+	}
+	name := t.UTC().Format("20060102T150405.000000000Z") + "-" + requestIDFrom(r.Context()) + ".http"
+	f, err := os.OpenFile(filepath.Join(c.dir, name), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(dump, b...)); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// captureBody records the bytes read from a request body up to a maximum size.
+type captureBody struct {
+	io.ReadCloser
+	buf       bytes.Buffer
+	max       int64
+	truncated bool
+	eof       bool
+}
+
+func (b *captureBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if rest := b.max - int64(b.buf.Len()); int64(n) > rest {
+		b.buf.Write(p[:rest])
+		b.truncated = true
+	} else {
+		b.buf.Write(p[:n])
+	}
+	if errors.Is(err, io.EOF) {
+		b.eof = true
+	}
+	return n, err
+}
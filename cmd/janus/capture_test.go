@@ -0,0 +1,91 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/stretchr/testify/require"
+)
+
+func Test_newCapture(t *testing.T) {
+	Nil(t, newCapture("", 1, nil, "/", 1024))
+	c := newCapture("dir", 10, []string{"/releases/"}, "/files/", 1024)
+	Equal(t, "/files", c.prefix)
+	Equal(t, uint64(10), c.rate)
+}
+
+func Test_capture_keep(t *testing.T) {
+	c := newCapture("dir", 2, []string{"/releases/"}, "/files/", 1024)
+	False(t, c.keep("/files/docs/a.txt"))
+	True(t, c.keep("/files/releases/a.txt"))
+	False(t, c.keep("/files/releases/b.txt"))
+	True(t, c.keep("/files/releases/c.txt"))
+}
+
+func Test_captureRequests(t *testing.T) {
+	dir := t.TempDir()
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(io.Discard, r.Body)
+		w.WriteHeader(http.StatusCreated)
+	})
+	h := captureRequests(newCapture(dir, 1, nil, "/", 4), next)
+
+	r := httptest.NewRequest(http.MethodPut, "/a/b.txt?x=1", strings.NewReader("abcdefgh"))
+	r.Header.Set("Authorization", "Bearer secret")
+	r = r.WithContext(context.WithValue(r.Context(), requestID, "0123"))
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, r)
+	Equal(t, http.StatusCreated, rec.Code)
+
+	names, err := filepath.Glob(filepath.Join(dir, "*-0123.http"))
+	NoError(t, err)
+	Len(t, names, 1)
+	b, err := os.ReadFile(names[0])
+	NoError(t, err)
+	s := string(b)
+	True(t, strings.HasPrefix(s, "PUT /a/b.txt?x=1 HTTP/1.1\r\nHost: example.com\r\n"), s)
+	Contains(t, s, "Authorization: Bearer secret\r\n")
+	Contains(t, s, "Content-Length: 4\r\n")
+	Contains(t, s, captureTruncatedHeader+": true\r\n")
+	True(t, strings.HasSuffix(s, "\r\n\r\nabcd"), s)
+
+	h = captureRequests(nil, next)
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	Equal(t, http.StatusCreated, rec.Code)
+}
+
+func Test_capture_write(t *testing.T) {
+	dir := t.TempDir()
+	c := newCapture(dir, 1, nil, "/", 1024)
+	r := httptest.NewRequest(http.MethodGet, "/index.html", nil)
+	r = r.WithContext(context.WithValue(r.Context(), requestID, "42"))
+	ts := time.Date(2022, 11, 27, 10, 0, 0, 123, time.UTC)
+	NoError(t, c.write(r, nil, ts))
+
+	b, err := os.ReadFile(filepath.Join(dir, "20221127T100000.000000123Z-42.http"))
+	NoError(t, err)
+	Equal(t, "GET /index.html HTTP/1.1\r\nHost: example.com\r\n\r\n", string(b))
+	Error(t, c.write(r, nil, ts), "existing captures are not overwritten")
+}
@@ -0,0 +1,180 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// casDir is the directory below the server root, in which the content-addressable store keeps the blobs.
+const casDir = ".janus-cas"
+
+// casPath is the path, at which blobs are served by their SHA-256 digest.
+const casPath = "/cas/sha256/"
+
+// errInvalidDigest indicates that a blob was requested by a malformed digest.
+var errInvalidDigest = errors.New("invalid digest")
+
+// storeBlob writes the content to the content-addressable store in root and returns its SHA-256 digest.
+// Blobs are immutable, hence storing the same content again leaves the existing blob untouched.
+func storeBlob(root string, src io.Reader) (string, error) {
+	dir := filepath.Join(root, casDir, "sha256")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	f, err := os.CreateTemp(dir, ".janus-blob-*")
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = os.Remove(f.Name()) }()
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(f, h), src); err != nil {
+		return "", err
+	} else if err := f.Chmod(0444); err != nil {
+		return "", err
+	} else if err := f.Close(); err != nil {
+		return "", err
+	}
+
+	digest := hex.EncodeToString(h.Sum(nil))
+	if exists(blobName(root, digest)) {
+		// the blob was stored again, which matters for retention
+		now := time.Now()
+		return digest, os.Chtimes(blobName(root, digest), now, now)
+	}
+	return digest, os.Rename(f.Name(), blobName(root, digest))
+}
+
+// linkBlob makes the named file point to the blob with the given digest by replacing it with a hard link.
+func linkBlob(root, digest, name string) error {
+	tmp := filepath.Join(filepath.Dir(name), ".janus-link-"+digest)
+	_ = os.Remove(tmp)
+	if err := os.Link(blobName(root, digest), tmp); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, name); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// storeFile moves the named file into the content-addressable store and replaces it with a link to the blob.
+func storeFile(root, name string) (string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	digest, err := storeBlob(root, f)
+	if err != nil {
+		return "", err
+	}
+	return digest, linkBlob(root, digest, name)
+}
+
+// replaceFile creates the named file like os.Create, but replaces an existing file rather than truncating it.
+// Hence, other hard links to the file (e.g., to a blob of the content-addressable store) keep their content.
+func replaceFile(name string) (*os.File, error) {
+	if fi, err := os.Lstat(name); err == nil && fi.Mode().IsRegular() {
+		if err := os.Remove(name); err != nil {
+			return nil, err
+		}
+	}
+	return os.Create(name)
+}
+
+// storedDigest returns the SHA-256 digest announced in the X-Checksum-Sha256 header of an upload,
+// if the content-addressable store already holds a blob with this digest.
+func storedDigest(a app, r *http.Request) (string, bool) {
+	digest := strings.ToLower(strings.TrimSpace(r.Header.Get("X-Checksum-Sha256")))
+	if !a.CAS || !isDigest(digest) {
+		return "", false
+	}
+	return digest, exists(blobName(rootDir(a, r), digest))
+}
+
+// blobName returns the file name of the blob with the given digest.
+func blobName(root, digest string) string {
+	return filepath.Join(root, casDir, "sha256", digest)
+}
+
+// isDigest reports whether s is a hex-encoded SHA-256 digest in lower case.
+func isDigest(s string) bool {
+	if len(s) != 2*sha256.Size {
+		return false
+	}
+	for _, c := range s {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// setDigest announces the digest of stored content and the URL, at which it can be fetched.
+func setDigest(w http.ResponseWriter, prefix, digest string) {
+	w.Header().Set("X-Checksum-Sha256", digest)
+	w.Header().Set("Content-Location", strings.TrimRight(prefix, "/")+casPath+digest)
+}
+
+// serveCAS serves blobs by their digest at "/cas/sha256/<digest>".
+// Since blobs never change, they can be cached forever.
+// If the content-addressable store is disabled, h is returned as is.
+func serveCAS(a app, h http.Handler) http.Handler {
+	if !a.CAS {
+		return h
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, casPath) || (r.Method != http.MethodGet && r.Method != http.MethodHead) {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		digest := strings.TrimPrefix(r.URL.Path, casPath)
+		if !isDigest(digest) {
+			renderError(w, r, errInvalidDigest, "invalid digest", http.StatusNotFound)
+			return
+		}
+		f, err := os.Open(blobName(rootDir(a, r), digest))
+		if err != nil {
+			renderError(w, r, err, "file not found", http.StatusNotFound)
+			return
+		}
+		defer f.Close()
+		fi, err := f.Stat()
+		if err != nil {
+			renderError(w, r, err, "file not found", http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+		w.Header().Set("ETag", `"sha256:`+digest+`"`)
+		w.Header().Set("X-Checksum-Sha256", digest)
+		http.ServeContent(w, r, "", fi.ModTime(), f)
+	})
+}
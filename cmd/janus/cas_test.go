@@ -0,0 +1,224 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	. "github.com/stretchr/testify/require"
+)
+
+// sumData is the SHA-256 digest of "data".
+const sumData = "3a6eb0790f39ac87c94f3856b2dd2c5d110e6811602261a9a923d3bb23adc8b7"
+
+func Test_storeBlob(t *testing.T) {
+	root := t.TempDir()
+	digest, err := storeBlob(root, strings.NewReader("data"))
+	NoError(t, err)
+	Equal(t, sumData, digest)
+
+	b, err := os.ReadFile(blobName(root, digest))
+	NoError(t, err)
+	Equal(t, "data", string(b))
+	fi, err := os.Stat(blobName(root, digest))
+	NoError(t, err)
+	Equal(t, os.FileMode(0444), fi.Mode().Perm(), "blobs are immutable")
+
+	digest, err = storeBlob(root, strings.NewReader("data"))
+	NoError(t, err)
+	Equal(t, sumData, digest)
+	es, err := os.ReadDir(filepath.Join(root, casDir, "sha256"))
+	NoError(t, err)
+	Len(t, es, 1, "temporary files must be removed")
+}
+
+func Test_linkBlob(t *testing.T) {
+	root := t.TempDir()
+	name := filepath.Join(root, "file.txt")
+	NoError(t, os.WriteFile(name, []byte("old"), 0600))
+	digest, err := storeBlob(root, strings.NewReader("data"))
+	NoError(t, err)
+
+	NoError(t, linkBlob(root, digest, name))
+	b, err := os.ReadFile(name)
+	NoError(t, err)
+	Equal(t, "data", string(b))
+	fi, err := os.Stat(name)
+	NoError(t, err)
+	bfi, err := os.Stat(blobName(root, digest))
+	NoError(t, err)
+	True(t, os.SameFile(fi, bfi))
+
+	Error(t, linkBlob(root, strings.Repeat("0", 64), name))
+	b, err = os.ReadFile(name)
+	NoError(t, err)
+	Equal(t, "data", string(b))
+}
+
+func Test_storeFile(t *testing.T) {
+	root := t.TempDir()
+	name := filepath.Join(root, "file.txt")
+	NoError(t, os.WriteFile(name, []byte("data"), 0600))
+
+	digest, err := storeFile(root, name)
+	NoError(t, err)
+	Equal(t, sumData, digest)
+	FileExists(t, blobName(root, digest))
+	b, err := os.ReadFile(name)
+	NoError(t, err)
+	Equal(t, "data", string(b))
+}
+
+func Test_isDigest(t *testing.T) {
+	True(t, isDigest(sumData))
+	False(t, isDigest(strings.ToUpper(sumData)))
+	False(t, isDigest(sumData[1:]))
+	False(t, isDigest("../"+sumData[3:]))
+	False(t, isDigest(""))
+}
+
+func Test_serveCAS(t *testing.T) {
+	root := t.TempDir()
+	_, err := storeBlob(root, strings.NewReader("data"))
+	NoError(t, err)
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusTeapot) })
+	h := serveCAS(app{ServerRoot: root, CAS: true}, next)
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, casPath+sumData, nil))
+	Equal(t, http.StatusOK, w.Code)
+	Equal(t, "data", w.Body.String())
+	Equal(t, `"sha256:`+sumData+`"`, w.Header().Get("ETag"))
+	Contains(t, w.Header().Get("Cache-Control"), "immutable")
+
+	r := httptest.NewRequest(http.MethodGet, casPath+sumData, nil)
+	r.Header.Set("If-None-Match", `"sha256:`+sumData+`"`)
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	Equal(t, http.StatusNotModified, w.Code)
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, casPath+strings.Repeat("0", 64), nil))
+	Equal(t, http.StatusNotFound, w.Code)
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, casPath+"latest", nil))
+	Equal(t, http.StatusNotFound, w.Code)
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/file.txt", nil))
+	Equal(t, http.StatusTeapot, w.Code)
+
+	Equal(t, http.StatusTeapot, func() int {
+		w := httptest.NewRecorder()
+		serveCAS(app{ServerRoot: root}, next).ServeHTTP(w, httptest.NewRequest(http.MethodGet, casPath+sumData, nil))
+		return w.Code
+	}(), "disabled")
+}
+
+func Test_handleRequest_FileUpload_CAS(t *testing.T) {
+	root := t.TempDir()
+	h := handleRequest(app{ServerRoot: root, Prefix: "/files/", EnableUpload: true, CAS: true})
+	upload := func(name string) *httptest.ResponseRecorder {
+		body := "--xxx\r\nContent-Disposition: form-data; name=\"file\"; filename=\"" + name + "\"\r\n\r\ndata\r\n--xxx--\r\n"
+		r := httptest.NewRequest(http.MethodPost, "/", io.NopCloser(bytes.NewBufferString(body)))
+		r.Header.Set("Content-Type", "multipart/form-data; boundary=xxx")
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	w := upload("file.txt")
+	Equal(t, http.StatusOK, w.Code)
+	Equal(t, sumData, w.Header().Get("X-Checksum-Sha256"))
+	Equal(t, "/files"+casPath+sumData, w.Header().Get("Content-Location"))
+	b, err := os.ReadFile(filepath.Join(root, "file.txt"))
+	NoError(t, err)
+	Equal(t, "data", string(b))
+
+	Equal(t, http.StatusOK, upload("file.txt").Code, "the same content can be uploaded again")
+	FileExists(t, blobName(root, sumData))
+	Equal(t, http.StatusForbidden, upload(casDir).Code)
+}
+
+func Test_replaceFile(t *testing.T) {
+	root := t.TempDir()
+	name := filepath.Join(root, "file.txt")
+	digest, err := storeBlob(root, strings.NewReader("data"))
+	NoError(t, err)
+	NoError(t, linkBlob(root, digest, name))
+
+	f, err := replaceFile(name)
+	NoError(t, err)
+	_, err = f.WriteString("other")
+	NoError(t, err)
+	NoError(t, f.Close())
+
+	b, err := os.ReadFile(blobName(root, digest))
+	NoError(t, err)
+	Equal(t, "data", string(b))
+	b, err = os.ReadFile(name)
+	NoError(t, err)
+	Equal(t, "other", string(b))
+}
+
+func Test_handleRequest_Put_CAS(t *testing.T) {
+	root := t.TempDir()
+	h := handleRequest(app{ServerRoot: root, Prefix: "/", EnableUpload: true, CAS: true})
+	put := func(target string, body io.Reader) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPut, target, body)
+		r.Header.Set("X-Checksum-Sha256", strings.ToUpper(sumData))
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	w := put("/builds/1/app.tar", strings.NewReader("data"))
+	Equal(t, http.StatusCreated, w.Code)
+	FileExists(t, blobName(root, sumData))
+
+	// the content is stored already, hence the body must not be read
+	w = put("/builds/2/app.tar", iotest.ErrReader(errors.New("body must not be read")))
+	Equal(t, http.StatusCreated, w.Code)
+	Equal(t, sumData, w.Header().Get("X-Checksum-Sha256"))
+	b, err := os.ReadFile(filepath.Join(root, "builds", "2", "app.tar"))
+	NoError(t, err)
+	Equal(t, "data", string(b))
+	fi1, err := os.Stat(filepath.Join(root, "builds", "1", "app.tar"))
+	NoError(t, err)
+	fi2, err := os.Stat(filepath.Join(root, "builds", "2", "app.tar"))
+	NoError(t, err)
+	True(t, os.SameFile(fi1, fi2))
+}
+
+func Test_checkConfig_CAS(t *testing.T) {
+	a := app{ServerRoot: t.TempDir(), ListenAddress: ":0", CAS: true, Roles: []string{"public read,write"}}
+	Empty(t, checkConfig(a))
+
+	a.Roles = []string{"public read,write /pub/"}
+	errs := checkConfig(a)
+	Len(t, errs, 1)
+	EqualError(t, errs[0], "cas: content-addressable storage cannot be combined with access files or roles restricted to paths")
+
+	a.Roles, a.EnableUpload, a.EnableAccessFiles = nil, true, true
+	Len(t, checkConfig(a), 1)
+}
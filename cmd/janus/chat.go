@@ -0,0 +1,212 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// chatEvents are the events chat messages can be posted about.
+var chatEvents = []string{"upload", "delete", "quarantine", "reject"}
+
+// chatTarget is a Slack or Teams webhook, or a Matrix room, which receives messages about events matching a path.
+type chatTarget struct {
+	kind    string
+	url     string
+	room    string
+	events  []string
+	pattern string
+}
+
+// chatMessage holds the data available to the message template.
+type chatMessage struct {
+	Event string
+	Name  string
+	Path  string
+	URL   string
+	Link  string
+	Size  int64
+	User  string
+	Time  time.Time
+}
+
+// chat posts templated messages to chat services.
+type chat struct {
+	targets []chatTarget
+	token   string
+	tmpl    *template.Template
+	client  *http.Client
+}
+
+// parseChatTarget parses a target like "slack https://hooks.slack.com/... events=upload path=/reports/".
+func parseChatTarget(spec string) (chatTarget, error) {
+	fs := strings.Fields(spec)
+	if len(fs) < 2 {
+		return chatTarget{}, fmt.Errorf("invalid chat target %q (must be \"<slack|teams|matrix> <url> [room=<id>] [events=<event>,...] [path=<pattern>]\")", spec)
+	}
+	t := chatTarget{kind: fs[0], url: fs[1], events: chatEvents}
+	if t.kind != "slack" && t.kind != "teams" && t.kind != "matrix" {
+		return chatTarget{}, fmt.Errorf("invalid kind %q in chat target %q (must be slack, teams or matrix)", t.kind, spec)
+	} else if u, err := url.Parse(t.url); err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+		return chatTarget{}, fmt.Errorf("invalid URL in chat target %q", spec)
+	}
+
+	for _, f := range fs[2:] {
+		k, v, _ := strings.Cut(f, "=")
+		switch k {
+		case "room":
+			t.room = v
+		case "events":
+			t.events = strings.Split(v, ",")
+			for _, e := range t.events {
+				if !contains(chatEvents, e) {
+					return chatTarget{}, fmt.Errorf("invalid event %q in chat target %q (must be upload or delete)", e, spec)
+				}
+			}
+		case "path":
+			t.pattern = v
+		default:
+			return chatTarget{}, fmt.Errorf("invalid option %q in chat target %q", f, spec)
+		}
+	}
+	if t.kind == "matrix" && t.room == "" {
+		return chatTarget{}, fmt.Errorf("missing room in chat target %q", spec)
+	}
+	return t, nil
+}
+
+// contains reports whether s is an element of ss.
+func contains(ss []string, s string) bool {
+	for _, e := range ss {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
+
+// newChat creates a chat from the target specs and the message template.
+// If there are no targets, nil is returned.
+func newChat(specs []string, token, tmpl string) (*chat, error) {
+	if len(specs) == 0 {
+		return nil, nil
+	}
+	c := &chat{token: token, client: &http.Client{Timeout: 10 * time.Second, Transport: outboundTransport}}
+	for _, spec := range specs {
+		t, err := parseChatTarget(spec)
+		if err != nil {
+			return nil, err
+		}
+		c.targets = append(c.targets, t)
+	}
+	var err error
+	if c.tmpl, err = template.New("chat").Parse(tmpl); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// notifyChat posts a message about an event concerning the file at p (relative to the prefix) to all matching targets.
+// For uploads, the message contains a share link, if share links are enabled.
+// Messages are posted in the background, so that the client does not wait for the chat service.
+func notifyChat(a app, r *http.Request, event, p string, size int64) {
+	if a.chat == nil {
+		return
+	}
+	var ts []chatTarget
+	for _, t := range a.chat.targets {
+		if contains(t.events, event) && (t.pattern == "" || matchPath([]string{t.pattern}, p)) {
+			ts = append(ts, t)
+		}
+	}
+	if len(ts) == 0 {
+		return
+	}
+
+	m := chatMessage{
+		Event: event,
+		Name:  path.Base(p),
+		Path:  p,
+		URL:   externalURL(a, r, p),
+		Size:  size,
+		Time:  time.Now(),
+	}
+	m.Link = m.URL
+	if sp, err := sharePath(a, r, p); err == nil && a.shares != nil && event == "upload" {
+		m.Link = shareURL(a, r, sp)
+	}
+	if id := identityFrom(r.Context()); id != nil {
+		m.User = id.name
+	}
+
+	text := &strings.Builder{}
+	if err := a.chat.tmpl.Execute(text, m); err != nil {
+		log.Err(err).Str("path", p).Msg("Cannot render chat message")
+		return
+	}
+	for _, t := range ts {
+		go func(t chatTarget) {
+			if err := a.chat.post(t, text.String()); err != nil {
+				log.Err(err).Str("chat", t.kind).Str("path", p).Msg("Cannot post chat message")
+			}
+		}(t)
+	}
+}
+
+// post sends the text to the target in the format of the chat service.
+func (c *chat) post(t chatTarget, text string) error {
+	method, u := http.MethodPost, t.url
+	var payload interface{} = map[string]string{"text": text}
+	if t.kind == "matrix" {
+		// https://spec.matrix.org/latest/client-server-api/#put_matrixclientv3roomsroomidsendeventtypetxnid
+		method = http.MethodPut
+		u = strings.TrimRight(t.url, "/") + "/_matrix/client/v3/rooms/" + url.PathEscape(t.room) +
+			"/send/m.room.message/janus-" + newRequestID()
+		payload = map[string]string{"msgtype": "m.text", "body": text}
+	}
+
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(method, u, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if t.kind == "matrix" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	res, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode/100 != 2 {
+		return fmt.Errorf("unexpected status %s", res.Status)
+	}
+	return nil
+}
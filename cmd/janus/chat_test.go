@@ -0,0 +1,125 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/stretchr/testify/require"
+)
+
+func Test_parseChatTarget(t *testing.T) {
+	ct, err := parseChatTarget("slack https://hooks.slack.com/services/x events=upload path=/reports/")
+	NoError(t, err)
+	Equal(t, chatTarget{kind: "slack", url: "https://hooks.slack.com/services/x", events: []string{"upload"}, pattern: "/reports/"}, ct)
+
+	ct, err = parseChatTarget("matrix https://matrix.example.com room=!abc:example.com")
+	NoError(t, err)
+	Equal(t, chatEvents, ct.events)
+	Equal(t, "!abc:example.com", ct.room)
+
+	for spec, msg := range map[string]string{
+		"slack":                       `invalid chat target "slack"`,
+		"irc https://irc.example.com": `invalid kind "irc"`,
+		"teams hooks.example.com":     `invalid URL in chat target`,
+		"teams https://hooks.example.com events=x":  `invalid event "x"`,
+		"teams https://hooks.example.com color=red": `invalid option "color=red"`,
+		"matrix https://matrix.example.com":         `missing room`,
+	} {
+		_, err := parseChatTarget(spec)
+		ErrorContains(t, err, msg, spec)
+	}
+}
+
+func Test_newChat(t *testing.T) {
+	c, err := newChat(nil, "", "")
+	NoError(t, err)
+	Nil(t, c)
+
+	_, err = newChat([]string{"slack"}, "", "{{.Name}}")
+	Error(t, err)
+	_, err = newChat([]string{"slack https://hooks.slack.com/x"}, "", "{{.Name")
+	Error(t, err)
+}
+
+func Test_notifyChat(t *testing.T) {
+	type post struct {
+		method, path, auth string
+		body               map[string]string
+	}
+	posts := make(chan post, 4)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p := post{method: r.Method, path: r.URL.Path, auth: r.Header.Get("Authorization")}
+		_ = json.NewDecoder(r.Body).Decode(&p.body)
+		posts <- p
+	}))
+	defer srv.Close()
+
+	c, err := newChat([]string{
+		"slack " + srv.URL + "/slack events=upload path=/reports/",
+		"matrix " + srv.URL + " room=!abc:example.com events=delete",
+	}, "token", "{{.Event}} {{.Name}} {{.Size}} {{.User}} {{.Link}}")
+	NoError(t, err)
+	a := app{ServerRoot: t.TempDir(), Prefix: "/files/", chat: c, shares: newShareLinks(time.Hour)}
+
+	r := withIdentity(httptest.NewRequest(http.MethodPost, "http://example.com/reports/", nil), &identity{name: "alice"})
+	notifyChat(a, r, "upload", "/reports/weekly.pdf", 42)
+	p := receivePost(t, posts)
+	Equal(t, http.MethodPost, p.method)
+	Equal(t, "/slack", p.path)
+	True(t, strings.HasPrefix(p.body["text"], "upload weekly.pdf 42 alice http://example.com/files/_janus/share/"), p.body["text"])
+
+	notifyChat(a, r, "delete", "/reports/weekly.pdf", 42)
+	p = receivePost(t, posts)
+	Equal(t, http.MethodPut, p.method)
+	True(t, strings.HasPrefix(p.path, "/_matrix/client/v3/rooms/!abc:example.com/send/m.room.message/janus-"), p.path)
+	Equal(t, "Bearer token", p.auth)
+	Equal(t, map[string]string{"msgtype": "m.text", "body": "delete weekly.pdf 42 alice http://example.com/files/reports/weekly.pdf"}, p.body)
+
+	notifyChat(a, r, "upload", "/other.pdf", 1)
+	notifyChat(app{}, r, "upload", "/reports/a.pdf", 1)
+	select {
+	case p := <-posts:
+		FailNow(t, "unexpected message", p.body)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+// receivePost waits for the next message posted to the chat service.
+func receivePost[T any](t *testing.T, c <-chan T) T {
+	select {
+	case p := <-c:
+		return p
+	case <-time.After(5 * time.Second):
+		FailNow(t, "no message posted")
+	}
+	panic("unreachable")
+}
+
+func Test_chat_post(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer srv.Close()
+
+	c, err := newChat([]string{"teams " + srv.URL}, "", "{{.Name}}")
+	NoError(t, err)
+	EqualError(t, c.post(c.targets[0], "hello"), "unexpected status 403 Forbidden")
+}
@@ -0,0 +1,305 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/mail"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+// checkConfig validates the configuration as thoroughly as possible without starting the server.
+// It returns all problems found, each prefixed with the name of the offending option.
+func checkConfig(a app) (errs []error) {
+	fail := func(opt string, err error) {
+		errs = append(errs, fmt.Errorf("%s: %w", opt, err))
+	}
+
+	if fi, err := os.Stat(a.ServerRoot); err != nil {
+		fail("server-root", err)
+	} else if !fi.IsDir() {
+		fail("server-root", errors.New("not a directory"))
+	}
+	if _, err := newUpstream(a); err != nil {
+		fail("mirror-upstream", err)
+	}
+	if err := checkMirrorRoots(a); err != nil {
+		fail("mirror-root", err)
+	}
+	if _, err := resolveIPs(a.ListenAddress, a.IPFamily); err != nil {
+		fail("listen", err)
+	}
+
+	if m, err := newACMEManager(a); err != nil {
+		fail("acme", err)
+	} else {
+		a.acme = m
+	}
+	if certs, err := newCertStore(a.TLSCerts, a.TLSKeys); err != nil {
+		fail("tls-cert", err)
+	} else if _, err := newTLSConfig(a, certs); err != nil {
+		fail("tls-client-ca", err)
+	}
+	if _, err := newOutboundTransport(a.OutboundCAs); err != nil {
+		fail("outbound-ca", err)
+	}
+	if rules, err := parseCertRules(a.TLSClientRules); err != nil {
+		fail("tls-client-rule", err)
+	} else if len(rules) > 0 && len(a.TLSClientCAs) == 0 {
+		fail("tls-client-rule", errors.New("client certificate rules require a client CA"))
+	}
+
+	if _, err := newSAMLAuth(a); err != nil {
+		fail("saml-idp-metadata", err)
+	}
+	if _, err := newOIDCAuth(a); err != nil {
+		fail("oidc-issuer", err)
+	}
+	if _, err := newJWTAuth(a); err != nil {
+		fail("auth-jwt", err)
+	}
+	if _, err := loadAccounts(a.UsersFile, a.GroupsFile); err != nil {
+		fail("users-file", err)
+	}
+	if a.GroupsFile != "" && a.UsersFile == "" {
+		fail("groups-file", errors.New("groups require a users file"))
+	}
+	if a.HomeDirs && a.UsersFile == "" && a.SAMLIDPMetadata == "" && a.OIDCIssuer == "" && len(a.TLSClientRules) == 0 {
+		fail("home-dirs", errors.New("home directories require users, SAML, OpenID Connect or client certificate rules"))
+	}
+	// uploadEnabled relies on the parsed roles as main does
+	if roles, err := parseRoles(a.Roles); err != nil {
+		fail("role", err)
+	} else {
+		a.roles = roles
+	}
+	if _, err := newScopes(a); err != nil {
+		fail("config", err)
+	}
+	if _, err := newIPFilter(a.AllowCIDRs, a.DenyCIDRs, a.CIDRScope); err != nil {
+		fail("allow-cidr", err)
+	}
+	if _, err := headerRules(a); err != nil {
+		fail("header", err)
+	}
+	if _, err := newWorkPools(a.WorkPools); err != nil {
+		fail("work-pool", err)
+	}
+	if il, err := newIdentityLimits(a.Limits); err != nil {
+		fail("limit", err)
+	} else if il != nil && !a.HomeDirs && a.TenantsFile == "" {
+		for _, l := range il.limits {
+			if l.quota > 0 {
+				fail("limit", errors.New("storage quotas require home directories or tenants"))
+				break
+			}
+		}
+	}
+	if _, err := loadTenants(a.TenantsFile); err != nil {
+		fail("tenants-file", err)
+	} else if a.TenantsFile != "" && a.HomeDirs {
+		fail("tenants-file", errors.New("tenants cannot be combined with home directories"))
+	}
+
+	if _, err := newMaintenance(false, a.MaintenancePage); err != nil {
+		fail("maintenance-page", err)
+	}
+	if _, err := loadTranslations(a.Translations); err != nil {
+		fail("translations", err)
+	}
+	if _, err := newBrand(app{BrandCSS: a.BrandCSS}); err != nil {
+		fail("brand-css", err)
+	}
+	if _, err := newBrand(app{BrandLogo: a.BrandLogo}); err != nil {
+		fail("brand-logo", err)
+	}
+	if _, err := loadTemplates(a.Templates, a.Prefix, nil); err != nil {
+		fail("templates", err)
+	}
+	if _, err := newSigner(a.SigningKey, a.SigningKeyID); err != nil {
+		fail("signing-key", err)
+	}
+	if a.Maven && !uploadEnabled(a) {
+		fail("maven", errors.New("deployments require enable-upload or roles"))
+	} else if a.Maven && a.DropBox {
+		fail("maven", errors.New("deployments cannot replace files in drop box mode"))
+	}
+	if a.CAS && !uploadEnabled(a) {
+		fail("cas", errors.New("content-addressable storage requires enable-upload or roles"))
+	} else if a.CAS && a.DropBox {
+		fail("cas", errors.New("content-addressable storage cannot be combined with drop box mode"))
+	} else if a.CAS && (a.EnableAccessFiles || pathRoles(a.roles)) {
+		fail("cas", errors.New("content-addressable storage cannot be combined with access files or roles restricted to paths"))
+	}
+	if _, err := parseBaseURL(a.BaseURL); err != nil {
+		fail("base-url", err)
+	}
+	if a.Locks && !uploadEnabled(a) {
+		fail("locks", errors.New("locking requires enable-upload or roles"))
+	} else if a.Locks && a.DropBox {
+		fail("locks", errors.New("locking cannot be combined with drop box mode"))
+	} else if a.Locks && a.LockTimeout <= 0 {
+		fail("lock-timeout", errors.New("lock timeout must be positive"))
+	}
+	if a.Resumable && !uploadEnabled(a) {
+		fail("resumable", errors.New("resumable uploads require enable-upload or roles"))
+	} else if a.Resumable && a.DropBox {
+		fail("resumable", errors.New("resumable uploads cannot be combined with drop box mode"))
+	} else if a.Resumable && a.ResumableExpiry <= 0 {
+		fail("resumable-expiry", errors.New("expiry must be positive"))
+	}
+	if _, err := newICAPClient(a.ICAP, a.ICAPMethod, a.ICAPTimeout); err != nil {
+		fail("icap", err)
+	} else if a.ICAP != "" && a.Append {
+		fail("icap", errors.New("content inspection cannot be combined with appending, since appended data is not inspected"))
+	}
+	root, _ := filepath.Abs(a.ServerRoot)
+	qdir, _ := filepath.Abs(a.QuarantineDir)
+	if a.QuarantineDir != "" && !uploadEnabled(a) {
+		fail("quarantine-dir", errors.New("quarantine requires enable-upload or roles"))
+	} else if a.QuarantineDir != "" && a.AdminToken == "" {
+		fail("quarantine-dir", errors.New("quarantine requires an admin token for reviewing uploads"))
+	} else if a.QuarantineDir != "" && (qdir == root || within(root, qdir)) {
+		fail("quarantine-dir", errors.New("quarantine directory must be outside the server root"))
+	} else if a.QuarantineDir != "" && a.Chroot {
+		fail("quarantine-dir", errors.New("quarantine cannot be combined with chroot"))
+	} else if a.QuarantineDir != "" && (a.Resumable || a.Append || a.Maven || a.CAS) {
+		fail("quarantine-dir", errors.New("quarantine cannot be combined with resumable uploads, appending, Maven deployments or content-addressable storage"))
+	}
+	hdir, _ := filepath.Abs(a.HistoryDir)
+	if a.HistoryDir != "" && a.AdminToken == "" {
+		fail("history-dir", errors.New("history requires an admin token for querying it"))
+	} else if a.HistoryDir != "" && (hdir == root || within(root, hdir)) {
+		fail("history-dir", errors.New("history directory must be outside the server root"))
+	} else if a.HistoryDir != "" && a.Chroot {
+		fail("history-dir", errors.New("history cannot be combined with chroot"))
+	} else if a.HistoryDir != "" && a.HistoryInterval <= 0 {
+		fail("history-interval", errors.New("interval must be positive"))
+	} else if a.HistoryDir != "" && a.HistoryKeep < 2 {
+		fail("history-keep", errors.New("at least two snapshots must be kept for comparing them"))
+	}
+	for _, p := range a.HistoryPaths {
+		if !strings.HasPrefix(p, "/") {
+			fail("history-path", fmt.Errorf("path %q must start with a slash", p))
+		}
+	}
+	if len(a.AssetPaths) > 0 && !uploadEnabled(a) {
+		fail("asset-path", errors.New("hashed assets require enable-upload or roles"))
+	} else if len(a.AssetPaths) > 0 && a.DropBox {
+		fail("asset-path", errors.New("hashed assets cannot be combined with drop box mode"))
+	}
+	if err := appendConflict(a); err != nil {
+		fail("append", err)
+	}
+	if a.GitUpdateServerInfo && !a.Git {
+		fail("git-update-server-info", errors.New("updating server info requires git mode"))
+	} else if _, err := exec.LookPath("git"); err != nil && a.GitUpdateServerInfo {
+		fail("git-update-server-info", err)
+	}
+	if _, err := a.Robots.content(); err != nil {
+		fail("robots", err)
+	}
+	if u, err := url.Parse(a.Sitemap); a.Sitemap != "" && (err != nil || u.Host == "" ||
+		(u.Scheme != "http" && u.Scheme != "https")) {
+		fail("sitemap", fmt.Errorf("invalid URL %q", a.Sitemap))
+	} else if a.Sitemap != "" && (a.HomeDirs || a.TenantsFile != "" || a.DropBox) {
+		fail("sitemap", errors.New("a sitemap cannot be generated for home directories, tenants or drop boxes"))
+	}
+	for _, t := range a.TorrentTrackers {
+		if u, err := url.Parse(t); err != nil || u.Host == "" {
+			fail("torrent-tracker", fmt.Errorf("invalid URL %q", t))
+		} else if !a.Torrent {
+			fail("torrent-tracker", errors.New("trackers require torrent"))
+		}
+	}
+	if _, err := net.ResolveUDPAddr("udp", a.StatsD); a.StatsD != "" && err != nil {
+		fail("statsd", err)
+	}
+	if _, err := newOTLPMetrics(a.OTLPEndpoint, a.OTLPInterval); err != nil {
+		fail("otlp-endpoint", err)
+	}
+	if len(a.StatsDTags) > 0 && a.StatsDFormat != "dogstatsd" {
+		fail("statsd-tag", errors.New("tags require the dogstatsd format"))
+	}
+	if _, _, err := net.SplitHostPort(a.SMTPServer); a.SMTPServer != "" && err != nil {
+		fail("smtp-server", err)
+	} else if _, err := mail.ParseAddress(a.SMTPFrom); a.SMTPServer != "" && err != nil {
+		fail("smtp-from", fmt.Errorf("invalid sender %q", a.SMTPFrom))
+	}
+	for _, spec := range a.NotifyRules {
+		if _, err := parseNotifyRule(spec); err != nil {
+			fail("notify", err)
+		} else if a.SMTPServer == "" {
+			fail("notify", errors.New("notifications require an SMTP server"))
+			break
+		}
+	}
+	if _, err := template.New("subject").Parse(a.NotifySubject); err != nil {
+		fail("notify-subject", err)
+	}
+	if b, err := os.ReadFile(a.NotifyBody); a.NotifyBody != "" && err != nil {
+		fail("notify-body", err)
+	} else if _, err := template.New("body").Parse(string(b)); a.NotifyBody != "" && err != nil {
+		fail("notify-body", err)
+	}
+	for _, spec := range a.ChatTargets {
+		if t, err := parseChatTarget(spec); err != nil {
+			fail("chat", err)
+		} else if t.kind == "matrix" && a.ChatMatrixToken == "" {
+			fail("chat-matrix-token", errors.New("posting to Matrix requires an access token"))
+		}
+	}
+	if _, err := template.New("chat").Parse(a.ChatTemplate); err != nil {
+		fail("chat-template", err)
+	}
+	if fi, err := os.Stat(a.Capture); a.Capture != "" && err != nil {
+		fail("capture", err)
+	} else if a.Capture != "" && !fi.IsDir() {
+		fail("capture", errors.New("not a directory"))
+	}
+	for _, f := range []struct {
+		opt  string
+		rate float64
+	}{{"fault-error-rate", a.FaultErrorRate}, {"fault-reset-rate", a.FaultResetRate}, {"fault-truncate-rate", a.FaultTruncateRate}} {
+		if f.rate < 0 || f.rate > 1 {
+			fail(f.opt, fmt.Errorf("invalid rate %v (must be between 0 and 1)", f.rate))
+		}
+	}
+	if _, err := lookupCredentials(a.User, a.Group); err != nil {
+		fail("user", err)
+	}
+	return errs
+}
+
+// runCheck validates the configuration, reports the result and returns the exit code.
+func runCheck(a app, stdout, stderr io.Writer) int {
+	errs := checkConfig(a)
+	for _, err := range errs {
+		_, _ = fmt.Fprintln(stderr, err)
+	}
+	if len(errs) > 0 {
+		return 1
+	}
+	_, _ = fmt.Fprintln(stdout, "Configuration OK")
+	return 0
+}
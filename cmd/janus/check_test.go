@@ -0,0 +1,114 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/stretchr/testify/require"
+)
+
+func Test_checkConfig(t *testing.T) {
+	a := loadConfig("check", "-d", t.TempDir(), "-l", "127.0.0.1:0")
+	Equal(t, "check", a.command)
+	Empty(t, checkConfig(a))
+
+	file := filepath.Join(t.TempDir(), "file")
+	NoError(t, os.WriteFile(file, nil, 0600))
+	a.ServerRoot = file
+	a.TLSCerts = []string{"cert.pem"}
+	a.ACME = true
+	a.TLSClientRules = []string{"CN=backup rw"}
+	a.GroupsFile = file
+	a.Roles = []string{"alice rw"}
+	a.HomeDirs = true
+	a.TenantsFile = file
+	a.Headers = []string{"/public/ Access Control: *"}
+	a.WorkPools = []string{"thumbnail workers=2"}
+	a.Limits = []string{"public rate=fast"}
+	a.DropBox = true
+	a.CAS = true
+	a.Locks = true
+	a.Resumable = true
+	a.ICAP = "http://dlp.example.com"
+	a.QuarantineDir = filepath.Join(a.ServerRoot, "quarantine")
+	a.HistoryDir = a.QuarantineDir
+	a.HistoryPaths = []string{"shared"}
+	a.AssetPaths = []string{"/static/"}
+	a.Append = true
+	a.Sitemap = "files.example.com"
+	a.TorrentTrackers = []string{"tracker.example.com"}
+	a.StatsDTags = []string{"env:prod"}
+	a.OTLPEndpoint = "collector:4318"
+	a.NotifyRules = []string{"/reports/ alice"}
+	a.ChatTargets = []string{"matrix https://matrix.example.com room=!abc:example.com"}
+	a.Capture = file
+	a.FaultResetRate = 1.5
+
+	var msgs []string
+	for _, err := range checkConfig(a) {
+		msgs = append(msgs, err.Error())
+	}
+	Equal(t, []string{
+		"server-root: not a directory",
+		"acme: ACME cannot be combined with TLS certificates",
+		"tls-cert: number of TLS certificates and keys must match",
+		"tls-client-rule: client certificate rules require a client CA",
+		"groups-file: groups require a users file",
+		`role: invalid permission "rw" in role (must be read, write, delete or share): "alice rw"`,
+		`header: invalid header rule "/public/ Access Control: *"`,
+		`work-pool: invalid work pool "thumbnail workers=2" (class must be checksum or metadata)`,
+		`limit: invalid rate in limit "public rate=fast"`,
+		"tenants-file: tenants cannot be combined with home directories",
+		"cas: content-addressable storage cannot be combined with drop box mode",
+		"locks: locking cannot be combined with drop box mode",
+		"resumable: resumable uploads cannot be combined with drop box mode",
+		`icap: invalid ICAP URL "http://dlp.example.com"`,
+		"quarantine-dir: quarantine requires an admin token for reviewing uploads",
+		"history-dir: history requires an admin token for querying it",
+		`history-path: path "shared" must start with a slash`,
+		"asset-path: hashed assets cannot be combined with drop box mode",
+		"append: appending cannot be combined with drop box mode",
+		`sitemap: invalid URL "files.example.com"`,
+		`torrent-tracker: invalid URL "tracker.example.com"`,
+		`otlp-endpoint: invalid URL "collector:4318"`,
+		"statsd-tag: tags require the dogstatsd format",
+		`notify: invalid recipient "alice" in notification rule "/reports/ alice"`,
+		"chat-matrix-token: posting to Matrix requires an access token",
+		"capture: not a directory",
+		"fault-reset-rate: invalid rate 1.5 (must be between 0 and 1)",
+	}, msgs)
+}
+
+func Test_checkConfig_Roles(t *testing.T) {
+	a := loadConfig("check", "-d", t.TempDir(), "-l", "127.0.0.1:0", "--role", "public read,write",
+		"--cas", "--maven", "--locks", "--resumable", "--asset-path", "/static/")
+	Empty(t, checkConfig(a))
+}
+
+func Test_runCheck(t *testing.T) {
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	Equal(t, 0, runCheck(app{ServerRoot: t.TempDir(), ListenAddress: ":0"}, stdout, stderr))
+	Equal(t, "Configuration OK\n", stdout.String())
+	Empty(t, stderr.String())
+
+	stdout.Reset()
+	Equal(t, 1, runCheck(app{ServerRoot: "/nonexistent", ListenAddress: ":0"}, stdout, stderr))
+	Empty(t, stdout.String())
+	Contains(t, stderr.String(), "server-root: ")
+}
@@ -0,0 +1,127 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+// errAccessDenied indicates that a client certificate does not grant access to the requested resource.
+var errAccessDenied = errors.New("access denied")
+
+// certRule grants access to clients, whose certificate has an attribute matching the value.
+type certRule struct {
+	field     string
+	value     string
+	readWrite bool
+	patterns  []string
+}
+
+// parseCertRules parses rules of the form "<field>=<value> <ro|rw> [<path pattern>...]".
+// Supported fields are CN (common name), OU (organizational unit) and SAN (DNS name, email address or URI).
+// The value may contain wildcards (see path.Match).
+// Path patterns are matched by matchPath. If none is given, all paths are accessible.
+func parseCertRules(specs []string) ([]certRule, error) {
+	rules := make([]certRule, len(specs))
+	for i, spec := range specs {
+		fs := strings.Fields(spec)
+		if len(fs) < 2 {
+			return nil, fmt.Errorf("invalid client certificate rule: %q", spec)
+		}
+
+		field, value, ok := strings.Cut(fs[0], "=")
+		field = strings.ToUpper(field)
+		if !ok || field != "CN" && field != "OU" && field != "SAN" {
+			return nil, fmt.Errorf("invalid client certificate attribute in rule: %q", spec)
+		} else if _, err := path.Match(value, ""); err != nil {
+			return nil, fmt.Errorf("invalid value in client certificate rule %q: %w", spec, err)
+		} else if fs[1] != "ro" && fs[1] != "rw" {
+			return nil, fmt.Errorf("invalid access in client certificate rule (must be ro or rw): %q", spec)
+		}
+		rules[i] = certRule{field: field, value: value, readWrite: fs[1] == "rw", patterns: fs[2:]}
+	}
+	return rules, nil
+}
+
+// matches reports whether the certificate has an attribute matching the rule.
+func (cr certRule) matches(c *x509.Certificate) bool {
+	var vals []string
+	switch cr.field {
+	case "CN":
+		vals = []string{c.Subject.CommonName}
+	case "OU":
+		vals = c.Subject.OrganizationalUnit
+	case "SAN":
+		vals = subjectAltNames(c)
+	}
+
+	for _, v := range vals {
+		if ok, _ := path.Match(cr.value, v); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// subjectAltNames returns the DNS names, email addresses and URIs of the certificate.
+func subjectAltNames(c *x509.Certificate) []string {
+	sans := append(append([]string{}, c.DNSNames...), c.EmailAddresses...)
+	for _, u := range c.URIs {
+		sans = append(sans, u.String())
+	}
+	return sans
+}
+
+// allows reports whether the rule permits the request.
+func (cr certRule) allows(r *http.Request) bool {
+	if !cr.readWrite && r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+	return len(cr.patterns) == 0 || matchPath(cr.patterns, r.URL.Path)
+}
+
+// authorizeClientCert permits requests according to the first rule matching the verified client certificate.
+// If no rule matches or the rule does not permit the request, "403 Forbidden" is sent.
+// If there are no rules, h is returned as is.
+func authorizeClientCert(rules []certRule, h http.Handler) http.Handler {
+	if len(rules) == 0 {
+		return h
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 {
+			c := r.TLS.VerifiedChains[0][0]
+			for _, cr := range rules {
+				if !cr.matches(c) {
+					continue
+				} else if cr.allows(r) {
+					h.ServeHTTP(w, withIdentity(r, &identity{name: c.Subject.CommonName, groups: c.Subject.OrganizationalUnit}))
+					return
+				}
+				break
+			}
+			log.Warn().Str("request-id", requestIDFrom(r.Context())).Str("subject", c.Subject.CommonName).
+				Str("method", r.Method).Str("path", r.URL.Path).Msg("Client certificate not authorized")
+		}
+		renderError(w, r, errAccessDenied, "access denied", http.StatusForbidden)
+	})
+}
@@ -0,0 +1,100 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/rs/zerolog/log"
+	. "github.com/stretchr/testify/require"
+)
+
+func Test_parseCertRules(t *testing.T) {
+	rules, err := parseCertRules([]string{"CN=backup rw /backups/ /shared/", "ou=ops ro"})
+	NoError(t, err)
+	Equal(t, []certRule{
+		{field: "CN", value: "backup", readWrite: true, patterns: []string{"/backups/", "/shared/"}},
+		{field: "OU", value: "ops", patterns: []string{}},
+	}, rules)
+
+	for _, spec := range []string{"CN=backup", "O=acme ro", "CN=backup rx", "backup ro", "CN=[ ro"} {
+		_, err = parseCertRules([]string{spec})
+		Error(t, err, spec)
+	}
+}
+
+func Test_certRule_matches(t *testing.T) {
+	u, _ := url.Parse("spiffe://example.com/backup")
+	c := &x509.Certificate{
+		Subject:  pkix.Name{CommonName: "backup", OrganizationalUnit: []string{"ops", "dev"}},
+		DNSNames: []string{"backup.svc.cluster.local"},
+		URIs:     []*url.URL{u},
+	}
+
+	True(t, certRule{field: "CN", value: "backup"}.matches(c))
+	True(t, certRule{field: "OU", value: "dev"}.matches(c))
+	True(t, certRule{field: "SAN", value: "*.svc.cluster.local"}.matches(c))
+	True(t, certRule{field: "SAN", value: "spiffe://example.com/backup"}.matches(c))
+	False(t, certRule{field: "CN", value: "ops"}.matches(c))
+	False(t, certRule{field: "SAN", value: "backup"}.matches(c))
+}
+
+func Test_authorizeClientCert(t *testing.T) {
+	rules, err := parseCertRules([]string{"CN=backup rw /backups/", "OU=ops ro"})
+	NoError(t, err)
+	h := authorizeClientCert(rules, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	serve := func(method, p string, c *x509.Certificate) int {
+		r := httptest.NewRequest(method, p, nil)
+		if c != nil {
+			r.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{c}}}
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	backup := &x509.Certificate{Subject: pkix.Name{CommonName: "backup", OrganizationalUnit: []string{"ops"}}}
+	ops := &x509.Certificate{Subject: pkix.Name{CommonName: "alice", OrganizationalUnit: []string{"ops"}}}
+	Equal(t, http.StatusOK, serve(http.MethodPost, "/backups/db.tar", backup))
+	Equal(t, http.StatusForbidden, serve(http.MethodGet, "/index.html", backup))
+	Equal(t, http.StatusOK, serve(http.MethodGet, "/index.html", ops))
+	Equal(t, http.StatusForbidden, serve(http.MethodPost, "/backups/db.tar", ops))
+	Equal(t, http.StatusForbidden, serve(http.MethodGet, "/index.html", &x509.Certificate{}))
+	Equal(t, http.StatusForbidden, serve(http.MethodGet, "/index.html", nil))
+}
+
+func Test_logHandler_ClientCert(t *testing.T) {
+	b := &bytes.Buffer{}
+	orig := log.Logger
+	log.Logger = log.Output(b)
+	t.Cleanup(func() { log.Logger = orig })
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{{
+		Subject:        pkix.Name{CommonName: "backup"},
+		DNSNames:       []string{"backup.svc.cluster.local"},
+		EmailAddresses: []string{"ops@example.com"},
+	}}}}
+	logHandler(nil, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).ServeHTTP(httptest.NewRecorder(), r)
+	Contains(t, b.String(), `"client-cn":"backup","client-san":["backup.svc.cluster.local","ops@example.com"]`)
+}
@@ -0,0 +1,190 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/jessevdk/go-flags"
+)
+
+const (
+	srcDefault = "default"
+	srcFile    = "file"
+	srcEnv     = "env"
+	srcFlag    = "flag"
+)
+
+// parseConfigFile parses the named INI file, environment variables and command line arguments (in this order),
+// each taking precedence over the previous one.
+// Location sections are kept for newScopes, since they may only override a few options.
+// It returns the names of the options set in the INI file.
+func parseConfigFile(a *app, name string, args []string) (*flags.Parser, map[string]bool, error) {
+	*a = app{}
+	p := newParser(a)
+	f, err := os.Open(name)
+	if err != nil {
+		return p, nil, err
+	}
+	global, locs, err := splitLocations(f)
+	_ = f.Close()
+	if err != nil {
+		return p, nil, fmt.Errorf("%s: %w", name, err)
+	}
+	ip := flags.NewIniParser(p)
+	if err := ip.Parse(strings.NewReader(global)); err != nil {
+		var iErr *flags.IniError
+		if errors.As(err, &iErr) {
+			iErr.File = name
+		}
+		return p, nil, err
+	}
+	filed := setOptions(p)
+	// values from the INI file prevent options from being set via environment variables
+	if err := ip.Parse(envIni(p)); err != nil {
+		return p, nil, err
+	}
+	_, err = p.ParseArgs(args)
+	a.locations = locs
+	return p, filed, err
+}
+
+// newParser creates a parser for the options and commands.
+func newParser(a *app) *flags.Parser {
+	p := flags.NewParser(a, flags.Default)
+	for _, o := range options(p) {
+		if o.Field().Tag.Get("no-env") == "" {
+			o.EnvDefaultKey = envKey(o.LongName)
+		}
+	}
+	p.SubcommandsOptional = true
+	_, _ = p.AddCommand("check", "Validate the configuration",
+		"Validate the configuration and exit with a non-zero status code if it is invalid.", &struct{}{})
+	cfg, _ := p.AddCommand("config", "Inspect the configuration", "Inspect the configuration.", &struct{}{})
+	_, _ = cfg.AddCommand("show", "Print the effective configuration",
+		"Print the effective configuration along with the source of each value. Secrets are redacted.", &struct{}{})
+	_, _ = p.AddCommand("replay", "Replay captured requests",
+		"Send requests recorded via --capture to another instance and print the status code of each response.", &a.replay)
+	_, _ = p.AddCommand("bench", "Run a load test",
+		"Download a URL (or upload files to it) with concurrent requests and report latency percentiles and throughput.", &a.bench)
+	_, _ = p.AddCommand("backup", "Create a snapshot archive",
+		"Write the server root, the configuration and the files referenced by it (except for private keys) to a tar.gz archive.", &a.backup)
+	_, _ = p.AddCommand("restore", "Restore a snapshot archive",
+		"Extract an archive created by \"janus backup\" into the server root, or merge it into an existing one.", &a.restore)
+	return p
+}
+
+// envIni renders all options, which are set via environment variables, in INI format.
+func envIni(p *flags.Parser) io.Reader {
+	b := &strings.Builder{}
+	for _, o := range options(p) {
+		k := o.EnvKeyWithNamespace()
+		v, ok := os.LookupEnv(k)
+		if k == "" || !ok || o.Field().Tag.Get("no-ini") != "" {
+			continue
+		}
+		vs := []string{v}
+		if o.EnvDefaultDelim != "" {
+			vs = strings.Split(v, o.EnvDefaultDelim)
+		}
+		for _, v := range vs {
+			fmt.Fprintf(b, "%s = %s\n", o.LongName, strconv.Quote(v))
+		}
+	}
+	return strings.NewReader(b.String())
+}
+
+// envKey derives the name of the environment variable for an option from its long name
+// e.g., "JANUS_SERVER_ROOT" for "server-root".
+func envKey(long string) string {
+	return "JANUS_" + strings.ToUpper(strings.ReplaceAll(long, "-", "_"))
+}
+
+// options returns all options of the parser.
+func options(p *flags.Parser) (opts []*flags.Option) {
+	for _, g := range p.Groups() {
+		opts = append(opts, g.Options()...)
+	}
+	return opts
+}
+
+// setOptions returns the long names of all options, which were set explicitly i.e., not by default.
+func setOptions(p *flags.Parser) map[string]bool {
+	set := map[string]bool{}
+	for _, o := range options(p) {
+		if o.IsSet() && !o.IsSetDefault() {
+			set[o.LongName] = true
+		}
+	}
+	return set
+}
+
+// optionSources determines the source of each option considering the precedence of
+// command line arguments over environment variables over the config file over defaults.
+func optionSources(p *flags.Parser, flagged, filed map[string]bool) map[string]string {
+	srcs := map[string]string{}
+	for _, o := range options(p) {
+		k := o.EnvKeyWithNamespace()
+		_, env := os.LookupEnv(k)
+		switch {
+		case flagged[o.LongName]:
+			srcs[o.LongName] = srcFlag
+		case k != "" && env:
+			srcs[o.LongName] = srcEnv + " " + k
+		case filed[o.LongName]:
+			srcs[o.LongName] = srcFile
+		default:
+			srcs[o.LongName] = srcDefault
+		}
+	}
+	return srcs
+}
+
+// showConfig prints the effective value and the source of each option.
+// Values of options tagged as secret are redacted.
+func showConfig(a app, w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "OPTION\tSOURCE\tVALUE")
+	for _, o := range options(newParser(&a)) {
+		v := formatValue(o.Value())
+		if o.Field().Tag.Get("secret") != "" && v != `""` {
+			v = "<redacted>"
+		}
+		src := a.sources[o.LongName]
+		if src == "" {
+			src = srcDefault
+		}
+		_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\n", o.LongName, src, v)
+	}
+	return tw.Flush()
+}
+
+// formatValue renders an option value, quoting strings.
+func formatValue(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return strconv.Quote(v)
+	case []string:
+		return fmt.Sprintf("%q", v)
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
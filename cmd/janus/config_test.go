@@ -0,0 +1,94 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/stretchr/testify/require"
+)
+
+func Test_envIni(t *testing.T) {
+	t.Setenv("JANUS_LISTEN", ":9091")
+	t.Setenv("JANUS_TLS_CERT", "a.pem,b.pem")
+	t.Setenv("JANUS_CONFIG", "janus.ini")
+
+	b, err := io.ReadAll(envIni(newParser(&app{})))
+	NoError(t, err)
+	Contains(t, string(b), "listen = \":9091\"\n")
+	Contains(t, string(b), "tls-cert = \"a.pem\"\ntls-cert = \"b.pem\"\n")
+	NotContains(t, string(b), "config")
+}
+
+func Test_optionSources(t *testing.T) {
+	cfg := filepath.Join(t.TempDir(), "janus.ini")
+	NoError(t, os.WriteFile(cfg, []byte("listen = :9090\nprefix = /files\nread-timeout = 1m\n"), 0600))
+	t.Setenv("JANUS_PREFIX", "/env")
+
+	a := loadConfig("config", "show", "-c", cfg, "--read-timeout", "1h")
+	Equal(t, "config show", a.command)
+	Equal(t, "file", a.sources["listen"])
+	Equal(t, "env JANUS_PREFIX", a.sources["prefix"])
+	Equal(t, "flag", a.sources["read-timeout"])
+	Equal(t, "default", a.sources["write-timeout"])
+	Equal(t, time.Hour, a.ReadTimeout)
+}
+
+func Test_showConfig(t *testing.T) {
+	a := loadConfig("-l", ":9090", "--admin-token", "s3cr3t-t0k3n", "--role", "public read")
+	b := &bytes.Buffer{}
+	NoError(t, showConfig(a, b))
+
+	Regexp(t, `(?m)^OPTION\s+SOURCE\s+VALUE$`, b.String())
+	Regexp(t, `(?m)^listen\s+flag\s+":9090"$`, b.String())
+	Regexp(t, `(?m)^role\s+flag\s+\["public read"\]$`, b.String())
+	Regexp(t, `(?m)^admin-token\s+flag\s+<redacted>$`, b.String())
+	Regexp(t, `(?m)^read-header-timeout\s+default\s+30s$`, b.String())
+	NotContains(t, b.String(), "s3cr3t-t0k3n")
+}
+
+func Test_formatValue(t *testing.T) {
+	Equal(t, `"a b"`, formatValue("a b"))
+	Equal(t, `["a" "b,c"]`, formatValue([]string{"a", "b,c"}))
+	Equal(t, "map[a:1 b:2]", formatValue(map[string]string{"b": "2", "a": "1"}))
+	Equal(t, "1m0s", formatValue(time.Minute))
+	Equal(t, "true", formatValue(true))
+}
+
+func Test_envKey(t *testing.T) {
+	Equal(t, "JANUS_SERVER_ROOT", envKey("server-root"))
+	Equal(t, "JANUS_TLS_CLIENT_CA", envKey("tls-client-ca"))
+}
+
+func Test_newParser_Env(t *testing.T) {
+	for _, o := range options(newParser(&app{})) {
+		if o.LongName == "version" || o.LongName == "enroll-totp" {
+			Empty(t, o.EnvDefaultKey, o.LongName)
+		} else {
+			Equal(t, envKey(o.LongName), o.EnvDefaultKey, o.LongName)
+		}
+	}
+
+	t.Setenv("JANUS_CLIENT_BODY_BUFFER_SIZE", "16")
+	t.Setenv("JANUS_VERSION", "true")
+	a := loadConfig()
+	Equal(t, uint32(16), a.BufferSizeKB)
+	False(t, a.Version)
+}
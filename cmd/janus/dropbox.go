@@ -0,0 +1,69 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// errDownloadDisabled indicates that files cannot be downloaded from a drop box.
+var errDownloadDisabled = errors.New("download disabled")
+
+// maxUniqueNames is the maximum number of suffixes tried for finding an unused file name.
+const maxUniqueNames = 1000
+
+// restrictDropBox permits uploads only. Requests for directories are redirected to the upload page,
+// whereas all other requests are rejected with "403 Forbidden".
+// If drop box mode is disabled, h is returned as is.
+func restrictDropBox(a app, h http.Handler) http.Handler {
+	if !a.DropBox {
+		return h
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := r.URL.Query()["upload"]; ok || r.Method == http.MethodPost {
+			h.ServeHTTP(w, r)
+			return
+		} else if strings.HasSuffix(r.URL.Path, "/") && (r.Method == http.MethodGet || r.Method == http.MethodHead) {
+			// relative, so that the prefix is preserved
+			w.Header().Set("Location", "?upload")
+			w.WriteHeader(http.StatusSeeOther)
+			return
+		}
+		renderError(w, r, errDownloadDisabled, "download disabled", http.StatusForbidden)
+	})
+}
+
+// createUnique creates the named file. If it exists, a numeric suffix is added e.g., "name-1.ext".
+func createUnique(name string) (*os.File, error) {
+	ext := filepath.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	for i := 0; i < maxUniqueNames; i++ {
+		n := name
+		if i > 0 {
+			n = fmt.Sprintf("%s-%d%s", base, i, ext)
+		}
+		f, err := os.OpenFile(n, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0666)
+		if !errors.Is(err, os.ErrExist) {
+			return f, err
+		}
+	}
+	return nil, os.ErrExist
+}
@@ -0,0 +1,56 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/stretchr/testify/require"
+)
+
+func Test_restrictDropBox(t *testing.T) {
+	h := restrictDropBox(app{DropBox: true}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	serve := func(method, target string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(method, target, nil))
+		return w
+	}
+
+	Equal(t, http.StatusOK, serve(http.MethodPost, "/").Code)
+	Equal(t, http.StatusOK, serve(http.MethodGet, "/dir/?upload").Code)
+	Equal(t, http.StatusForbidden, serve(http.MethodGet, "/a.txt").Code)
+	Equal(t, http.StatusForbidden, serve(http.MethodHead, "/a.txt").Code)
+
+	w := serve(http.MethodGet, "/dir/")
+	Equal(t, http.StatusSeeOther, w.Code)
+	Equal(t, "?upload", w.Header().Get("Location"))
+}
+
+func Test_createUnique(t *testing.T) {
+	d := t.TempDir()
+	for _, want := range []string{"a.txt", "a-1.txt", "a-2.txt"} {
+		f, err := createUnique(filepath.Join(d, "a.txt"))
+		NoError(t, err)
+		Equal(t, filepath.Join(d, want), f.Name())
+		NoError(t, f.Close())
+	}
+
+	_, err := createUnique(filepath.Join(d, "missing", "a.txt"))
+	ErrorIs(t, err, os.ErrNotExist)
+}
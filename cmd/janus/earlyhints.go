@@ -0,0 +1,46 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"net/http"
+	"strings"
+)
+
+// handleEarlyHints adds preload Link headers to the response of configured paths.
+// The headers are sent as 103 Early Hints first, so that browsers can start fetching
+// resources while the actual response is still being prepared.
+//
+// Paths ending with a slash also match their "index.html".
+func handleEarlyHints(links map[string]string, h http.Handler) http.Handler {
+	if len(links) == 0 {
+		return h
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p := r.URL.Path
+		if strings.HasSuffix(p, "/") {
+			p += "index.html"
+		}
+
+		if l, ok := links[p]; ok && r.Method == http.MethodGet {
+			w.Header().Add("Link", l)
+			if r.ProtoAtLeast(1, 1) {
+				w.WriteHeader(http.StatusEarlyHints)
+			}
+		}
+		h.ServeHTTP(w, r)
+	})
+}
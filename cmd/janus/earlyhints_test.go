@@ -0,0 +1,61 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httptrace"
+	"net/textproto"
+	"testing"
+
+	. "github.com/stretchr/testify/require"
+)
+
+func Test_handleEarlyHints(t *testing.T) {
+	link := "</app.js>; rel=preload; as=script"
+	h := handleEarlyHints(map[string]string{"/index.html": link}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	}))
+	s := httptest.NewServer(logHandler(nil, h))
+	defer s.Close()
+
+	var hints []string
+	trace := &httptrace.ClientTrace{Got1xxResponse: func(code int, header textproto.MIMEHeader) error {
+		if code == http.StatusEarlyHints {
+			hints = append(hints, header.Get("Link"))
+		}
+		return nil
+	}}
+
+	r, err := http.NewRequestWithContext(httptrace.WithClientTrace(context.Background(), trace), http.MethodGet, s.URL+"/", nil)
+	NoError(t, err)
+	resp, err := http.DefaultClient.Do(r)
+	NoError(t, err)
+	defer func() { _ = resp.Body.Close() }()
+
+	Equal(t, http.StatusOK, resp.StatusCode)
+	Equal(t, link, resp.Header.Get("Link"))
+	Equal(t, []string{link}, hints)
+}
+
+func Test_handleEarlyHints_NoMatch(t *testing.T) {
+	h := handleEarlyHints(map[string]string{"/index.html": "</app.js>; rel=preload"}, http.NotFoundHandler())
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/other.html", nil))
+	Equal(t, http.StatusNotFound, w.Code)
+	Empty(t, w.Header().Get("Link"))
+}
@@ -0,0 +1,110 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+)
+
+// errorCode is a stable, machine-readable identifier of an error, which clients can rely on.
+type errorCode string
+
+const (
+	codeAccessDenied     errorCode = "JANUS_ACCESS_DENIED"
+	codeAuthRequired     errorCode = "JANUS_AUTHENTICATION_REQUIRED"
+	codeBadRequest       errorCode = "JANUS_BAD_REQUEST"
+	codeChecksum         errorCode = "JANUS_CHECKSUM_MISMATCH"
+	codeConflict         errorCode = "JANUS_CONFLICT"
+	codeContentBlocked   errorCode = "JANUS_CONTENT_BLOCKED"
+	codeDownloadDisabled errorCode = "JANUS_DOWNLOAD_DISABLED"
+	codeFaultInjected    errorCode = "JANUS_FAULT_INJECTED"
+	codeInternal         errorCode = "JANUS_INTERNAL_ERROR"
+	codeInvalidShareLink errorCode = "JANUS_INVALID_SHARE_LINK"
+	codeLocked           errorCode = "JANUS_LOCKED"
+	codeLockMismatch     errorCode = "JANUS_LOCK_TOKEN_MISMATCH"
+	codeMaintenance      errorCode = "JANUS_MAINTENANCE"
+	codeMethodNotAllowed errorCode = "JANUS_METHOD_NOT_ALLOWED"
+	codeNotFound         errorCode = "JANUS_NOT_FOUND"
+	codeOffsetMismatch   errorCode = "JANUS_OFFSET_MISMATCH"
+	codePrecondition     errorCode = "JANUS_PRECONDITION_FAILED"
+	codePathEscape       errorCode = "JANUS_PATH_ESCAPE"
+	codeQuotaExceeded    errorCode = "JANUS_QUOTA_EXCEEDED"
+	codeRetained         errorCode = "JANUS_RETAINED"
+	codeShareLinkExpired errorCode = "JANUS_SHARE_LINK_EXPIRED"
+	codeTimeout          errorCode = "JANUS_TIMEOUT"
+	codeTooManyRequests  errorCode = "JANUS_TOO_MANY_REQUESTS"
+	codeUnavailable      errorCode = "JANUS_UNAVAILABLE"
+	codeUploadTooSlow    errorCode = "JANUS_UPLOAD_TOO_SLOW"
+	codeUpstream         errorCode = "JANUS_UPSTREAM_FAILED"
+	codeURITooLong       errorCode = "JANUS_URI_TOO_LONG"
+)
+
+// errorCodes maps errors to their codes. The first matching entry wins.
+var errorCodes = []struct {
+	err  error
+	code errorCode
+}{
+	{errPathEscape, codePathEscape},
+	{errDownloadDisabled, codeDownloadDisabled},
+	{errRetained, codeRetained},
+	{errQuotaExceeded, codeQuotaExceeded},
+	{errChecksumMismatch, codeChecksum},
+	{errContentBlocked, codeContentBlocked},
+	{errFaultInjected, codeFaultInjected},
+	{errInvalidShareLink, codeInvalidShareLink},
+	{errShareLinkExpired, codeShareLinkExpired},
+	{errLocked, codeLocked},
+	{errPreconditionFailed, codePrecondition},
+	{errRangeMismatch, codeOffsetMismatch},
+	{errLockTokenMismatch, codeLockMismatch},
+	{errMaintenance, codeMaintenance},
+	{errMethodNotAllowed, codeMethodNotAllowed},
+	{errTooManyRequests, codeTooManyRequests},
+	{errUploadTooSlow, codeUploadTooSlow},
+	{errURITooLong, codeURITooLong},
+	{errUpstream, codeUpstream},
+	{context.DeadlineExceeded, codeTimeout},
+	{errAccessDenied, codeAccessDenied},
+}
+
+// statusCodes maps HTTP status codes to error codes for errors without a specific code.
+var statusCodes = map[int]errorCode{
+	http.StatusBadRequest:         codeBadRequest,
+	http.StatusUnauthorized:       codeAuthRequired,
+	http.StatusForbidden:          codeAccessDenied,
+	http.StatusNotFound:           codeNotFound,
+	http.StatusMethodNotAllowed:   codeMethodNotAllowed,
+	http.StatusConflict:           codeConflict,
+	http.StatusServiceUnavailable: codeUnavailable,
+}
+
+// codeOf returns the error code for an error rendered with the given HTTP status code.
+// Missing credentials are always reported as JANUS_AUTHENTICATION_REQUIRED.
+func codeOf(err error, status int) errorCode {
+	if status == http.StatusUnauthorized {
+		return codeAuthRequired
+	}
+	for _, ec := range errorCodes {
+		if errors.Is(err, ec.err) {
+			return ec.code
+		}
+	}
+	if c, ok := statusCodes[status]; ok {
+		return c
+	}
+	return codeInternal
+}
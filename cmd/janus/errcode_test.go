@@ -0,0 +1,43 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"testing"
+
+	. "github.com/stretchr/testify/require"
+)
+
+func Test_codeOf(t *testing.T) {
+	Equal(t, codeAuthRequired, codeOf(errAccessDenied, http.StatusUnauthorized))
+	Equal(t, codeAccessDenied, codeOf(errAccessDenied, http.StatusForbidden))
+	Equal(t, codeRetained, codeOf(fmt.Errorf("upload: %w", errRetained), http.StatusForbidden))
+	Equal(t, codeTimeout, codeOf(context.DeadlineExceeded, http.StatusServiceUnavailable))
+	Equal(t, codePathEscape, codeOf(errPathEscape, http.StatusBadRequest))
+	Equal(t, codeFaultInjected, codeOf(errFaultInjected, http.StatusBadGateway))
+	Equal(t, codeTooManyRequests, codeOf(errRateLimited, http.StatusTooManyRequests))
+	Equal(t, codeQuotaExceeded, codeOf(errQuotaExceeded, http.StatusInsufficientStorage))
+	Equal(t, codeLocked, codeOf(errLocked, http.StatusLocked))
+	Equal(t, codePrecondition, codeOf(errPreconditionFailed, http.StatusPreconditionFailed))
+	Equal(t, codeContentBlocked, codeOf(errContentBlocked, http.StatusForbidden))
+	Equal(t, codeOffsetMismatch, codeOf(errRangeMismatch, http.StatusRequestedRangeNotSatisfiable))
+	Equal(t, codeNotFound, codeOf(nil, http.StatusNotFound))
+	Equal(t, codeBadRequest, codeOf(io.EOF, http.StatusBadRequest))
+	Equal(t, codeInternal, codeOf(io.EOF, http.StatusInternalServerError))
+}
@@ -0,0 +1,182 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// errFaultInjected indicates an error response caused by fault injection.
+var errFaultInjected = errors.New("fault injected")
+
+// faultStatuses are the status codes of injected error responses.
+var faultStatuses = []int{
+	http.StatusInternalServerError,
+	http.StatusBadGateway,
+	http.StatusServiceUnavailable,
+	http.StatusGatewayTimeout,
+}
+
+// faults injects latency, error responses, connection resets and truncated bodies into matching requests
+// for testing the behavior of clients.
+type faults struct {
+	latency      time.Duration
+	errorRate    float64
+	resetRate    float64
+	truncateRate float64
+	patterns     []string
+	prefix       string
+	rnd          func() float64
+}
+
+// newFaults creates faults according to the configuration.
+// If no fault is configured, nil is returned.
+func newFaults(a app) *faults {
+	if a.FaultLatency <= 0 && a.FaultErrorRate <= 0 && a.FaultResetRate <= 0 && a.FaultTruncateRate <= 0 {
+		return nil
+	}
+
+	var mu sync.Mutex
+	r := rand.New(rand.NewSource(time.Now().UnixNano())) //nolint:gosec // no security purpose
+	return &faults{
+		latency:      a.FaultLatency,
+		errorRate:    a.FaultErrorRate,
+		resetRate:    a.FaultResetRate,
+		truncateRate: a.FaultTruncateRate,
+		patterns:     a.FaultPaths,
+		prefix:       strings.TrimRight(a.Prefix, "/"),
+		rnd: func() float64 {
+			mu.Lock()
+			defer mu.Unlock()
+			return r.Float64()
+		},
+	}
+}
+
+// hit randomly decides whether a fault with the given rate occurs.
+func (f *faults) hit(rate float64) bool {
+	return rate > 0 && f.rnd() < rate
+}
+
+// injectFaults delays matching requests, and either resets the connection, responds with a random 5xx status code
+// or truncates the response body according to the configured rates.
+// If f is nil, h is returned as is.
+func injectFaults(f *faults, h http.Handler) http.Handler {
+	if f == nil {
+		return h
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(f.patterns) > 0 && !matchPath(f.patterns, strings.TrimPrefix(r.URL.Path, f.prefix)) {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		if f.latency > 0 {
+			t := time.NewTimer(f.latency)
+			select {
+			case <-t.C:
+			case <-r.Context().Done():
+				t.Stop()
+				return
+			}
+		}
+
+		l := log.Warn().Str("request-id", requestIDFrom(r.Context())).Str("path", r.URL.Path)
+		switch {
+		case f.hit(f.resetRate):
+			l.Str("fault", "reset").Msg("Fault injected")
+			resetConn(w)
+		case f.hit(f.errorRate):
+			status := faultStatuses[int(f.rnd()*float64(len(faultStatuses)))%len(faultStatuses)]
+			l.Str("fault", "error").Int("status", status).Msg("Fault injected")
+			renderError(w, r, errFaultInjected, "fault injected", status)
+		case f.hit(f.truncateRate):
+			tw := &truncatingWriter{ResponseWriter: w, limit: -1}
+			h.ServeHTTP(tw, r)
+			if !tw.truncated {
+				return
+			}
+			l.Str("fault", "truncate").Int64("size", tw.limit).Msg("Fault injected")
+			if w.Header().Get("Content-Length") == "" {
+				// the connection is closed before the final chunk, which marks the end of the body
+				if fl, ok := w.(http.Flusher); ok {
+					fl.Flush()
+				}
+				panic(http.ErrAbortHandler)
+			}
+			// otherwise, net/http closes the connection, because the body is shorter than announced
+		default:
+			h.ServeHTTP(w, r)
+		}
+	})
+}
+
+// resetConn closes the client connection without sending a response.
+// If possible, a TCP reset is sent instead of an orderly shutdown.
+func resetConn(w http.ResponseWriter) {
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		panic(http.ErrAbortHandler)
+	}
+	conn, _, err := hj.Hijack()
+	if err != nil {
+		panic(http.ErrAbortHandler)
+	}
+	if tc, ok := conn.(*net.TCPConn); ok {
+		_ = tc.SetLinger(0)
+	}
+	_ = conn.Close()
+}
+
+// truncatingWriter discards the second half of the response body.
+// If the length of the body is unknown, the second half of the first write is discarded.
+type truncatingWriter struct {
+	http.ResponseWriter
+	limit     int64
+	n         int64
+	truncated bool
+}
+
+func (w *truncatingWriter) Write(p []byte) (int, error) {
+	if w.limit < 0 {
+		if cl, err := strconv.ParseInt(w.Header().Get("Content-Length"), 10, 64); err == nil {
+			w.limit = cl / 2
+		} else {
+			w.limit = int64(len(p)) / 2
+		}
+	}
+	if w.n+int64(len(p)) <= w.limit {
+		w.n += int64(len(p))
+		return w.ResponseWriter.Write(p)
+	}
+
+	n, err := w.ResponseWriter.Write(p[:w.limit-w.n])
+	w.n += int64(n)
+	w.truncated = true
+	if err == nil {
+		err = errFaultInjected
+	}
+	return n, err
+}
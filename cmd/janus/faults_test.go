@@ -0,0 +1,116 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/stretchr/testify/require"
+)
+
+func Test_newFaults(t *testing.T) {
+	Nil(t, newFaults(app{}))
+	f := newFaults(app{FaultErrorRate: 0.5, FaultPaths: []string{"/releases/"}, Prefix: "/files/"})
+	Equal(t, 0.5, f.errorRate)
+	Equal(t, "/files", f.prefix)
+	v := f.rnd()
+	True(t, v >= 0 && v < 1)
+}
+
+func Test_faults_hit(t *testing.T) {
+	f := &faults{rnd: func() float64 { return 0.3 }}
+	False(t, f.hit(0))
+	False(t, f.hit(0.3))
+	True(t, f.hit(0.5))
+	True(t, f.hit(1))
+}
+
+func Test_injectFaults(t *testing.T) {
+	body := strings.Repeat("x", 1000)
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/chunked" {
+			_, _ = io.WriteString(w, body)
+			return
+		}
+		http.ServeContent(w, r, "", time.Time{}, strings.NewReader(body))
+	})
+	rec := httptest.NewRecorder()
+	injectFaults(nil, next).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	Equal(t, body, rec.Body.String())
+
+	f := &faults{patterns: []string{"/releases/"}, prefix: "/files", rnd: func() float64 { return 0 }}
+	srv := httptest.NewServer(injectFaults(f, next))
+	defer srv.Close()
+	get := func(p string) (*http.Response, string, error) {
+		res, err := http.Get(srv.URL + p)
+		if err != nil {
+			return nil, "", err
+		}
+		defer res.Body.Close()
+		b, err := io.ReadAll(res.Body)
+		return res, string(b), err
+	}
+
+	f.errorRate = 1
+	res, b, err := get("/files/docs/a.txt")
+	NoError(t, err)
+	Equal(t, http.StatusOK, res.StatusCode)
+	Equal(t, body, b)
+
+	res, _, err = get("/files/releases/a.txt")
+	NoError(t, err)
+	Equal(t, http.StatusInternalServerError, res.StatusCode)
+	Equal(t, string(codeFaultInjected), res.Header.Get("X-Janus-Error"))
+
+	f.errorRate, f.truncateRate = 0, 1
+	res, b, err = get("/files/releases/a.txt")
+	ErrorIs(t, err, io.ErrUnexpectedEOF)
+	Equal(t, http.StatusOK, res.StatusCode)
+	Equal(t, body[:500], b)
+
+	_, b, err = get("/files/releases/chunked")
+	Error(t, err)
+	Equal(t, body[:500], b)
+
+	f.truncateRate, f.resetRate = 0, 1
+	_, _, err = get("/files/releases/a.txt")
+	Error(t, err)
+
+	f.resetRate, f.latency = 0, 50*time.Millisecond
+	start := time.Now()
+	res, _, err = get("/files/releases/a.txt")
+	NoError(t, err)
+	Equal(t, http.StatusOK, res.StatusCode)
+	GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+}
+
+func Test_truncatingWriter_Write(t *testing.T) {
+	rec := httptest.NewRecorder()
+	rec.Header().Set("Content-Length", "10")
+	w := &truncatingWriter{ResponseWriter: rec, limit: -1}
+	n, err := w.Write([]byte("abc"))
+	NoError(t, err)
+	Equal(t, 3, n)
+	n, err = w.Write([]byte("defg"))
+	ErrorIs(t, err, errFaultInjected)
+	Equal(t, 2, n)
+	True(t, w.truncated)
+	Equal(t, "abcde", rec.Body.String())
+}
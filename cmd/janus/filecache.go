@@ -0,0 +1,109 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"expvar"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// fileCacheStats exposes the effectiveness of the file cache.
+var fileCacheStats = expvar.NewMap("file_cache")
+
+// cachedFile holds the content of a file along with precomputed headers.
+type cachedFile struct {
+	modTime     time.Time
+	data        []byte
+	etag        string
+	contentType string
+}
+
+// fileCache keeps small, frequently requested files in memory.
+// An entry is considered stale as soon as the size or modification time of the file changes.
+type fileCache struct {
+	lru     *lru[string, cachedFile]
+	maxFile int64
+}
+
+// newFileCache creates a cache holding files of at most maxFile bytes, up to a total of maxSize bytes.
+// If maxSize is not positive, caching is disabled and nil is returned.
+func newFileCache(maxSize, maxFile int64) *fileCache {
+	if maxSize <= 0 {
+		return nil
+	}
+	cost := func(f cachedFile) int64 { return int64(len(f.data)) }
+	return &fileCache{lru: newLRU[string, cachedFile](maxSize, cost), maxFile: maxFile}
+}
+
+// serveFile serves the named file from memory and reports whether it was cacheable.
+// If false is returned, nothing has been written and the request has to be handled elsewhere.
+func (c *fileCache) serveFile(w http.ResponseWriter, r *http.Request, name string) bool {
+	if strings.HasSuffix(r.URL.Path, "/index.html") {
+		// let http.ServeFile redirect to the directory
+		return false
+	}
+
+	fi, err := statFS(r.Context(), name)
+	if err != nil || !fi.Mode().IsRegular() || fi.Size() > c.maxFile {
+		return false
+	}
+
+	f, ok := c.lru.Get(name)
+	if ok && f.modTime.Equal(fi.ModTime()) && int64(len(f.data)) == fi.Size() {
+		fileCacheStats.Add("hits", 1)
+	} else {
+		fileCacheStats.Add("misses", 1)
+		if f, err = loadFile(name, fi); err != nil {
+			c.lru.Remove(name)
+			return false
+		}
+		c.lru.Add(name, f)
+	}
+
+	if f.contentType != "" {
+		w.Header().Set("Content-Type", f.contentType)
+	}
+	w.Header().Set("ETag", f.etag)
+	http.ServeContent(w, r, "", f.modTime, bytes.NewReader(f.data))
+	return true
+}
+
+// loadFile reads the named file and precomputes its headers.
+func loadFile(name string, fi os.FileInfo) (cachedFile, error) {
+	d, err := os.ReadFile(name)
+	if err != nil {
+		return cachedFile{}, err
+	}
+
+	sum := sha256.Sum256(d)
+	ct := mime.TypeByExtension(filepath.Ext(name))
+	if ct == "" {
+		ct = http.DetectContentType(d)
+	}
+	return cachedFile{fi.ModTime(), d, hashETag(sum[:]), ct}, nil
+}
+
+// hashETag returns the entity tag of a file with the given SHA-256 digest.
+func hashETag(sum []byte) string {
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
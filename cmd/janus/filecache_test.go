@@ -0,0 +1,63 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/stretchr/testify/require"
+)
+
+func Test_fileCache_serveFile(t *testing.T) {
+	d := t.TempDir()
+	p := filepath.Join(d, "a.txt")
+	NoError(t, os.WriteFile(p, []byte("hello"), 0600))
+
+	c := newFileCache(1024, 16)
+	w := httptest.NewRecorder()
+	True(t, c.serveFile(w, httptest.NewRequest(http.MethodGet, "/a.txt", nil), p))
+	Equal(t, "hello", w.Body.String())
+	Equal(t, "text/plain; charset=utf-8", w.Header().Get("Content-Type"))
+	etag := w.Header().Get("ETag")
+	NotEmpty(t, etag)
+
+	r := httptest.NewRequest(http.MethodGet, "/a.txt", nil)
+	r.Header.Set("If-None-Match", etag)
+	w = httptest.NewRecorder()
+	True(t, c.serveFile(w, r, p))
+	Equal(t, http.StatusNotModified, w.Code)
+
+	NoError(t, os.WriteFile(p, []byte("changed"), 0600))
+	NoError(t, os.Chtimes(p, time.Now(), time.Now().Add(time.Minute)))
+	w = httptest.NewRecorder()
+	True(t, c.serveFile(w, httptest.NewRequest(http.MethodGet, "/a.txt", nil), p))
+	Equal(t, "changed", w.Body.String())
+}
+
+func Test_fileCache_serveFile_NotCacheable(t *testing.T) {
+	d := t.TempDir()
+	p := filepath.Join(d, "large.bin")
+	NoError(t, os.WriteFile(p, make([]byte, 32), 0600))
+
+	c := newFileCache(1024, 16)
+	False(t, c.serveFile(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/large.bin", nil), p))
+	False(t, c.serveFile(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil), d))
+	Nil(t, newFileCache(0, 16))
+}
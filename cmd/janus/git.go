@@ -0,0 +1,272 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// gitPath matches the files of a bare Git repository, which are fetched by dumb HTTP clients.
+// The first group is the path of the repository, the second one the file within the repository.
+var gitPath = regexp.MustCompile(`^(.*)/(HEAD|info/refs|objects/info/(?:packs|alternates|http-alternates)|` +
+	`objects/[0-9a-f]{2}/[0-9a-f]{38,62}|objects/pack/pack-[0-9a-f]{40,64}\.(?:pack|idx))$`)
+
+// gitMu serializes the updates of the auxiliary files of all repositories.
+var gitMu sync.Mutex
+
+// serveGit serves bare Git repositories over the dumb HTTP protocol.
+// info/refs and objects/info/packs are generated from the repository, unless updateServerInfo is set.
+// In this case, "git update-server-info" is run whenever the refs or packs are newer than info/refs.
+// If git mode is disabled, h is returned as is.
+func serveGit(a app, h http.Handler) http.Handler {
+	if !a.Git {
+		return h
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m := gitPath.FindStringSubmatch(r.URL.Path)
+		repo := ""
+		if m != nil {
+			repo = path.Join(rootDir(a, r), m[1])
+		}
+		if (r.Method != http.MethodGet && r.Method != http.MethodHead) || m == nil || !isBareRepo(repo) {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		file := m[2]
+		gen := map[string]func(string) ([]byte, error){"info/refs": infoRefs, "objects/info/packs": infoPacks}[file]
+		if gen != nil && a.GitUpdateServerInfo {
+			if err := updateServerInfo(repo); err != nil {
+				renderError(w, r, err, "cannot update server info", http.StatusInternalServerError)
+				return
+			}
+		} else if gen != nil {
+			b, err := gen(repo)
+			if err != nil {
+				renderError(w, r, err, "cannot read repository", http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("Content-Type", gitContentType(file))
+			w.Header().Set("Cache-Control", "no-cache")
+			http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(b))
+			return
+		}
+
+		w.Header().Set("Content-Type", gitContentType(file))
+		if strings.HasPrefix(file, "objects/") && !strings.HasPrefix(file, "objects/info/") {
+			// objects are immutable, since they are named after their content
+			w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+		} else {
+			w.Header().Set("Cache-Control", "no-cache")
+		}
+		http.ServeFile(w, r, filepath.Join(repo, filepath.FromSlash(file)))
+	})
+}
+
+// isBareRepo reports whether dir looks like a bare Git repository.
+func isBareRepo(dir string) bool {
+	for _, name := range []string{"HEAD", "objects", "refs"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// gitContentType returns the media type of a repository file as sent by git-http-backend.
+func gitContentType(file string) string {
+	switch {
+	case strings.HasSuffix(file, ".pack"):
+		return "application/x-git-packed-objects"
+	case strings.HasSuffix(file, ".idx"):
+		return "application/x-git-packed-objects-toc"
+	case strings.HasPrefix(file, "objects/") && !strings.HasPrefix(file, "objects/info/"):
+		return "application/x-git-loose-object"
+	default:
+		return "text/plain; charset=utf-8"
+	}
+}
+
+// infoRefs generates the content of info/refs just like "git update-server-info".
+// Every ref is listed with its object name, annotated tags are followed by the peeled object.
+func infoRefs(repo string) ([]byte, error) {
+	refs, peeled, err := readRefs(repo)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(refs))
+	for name := range refs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	b := &bytes.Buffer{}
+	for _, name := range names {
+		_, _ = fmt.Fprintf(b, "%s\t%s\n", refs[name], name)
+		if p, ok := peeled[name]; ok {
+			_, _ = fmt.Fprintf(b, "%s\t%s^{}\n", p, name)
+		} else if !strings.HasPrefix(name, "refs/tags/") {
+			continue
+		} else if p, ok := peelLooseTag(repo, refs[name]); ok {
+			_, _ = fmt.Fprintf(b, "%s\t%s^{}\n", p, name)
+		}
+	}
+	return b.Bytes(), nil
+}
+
+// readRefs reads the packed refs and the loose refs, which take precedence.
+// Symbolic refs are skipped. Peeled object names are only known for packed tags.
+func readRefs(repo string) (refs, peeled map[string]string, err error) {
+	refs, peeled = map[string]string{}, map[string]string{}
+	if f, err := os.Open(filepath.Join(repo, "packed-refs")); err == nil {
+		defer f.Close()
+		s, last := bufio.NewScanner(f), ""
+		for s.Scan() {
+			line := s.Text()
+			if strings.HasPrefix(line, "^") && last != "" {
+				peeled[last] = line[1:]
+			} else if oid, name, ok := strings.Cut(line, " "); ok && !strings.HasPrefix(line, "#") {
+				refs[name], last = oid, name
+			}
+		}
+		if err := s.Err(); err != nil {
+			return nil, nil, err
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, nil, err
+	}
+
+	err = filepath.WalkDir(filepath.Join(repo, "refs"), func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		b, err := os.ReadFile(filepath.Clean(p))
+		if err != nil {
+			return err
+		}
+		oid := strings.TrimSpace(string(b))
+		if strings.HasPrefix(oid, "ref: ") {
+			return nil
+		}
+		rel, err := filepath.Rel(repo, p)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(rel)
+		if refs[name] != oid {
+			delete(peeled, name)
+		}
+		refs[name] = oid
+		return nil
+	})
+	return refs, peeled, err
+}
+
+// peelLooseTag returns the object an annotated tag points to, if the tag is a loose object.
+// Tags pointing to tags are peeled until a different kind of object is found.
+func peelLooseTag(repo, oid string) (string, bool) {
+	peeled := false
+	for i := 0; i < 10 && len(oid) > 2; i++ {
+		f, err := os.Open(filepath.Join(repo, "objects", oid[:2], oid[2:]))
+		if err != nil {
+			return oid, peeled
+		}
+		zr, err := zlib.NewReader(f)
+		if err != nil {
+			_ = f.Close()
+			return oid, peeled
+		}
+		br := bufio.NewReader(io.LimitReader(zr, 4096))
+		hdr, _ := br.ReadString(0)
+		line, _ := br.ReadString('\n')
+		_ = zr.Close()
+		_ = f.Close()
+
+		target := strings.TrimPrefix(strings.TrimSpace(line), "object ")
+		if !strings.HasPrefix(hdr, "tag ") || target == strings.TrimSpace(line) {
+			return oid, peeled
+		}
+		oid, peeled = target, true
+	}
+	return oid, peeled
+}
+
+// infoPacks generates the content of objects/info/packs, which lists all packs of the repository.
+func infoPacks(repo string) ([]byte, error) {
+	packs, err := filepath.Glob(filepath.Join(repo, "objects", "pack", "pack-*.pack"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(packs)
+
+	b := &bytes.Buffer{}
+	for _, p := range packs {
+		_, _ = fmt.Fprintf(b, "P %s\n", filepath.Base(p))
+	}
+	b.WriteString("\n")
+	return b.Bytes(), nil
+}
+
+// updateServerInfo runs "git update-server-info" in the repository,
+// if a ref or pack has changed since info/refs was last written.
+func updateServerInfo(repo string) error {
+	gitMu.Lock()
+	defer gitMu.Unlock()
+
+	fi, err := os.Stat(filepath.Join(repo, "info", "refs"))
+	if err == nil && !changedSince(repo, fi.ModTime()) {
+		return nil
+	}
+	cmd := exec.Command("git", "update-server-info")
+	cmd.Dir = repo
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("git update-server-info: %w: %s", err, bytes.TrimSpace(out))
+	}
+	return nil
+}
+
+// changedSince reports whether packed-refs, a loose ref or the packs were modified after t.
+func changedSince(repo string, t time.Time) bool {
+	for _, name := range []string{"packed-refs", filepath.Join("objects", "pack")} {
+		if fi, err := os.Stat(filepath.Join(repo, name)); err == nil && fi.ModTime().After(t) {
+			return true
+		}
+	}
+	changed := false
+	_ = filepath.WalkDir(filepath.Join(repo, "refs"), func(p string, d fs.DirEntry, err error) error {
+		if fi, err := d.Info(); err == nil && fi.ModTime().After(t) {
+			changed = true
+		}
+		return nil
+	})
+	return changed
+}
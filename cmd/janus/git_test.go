@@ -0,0 +1,149 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"compress/zlib"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/stretchr/testify/require"
+)
+
+const (
+	commitOID = "1111111111111111111111111111111111111111"
+	tagOID    = "2222222222222222222222222222222222222222"
+	packedOID = "3333333333333333333333333333333333333333"
+	packName  = "pack-4444444444444444444444444444444444444444"
+)
+
+// writeBareRepo creates a minimal bare repository with loose and packed refs, an annotated tag and a pack.
+func writeBareRepo(t *testing.T, dir string) {
+	t.Helper()
+	for _, d := range []string{"refs/heads", "refs/tags", "objects/pack", "objects/22"} {
+		NoError(t, os.MkdirAll(filepath.Join(dir, d), 0700))
+	}
+
+	tag := &bytes.Buffer{}
+	zw := zlib.NewWriter(tag)
+	_, _ = zw.Write([]byte("tag 60\x00object " + commitOID + "\ntype commit\ntag v1\n"))
+	NoError(t, zw.Close())
+
+	for name, content := range map[string]string{
+		"HEAD":                               "ref: refs/heads/main\n",
+		"refs/heads/main":                    commitOID + "\n",
+		"refs/tags/v1":                       tagOID + "\n",
+		"packed-refs":                        "# pack-refs with: peeled fully-peeled sorted\n" + packedOID + " refs/tags/v0\n^" + commitOID + "\n",
+		"objects/22/" + tagOID[2:]:           tag.String(),
+		"objects/pack/" + packName + ".pack": "PACK",
+		"objects/pack/" + packName + ".idx":  "IDX",
+	} {
+		NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0600))
+	}
+}
+
+func Test_infoRefs(t *testing.T) {
+	d := t.TempDir()
+	writeBareRepo(t, d)
+
+	b, err := infoRefs(d)
+	NoError(t, err)
+	Equal(t, commitOID+"\trefs/heads/main\n"+
+		packedOID+"\trefs/tags/v0\n"+commitOID+"\trefs/tags/v0^{}\n"+
+		tagOID+"\trefs/tags/v1\n"+commitOID+"\trefs/tags/v1^{}\n", string(b))
+
+	// loose refs take precedence over packed ones
+	NoError(t, os.WriteFile(filepath.Join(d, "refs", "tags", "v0"), []byte(commitOID), 0600))
+	b, err = infoRefs(d)
+	NoError(t, err)
+	Contains(t, string(b), commitOID+"\trefs/tags/v0\n")
+	NotContains(t, string(b), "refs/tags/v0^{}")
+}
+
+func Test_infoPacks(t *testing.T) {
+	d := t.TempDir()
+	writeBareRepo(t, d)
+
+	b, err := infoPacks(d)
+	NoError(t, err)
+	Equal(t, "P "+packName+".pack\n\n", string(b))
+}
+
+func Test_gitContentType(t *testing.T) {
+	Equal(t, "text/plain; charset=utf-8", gitContentType("info/refs"))
+	Equal(t, "text/plain; charset=utf-8", gitContentType("objects/info/packs"))
+	Equal(t, "application/x-git-loose-object", gitContentType("objects/22/"+tagOID[2:]))
+	Equal(t, "application/x-git-packed-objects", gitContentType("objects/pack/"+packName+".pack"))
+	Equal(t, "application/x-git-packed-objects-toc", gitContentType("objects/pack/"+packName+".idx"))
+}
+
+func Test_serveGit(t *testing.T) {
+	d := t.TempDir()
+	writeBareRepo(t, filepath.Join(d, "repos", "p.git"))
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusTeapot) })
+	h := serveGit(app{ServerRoot: d, Git: true}, next)
+
+	serve := func(method, p string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(method, p, nil))
+		return w
+	}
+
+	w := serve(http.MethodGet, "/repos/p.git/info/refs?service=git-upload-pack")
+	Equal(t, http.StatusOK, w.Code)
+	Equal(t, "text/plain; charset=utf-8", w.Header().Get("Content-Type"))
+	True(t, strings.HasPrefix(w.Body.String(), commitOID+"\trefs/heads/main\n"))
+
+	w = serve(http.MethodGet, "/repos/p.git/objects/pack/"+packName+".pack")
+	Equal(t, http.StatusOK, w.Code)
+	Equal(t, "application/x-git-packed-objects", w.Header().Get("Content-Type"))
+	Contains(t, w.Header().Get("Cache-Control"), "immutable")
+	Equal(t, "PACK", w.Body.String())
+
+	w = serve(http.MethodGet, "/repos/p.git/HEAD")
+	Equal(t, "ref: refs/heads/main\n", w.Body.String())
+
+	Equal(t, http.StatusTeapot, serve(http.MethodGet, "/repos/p.git/").Code)
+	Equal(t, http.StatusTeapot, serve(http.MethodGet, "/repos/info/refs").Code)
+	Equal(t, http.StatusTeapot, serve(http.MethodPost, "/repos/p.git/info/refs").Code)
+
+	w = httptest.NewRecorder()
+	serveGit(app{ServerRoot: d}, next).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/repos/p.git/info/refs", nil))
+	Equal(t, http.StatusTeapot, w.Code)
+}
+
+func Test_updateServerInfo(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	d := t.TempDir()
+	NoError(t, exec.Command("git", "init", "-q", "--bare", d).Run())
+
+	NoError(t, updateServerInfo(d))
+	fi, err := os.Stat(filepath.Join(d, "info", "refs"))
+	NoError(t, err)
+	False(t, changedSince(d, fi.ModTime()))
+
+	later := time.Now().Add(time.Minute)
+	NoError(t, os.Chtimes(filepath.Join(d, "refs", "heads"), later, later))
+	True(t, changedSince(d, fi.ModTime()))
+}
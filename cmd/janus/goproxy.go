@@ -0,0 +1,207 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/semver"
+)
+
+// goProxyPath matches requests of the GOPROXY protocol.
+// The first group is the escaped module path, the second one the file below "@v" or "@latest".
+var goProxyPath = regexp.MustCompile(`^/(.+)/(@v/list|@v/[^/]+\.(?:info|mod|zip)|@latest)$`)
+
+// errModuleNotFound indicates that a module or version is not available.
+var errModuleNotFound = errors.New("module not found")
+
+// moduleInfo is the JSON representation of a module version as defined by the GOPROXY protocol.
+type moduleInfo struct {
+	Version string
+	Time    time.Time
+}
+
+// serveGoProxy serves the server root as Go module proxy.
+// Module versions are stored as "<module>/@v/<version>.zip" with escaped module paths and versions.
+// The list of versions, .info and .mod files are generated from the zip files, unless they exist.
+// If the proxy mode is disabled, h is returned as is.
+func serveGoProxy(a app, h http.Handler) http.Handler {
+	if !a.GoProxy {
+		return h
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m := goProxyPath.FindStringSubmatch(r.URL.Path)
+		if (r.Method != http.MethodGet && r.Method != http.MethodHead) || m == nil {
+			h.ServeHTTP(w, r)
+			return
+		}
+		mod, err := module.UnescapePath(m[1])
+		if err != nil {
+			renderError(w, r, err, "invalid module path", http.StatusBadRequest)
+			return
+		}
+
+		dir := filepath.Join(rootDir(a, r), filepath.FromSlash(m[1]), "@v")
+		if p := filepath.Join(dir, "..", filepath.FromSlash(m[2])); exists(p) {
+			w.Header().Set("Content-Type", goProxyContentType(p))
+			http.ServeFile(w, r, p)
+			return
+		}
+
+		release, ok := a.pools.acquire(w, r, poolMetadata)
+		if !ok {
+			return
+		}
+		defer release()
+
+		var b []byte
+		switch file := strings.TrimPrefix(m[2], "@v/"); {
+		case file == "list":
+			var vs []string
+			if vs, err = moduleVersions(dir); err == nil && len(vs) > 0 {
+				b = []byte(strings.Join(vs, "\n") + "\n")
+			}
+		case file == "@latest":
+			b, err = latestInfo(dir)
+		case strings.HasSuffix(file, ".info"):
+			b, err = versionInfo(dir, strings.TrimSuffix(file, ".info"))
+		case strings.HasSuffix(file, ".mod"):
+			b, err = goMod(dir, mod, strings.TrimSuffix(file, ".mod"))
+		default:
+			err = errModuleNotFound
+		}
+
+		if errors.Is(err, errModuleNotFound) || os.IsNotExist(err) {
+			renderError(w, r, err, "module version not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			renderError(w, r, err, "cannot read module", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", goProxyContentType(m[2]))
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(b))
+	})
+}
+
+// goProxyContentType returns the media type of a file of the GOPROXY protocol.
+func goProxyContentType(name string) string {
+	switch {
+	case strings.HasSuffix(name, ".zip"):
+		return "application/zip"
+	case strings.HasSuffix(name, ".info"), strings.HasSuffix(name, "@latest"):
+		return "application/json"
+	default:
+		return "text/plain; charset=utf-8"
+	}
+}
+
+// moduleVersions returns the release and pre-release versions of all module zip files in dir in semver order.
+// Pseudo-versions are omitted just like with proxy.golang.org.
+func moduleVersions(dir string) ([]string, error) {
+	if _, err := os.Stat(dir); err != nil {
+		return nil, err
+	}
+	names, err := filepath.Glob(filepath.Join(dir, "*.zip"))
+	if err != nil {
+		return nil, err
+	}
+
+	var vs []string
+	for _, name := range names {
+		v, err := module.UnescapeVersion(strings.TrimSuffix(filepath.Base(name), ".zip"))
+		if err == nil && semver.IsValid(v) && !module.IsPseudoVersion(v) {
+			vs = append(vs, v)
+		}
+	}
+	sort.Slice(vs, func(i, j int) bool { return semver.Compare(vs[i], vs[j]) < 0 })
+	return vs, nil
+}
+
+// versionInfo generates the .info file of a module version, taking the modification time of its zip file.
+func versionInfo(dir, escVersion string) ([]byte, error) {
+	v, err := module.UnescapeVersion(escVersion)
+	if err != nil {
+		return nil, errModuleNotFound
+	}
+	fi, err := os.Stat(filepath.Join(dir, escVersion+".zip"))
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(moduleInfo{Version: v, Time: fi.ModTime().UTC()})
+}
+
+// latestInfo generates the .info file of the latest version, preferring releases over pre-releases.
+func latestInfo(dir string) ([]byte, error) {
+	vs, err := moduleVersions(dir)
+	if err != nil {
+		return nil, err
+	} else if len(vs) == 0 {
+		return nil, errModuleNotFound
+	}
+
+	latest := vs[len(vs)-1]
+	for i := len(vs) - 1; i >= 0; i-- {
+		if semver.Prerelease(vs[i]) == "" {
+			latest = vs[i]
+			break
+		}
+	}
+	v, err := module.EscapeVersion(latest)
+	if err != nil {
+		return nil, err
+	}
+	return versionInfo(dir, v)
+}
+
+// goMod extracts the go.mod file of a module version from its zip file.
+// Modules without go.mod file get a synthesized one, which only declares the module path.
+func goMod(dir, mod, escVersion string) ([]byte, error) {
+	v, err := module.UnescapeVersion(escVersion)
+	if err != nil {
+		return nil, errModuleNotFound
+	}
+	zr, err := zip.OpenReader(filepath.Join(dir, escVersion+".zip"))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+
+	name := mod + "@" + v + "/go.mod"
+	for _, f := range zr.File {
+		if f.Name != name {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer rc.Close()
+		return io.ReadAll(io.LimitReader(rc, 16<<20))
+	}
+	return []byte("module " + mod + "\n"), nil
+}
@@ -0,0 +1,139 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/stretchr/testify/require"
+)
+
+// writeModuleZip creates the zip file of a module version in the GOPROXY layout below root.
+func writeModuleZip(t *testing.T, root, escPath, mod, version, goMod string) {
+	t.Helper()
+	dir := filepath.Join(root, filepath.FromSlash(escPath), "@v")
+	NoError(t, os.MkdirAll(dir, 0700))
+	f, err := os.Create(filepath.Join(dir, version+".zip"))
+	NoError(t, err)
+	zw := zip.NewWriter(f)
+	files := map[string]string{"lib.go": "package lib\n"}
+	if goMod != "" {
+		files["go.mod"] = goMod
+	}
+	for name, content := range files {
+		w, err := zw.Create(mod + "@" + version + "/" + name)
+		NoError(t, err)
+		_, err = w.Write([]byte(content))
+		NoError(t, err)
+	}
+	NoError(t, zw.Close())
+	NoError(t, f.Close())
+}
+
+func Test_moduleVersions(t *testing.T) {
+	d := t.TempDir()
+	for _, v := range []string{"v1.10.0", "v1.2.0", "v2.0.0-rc.1", "v0.0.0-20220101000000-abcdefabcdef", "invalid"} {
+		writeModuleZip(t, d, "example.com/lib", "example.com/lib", v, "")
+	}
+
+	vs, err := moduleVersions(filepath.Join(d, "example.com", "lib", "@v"))
+	NoError(t, err)
+	Equal(t, []string{"v1.2.0", "v1.10.0", "v2.0.0-rc.1"}, vs)
+
+	_, err = moduleVersions(filepath.Join(d, "missing", "@v"))
+	True(t, os.IsNotExist(err))
+}
+
+func Test_latestInfo(t *testing.T) {
+	d := t.TempDir()
+	dir := filepath.Join(d, "example.com", "lib", "@v")
+	writeModuleZip(t, d, "example.com/lib", "example.com/lib", "v1.0.0-beta", "")
+
+	b, err := latestInfo(dir)
+	NoError(t, err)
+	info := moduleInfo{}
+	NoError(t, json.Unmarshal(b, &info))
+	Equal(t, "v1.0.0-beta", info.Version)
+
+	writeModuleZip(t, d, "example.com/lib", "example.com/lib", "v0.9.0", "")
+	b, err = latestInfo(dir)
+	NoError(t, err)
+	NoError(t, json.Unmarshal(b, &info))
+	Equal(t, "v0.9.0", info.Version)
+}
+
+func Test_goMod(t *testing.T) {
+	d := t.TempDir()
+	writeModuleZip(t, d, "github.com/!acme/lib", "github.com/Acme/lib", "v1.0.0", "module github.com/Acme/lib\n\ngo 1.19\n")
+	writeModuleZip(t, d, "github.com/!acme/lib", "github.com/Acme/lib", "v0.1.0", "")
+	dir := filepath.Join(d, "github.com", "!acme", "lib", "@v")
+
+	b, err := goMod(dir, "github.com/Acme/lib", "v1.0.0")
+	NoError(t, err)
+	Equal(t, "module github.com/Acme/lib\n\ngo 1.19\n", string(b))
+
+	b, err = goMod(dir, "github.com/Acme/lib", "v0.1.0")
+	NoError(t, err)
+	Equal(t, "module github.com/Acme/lib\n", string(b))
+
+	_, err = goMod(dir, "github.com/Acme/lib", "v2.0.0")
+	True(t, os.IsNotExist(err))
+}
+
+func Test_serveGoProxy(t *testing.T) {
+	d := t.TempDir()
+	writeModuleZip(t, d, "github.com/!acme/lib", "github.com/Acme/lib", "v1.0.0", "module github.com/Acme/lib\n")
+	writeModuleZip(t, d, "github.com/!acme/lib", "github.com/Acme/lib", "v1.1.0", "module github.com/Acme/lib\n")
+	NoError(t, os.WriteFile(filepath.Join(d, "github.com", "!acme", "lib", "@v", "v1.0.0.info"),
+		[]byte(`{"Version":"v1.0.0","Time":"2022-01-01T00:00:00Z"}`), 0600))
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusTeapot) })
+	h := serveGoProxy(app{ServerRoot: d, GoProxy: true}, next)
+	serve := func(p string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, p, nil))
+		return w
+	}
+
+	w := serve("/github.com/!acme/lib/@v/list")
+	Equal(t, http.StatusOK, w.Code)
+	Equal(t, "v1.0.0\nv1.1.0\n", w.Body.String())
+
+	w = serve("/github.com/!acme/lib/@v/v1.0.0.info")
+	Equal(t, "application/json", w.Header().Get("Content-Type"))
+	JSONEq(t, `{"Version":"v1.0.0","Time":"2022-01-01T00:00:00Z"}`, w.Body.String())
+
+	w = serve("/github.com/!acme/lib/@latest")
+	Equal(t, http.StatusOK, w.Code)
+	Contains(t, w.Body.String(), `"Version":"v1.1.0"`)
+
+	w = serve("/github.com/!acme/lib/@v/v1.1.0.mod")
+	Equal(t, "module github.com/Acme/lib\n", w.Body.String())
+
+	w = serve("/github.com/!acme/lib/@v/v1.1.0.zip")
+	Equal(t, http.StatusOK, w.Code)
+	Equal(t, "application/zip", w.Header().Get("Content-Type"))
+
+	Equal(t, http.StatusNotFound, serve("/github.com/!acme/lib/@v/v2.0.0.info").Code)
+	Equal(t, http.StatusNotFound, serve("/github.com/!acme/other/@v/list").Code)
+	Equal(t, http.StatusBadRequest, serve("/github.com/Acme/lib/@v/list").Code)
+	Equal(t, http.StatusTeapot, serve("/github.com/!acme/lib/").Code)
+}
@@ -0,0 +1,172 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"expvar"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+)
+
+// handleCacheStats exposes the effectiveness of the handle cache.
+var handleCacheStats = expvar.NewMap("handle_cache")
+
+// errNegativeOffset indicates an attempt to seek before the start of a file.
+var errNegativeOffset = errors.New("negative offset")
+
+// openFile is a file kept open for serving range requests.
+// It is closed as soon as it was evicted from the cache and no request reads it anymore.
+type openFile struct {
+	mu      sync.Mutex
+	f       *os.File
+	fi      os.FileInfo
+	refs    int
+	evicted bool
+}
+
+// acquire marks the file as being read and reports whether it is still open.
+func (of *openFile) acquire() bool {
+	of.mu.Lock()
+	defer of.mu.Unlock()
+	if of.evicted {
+		return false
+	}
+	of.refs++
+	return true
+}
+
+// release marks the file as no longer being read by a request.
+func (of *openFile) release() {
+	of.mu.Lock()
+	defer of.mu.Unlock()
+	if of.refs--; of.refs == 0 && of.evicted {
+		_ = of.f.Close()
+	}
+}
+
+// evict closes the file, once it is no longer being read.
+func (of *openFile) evict() {
+	of.mu.Lock()
+	defer of.mu.Unlock()
+	of.evicted = true
+	if of.refs == 0 {
+		_ = of.f.Close()
+	}
+}
+
+// handleCache keeps large files open, which receive many range requests e.g., from video players or download
+// accelerators. Concurrent requests share a single handle and read it at their offsets, which saves repeated open
+// and seek calls, especially on network filesystems.
+// A handle is replaced as soon as the size or modification time of the file changes.
+type handleCache struct {
+	lru       *lru[string, *openFile]
+	minSize   int64
+	readahead int
+}
+
+// newHandleCache creates a cache holding at most max handles of files having at least minSize bytes.
+// Each request reads readahead bytes at once (unless it is zero).
+// If max is not positive, caching is disabled and nil is returned.
+func newHandleCache(max int, minSize int64, readahead int) *handleCache {
+	if max <= 0 {
+		return nil
+	}
+	c := &handleCache{lru: newLRU[string, *openFile](int64(max), nil), minSize: minSize, readahead: readahead}
+	c.lru.evicted = func(_ string, of *openFile) {
+		handleCacheStats.Add("open", -1)
+		of.evict()
+	}
+	return c
+}
+
+// serveFile serves a range request for the named file from a cached handle and reports whether it was cacheable.
+// If false is returned, nothing has been written and the request has to be handled elsewhere.
+func (c *handleCache) serveFile(w http.ResponseWriter, r *http.Request, name string) bool {
+	if r.Header.Get("Range") == "" || (r.Method != http.MethodGet && r.Method != http.MethodHead) {
+		return false
+	}
+	fi, err := statFS(r.Context(), name)
+	if err != nil || !fi.Mode().IsRegular() || fi.Size() < c.minSize {
+		return false
+	}
+
+	of, ok := c.lru.Get(name)
+	if ok && os.SameFile(of.fi, fi) && of.fi.ModTime().Equal(fi.ModTime()) && of.fi.Size() == fi.Size() && of.acquire() {
+		handleCacheStats.Add("hits", 1)
+	} else {
+		handleCacheStats.Add("misses", 1)
+		f, err := openFS(r.Context(), name)
+		if err != nil {
+			return false
+		}
+		of = &openFile{f: f, fi: fi, refs: 1}
+		handleCacheStats.Add("open", 1)
+		c.lru.Add(name, of)
+	}
+	defer of.release()
+
+	var rs io.ReadSeeker = io.NewSectionReader(of.f, 0, fi.Size())
+	if c.readahead > 0 {
+		rs = &readaheadReader{r: of.f, size: fi.Size(), buf: make([]byte, c.readahead)}
+	}
+	w.Header().Set("ETag", fileETag(fi))
+	http.ServeContent(w, r, fi.Name(), fi.ModTime(), rs)
+	return true
+}
+
+// readaheadReader reads a file at the current offset in chunks of the buffer size, so that network filesystems
+// receive fewer, but larger reads. It does not change the offset of the file, hence the file can be shared.
+type readaheadReader struct {
+	r    io.ReaderAt
+	size int64
+	off  int64
+	buf  []byte
+	// start is the offset of the buffered data, and n is its length.
+	start int64
+	n     int
+}
+
+func (ra *readaheadReader) Read(p []byte) (int, error) {
+	if ra.off >= ra.size {
+		return 0, io.EOF
+	}
+	if ra.off < ra.start || ra.off >= ra.start+int64(ra.n) {
+		n, err := ra.r.ReadAt(ra.buf, ra.off)
+		if n == 0 && err != nil {
+			return 0, err
+		}
+		ra.start, ra.n = ra.off, n
+	}
+	n := copy(p, ra.buf[ra.off-ra.start:ra.n])
+	ra.off += int64(n)
+	return n, nil
+}
+
+func (ra *readaheadReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += ra.off
+	case io.SeekEnd:
+		offset += ra.size
+	}
+	if offset < 0 {
+		return 0, errNegativeOffset
+	}
+	ra.off = offset
+	return offset, nil
+}
@@ -0,0 +1,95 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/stretchr/testify/require"
+)
+
+func Test_handleCache_serveFile(t *testing.T) {
+	d := t.TempDir()
+	p := filepath.Join(d, "movie.mp4")
+	NoError(t, os.WriteFile(p, []byte("0123456789abcdef"), 0600))
+
+	c := newHandleCache(1, 8, 4)
+	get := func(rng string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/movie.mp4", nil)
+		if rng != "" {
+			r.Header.Set("Range", rng)
+		}
+		w := httptest.NewRecorder()
+		if !c.serveFile(w, r, p) {
+			return nil
+		}
+		return w
+	}
+
+	Nil(t, get(""), "requests without range are not served")
+	w := get("bytes=2-9")
+	Equal(t, http.StatusPartialContent, w.Code)
+	Equal(t, "23456789", w.Body.String())
+	Equal(t, "video/mp4", w.Header().Get("Content-Type"))
+	of, ok := c.lru.Get(p)
+	True(t, ok)
+	Equal(t, "cdef", get("bytes=12-").Body.String())
+	of2, _ := c.lru.Get(p)
+	Same(t, of, of2, "the handle must be reused")
+
+	NoError(t, os.WriteFile(p, []byte("fedcba9876543210"), 0600))
+	NoError(t, os.Chtimes(p, time.Now(), time.Now().Add(time.Minute)))
+	Equal(t, "fedc", get("bytes=0-3").Body.String())
+	True(t, of.evicted, "the stale handle must be closed")
+
+	small := filepath.Join(d, "small.txt")
+	NoError(t, os.WriteFile(small, []byte("abc"), 0600))
+	False(t, c.serveFile(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/small.txt", nil), small))
+	Nil(t, newHandleCache(0, 8, 4))
+}
+
+func Test_readaheadReader(t *testing.T) {
+	data := "0123456789abcdef"
+	ra := &readaheadReader{r: strings.NewReader(data), size: int64(len(data)), buf: make([]byte, 3)}
+	b, err := io.ReadAll(ra)
+	NoError(t, err)
+	Equal(t, data, string(b))
+
+	off, err := ra.Seek(-4, io.SeekEnd)
+	NoError(t, err)
+	Equal(t, int64(12), off)
+	b, err = io.ReadAll(ra)
+	NoError(t, err)
+	Equal(t, "cdef", string(b))
+
+	_, err = ra.Seek(5, io.SeekStart)
+	NoError(t, err)
+	_, err = ra.Seek(-2, io.SeekCurrent)
+	NoError(t, err)
+	b = make([]byte, 2)
+	_, err = io.ReadFull(ra, b)
+	NoError(t, err)
+	Equal(t, "34", string(b))
+
+	_, err = ra.Seek(-1, io.SeekStart)
+	ErrorIs(t, err, errNegativeOffset)
+}
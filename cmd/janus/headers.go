@@ -0,0 +1,159 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// headerRule adds a response header to all requests matching a path pattern.
+type headerRule struct {
+	pattern string
+	name    string
+	value   string
+}
+
+// noCacheHeaders prevent clients and proxies from caching files, since they may change anytime.
+// Like other headers set by janus, they can be overridden by header rules e.g., for immutable files.
+var noCacheHeaders = []headerRule{
+	{"/", "Cache-Control", "no-cache, no-store, must-revalidate"}, // HTTP 1.1
+	{"/", "Pragma", "no-cache"},                                   // HTTP 1.0
+	{"/", "Expires", "0"},                                         // Proxies
+}
+
+// headerRules returns the rules of the security header options followed by the custom header rules,
+// which are applied later, hence can override security headers for some paths e.g., to allow embedding.
+func headerRules(a app) ([]headerRule, error) {
+	var specs []string
+	if a.HSTSMaxAge > 0 {
+		specs = append(specs, fmt.Sprintf("/ Strict-Transport-Security: max-age=%d", a.HSTSMaxAge/time.Second))
+	}
+	if a.CSP != "" {
+		specs = append(specs, "/ Content-Security-Policy: "+a.CSP)
+	}
+	if a.FrameOptions != "" {
+		specs = append(specs, "/ X-Frame-Options: "+a.FrameOptions)
+	}
+	if a.NoSniff {
+		specs = append(specs, "/ X-Content-Type-Options: nosniff")
+	}
+	return parseHeaderRules(append(specs, a.Headers...))
+}
+
+// parseHeaderRules parses rules of the form "<path pattern> <name>: <value>".
+// An empty value removes the header from the response.
+func parseHeaderRules(specs []string) ([]headerRule, error) {
+	var hrs []headerRule
+	for _, spec := range specs {
+		pat, hdr, _ := strings.Cut(strings.TrimSpace(spec), " ")
+		name, value, ok := strings.Cut(hdr, ":")
+		name, value = strings.TrimSpace(name), strings.TrimSpace(value)
+		if !ok || !strings.HasPrefix(pat, "/") || !validHeaderName(name) || strings.ContainsAny(value, "\r\n") {
+			return nil, fmt.Errorf("invalid header rule %q", spec)
+		}
+		hrs = append(hrs, headerRule{pat, http.CanonicalHeaderKey(name), value})
+	}
+	return hrs, nil
+}
+
+// set sets the header, or removes it if the value is empty.
+func (hr headerRule) set(h http.Header) {
+	if hr.value == "" {
+		h.Del(hr.name)
+	} else {
+		h.Set(hr.name, hr.value)
+	}
+}
+
+// validHeaderName reports whether s is a valid HTTP header field name (token).
+func validHeaderName(s string) bool {
+	return s != "" && strings.IndexFunc(s, func(c rune) bool {
+		return c <= ' ' || c >= 0x7f || strings.ContainsRune(`"(),/:;<=>?@[\]{}`, c)
+	}) < 0
+}
+
+// addHeaders sets the headers of all rules matching the request path, once the response is written.
+// Hence, they take precedence over the headers set by janus e.g., Cache-Control.
+// If there are no rules, h is returned as is.
+func addHeaders(hrs []headerRule, h http.Handler) http.Handler {
+	if len(hrs) == 0 {
+		return h
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var match []headerRule
+		for _, hr := range hrs {
+			if matchPath([]string{hr.pattern}, r.URL.Path) {
+				match = append(match, hr)
+			}
+		}
+		if len(match) == 0 {
+			h.ServeHTTP(w, r)
+			return
+		}
+		h.ServeHTTP(&headerWriter{ResponseWriter: w, rules: match}, r)
+	})
+}
+
+// headerWriter applies header rules before the response header is written.
+type headerWriter struct {
+	http.ResponseWriter
+	rules   []headerRule
+	applied bool
+}
+
+func (w *headerWriter) apply() {
+	if w.applied {
+		return
+	}
+	w.applied = true
+	for _, hr := range w.rules {
+		hr.set(w.Header())
+	}
+}
+
+func (w *headerWriter) WriteHeader(status int) {
+	if status >= http.StatusOK {
+		// informational responses are followed by the final one
+		w.apply()
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *headerWriter) Write(b []byte) (int, error) {
+	w.apply()
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush delegates to the underlying ResponseWriter, if it implements http.Flusher.
+func (w *headerWriter) Flush() {
+	w.apply()
+	if fl, ok := w.ResponseWriter.(http.Flusher); ok {
+		fl.Flush()
+	}
+}
+
+// ReadFrom delegates to the underlying ResponseWriter, if it implements io.ReaderFrom, so that sendfile(2) can be used.
+func (w *headerWriter) ReadFrom(src io.Reader) (int64, error) {
+	w.apply()
+	if rf, ok := w.ResponseWriter.(io.ReaderFrom); ok {
+		return rf.ReadFrom(src)
+	}
+	return io.Copy(struct{ io.Writer }{w.ResponseWriter}, src)
+}
@@ -0,0 +1,89 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/stretchr/testify/require"
+)
+
+func Test_parseHeaderRules(t *testing.T) {
+	hrs, err := parseHeaderRules([]string{"/public/ access-control-allow-origin: *", "/reports/*.pdf Content-Disposition: attachment", "/ Server:"})
+	NoError(t, err)
+	Equal(t, []headerRule{
+		{"/public/", "Access-Control-Allow-Origin", "*"},
+		{"/reports/*.pdf", "Content-Disposition", "attachment"},
+		{"/", "Server", ""},
+	}, hrs)
+
+	for _, spec := range []string{"/public/", "public/ X-A: b", "/ X A: b", "/ : b", "/ X-A: b\r\nX-B: c"} {
+		_, err := parseHeaderRules([]string{spec})
+		Error(t, err, spec)
+	}
+}
+
+func Test_headerRules(t *testing.T) {
+	hrs, err := headerRules(app{})
+	NoError(t, err)
+	Empty(t, hrs)
+
+	hrs, err = headerRules(app{HSTSMaxAge: 365 * 24 * time.Hour, CSP: "default-src 'self'", FrameOptions: "DENY", NoSniff: true,
+		Headers: []string{"/embed/ X-Frame-Options:"}})
+	NoError(t, err)
+	Equal(t, []headerRule{
+		{"/", "Strict-Transport-Security", "max-age=31536000"},
+		{"/", "Content-Security-Policy", "default-src 'self'"},
+		{"/", "X-Frame-Options", "DENY"},
+		{"/", "X-Content-Type-Options", "nosniff"},
+		{"/embed/", "X-Frame-Options", ""},
+	}, hrs)
+
+	_, err = headerRules(app{FrameOptions: "DENY\r\nX-A: b"})
+	EqualError(t, err, `invalid header rule "/ X-Frame-Options: DENY\r\nX-A: b"`)
+}
+
+func Test_addHeaders(t *testing.T) {
+	dir := t.TempDir()
+	NoError(t, os.Mkdir(filepath.Join(dir, "public"), 0700))
+	NoError(t, os.WriteFile(filepath.Join(dir, "public", "a.txt"), []byte("a"), 0600))
+	hrs, err := parseHeaderRules([]string{
+		"/public/ Access-Control-Allow-Origin: *",
+		"/public/*.txt Cache-Control: public, max-age=60",
+		"/ X-Frame-Options: DENY",
+		"/public/ X-Frame-Options:",
+	})
+	NoError(t, err)
+	h := addHeaders(hrs, handleRequest(app{ServerRoot: dir}))
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/public/a.txt", nil))
+	Equal(t, http.StatusOK, w.Code)
+	Equal(t, "*", w.Header().Get("Access-Control-Allow-Origin"))
+	Equal(t, "public, max-age=60", w.Header().Get("Cache-Control"))
+	NotContains(t, w.Header(), "X-Frame-Options")
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/missing.txt", nil))
+	Equal(t, http.StatusNotFound, w.Code)
+	Equal(t, "DENY", w.Header().Get("X-Frame-Options"))
+	Empty(t, w.Header().Get("Access-Control-Allow-Origin"))
+	Equal(t, "no-cache, no-store, must-revalidate", w.Header().Get("Cache-Control"))
+}
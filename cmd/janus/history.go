@@ -0,0 +1,274 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// historyTimeFormat is the format of the time in the file names of snapshots, which sorts chronologically.
+const historyTimeFormat = "20060102T150405Z"
+
+// snapshotEntry describes a file at the time of a snapshot.
+type snapshotEntry struct {
+	Size     int64     `json:"size"`
+	Modified time.Time `json:"modified"`
+}
+
+// snapshot records the files below the configured paths at a point in time.
+type snapshot struct {
+	Time  time.Time                `json:"time"`
+	Files map[string]snapshotEntry `json:"files"`
+}
+
+// historyChange describes a file, which appeared, disappeared or was modified between two snapshots.
+type historyChange struct {
+	Time   time.Time `json:"time"`
+	Path   string    `json:"path"`
+	Change string    `json:"change"`
+	Size   int64     `json:"size"`
+}
+
+// historyReport lists the times of all snapshots and the changes between them.
+type historyReport struct {
+	Snapshots []time.Time     `json:"snapshots"`
+	Changes   []historyChange `json:"changes"`
+}
+
+// history periodically records snapshots of the files below the server root, so that it can be determined when
+// files appeared or disappeared.
+type history struct {
+	root  string
+	dir   string
+	paths []string
+	keep  int
+}
+
+// newHistory creates the directory for snapshots.
+func newHistory(a app) (*history, error) {
+	if err := os.MkdirAll(a.HistoryDir, 0700); err != nil {
+		return nil, err
+	}
+	ps := a.HistoryPaths
+	if len(ps) == 0 {
+		ps = []string{"/"}
+	}
+	return &history{root: a.ServerRoot, dir: a.HistoryDir, paths: ps, keep: a.HistoryKeep}, nil
+}
+
+// run records a snapshot immediately and then at the given interval.
+func (h *history) run(interval time.Duration) {
+	h.report(h.record(time.Now()))
+	for now := range time.NewTicker(interval).C {
+		h.report(h.record(now))
+	}
+}
+
+// report logs the outcome of recording a snapshot.
+func (h *history) report(files int, err error) {
+	if err != nil {
+		log.Err(err).Msg("Cannot record snapshot")
+		return
+	}
+	log.Debug().Int("files", files).Msg("Recorded snapshot")
+}
+
+// record writes a snapshot of the files below the configured paths and removes the oldest snapshots exceeding
+// the number of snapshots to keep. It returns the number of files recorded.
+func (h *history) record(now time.Time) (int, error) {
+	s := snapshot{Time: now.UTC().Truncate(time.Second), Files: map[string]snapshotEntry{}}
+	for _, p := range h.paths {
+		start := filepath.Join(h.root, filepath.FromSlash(p))
+		err := filepath.WalkDir(start, func(name string, d fs.DirEntry, err error) error {
+			if os.IsNotExist(err) && name == start {
+				return filepath.SkipDir
+			} else if err != nil {
+				return err
+			} else if strings.HasPrefix(d.Name(), ".janus-") {
+				if d.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			} else if !d.Type().IsRegular() {
+				return nil
+			}
+			fi, err := d.Info()
+			if err != nil {
+				// the file was removed in the meantime
+				return nil
+			}
+			rel, err := filepath.Rel(h.root, name)
+			if err != nil {
+				return err
+			}
+			s.Files["/"+filepath.ToSlash(rel)] = snapshotEntry{fi.Size(), fi.ModTime().UTC()}
+			return nil
+		})
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	if err := h.save(s); err != nil {
+		return 0, err
+	}
+	return len(s.Files), h.prune()
+}
+
+// save writes the snapshot as compressed JSON atomically.
+func (h *history) save(s snapshot) error {
+	f, err := os.CreateTemp(h.dir, ".snapshot-*")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.Remove(f.Name()) }()
+	defer f.Close()
+
+	zw := gzip.NewWriter(f)
+	if err := json.NewEncoder(zw).Encode(s); err != nil {
+		return err
+	} else if err := zw.Close(); err != nil {
+		return err
+	} else if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), filepath.Join(h.dir, s.Time.Format(historyTimeFormat)+".json.gz"))
+}
+
+// names returns the file names of all snapshots, the oldest first.
+func (h *history) names() ([]string, error) {
+	names, err := filepath.Glob(filepath.Join(h.dir, "*.json.gz"))
+	sort.Strings(names)
+	return names, err
+}
+
+// prune removes the oldest snapshots exceeding the number of snapshots to keep.
+func (h *history) prune() error {
+	names, err := h.names()
+	if err != nil || len(names) <= h.keep {
+		return err
+	}
+	for _, name := range names[:len(names)-h.keep] {
+		if err := os.Remove(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// load reads the named snapshot.
+func (h *history) load(name string) (snapshot, error) {
+	var s snapshot
+	f, err := os.Open(filepath.Clean(name))
+	if err != nil {
+		return s, err
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		return s, err
+	}
+	return s, json.NewDecoder(zr).Decode(&s)
+}
+
+// changes compares consecutive snapshots and returns the changes of files matching the pattern after since.
+func (h *history) changes(pattern string, since time.Time) (historyReport, error) {
+	rep := historyReport{Snapshots: []time.Time{}, Changes: []historyChange{}}
+	names, err := h.names()
+	if err != nil {
+		return rep, err
+	}
+
+	var prev *snapshot
+	for _, name := range names {
+		s, err := h.load(name)
+		if err != nil {
+			return rep, err
+		}
+		rep.Snapshots = append(rep.Snapshots, s.Time)
+		if prev != nil && s.Time.After(since) {
+			rep.Changes = append(rep.Changes, diffSnapshots(*prev, s, pattern)...)
+		}
+		prev = &s
+	}
+	return rep, nil
+}
+
+// diffSnapshots returns the files matching the pattern, which were added, removed or modified from a to b.
+func diffSnapshots(a, b snapshot, pattern string) []historyChange {
+	var cs []historyChange
+	for p, e := range b.Files {
+		if pattern != "" && !matchPath([]string{pattern}, p) {
+			continue
+		}
+		if old, ok := a.Files[p]; !ok {
+			cs = append(cs, historyChange{b.Time, p, "added", e.Size})
+		} else if old != e {
+			cs = append(cs, historyChange{b.Time, p, "modified", e.Size})
+		}
+	}
+	for p, e := range a.Files {
+		if _, ok := b.Files[p]; !ok && (pattern == "" || matchPath([]string{pattern}, p)) {
+			cs = append(cs, historyChange{b.Time, p, "removed", e.Size})
+		}
+	}
+	sort.Slice(cs, func(i, j int) bool { return cs[i].Path < cs[j].Path })
+	return cs
+}
+
+// handleHistory reports the snapshots and the changes between them in JSON.
+// The changes can be restricted to a path pattern ("path") and to snapshots taken after a point in time ("since").
+func handleHistory(h *history) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET")
+			renderError(w, r, errMethodNotAllowed, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		var since time.Time
+		if s := r.URL.Query().Get("since"); s != "" {
+			var err error
+			if since, err = time.Parse(time.RFC3339, s); err != nil {
+				renderError(w, r, err, "invalid time (must be RFC 3339)", http.StatusBadRequest)
+				return
+			}
+		}
+		pattern := r.URL.Query().Get("path")
+		if pattern != "" && !strings.HasPrefix(pattern, "/") {
+			pattern = path.Join("/", pattern)
+		}
+
+		rep, err := h.changes(pattern, since)
+		if err != nil {
+			renderError(w, r, err, "cannot read snapshots", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(rep); err != nil {
+			log.Err(err).Msg("cannot render message")
+		}
+	}
+}
@@ -0,0 +1,104 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/stretchr/testify/require"
+)
+
+func Test_history(t *testing.T) {
+	root := t.TempDir()
+	NoError(t, os.MkdirAll(filepath.Join(root, "shared", ".janus-uploads"), 0700))
+	NoError(t, os.WriteFile(filepath.Join(root, "shared", "a.txt"), []byte("a"), 0600))
+	NoError(t, os.WriteFile(filepath.Join(root, "shared", "b.txt"), []byte("b"), 0600))
+	NoError(t, os.WriteFile(filepath.Join(root, "shared", ".janus-uploads", "x.part"), []byte("x"), 0600))
+	NoError(t, os.WriteFile(filepath.Join(root, "private.txt"), []byte("p"), 0600))
+	h, err := newHistory(app{ServerRoot: root, HistoryDir: t.TempDir(), HistoryPaths: []string{"/shared/", "/missing/"}, HistoryKeep: 2})
+	NoError(t, err)
+
+	t0 := time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC)
+	n, err := h.record(t0)
+	NoError(t, err)
+	Equal(t, 2, n)
+
+	NoError(t, os.Remove(filepath.Join(root, "shared", "a.txt")))
+	NoError(t, os.WriteFile(filepath.Join(root, "shared", "b.txt"), []byte("bb"), 0600))
+	NoError(t, os.WriteFile(filepath.Join(root, "shared", "c.txt"), []byte("c"), 0600))
+	_, err = h.record(t0.Add(time.Hour))
+	NoError(t, err)
+
+	rep, err := h.changes("", time.Time{})
+	NoError(t, err)
+	Equal(t, []time.Time{t0, t0.Add(time.Hour)}, rep.Snapshots)
+	Equal(t, []historyChange{
+		{t0.Add(time.Hour), "/shared/a.txt", "removed", 1},
+		{t0.Add(time.Hour), "/shared/b.txt", "modified", 2},
+		{t0.Add(time.Hour), "/shared/c.txt", "added", 1},
+	}, rep.Changes)
+
+	rep, err = h.changes("/shared/a.*", time.Time{})
+	NoError(t, err)
+	Len(t, rep.Changes, 1)
+
+	// the oldest snapshot is removed
+	_, err = h.record(t0.Add(2 * time.Hour))
+	NoError(t, err)
+	rep, err = h.changes("", t0.Add(time.Hour))
+	NoError(t, err)
+	Equal(t, []time.Time{t0.Add(time.Hour), t0.Add(2 * time.Hour)}, rep.Snapshots)
+	Empty(t, rep.Changes)
+}
+
+func Test_handleHistory(t *testing.T) {
+	root := t.TempDir()
+	NoError(t, os.WriteFile(filepath.Join(root, "a.txt"), []byte("a"), 0600))
+	h, err := newHistory(app{ServerRoot: root, HistoryDir: t.TempDir(), HistoryKeep: 10})
+	NoError(t, err)
+	t0 := time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC)
+	_, err = h.record(t0)
+	NoError(t, err)
+	NoError(t, os.Remove(filepath.Join(root, "a.txt")))
+	_, err = h.record(t0.Add(time.Hour))
+	NoError(t, err)
+
+	w := httptest.NewRecorder()
+	handleHistory(h).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/_janus/admin/history?path=a.txt", nil))
+	Equal(t, http.StatusOK, w.Code)
+	var rep historyReport
+	NoError(t, json.Unmarshal(w.Body.Bytes(), &rep))
+	Equal(t, []historyChange{{t0.Add(time.Hour), "/a.txt", "removed", 1}}, rep.Changes)
+
+	w = httptest.NewRecorder()
+	handleHistory(h).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/_janus/admin/history?since=yesterday", nil))
+	Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func Test_checkConfig_History(t *testing.T) {
+	a := app{ServerRoot: t.TempDir(), ListenAddress: ":0", AdminToken: "s3cr3t", HistoryDir: t.TempDir(),
+		HistoryInterval: time.Hour, HistoryKeep: 2, Chroot: true}
+	errs := checkConfig(a)
+	Len(t, errs, 1)
+	EqualError(t, errs[0], "history-dir: history cannot be combined with chroot")
+	_, rw := sandboxDirs(a)
+	Contains(t, rw, a.HistoryDir)
+}
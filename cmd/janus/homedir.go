@@ -0,0 +1,63 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+// rootDir returns the directory, from which the request is served.
+// In home directory mode, this is the directory of the authenticated user below the server root.
+// If tenants are configured, this is the directory of the tenant the client belongs to.
+func rootDir(a app, r *http.Request) string {
+	if id := identityFrom(r.Context()); a.HomeDirs && id != nil {
+		return filepath.Join(a.ServerRoot, id.name)
+	} else if t := a.tenants.of(id); t != nil {
+		return filepath.Join(a.ServerRoot, t.dir)
+	}
+	return a.ServerRoot
+}
+
+// requireHomeDir rejects anonymous clients and creates the home directory of a user on first access.
+// User names, which cannot be used as directory names, are rejected as well.
+// If home directory mode is disabled, h is returned as is.
+func requireHomeDir(a app, h http.Handler) http.Handler {
+	if !a.HomeDirs {
+		return h
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := identityFrom(r.Context())
+		if id == nil || id.name == "" || id.name == "." || id.name == ".." || strings.ContainsAny(id.name, `/\`) {
+			renderError(w, r, errAccessDenied, "home directory not available", http.StatusForbidden)
+			return
+		}
+
+		dir := rootDir(a, r)
+		if _, err := os.Stat(dir); os.IsNotExist(err) {
+			if err = os.Mkdir(dir, 0750); err != nil && !os.IsExist(err) {
+				renderError(w, r, err, "cannot create home directory", http.StatusInternalServerError)
+				return
+			}
+			log.Info().Str("user", id.name).Str("dir", dir).Msg("Created home directory")
+		}
+		h.ServeHTTP(w, r)
+	})
+}
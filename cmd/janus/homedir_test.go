@@ -0,0 +1,72 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/stretchr/testify/require"
+)
+
+func Test_rootDir(t *testing.T) {
+	a := app{ServerRoot: "/srv"}
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	Equal(t, "/srv", rootDir(a, r))
+	Equal(t, "/srv", rootDir(a, withIdentity(r, &identity{name: "alice"})))
+
+	a.HomeDirs = true
+	Equal(t, "/srv", rootDir(a, r))
+	Equal(t, filepath.Join("/srv", "alice"), rootDir(a, withIdentity(r, &identity{name: "alice"})))
+
+	a.HomeDirs = false
+	a.tenants = tenants{{name: "acme", dir: filepath.Join("tenants", "acme"), groups: []string{"acme-devs"}}}
+	Equal(t, "/srv", rootDir(a, r))
+	Equal(t, filepath.Join("/srv", "tenants", "acme"), rootDir(a, withIdentity(r, &identity{name: "bob", groups: []string{"acme-devs"}})))
+}
+
+func Test_requireHomeDir(t *testing.T) {
+	a := app{ServerRoot: t.TempDir(), HomeDirs: true}
+	h := requireHomeDir(a, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(rootDir(a, r)))
+	}))
+
+	serve := func(id *identity) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		if id != nil {
+			r = withIdentity(r, id)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	Equal(t, http.StatusForbidden, serve(nil).Code)
+	Equal(t, http.StatusForbidden, serve(&identity{name: ".."}).Code)
+	Equal(t, http.StatusForbidden, serve(&identity{name: "a/b"}).Code)
+	NoDirExists(t, filepath.Join(a.ServerRoot, "alice"))
+
+	w := serve(&identity{name: "alice"})
+	Equal(t, http.StatusOK, w.Code)
+	Equal(t, filepath.Join(a.ServerRoot, "alice"), w.Body.String())
+	DirExists(t, filepath.Join(a.ServerRoot, "alice"))
+
+	fi, err := os.Stat(filepath.Join(a.ServerRoot, "alice"))
+	NoError(t, err)
+	True(t, fi.IsDir())
+}
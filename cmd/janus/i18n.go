@@ -0,0 +1,132 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// defaultLanguage is the language of the built-in messages, which do not need a catalog.
+const defaultLanguage = "en"
+
+// catalog maps the built-in English messages to their translation.
+type catalog map[string]string
+
+// translations holds the message catalogs by lower-case language tag e.g., "de" or "pt-br".
+type translations map[string]catalog
+
+// loadTranslations reads all message catalogs from the directory.
+// Each catalog is a JSON object named after its language e.g., "de.json" or "pt-BR.json".
+// If dir is empty, nil is returned.
+func loadTranslations(dir string) (translations, error) {
+	if dir == "" {
+		return nil, nil
+	}
+	names, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	} else if len(names) == 0 {
+		return nil, fmt.Errorf("no message catalogs in %s", dir)
+	}
+
+	ts := translations{}
+	for _, name := range names {
+		b, err := os.ReadFile(filepath.Clean(name))
+		if err != nil {
+			return nil, err
+		}
+		c := catalog{}
+		if err := json.Unmarshal(b, &c); err != nil {
+			return nil, fmt.Errorf("%s: %w", filepath.Base(name), err)
+		}
+		for m, t := range c {
+			// messages with placeholders are formatted after translation
+			if strings.Count(m, "%s") != strings.Count(t, "%s") {
+				return nil, fmt.Errorf("%s: translation of %q must keep its placeholders", filepath.Base(name), m)
+			}
+		}
+		ts[strings.ToLower(strings.TrimSuffix(filepath.Base(name), ".json"))] = c
+	}
+	return ts, nil
+}
+
+// negotiate selects the catalog for the most preferred language in the Accept-Language header.
+// If a language is not available, its primary language e.g., "de" for "de-AT" is tried as well.
+// The default language is returned, if none of the languages are available.
+func (ts translations) negotiate(acceptLanguage string) (string, catalog) {
+	type langQ struct {
+		tag string
+		q   float64
+	}
+	var ls []langQ
+	for _, l := range strings.Split(acceptLanguage, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(l), ";")
+		q := 1.0
+		if params = strings.TrimSpace(params); strings.HasPrefix(params, "q=") {
+			var err error
+			if q, err = strconv.ParseFloat(params[len("q="):], 64); err != nil {
+				continue
+			}
+		}
+		if tag = strings.ToLower(strings.TrimSpace(tag)); tag != "" && q > 0 {
+			ls = append(ls, langQ{tag, q})
+		}
+	}
+	sort.SliceStable(ls, func(i, j int) bool { return ls[i].q > ls[j].q })
+
+	for _, l := range ls {
+		primary, _, _ := strings.Cut(l.tag, "-")
+		for _, tag := range []string{l.tag, primary} {
+			if c, ok := ts[tag]; ok {
+				return tag, c
+			} else if tag == defaultLanguage || tag == "*" {
+				return defaultLanguage, nil
+			}
+		}
+	}
+	return defaultLanguage, nil
+}
+
+// localize attaches the message catalog negotiated with the client to the request.
+// If there are no translations, the handler is returned as is.
+func localize(ts translations, h http.Handler) http.Handler {
+	if len(ts) == 0 {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tag, c := ts.negotiate(r.Header.Get("Accept-Language"))
+		w.Header().Add("Vary", "Accept-Language")
+		w.Header().Set("Content-Language", tag)
+		h.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), language, c)))
+	})
+}
+
+// tr translates the message into the language negotiated with the client.
+// Messages without translation are returned unchanged.
+func tr(r *http.Request, m string) string {
+	c, _ := r.Context().Value(language).(catalog)
+	if t, ok := c[m]; ok {
+		return t
+	}
+	return m
+}
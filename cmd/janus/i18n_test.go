@@ -0,0 +1,114 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/stretchr/testify/require"
+)
+
+// writeTranslations creates a directory with the given message catalogs.
+func writeTranslations(t *testing.T, catalogs map[string]string) string {
+	t.Helper()
+	d := t.TempDir()
+	for name, content := range catalogs {
+		NoError(t, os.WriteFile(filepath.Join(d, name), []byte(content), 0600))
+	}
+	return d
+}
+
+func Test_loadTranslations(t *testing.T) {
+	ts, err := loadTranslations("")
+	NoError(t, err)
+	Nil(t, ts)
+
+	_, err = loadTranslations(t.TempDir())
+	Error(t, err)
+
+	d := writeTranslations(t, map[string]string{
+		"de.json":    `{"Upload": "Hochladen", "%s uploaded successfully.": "%s erfolgreich hochgeladen."}`,
+		"pt-BR.json": `{"Upload": "Enviar"}`,
+	})
+	ts, err = loadTranslations(d)
+	NoError(t, err)
+	Equal(t, translations{
+		"de":    {"Upload": "Hochladen", "%s uploaded successfully.": "%s erfolgreich hochgeladen."},
+		"pt-br": {"Upload": "Enviar"},
+	}, ts)
+
+	_, err = loadTranslations(writeTranslations(t, map[string]string{"de.json": `["Upload"]`}))
+	ErrorContains(t, err, "de.json")
+
+	_, err = loadTranslations(writeTranslations(t, map[string]string{"de.json": `{"Error: %s": "Fehler"}`}))
+	ErrorContains(t, err, "placeholders")
+}
+
+func Test_translations_negotiate(t *testing.T) {
+	ts := translations{"de": {"Upload": "Hochladen"}, "pt-br": {"Upload": "Enviar"}, "pt": {"Upload": "Carregar"}}
+
+	tests := []struct {
+		acceptLanguage string
+		want           string
+	}{
+		{"", defaultLanguage},
+		{"de", "de"},
+		{"de-AT", "de"},
+		{"pt-BR", "pt-br"},
+		{"pt-PT", "pt"},
+		{"fr, de;q=0.5", "de"},
+		{"en-US, de;q=0.5", defaultLanguage},
+		{"de;q=0.5, pt", "pt"},
+		{"de;q=0, fr", defaultLanguage},
+		{"*, de;q=0.5", defaultLanguage},
+		{"de;q=x", defaultLanguage},
+	}
+	for _, tt := range tests {
+		tag, c := ts.negotiate(tt.acceptLanguage)
+		Equal(t, tt.want, tag, tt.acceptLanguage)
+		Equal(t, ts[tt.want], c, tt.acceptLanguage)
+	}
+}
+
+func Test_localize(t *testing.T) {
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = renderMsg(w, tr(r, "Upload"))
+	})
+	serve := func(h http.Handler, lang string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("Accept-Language", lang)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	w := serve(localize(nil, h), "de")
+	Equal(t, "Upload", w.Body.String())
+	Empty(t, w.Header().Get("Content-Language"))
+
+	lh := localize(translations{"de": {"Upload": "Hochladen"}}, h)
+	w = serve(lh, "de-DE")
+	Equal(t, "Hochladen", w.Body.String())
+	Equal(t, "de", w.Header().Get("Content-Language"))
+	Equal(t, "Accept-Language", w.Header().Get("Vary"))
+
+	w = serve(lh, "fr")
+	Equal(t, "Upload", w.Body.String())
+	Equal(t, defaultLanguage, w.Header().Get("Content-Language"))
+}
@@ -0,0 +1,225 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	// errContentBlocked indicates that the content inspection service blocked an upload.
+	errContentBlocked = errors.New("content blocked by inspection")
+	// errInspection indicates that the content inspection service could not be asked for a verdict.
+	errInspection = errors.New("content inspection failed")
+)
+
+// icapVerdictHeaders are the ICAP response headers, which name the reason an inspection service blocked content.
+var icapVerdictHeaders = []string{"X-Infection-Found", "X-Virus-Id", "X-Violations-Found", "X-Blocked-Reason"}
+
+// icapThreatRegex extracts the threat from the X-Infection-Found header e.g., "Type=0; Resolution=2; Threat=EICAR;".
+var icapThreatRegex = regexp.MustCompile(`Threat=([^;]+)`)
+
+// icapClient streams uploads through a content inspection service (e.g., anti-virus or DLP) via ICAP (RFC 3507).
+type icapClient struct {
+	u       *url.URL
+	method  string
+	timeout time.Duration
+}
+
+// newICAPClient creates an ICAP client for the service at the given URL e.g., "icap://dlp.example.com:1344/reqmod".
+// If the URL is empty, nil is returned.
+func newICAPClient(rawURL, method string, timeout time.Duration) (*icapClient, error) {
+	if rawURL == "" {
+		return nil, nil
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Scheme != "icap" || u.Hostname() == "" {
+		return nil, fmt.Errorf("invalid ICAP URL %q", rawURL)
+	}
+	if u.Port() == "" {
+		u.Host = net.JoinHostPort(u.Hostname(), "1344")
+	}
+	if method != "RESPMOD" {
+		method = "REQMOD"
+	}
+	return &icapClient{u: u, method: method, timeout: timeout}, nil
+}
+
+// inspect sends the content of the file uploaded to p to the inspection service and rewinds it afterwards.
+// It returns an error wrapping errContentBlocked along with the reason, if the service blocked the content,
+// and an error wrapping errInspection, if the service failed.
+func (c *icapClient) inspect(r *http.Request, p string, src io.ReadSeeker) error {
+	if c == nil {
+		return nil
+	}
+	size, err := src.Seek(0, io.SeekEnd)
+	if err == nil {
+		_, err = src.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		return err
+	}
+
+	d := net.Dialer{Timeout: c.timeout}
+	conn, err := d.DialContext(r.Context(), "tcp", c.u.Host)
+	if err != nil {
+		return fmt.Errorf("%w: %v", errInspection, err)
+	}
+	defer conn.Close()
+	if c.timeout > 0 {
+		_ = conn.SetDeadline(time.Now().Add(c.timeout))
+	}
+
+	if err := c.writeRequest(conn, r, p, size, src); err != nil {
+		return fmt.Errorf("%w: %v", errInspection, err)
+	}
+	verdict, err := readVerdict(bufio.NewReader(conn))
+	if err != nil {
+		return fmt.Errorf("%w: %v", errInspection, err)
+	} else if verdict != "" {
+		return fmt.Errorf("%w: %s", errContentBlocked, verdict)
+	}
+	log.Debug().Str("request-id", requestIDFrom(r.Context())).Str("path", p).Msg("Upload allowed by content inspection")
+	_, err = src.Seek(0, io.SeekStart)
+	return err
+}
+
+// writeRequest sends the ICAP request encapsulating an HTTP request (REQMOD) or response (RESPMOD) with the content
+// as chunked body.
+func (c *icapClient) writeRequest(w io.Writer, r *http.Request, p string, size int64, src io.Reader) error {
+	u := url.URL{Path: p}
+	var enc string
+	hdrs := &strings.Builder{}
+	if c.method == "REQMOD" {
+		fmt.Fprintf(hdrs, "PUT %s HTTP/1.1\r\nHost: %s\r\nContent-Length: %d\r\n\r\n", u.EscapedPath(), r.Host, size)
+		enc = "req-hdr=0, req-body=" + strconv.Itoa(hdrs.Len())
+	} else {
+		fmt.Fprintf(hdrs, "GET %s HTTP/1.1\r\nHost: %s\r\n\r\n", u.EscapedPath(), r.Host)
+		res := hdrs.Len()
+		fmt.Fprintf(hdrs, "HTTP/1.1 200 OK\r\nContent-Length: %d\r\n\r\n", size)
+		enc = "req-hdr=0, res-hdr=" + strconv.Itoa(res) + ", res-body=" + strconv.Itoa(hdrs.Len())
+	}
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "%s %s ICAP/1.0\r\nHost: %s\r\nAllow: 204\r\nEncapsulated: %s\r\n", c.method, c.u, c.u.Host, enc)
+	if user := userName(r); user != "" {
+		fmt.Fprintf(bw, "X-Authenticated-User: %s\r\n", user)
+	}
+	fmt.Fprintf(bw, "X-Client-IP: %s\r\n\r\n%s", clientIP(r), hdrs)
+
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := src.Read(buf)
+		if n > 0 {
+			fmt.Fprintf(bw, "%x\r\n", n)
+			_, _ = bw.Write(buf[:n])
+			_, _ = bw.WriteString("\r\n")
+		}
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return err
+		}
+	}
+	_, _ = bw.WriteString("0\r\n\r\n")
+	return bw.Flush()
+}
+
+// readVerdict reads the ICAP response and returns the reason, if the content was blocked.
+// "204 No Content" allows the content. A "200 OK" response blocks it, if the service reports a finding or replaced
+// the content with an error response e.g., a block page.
+func readVerdict(br *bufio.Reader) (string, error) {
+	tp := textproto.NewReader(br)
+	line, err := tp.ReadLine()
+	if err != nil {
+		return "", err
+	}
+	proto, status, _ := strings.Cut(line, " ")
+	code, _, _ := strings.Cut(status, " ")
+	if proto != "ICAP/1.0" {
+		return "", fmt.Errorf("invalid ICAP response %q", line)
+	}
+	hdr, err := tp.ReadMIMEHeader()
+	if err != nil {
+		return "", err
+	}
+
+	switch code {
+	case "204":
+		return "", nil
+	case "200":
+	default:
+		return "", fmt.Errorf("ICAP status %s", status)
+	}
+
+	for _, k := range icapVerdictHeaders {
+		if v := strings.TrimSpace(hdr.Get(k)); v != "" {
+			if m := icapThreatRegex.FindStringSubmatch(v); m != nil {
+				return strings.TrimSpace(m[1]), nil
+			}
+			return v, nil
+		}
+	}
+
+	// the encapsulated HTTP response indicates whether the content was replaced by an error page
+	for _, e := range strings.Split(hdr.Get("Encapsulated"), ",") {
+		k, v, _ := strings.Cut(strings.TrimSpace(e), "=")
+		if k != "res-hdr" {
+			continue
+		}
+		off, err := strconv.Atoi(v)
+		if err != nil {
+			return "", fmt.Errorf("invalid Encapsulated header %q", hdr.Get("Encapsulated"))
+		} else if _, err := br.Discard(off); err != nil {
+			return "", err
+		}
+		res, err := http.ReadResponse(br, nil)
+		if err != nil {
+			return "", err
+		} else if res.StatusCode >= http.StatusBadRequest {
+			return "HTTP " + res.Status, nil
+		}
+	}
+	return "", nil
+}
+
+// renderUploadError rejects an upload, which was blocked by the content inspection service or could not be
+// inspected, and audits the verdict. Other errors are reported as failure to write the file.
+func renderUploadError(w http.ResponseWriter, r *http.Request, p string, err error) {
+	switch {
+	case errors.Is(err, errContentBlocked):
+		audit(r, "upload").Str("name", path.Base(p)).Str("result", "blocked").
+			Str("verdict", strings.TrimPrefix(err.Error(), errContentBlocked.Error()+": ")).Msg("Upload blocked by content inspection")
+		renderError(w, r, err, "the file was blocked by content inspection", http.StatusForbidden)
+	case errors.Is(err, errInspection):
+		renderError(w, r, err, "the file cannot be inspected", http.StatusServiceUnavailable)
+	default:
+		renderError(w, r, err, "cannot write file", http.StatusInternalServerError)
+	}
+}
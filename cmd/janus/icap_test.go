@@ -0,0 +1,148 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/stretchr/testify/require"
+)
+
+// fakeICAP serves ICAP requests with the response returned by respond for the received body.
+func fakeICAP(t *testing.T, respond func(method string, body []byte) string) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	NoError(t, err)
+	t.Cleanup(func() { _ = l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				tp := textproto.NewReader(bufio.NewReader(conn))
+				line, _ := tp.ReadLine()
+				hdr, _ := tp.ReadMIMEHeader()
+				// skip the encapsulated HTTP headers up to the body
+				enc := hdr.Get("Encapsulated")
+				off := enc[strings.LastIndex(enc, "=")+1:]
+				n := 0
+				for _, c := range off {
+					n = n*10 + int(c-'0')
+				}
+				_, _ = io.CopyN(io.Discard, tp.R, int64(n))
+				body, _ := io.ReadAll(httputil.NewChunkedReader(tp.R))
+				_, _ = conn.Write([]byte(respond(strings.Fields(line)[0], body)))
+			}(conn)
+		}
+	}()
+	return "icap://" + l.Addr().String() + "/avscan"
+}
+
+func Test_icapClient_inspect(t *testing.T) {
+	var methods []string
+	u := fakeICAP(t, func(method string, body []byte) string {
+		methods = append(methods, method)
+		switch {
+		case bytes.Contains(body, []byte("EICAR")):
+			return "ICAP/1.0 200 OK\r\nX-Infection-Found: Type=0; Resolution=2; Threat=Eicar-Test-Signature;\r\nEncapsulated: null-body=0\r\n\r\n"
+		case bytes.Contains(body, []byte("secret")):
+			page := "HTTP/1.1 403 Forbidden\r\nContent-Length: 0\r\n\r\n"
+			return "ICAP/1.0 200 OK\r\nEncapsulated: res-hdr=0, null-body=" + string(rune('0'+len(page)/10)) + string(rune('0'+len(page)%10)) + "\r\n\r\n" + page
+		case bytes.Contains(body, []byte("fail")):
+			return "ICAP/1.0 500 Server Error\r\n\r\n"
+		}
+		return "ICAP/1.0 204 No Content\r\n\r\n"
+	})
+
+	for _, method := range []string{"REQMOD", "RESPMOD"} {
+		c, err := newICAPClient(u, method, time.Second)
+		NoError(t, err)
+		r := httptest.NewRequest(http.MethodPost, "/", nil)
+
+		src := strings.NewReader("clean data")
+		NoError(t, c.inspect(r, "/a.txt", src))
+		b, _ := io.ReadAll(src)
+		Equal(t, "clean data", string(b), "content must be rewound")
+
+		err = c.inspect(r, "/a.txt", strings.NewReader("X5O!P%@AP EICAR"))
+		ErrorIs(t, err, errContentBlocked)
+		Contains(t, err.Error(), "Eicar-Test-Signature")
+		ErrorIs(t, c.inspect(r, "/a.txt", strings.NewReader("top secret")), errContentBlocked)
+		ErrorIs(t, c.inspect(r, "/a.txt", strings.NewReader("fail")), errInspection)
+	}
+	Equal(t, []string{"REQMOD", "REQMOD", "REQMOD", "REQMOD", "RESPMOD", "RESPMOD", "RESPMOD", "RESPMOD"}, methods)
+
+	Nil(t, (*icapClient)(nil).inspect(nil, "/a.txt", nil))
+}
+
+func Test_newICAPClient(t *testing.T) {
+	c, err := newICAPClient("icap://dlp.example.com/reqmod", "", time.Minute)
+	NoError(t, err)
+	Equal(t, "dlp.example.com:1344", c.u.Host)
+	Equal(t, "REQMOD", c.method)
+
+	c, err = newICAPClient("", "REQMOD", time.Minute)
+	NoError(t, err)
+	Nil(t, c)
+
+	_, err = newICAPClient("http://dlp.example.com", "REQMOD", time.Minute)
+	Error(t, err)
+}
+
+func Test_handleFileUpload_ICAP(t *testing.T) {
+	u := fakeICAP(t, func(_ string, body []byte) string {
+		if bytes.Contains(body, []byte("EICAR")) {
+			return "ICAP/1.0 200 OK\r\nX-Virus-ID: EICAR\r\nEncapsulated: null-body=0\r\n\r\n"
+		}
+		return "ICAP/1.0 204 No Content\r\n\r\n"
+	})
+	c, err := newICAPClient(u, "REQMOD", time.Second)
+	NoError(t, err)
+	dir := t.TempDir()
+	h := handleRequest(app{ServerRoot: dir, EnableUpload: true, icap: c})
+
+	upload := func(name, data string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/", bytes.NewBufferString(
+			"--xxx\r\nContent-Disposition: form-data; name=\"file\"; filename=\""+name+"\"\r\n\r\n"+data+"\r\n--xxx--\r\n"))
+		r.Header.Set("Content-Type", "multipart/form-data; boundary=xxx")
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	Equal(t, http.StatusOK, upload("a.txt", "clean").Code)
+	data, err := os.ReadFile(filepath.Join(dir, "a.txt"))
+	NoError(t, err)
+	Equal(t, "clean", string(data))
+
+	w := upload("b.txt", "EICAR")
+	Equal(t, http.StatusForbidden, w.Code)
+	Equal(t, string(codeContentBlocked), w.Header().Get("X-Janus-Error"))
+	NoFileExists(t, filepath.Join(dir, "b.txt"))
+}
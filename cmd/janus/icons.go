@@ -0,0 +1,153 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"image"
+	"image/color"
+	"image/png"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// iconColors are the colors of the two faces of the built-in icon.
+var iconColors = [2]color.RGBA{{0x09, 0x69, 0xda, 0xff}, {0x1f, 0x23, 0x28, 0xff}}
+
+// iconSizes are the sizes of the icons referenced by the web manifest.
+var iconSizes = []int{192, 512}
+
+// icons holds the built-in favicon, the web manifest and the icons it references.
+type icons struct {
+	favicon  []byte
+	manifest []byte
+	pngs     map[string][]byte
+	start    time.Time
+}
+
+// newIcons renders the built-in icons and the web manifest, which is named after the brand.
+func newIcons(a app) *icons {
+	name := a.BrandTitle
+	if name == "" {
+		name = "janus"
+	}
+	type icon struct {
+		Src   string `json:"src"`
+		Sizes string `json:"sizes"`
+		Type  string `json:"type"`
+	}
+	start := strings.TrimSuffix(publicPath(a, "/"), "/") + "/"
+	m := struct {
+		Name            string `json:"name"`
+		ShortName       string `json:"short_name"`
+		StartURL        string `json:"start_url"`
+		Scope           string `json:"scope"`
+		Display         string `json:"display"`
+		BackgroundColor string `json:"background_color"`
+		ThemeColor      string `json:"theme_color"`
+		Icons           []icon `json:"icons"`
+	}{name, name, start, start, "minimal-ui", "#ffffff", "#0969da", nil}
+
+	ic := &icons{favicon: ico(drawIcon(32)), pngs: map[string][]byte{}, start: time.Now()}
+	for _, s := range iconSizes {
+		name := "icon-" + strconv.Itoa(s) + ".png"
+		ic.pngs[name] = drawIcon(s)
+		m.Icons = append(m.Icons, icon{publicPath(a, apiPrefix+name), strconv.Itoa(s) + "x" + strconv.Itoa(s), "image/png"})
+	}
+	ic.manifest, _ = json.MarshalIndent(m, "", "  ")
+	return ic
+}
+
+// drawIcon renders the built-in icon as PNG: a circle split into two halves, one for each face of Janus.
+func drawIcon(size int) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, size, size))
+	c, r := float64(size)/2, float64(size)/2-float64(size)/32
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			dx, dy := float64(x)+.5-c, float64(y)+.5-c
+			if dx*dx+dy*dy > r*r || (dx > -float64(size)/32 && dx < float64(size)/32) {
+				continue
+			}
+			face := 0
+			if dx > 0 {
+				face = 1
+			}
+			img.SetRGBA(x, y, iconColors[face])
+		}
+	}
+
+	b := &bytes.Buffer{}
+	_ = png.Encode(b, img)
+	return b.Bytes()
+}
+
+// ico wraps a PNG image of at most 256x256 pixels in the ICO format.
+func ico(p []byte) []byte {
+	cfg, _ := png.DecodeConfig(bytes.NewReader(p))
+	b := &bytes.Buffer{}
+	_ = binary.Write(b, binary.LittleEndian, struct {
+		Reserved, Type, Count uint16
+		Width, Height         uint8
+		Colors, Reserved2     uint8
+		Planes, BitCount      uint16
+		Size, Offset          uint32
+	}{0, 1, 1, uint8(cfg.Width), uint8(cfg.Height), 0, 0, 1, 32, uint32(len(p)), 22})
+	b.Write(p)
+	return b.Bytes()
+}
+
+// serveIcons serves the built-in favicon, the web manifest and its icons, unless the server root contains
+// "favicon.ico" or "manifest.webmanifest", which take precedence.
+// Like robots.txt, the favicon is served at the root of the host and below the prefix, without authentication.
+func serveIcons(a app, h http.Handler) http.Handler {
+	if a.icons == nil {
+		return h
+	}
+
+	prefix := strings.TrimRight(a.Prefix, "/")
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		var name, ct string
+		var data []byte
+		switch p := r.URL.Path; {
+		case p == "/favicon.ico" || p == prefix+"/favicon.ico":
+			name, ct, data = "favicon.ico", "image/x-icon", a.icons.favicon
+		case p == prefix+"/manifest.webmanifest":
+			name, ct, data = "manifest.webmanifest", "application/manifest+json", a.icons.manifest
+		case strings.HasPrefix(p, prefix+apiPrefix) && a.icons.pngs[strings.TrimPrefix(p, prefix+apiPrefix)] != nil:
+			ct, data = "image/png", a.icons.pngs[strings.TrimPrefix(p, prefix+apiPrefix)]
+		default:
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		if name != "" && exists(filepath.Join(a.ServerRoot, name)) {
+			http.ServeFile(w, r, filepath.Join(a.ServerRoot, name))
+			return
+		}
+		w.Header().Set("Content-Type", ct)
+		w.Header().Set("Cache-Control", "public, max-age=86400")
+		http.ServeContent(w, r, "", a.icons.start, bytes.NewReader(data))
+	})
+}
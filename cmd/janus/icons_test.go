@@ -0,0 +1,106 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"image/color"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/stretchr/testify/require"
+)
+
+func Test_drawIcon(t *testing.T) {
+	img, err := png.Decode(bytes.NewReader(drawIcon(64)))
+	NoError(t, err)
+	Equal(t, 64, img.Bounds().Dx())
+	_, _, _, alpha := img.At(0, 0).RGBA()
+	Zero(t, alpha)
+	Equal(t, color.NRGBAModel.Convert(iconColors[0]), img.At(16, 32))
+	Equal(t, color.NRGBAModel.Convert(iconColors[1]), img.At(48, 32))
+}
+
+func Test_ico(t *testing.T) {
+	p := drawIcon(32)
+	b := ico(p)
+	Equal(t, []byte{0, 0, 1, 0, 1, 0, 32, 32}, b[:8])
+	Equal(t, uint32(len(p)), binary.LittleEndian.Uint32(b[14:]))
+	Equal(t, uint32(22), binary.LittleEndian.Uint32(b[18:]))
+	Equal(t, p, b[22:])
+}
+
+func Test_newIcons(t *testing.T) {
+	ic := newIcons(app{Prefix: "/files/", BrandTitle: "ACME"})
+	var m struct {
+		Name     string `json:"name"`
+		StartURL string `json:"start_url"`
+		Icons    []struct {
+			Src, Sizes string
+		} `json:"icons"`
+	}
+	NoError(t, json.Unmarshal(ic.manifest, &m))
+	Equal(t, "ACME", m.Name)
+	Equal(t, "/files/", m.StartURL)
+	Len(t, m.Icons, 2)
+	Equal(t, "/files/_janus/icon-512.png", m.Icons[1].Src)
+	Equal(t, "512x512", m.Icons[1].Sizes)
+	Contains(t, ic.pngs, "icon-192.png")
+}
+
+func Test_serveIcons(t *testing.T) {
+	root := t.TempDir()
+	a := app{ServerRoot: root, Prefix: "/files/"}
+	a.icons = newIcons(a)
+	h := serveIcons(a, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}))
+	serve := func(method, target string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(method, target, nil))
+		return w
+	}
+
+	for target, ct := range map[string]string{
+		"/favicon.ico":                    "image/x-icon",
+		"/files/favicon.ico":              "image/x-icon",
+		"/files/manifest.webmanifest":     "application/manifest+json",
+		"/files/_janus/icon-192.png":      "image/png",
+		"/files/_janus/icon-512.png":      "image/png",
+		"/files/_janus/icon-1024.png":     "",
+		"/manifest.webmanifest":           "",
+		"/files/dir/manifest.webmanifest": "",
+	} {
+		w := serve(http.MethodGet, target)
+		if ct == "" {
+			Equal(t, http.StatusTeapot, w.Code, target)
+			continue
+		}
+		Equal(t, http.StatusOK, w.Code, target)
+		Equal(t, ct, w.Header().Get("Content-Type"), target)
+	}
+	Equal(t, http.StatusTeapot, serve(http.MethodPost, "/favicon.ico").Code)
+
+	NoError(t, os.WriteFile(filepath.Join(root, "favicon.ico"), []byte("custom"), 0600))
+	w := serve(http.MethodGet, "/favicon.ico")
+	Equal(t, http.StatusOK, w.Code)
+	Equal(t, "custom", w.Body.String())
+}
@@ -0,0 +1,71 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/rs/zerolog"
+)
+
+// publicPrincipal grants a permission to everyone, including anonymous clients.
+const publicPrincipal = "public"
+
+// identity describes an authenticated client.
+type identity struct {
+	name   string
+	groups []string
+}
+
+// withIdentity attaches the identity to the request and adds the user name to the access log.
+func withIdentity(r *http.Request, id *identity) *http.Request {
+	if e, ok := r.Context().Value(logger).(*zerolog.Event); ok {
+		e.Str("user", id.name)
+	}
+	return r.WithContext(context.WithValue(r.Context(), principal, id))
+}
+
+// identityFrom returns the identity of the client, or nil if it is anonymous.
+func identityFrom(ctx context.Context) *identity {
+	id, _ := ctx.Value(principal).(*identity)
+	return id
+}
+
+// inGroup reports whether the identity is a member of the group.
+func (id *identity) inGroup(g string) bool {
+	for _, ig := range id.groups {
+		if ig == g {
+			return true
+		}
+	}
+	return false
+}
+
+// is reports whether the principal, i.e., a user name, a group name prefixed with "@" or "public",
+// denotes the identity. A nil identity (anonymous client) is only denoted by "public".
+func (id *identity) is(p string) bool {
+	switch {
+	case p == publicPrincipal:
+		return true
+	case id == nil:
+		return false
+	case strings.HasPrefix(p, "@"):
+		return id.inGroup(p[1:])
+	default:
+		return p == id.name
+	}
+}
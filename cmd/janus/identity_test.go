@@ -0,0 +1,36 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"testing"
+
+	. "github.com/stretchr/testify/require"
+)
+
+func Test_identity_is(t *testing.T) {
+	var anon *identity
+	alice := &identity{name: "alice", groups: []string{"staff"}}
+
+	True(t, anon.is(publicPrincipal))
+	False(t, anon.is("alice"))
+	False(t, anon.is("@staff"))
+	True(t, alice.is(publicPrincipal))
+	True(t, alice.is("alice"))
+	True(t, alice.is("@staff"))
+	False(t, alice.is("bob"))
+	False(t, alice.is("@ops"))
+	False(t, alice.is("staff"))
+}
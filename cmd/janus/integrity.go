@@ -0,0 +1,164 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// integrityCacheSize is the maximum number of cached integrity hashes.
+const integrityCacheSize = 10000
+
+// integrityHash is the Subresource Integrity hash of a file at a certain point in time.
+type integrityHash struct {
+	size    int64
+	modTime time.Time
+	value   string
+}
+
+// integrityHashes computes Subresource Integrity hashes (sha384) and caches them until a file is modified.
+type integrityHashes struct {
+	lru *lru[string, integrityHash]
+}
+
+// integrityEntry is the JSON representation of a file and its integrity hash.
+type integrityEntry struct {
+	Path      string `json:"path"`
+	Integrity string `json:"integrity"`
+}
+
+// newIntegrityHashes creates an empty cache of integrity hashes.
+func newIntegrityHashes() *integrityHashes {
+	return &integrityHashes{lru: newLRU[string, integrityHash](integrityCacheSize, nil)}
+}
+
+// hash returns the integrity hash of the named file e.g., "sha384-<base64 digest>".
+// Reading stops as soon as the context is done.
+func (ih *integrityHashes) hash(ctx context.Context, name string, fi os.FileInfo) (string, error) {
+	if h, ok := ih.lru.Get(name); ok && h.size == fi.Size() && h.modTime.Equal(fi.ModTime()) {
+		return h.value, nil
+	}
+
+	f, err := openFS(ctx, name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	d := sha512.New384()
+	if _, err := copyContext(ctx, d, f); err != nil {
+		return "", err
+	}
+	v := "sha384-" + base64.StdEncoding.EncodeToString(d.Sum(nil))
+	ih.lru.Add(name, integrityHash{fi.Size(), fi.ModTime(), v})
+	return v, nil
+}
+
+// isSubresource reports whether the file is a script or style sheet, which is typically embedded in other pages.
+func isSubresource(name string) bool {
+	switch strings.ToLower(path.Ext(name)) {
+	case ".js", ".mjs", ".css":
+		return true
+	}
+	return false
+}
+
+// handleIntegrity responds with the integrity hash of the requested file.
+// For directories, all scripts and style sheets below are listed, one "<hash> <path>" per line,
+// or as JSON array, if the client accepts JSON.
+func handleIntegrity(a app) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := filepath.Join(rootDir(a, r), filepath.FromSlash(r.URL.Path))
+		fi, err := os.Stat(name)
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		release, ok := a.pools.acquire(w, r, poolChecksum)
+		if !ok {
+			return
+		}
+		defer release()
+
+		if !fi.IsDir() {
+			v, err := a.integrity.hash(r.Context(), name, fi)
+			if err != nil {
+				renderError(w, r, err, "cannot compute integrity hash", http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			_, _ = renderMsg(w, v+"\n")
+			return
+		}
+
+		var es []integrityEntry
+		err = filepath.WalkDir(name, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			} else if err := r.Context().Err(); err != nil {
+				return err
+			} else if p != name && strings.HasPrefix(d.Name(), ".") {
+				if d.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			} else if !d.Type().IsRegular() || !isSubresource(d.Name()) {
+				return nil
+			}
+
+			fi, err := d.Info()
+			if err != nil {
+				return err
+			}
+			v, err := a.integrity.hash(r.Context(), p, fi)
+			if err != nil {
+				return err
+			}
+			rel, err := filepath.Rel(name, p)
+			if err != nil {
+				return err
+			}
+			es = append(es, integrityEntry{path.Join(a.Prefix, r.URL.Path, filepath.ToSlash(rel)), v})
+			return nil
+		})
+		if err != nil {
+			renderError(w, r, err, "cannot compute integrity hash", http.StatusInternalServerError)
+			return
+		}
+
+		if strings.Contains(r.Header.Get("Accept"), "application/json") {
+			w.Header().Set("Content-Type", "application/json")
+			if es == nil {
+				es = []integrityEntry{}
+			}
+			_ = json.NewEncoder(w).Encode(es)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		for _, e := range es {
+			_, _ = renderMsg(w, e.Integrity+" "+e.Path+"\n")
+		}
+	}
+}
@@ -0,0 +1,99 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/stretchr/testify/require"
+)
+
+// sriAlert is the integrity hash of "alert(1);\n" (openssl dgst -sha384 -binary | openssl base64 -A).
+const sriAlert = "sha384-bGe/RBNQDjw1oSdQQ9Orj3inXga8nL70PiYuibiYD7weMiTyu/Y+coqsWPmeVsqL"
+
+func Test_integrityHashes_hash(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "app.js")
+	NoError(t, os.WriteFile(name, []byte("alert(1);\n"), 0600))
+	fi, err := os.Stat(name)
+	NoError(t, err)
+
+	ih := newIntegrityHashes()
+	v, err := ih.hash(context.Background(), name, fi)
+	NoError(t, err)
+	Equal(t, sriAlert, v)
+
+	NoError(t, os.WriteFile(name, []byte("alert(2);\n"), 0600))
+	v, err = ih.hash(context.Background(), name, fi)
+	NoError(t, err)
+	Equal(t, sriAlert, v, "cached until the file is modified")
+
+	mod := fi.ModTime().Add(time.Second)
+	NoError(t, os.Chtimes(name, mod, mod))
+	fi, err = os.Stat(name)
+	NoError(t, err)
+	v, err = ih.hash(context.Background(), name, fi)
+	NoError(t, err)
+	NotEqual(t, sriAlert, v)
+}
+
+func Test_isSubresource(t *testing.T) {
+	True(t, isSubresource("app.js"))
+	True(t, isSubresource("module.mjs"))
+	True(t, isSubresource("STYLE.CSS"))
+	False(t, isSubresource("index.html"))
+	False(t, isSubresource("js"))
+}
+
+func Test_handleIntegrity(t *testing.T) {
+	root := t.TempDir()
+	NoError(t, os.MkdirAll(filepath.Join(root, "assets", "js"), 0700))
+	NoError(t, os.MkdirAll(filepath.Join(root, "assets", ".cache"), 0700))
+	for _, name := range []string{"assets/js/app.js", "assets/.cache/old.js", "assets/index.html"} {
+		NoError(t, os.WriteFile(filepath.Join(root, name), []byte("alert(1);\n"), 0600))
+	}
+
+	a := app{ServerRoot: root, Prefix: "/static/", integrity: newIntegrityHashes()}
+	rec := httptest.NewRecorder()
+	handleIntegrity(a).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/assets/js/app.js?integrity", nil))
+	Equal(t, http.StatusOK, rec.Code)
+	Equal(t, sriAlert+"\n", rec.Body.String())
+
+	rec = httptest.NewRecorder()
+	handleIntegrity(a).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/assets/?integrity", nil))
+	Equal(t, sriAlert+" /static/assets/js/app.js\n", rec.Body.String())
+
+	req := httptest.NewRequest(http.MethodGet, "/assets/?integrity", nil)
+	req.Header.Set("Accept", "application/json")
+	rec = httptest.NewRecorder()
+	handleIntegrity(a).ServeHTTP(rec, req)
+	Equal(t, "application/json", rec.Header().Get("Content-Type"))
+	JSONEq(t, `[{"path": "/static/assets/js/app.js", "integrity": "`+sriAlert+`"}]`, rec.Body.String())
+
+	req = httptest.NewRequest(http.MethodGet, "/assets/.cache/?integrity", nil)
+	req.Header.Set("Accept", "application/json")
+	rec = httptest.NewRecorder()
+	handleIntegrity(a).ServeHTTP(rec, req)
+	JSONEq(t, `[{"path": "/static/assets/.cache/old.js", "integrity": "`+sriAlert+`"}]`, rec.Body.String())
+
+	rec = httptest.NewRecorder()
+	handleIntegrity(a).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/missing.js?integrity", nil))
+	Equal(t, http.StatusNotFound, rec.Code)
+}
@@ -0,0 +1,110 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+// ipFilter permits or denies requests by the IP address of the client.
+type ipFilter struct {
+	allow []*net.IPNet
+	deny  []*net.IPNet
+	// writeOnly exempts GET and HEAD requests, so that downloads are permitted to everyone.
+	writeOnly bool
+}
+
+// newIPFilter parses the allowed and denied networks.
+// If neither is configured, nil is returned.
+func newIPFilter(allow, deny []string, scope string) (*ipFilter, error) {
+	if len(allow) == 0 && len(deny) == 0 {
+		return nil, nil
+	}
+
+	f := &ipFilter{writeOnly: scope == "write"}
+	var err error
+	if f.allow, err = parseCIDRs(allow); err != nil {
+		return nil, err
+	} else if f.deny, err = parseCIDRs(deny); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// parseCIDRs parses networks in CIDR notation e.g., "10.0.0.0/8".
+// Single IP addresses are accepted as well.
+func parseCIDRs(specs []string) ([]*net.IPNet, error) {
+	ns := make([]*net.IPNet, 0, len(specs))
+	for _, s := range specs {
+		s = strings.TrimSpace(s)
+		if ip := net.ParseIP(s); ip != nil {
+			bits := 8 * net.IPv6len
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 8*net.IPv4len
+			}
+			ns = append(ns, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid network %q (must be an IP address or CIDR notation)", s)
+		}
+		ns = append(ns, n)
+	}
+	return ns, nil
+}
+
+// permits reports whether the IP address is not denied, and allowed if there are allowed networks.
+func (f *ipFilter) permits(ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	for _, n := range f.deny {
+		if n.Contains(ip) {
+			return false
+		}
+	}
+	for _, n := range f.allow {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return len(f.allow) == 0
+}
+
+// filterIPs rejects requests of clients, which are not permitted by the filter, with "403 Forbidden".
+// If f is nil, h is returned as is.
+func filterIPs(f *ipFilter, h http.Handler) http.Handler {
+	if f == nil {
+		return h
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if f.writeOnly && (r.Method == http.MethodGet || r.Method == http.MethodHead) ||
+			f.permits(net.ParseIP(clientIP(r))) {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		log.Warn().Str("request-id", requestIDFrom(r.Context())).Str("client", clientIP(r)).
+			Str("method", r.Method).Str("path", r.URL.Path).Msg("Client IP denied")
+		renderError(w, r, errAccessDenied, "access denied", http.StatusForbidden)
+	})
+}
@@ -0,0 +1,72 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	. "github.com/stretchr/testify/require"
+)
+
+func Test_newIPFilter(t *testing.T) {
+	f, err := newIPFilter(nil, nil, "all")
+	NoError(t, err)
+	Nil(t, f)
+
+	_, err = newIPFilter([]string{"10.0.0.0/33"}, nil, "all")
+	EqualError(t, err, `invalid network "10.0.0.0/33" (must be an IP address or CIDR notation)`)
+	_, err = newIPFilter(nil, []string{"office"}, "all")
+	EqualError(t, err, `invalid network "office" (must be an IP address or CIDR notation)`)
+}
+
+func Test_ipFilter_permits(t *testing.T) {
+	f, err := newIPFilter([]string{"10.0.0.0/8", "2001:db8::/32", "192.0.2.1"}, []string{"10.1.0.0/16"}, "all")
+	NoError(t, err)
+	True(t, f.permits(net.ParseIP("10.2.3.4")))
+	True(t, f.permits(net.ParseIP("2001:db8::1")))
+	True(t, f.permits(net.ParseIP("192.0.2.1")))
+	False(t, f.permits(net.ParseIP("192.0.2.2")))
+	False(t, f.permits(net.ParseIP("10.1.2.3")))
+	False(t, f.permits(nil))
+
+	f, err = newIPFilter(nil, []string{"::1"}, "all")
+	NoError(t, err)
+	True(t, f.permits(net.ParseIP("127.0.0.1")))
+	False(t, f.permits(net.ParseIP("::1")))
+}
+
+func Test_filterIPs(t *testing.T) {
+	serve := func(f *ipFilter, method, remoteAddr string) int {
+		r := httptest.NewRequest(method, "/a.txt", nil)
+		r.RemoteAddr = remoteAddr
+		w := httptest.NewRecorder()
+		filterIPs(f, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).ServeHTTP(w, r)
+		return w.Code
+	}
+
+	f, err := newIPFilter([]string{"10.0.0.0/8"}, nil, "all")
+	NoError(t, err)
+	Equal(t, http.StatusOK, serve(f, http.MethodPost, "10.0.0.1:1234"))
+	Equal(t, http.StatusForbidden, serve(f, http.MethodGet, "192.0.2.1:1234"))
+
+	f.writeOnly = true
+	Equal(t, http.StatusOK, serve(f, http.MethodGet, "192.0.2.1:1234"))
+	Equal(t, http.StatusOK, serve(f, http.MethodHead, "192.0.2.1:1234"))
+	Equal(t, http.StatusForbidden, serve(f, http.MethodPut, "192.0.2.1:1234"))
+	Equal(t, http.StatusOK, serve(nil, http.MethodPut, "192.0.2.1:1234"))
+}
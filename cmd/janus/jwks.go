@@ -0,0 +1,170 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/rs/zerolog/log"
+)
+
+// jwksRefreshInterval is the minimum duration between fetching the keys again, because of an unknown key ID.
+const jwksRefreshInterval = time.Minute
+
+// jwtMethods are the signature algorithms accepted for JWTs. Symmetric algorithms and "none" are not supported.
+var jwtMethods = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512"}
+
+// errUnknownKey indicates that a JWT was signed by a key, which is not published by the issuer.
+var errUnknownKey = errors.New("unknown signing key")
+
+// jsonWebKey is a public key as published in a JSON Web Key Set (RFC 7517).
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// jwks holds the public keys of an issuer, which are fetched from its JWKS URL.
+// Since issuers rotate their keys, the set is fetched again when a JWT refers to an unknown key.
+type jwks struct {
+	url    string
+	client *http.Client
+
+	mu      sync.Mutex
+	keys    map[string]crypto.PublicKey
+	fetched time.Time
+}
+
+// newJWKS creates a key set, which is fetched from the given URL on first use.
+func newJWKS(u string) *jwks {
+	return &jwks{url: u, client: &http.Client{Timeout: 10 * time.Second, Transport: outboundTransport}}
+}
+
+// keyFunc returns the key, which signed the token. It is intended to be used with jwt.Parse.
+// If the token does not name a key, the only key of the set is used.
+func (ks *jwks) keyFunc(t *jwt.Token) (interface{}, error) {
+	kid, _ := t.Header["kid"].(string)
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	if k, ok := ks.lookup(kid); ok {
+		return k, nil
+	} else if time.Since(ks.fetched) < jwksRefreshInterval {
+		return nil, fmt.Errorf("%w: %q", errUnknownKey, kid)
+	}
+	if err := ks.fetch(); err != nil {
+		return nil, err
+	} else if k, ok := ks.lookup(kid); ok {
+		return k, nil
+	}
+	return nil, fmt.Errorf("%w: %q", errUnknownKey, kid)
+}
+
+// lookup returns the key with the given ID.
+func (ks *jwks) lookup(kid string) (crypto.PublicKey, bool) {
+	if kid == "" && len(ks.keys) == 1 {
+		for _, k := range ks.keys {
+			return k, true
+		}
+	}
+	k, ok := ks.keys[kid]
+	return k, ok
+}
+
+// fetch replaces the keys with the ones currently published by the issuer.
+// Keys of unsupported types or for purposes other than signing are skipped.
+func (ks *jwks) fetch() error {
+	ks.fetched = time.Now()
+	res, err := ks.client.Get(ks.url)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("cannot fetch JWKS from %s: %s", ks.url, res.Status)
+	}
+
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&set); err != nil {
+		return fmt.Errorf("invalid JWKS at %s: %w", ks.url, err)
+	}
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		pk, err := parseJWK(k)
+		if err != nil {
+			log.Warn().Str("jwks", ks.url).Str("kid", k.Kid).Err(err).Msg("Skipping JSON Web Key")
+			continue
+		}
+		keys[k.Kid] = pk
+	}
+	ks.keys = keys
+	log.Info().Str("jwks", ks.url).Int("keys", len(keys)).Msg("Fetched JSON Web Keys")
+	return nil
+}
+
+// parseJWK converts an RSA or EC key to its public key.
+func parseJWK(k jsonWebKey) (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err1 := base64.RawURLEncoding.DecodeString(k.N)
+		e, err2 := base64.RawURLEncoding.DecodeString(k.E)
+		if err1 != nil || err2 != nil || len(n) == 0 || len(e) == 0 || len(e) > 4 {
+			return nil, errors.New("invalid RSA key")
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		var c elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			c = elliptic.P256()
+		case "P-384":
+			c = elliptic.P384()
+		case "P-521":
+			c = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err1 := base64.RawURLEncoding.DecodeString(k.X)
+		y, err2 := base64.RawURLEncoding.DecodeString(k.Y)
+		pk := &ecdsa.PublicKey{Curve: c, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if err1 != nil || err2 != nil || !c.IsOnCurve(pk.X, pk.Y) {
+			return nil, errors.New("invalid EC key")
+		}
+		return pk, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+}
@@ -0,0 +1,93 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	. "github.com/stretchr/testify/require"
+)
+
+func Test_parseJWK(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	NoError(t, err)
+	jwk := jsonWebKey{Kty: "EC", Crv: "P-256",
+		X: base64.RawURLEncoding.EncodeToString(key.X.Bytes()),
+		Y: base64.RawURLEncoding.EncodeToString(key.Y.Bytes())}
+
+	pk, err := parseJWK(jwk)
+	NoError(t, err)
+	True(t, key.PublicKey.Equal(pk))
+
+	jwk.Y = jwk.X
+	_, err = parseJWK(jwk)
+	EqualError(t, err, "invalid EC key")
+	_, err = parseJWK(jsonWebKey{Kty: "EC", Crv: "P-192"})
+	EqualError(t, err, `unsupported curve "P-192"`)
+	_, err = parseJWK(jsonWebKey{Kty: "oct"})
+	EqualError(t, err, `unsupported key type "oct"`)
+	_, err = parseJWK(jsonWebKey{Kty: "RSA", N: "AQAB"})
+	EqualError(t, err, "invalid RSA key")
+}
+
+func Test_jwks_keyFunc(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	NoError(t, err)
+	kid, fetches := "k1", 0
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches++
+		_ = json.NewEncoder(w).Encode(map[string][]jsonWebKey{"keys": {
+			{Kty: "EC", Kid: kid, Crv: "P-256",
+				X: base64.RawURLEncoding.EncodeToString(key.X.Bytes()),
+				Y: base64.RawURLEncoding.EncodeToString(key.Y.Bytes())},
+			{Kty: "RSA", Kid: "enc", Use: "enc"},
+		}})
+	}))
+	defer s.Close()
+
+	ks := newJWKS(s.URL)
+	tok := &jwt.Token{Header: map[string]interface{}{"kid": "k1"}}
+	pk, err := ks.keyFunc(tok)
+	NoError(t, err)
+	True(t, key.PublicKey.Equal(pk))
+	_, err = ks.keyFunc(tok)
+	NoError(t, err)
+	Equal(t, 1, fetches, "known keys must be cached")
+
+	// rotated keys are fetched again, but not more than once per interval
+	kid = "k2"
+	_, err = ks.keyFunc(&jwt.Token{Header: map[string]interface{}{"kid": "k2"}})
+	ErrorIs(t, err, errUnknownKey)
+	Equal(t, 1, fetches)
+	ks.fetched = ks.fetched.Add(-2 * jwksRefreshInterval)
+	_, err = ks.keyFunc(&jwt.Token{Header: map[string]interface{}{"kid": "k2"}})
+	NoError(t, err)
+	Equal(t, 2, fetches)
+
+	// tokens without a key ID are verified with the only key
+	_, err = ks.keyFunc(&jwt.Token{Header: map[string]interface{}{}})
+	NoError(t, err)
+	Len(t, ks.keys, 1, "keys not used for signatures must be skipped")
+	True(t, time.Since(ks.fetched) < time.Minute)
+}
@@ -0,0 +1,170 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// jwtAuth authenticates API clients e.g., CI pipelines, by JWTs passed as bearer tokens.
+type jwtAuth struct {
+	keyFunc     jwt.Keyfunc
+	issuer      string
+	audience    string
+	userClaim   string
+	groupsClaim string
+	logClaims   []string
+	// roles maps groups to the access they grant (true means read-write).
+	roles map[string]bool
+}
+
+// newJWTAuth creates an authenticator, which verifies JWTs with the keys published at the JWKS URL,
+// or with a static public key.
+// If neither is configured, nil is returned.
+func newJWTAuth(a app) (*jwtAuth, error) {
+	if a.AuthJWTJWKSURL == "" && a.AuthJWTKey == "" {
+		return nil, nil
+	} else if a.AuthJWTJWKSURL != "" && a.AuthJWTKey != "" {
+		return nil, errors.New("JWT authentication requires either a JWKS URL or a key, but not both")
+	} else if a.AuthJWTAudience == "" {
+		// without an audience, tokens issued for other services would be accepted
+		return nil, errors.New("JWT authentication requires an audience")
+	}
+
+	roles := make(map[string]bool, len(a.AuthJWTRoles))
+	for g, acc := range a.AuthJWTRoles {
+		if acc != "ro" && acc != "rw" {
+			return nil, fmt.Errorf("invalid access for JWT group %q (must be ro or rw): %s", g, acc)
+		}
+		roles[g] = acc == "rw"
+	}
+
+	ja := &jwtAuth{issuer: a.AuthJWTIssuer, audience: a.AuthJWTAudience, userClaim: a.AuthJWTUserClaim,
+		groupsClaim: a.AuthJWTGroupsClaim, logClaims: a.AuthJWTLogClaims, roles: roles}
+	if a.AuthJWTJWKSURL != "" {
+		ja.keyFunc = newJWKS(a.AuthJWTJWKSURL).keyFunc
+	} else {
+		key, err := loadPublicKey(a.AuthJWTKey)
+		if err != nil {
+			return nil, err
+		}
+		ja.keyFunc = func(*jwt.Token) (interface{}, error) { return key, nil }
+	}
+	return ja, nil
+}
+
+// loadPublicKey reads a PEM encoded RSA or ECDSA public key (or a certificate containing it).
+func loadPublicKey(name string) (interface{}, error) {
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	if k, err := jwt.ParseRSAPublicKeyFromPEM(b); err == nil {
+		return k, nil
+	} else if k, err := jwt.ParseECPublicKeyFromPEM(b); err == nil {
+		return k, nil
+	}
+	return nil, fmt.Errorf("no RSA or ECDSA public key found in %s", name)
+}
+
+// authenticate verifies bearer tokens, which are JWTs, and passes the request to authed.
+// Valid tokens are permitted according to their groups (see access), and invalid ones are rejected.
+// Requests without a JWT are passed to h.
+// If ja is nil, h is returned as is.
+func (ja *jwtAuth) authenticate(authed, h http.Handler) http.Handler {
+	if ja == nil {
+		return h
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tok := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if tok == r.Header.Get("Authorization") || strings.Count(tok, ".") != 2 {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		claims, err := ja.verify(tok, time.Now())
+		if err != nil {
+			log.Warn().Str("request-id", requestIDFrom(r.Context())).Str("client", clientIP(r)).Err(err).
+				Msg("Invalid JWT")
+			w.Header().Set("WWW-Authenticate", `Bearer realm="`+realm+`", error="invalid_token"`)
+			renderError(w, r, errAccessDenied, "invalid token", http.StatusUnauthorized)
+			return
+		}
+
+		id := &identity{name: claimStrings(claims, ja.userClaim)[0], groups: claimStrings(claims, ja.groupsClaim)}
+		if e, ok := r.Context().Value(logger).(*zerolog.Event); ok {
+			d := zerolog.Dict()
+			for _, c := range append([]string{"iss", "sub"}, ja.logClaims...) {
+				if v, ok := claims[c]; ok {
+					d.Interface(c, v)
+				}
+			}
+			e.Dict("jwt", d)
+		}
+
+		readWrite, ok := ja.access(id.groups)
+		if ok && (readWrite || r.Method == http.MethodGet || r.Method == http.MethodHead) {
+			authed.ServeHTTP(w, withIdentity(r, id))
+			return
+		}
+		log.Warn().Str("request-id", requestIDFrom(r.Context())).Str("user", id.name).
+			Str("method", r.Method).Str("path", r.URL.Path).Msg("JWT not authorized")
+		renderError(w, r, errAccessDenied, "access denied", http.StatusForbidden)
+	})
+}
+
+// access determines whether the groups grant any access and if so, whether it includes writing.
+// If no roles are configured, every valid token grants read-write access.
+func (ja *jwtAuth) access(groups []string) (readWrite, ok bool) {
+	if len(ja.roles) == 0 {
+		return true, true
+	}
+	for _, g := range groups {
+		if rw, found := ja.roles[g]; found {
+			readWrite, ok = readWrite || rw, true
+		}
+	}
+	return readWrite, ok
+}
+
+// verify checks the signature, issuer (if configured), audience and expiry of a JWT and returns its claims.
+// Tokens without an expiry are rejected, because they would be valid forever.
+func (ja *jwtAuth) verify(tok string, now time.Time) (jwt.MapClaims, error) {
+	claims := jwt.MapClaims{}
+	if _, err := jwt.ParseWithClaims(tok, claims, ja.keyFunc, jwt.WithValidMethods(jwtMethods)); err != nil {
+		return nil, err
+	}
+	switch {
+	case ja.issuer != "" && !claims.VerifyIssuer(ja.issuer, true):
+		return nil, errors.New("issuer mismatch")
+	case !claims.VerifyAudience(ja.audience, true):
+		return nil, errors.New("audience mismatch")
+	case !claims.VerifyExpiresAt(now.Unix(), true):
+		return nil, errors.New("token is expired or has no expiry")
+	case len(claimStrings(claims, ja.userClaim)) == 0:
+		return nil, fmt.Errorf("missing claim %q", ja.userClaim)
+	}
+	return claims, nil
+}
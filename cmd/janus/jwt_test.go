@@ -0,0 +1,131 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/rs/zerolog/log"
+	. "github.com/stretchr/testify/require"
+)
+
+func Test_newJWTAuth(t *testing.T) {
+	ja, err := newJWTAuth(app{})
+	NoError(t, err)
+	Nil(t, ja)
+
+	_, err = newJWTAuth(app{AuthJWTJWKSURL: "https://login.example.com/keys", AuthJWTKey: "key.pem"})
+	EqualError(t, err, "JWT authentication requires either a JWKS URL or a key, but not both")
+	_, err = newJWTAuth(app{AuthJWTJWKSURL: "https://login.example.com/keys"})
+	EqualError(t, err, "JWT authentication requires an audience")
+	_, err = newJWTAuth(app{AuthJWTJWKSURL: "https://login.example.com/keys", AuthJWTAudience: "janus",
+		AuthJWTRoles: map[string]string{"ci": "admin"}})
+	EqualError(t, err, `invalid access for JWT group "ci" (must be ro or rw): admin`)
+
+	f := filepath.Join(t.TempDir(), "key.pem")
+	NoError(t, os.WriteFile(f, []byte("no key"), 0600))
+	_, err = newJWTAuth(app{AuthJWTKey: f, AuthJWTAudience: "janus"})
+	EqualError(t, err, "no RSA or ECDSA public key found in "+f)
+}
+
+func Test_jwtAuth_authenticate(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	NoError(t, err)
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	NoError(t, err)
+	f := filepath.Join(t.TempDir(), "key.pem")
+	NoError(t, os.WriteFile(f, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0600))
+
+	ja, err := newJWTAuth(app{AuthJWTKey: f, AuthJWTIssuer: "https://ci.example.com", AuthJWTAudience: "janus",
+		AuthJWTUserClaim: "sub", AuthJWTGroupsClaim: "groups", AuthJWTLogClaims: []string{"pipeline"},
+		AuthJWTRoles: map[string]string{"ci": "rw", "dev": "ro"}})
+	NoError(t, err)
+
+	authed := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(identityFrom(r.Context()).name))
+	})
+	h := logHandler(nil, ja.authenticate(authed, http.NotFoundHandler()))
+	sign := func(claims jwt.MapClaims) string {
+		c := jwt.MapClaims{"iss": "https://ci.example.com", "aud": "janus", "sub": "build",
+			"exp": time.Now().Add(time.Minute).Unix(), "groups": []string{"ci"}}
+		for k, v := range claims {
+			c[k] = v
+		}
+		s, err := jwt.NewWithClaims(jwt.SigningMethodES256, c).SignedString(key)
+		NoError(t, err)
+		return s
+	}
+	serve := func(method, auth string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, "/a.txt", nil)
+		r.Header.Set("Authorization", auth)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	b := &bytes.Buffer{}
+	orig := log.Logger
+	log.Logger = log.Output(b)
+	t.Cleanup(func() { log.Logger = orig })
+
+	w := serve(http.MethodPost, "Bearer "+sign(jwt.MapClaims{"pipeline": 42}))
+	Equal(t, http.StatusOK, w.Code)
+	Equal(t, "build", w.Body.String())
+	Contains(t, b.String(), `"jwt":{"iss":"https://ci.example.com","sub":"build","pipeline":42}`)
+	Contains(t, b.String(), `"user":"build"`)
+
+	Equal(t, http.StatusOK, serve(http.MethodGet, "Bearer "+sign(jwt.MapClaims{"groups": "dev"})).Code)
+	Equal(t, http.StatusForbidden, serve(http.MethodPut, "Bearer "+sign(jwt.MapClaims{"groups": "dev"})).Code)
+	Equal(t, http.StatusForbidden, serve(http.MethodGet, "Bearer "+sign(jwt.MapClaims{"groups": nil})).Code)
+
+	for _, claims := range []jwt.MapClaims{
+		{"aud": "other"},
+		{"iss": "https://other.example.com"},
+		{"exp": time.Now().Add(-time.Minute).Unix()},
+		{"exp": nil},
+		{"sub": nil},
+	} {
+		w = serve(http.MethodGet, "Bearer "+sign(claims))
+		Equal(t, http.StatusUnauthorized, w.Code, claims)
+		Contains(t, w.Header().Get("WWW-Authenticate"), `error="invalid_token"`)
+	}
+
+	// other bearer tokens e.g., of tenants, and other schemes are left to the next handler
+	Equal(t, http.StatusNotFound, serve(http.MethodGet, "Bearer s3cr3t").Code)
+	Equal(t, http.StatusNotFound, serve(http.MethodGet, "Basic YWxpY2U6czNjcjN0").Code)
+}
+
+func Test_jwtAuth_JWKS(t *testing.T) {
+	idp := newTestIDP(t)
+	ja, err := newJWTAuth(app{AuthJWTJWKSURL: idp.URL + "/jwks", AuthJWTAudience: "janus", AuthJWTUserClaim: "sub"})
+	NoError(t, err)
+
+	idp.claims = jwt.MapClaims{"sub": "build"}
+	claims, err := ja.verify(idp.sign(t, ""), time.Now())
+	NoError(t, err)
+	Equal(t, "build", claims["sub"])
+}
@@ -0,0 +1,131 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	// errAlreadyRunning indicates that another instance holds the PID file.
+	errAlreadyRunning = errors.New("another instance is already running")
+	// errRestartConfined indicates that a confined process cannot start a new instance of itself.
+	errRestartConfined = errors.New("graceful restarts are not supported with user, group, chroot or sandbox")
+)
+
+// confined reports whether the process drops its privileges, changes its root directory or enables the sandbox
+// after startup, hence may lose access to files outside the server root.
+func confined(a app) bool {
+	return a.User != "" || a.Group != "" || a.Chroot || a.Sandbox
+}
+
+// restartFunc returns the function, which hands over the listeners to a new process on a restart signal.
+// After dropping privileges, changing the root directory or enabling the sandbox, the new process could neither
+// apply them again nor execute the binary, hence restarts are refused.
+func restartFunc(a app, ls []net.Listener) func() error {
+	if confined(a) {
+		return func() error { return errRestartConfined }
+	}
+	return func() error { return restart(ls) }
+}
+
+// serve handles requests on all listeners until the process receives SIGINT or SIGTERM.
+// Then, it stops accepting new connections and waits up to timeout for in-flight requests to complete.
+//
+// On a restart signal (see restartSignals), restart is invoked to hand over the listeners to a new process.
+// If that succeeds, the server shuts down gracefully, too.
+func serve(s *http.Server, ls []net.Listener, timeout time.Duration, restart func() error) error {
+	errc := make(chan error, len(ls))
+	for _, l := range ls {
+		go func(l net.Listener) { errc <- s.Serve(l) }(l)
+	}
+
+	sig, rsig := make(chan os.Signal, 1), make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sig)
+	if len(restartSignals) > 0 {
+		signal.Notify(rsig, restartSignals...)
+		defer signal.Stop(rsig)
+	}
+
+	for {
+		select {
+		case err := <-errc:
+			return err
+		case sg := <-rsig:
+			log.Info().Stringer("signal", sg).Msg("Restarting server")
+			if err := restart(); err != nil {
+				log.Error().Err(err).Msg("Cannot restart server")
+				continue
+			}
+		case sg := <-sig:
+			log.Info().Stringer("signal", sg).Msg("Received signal")
+		}
+
+		log.Info().Dur("timeout", timeout).Msg("Shutting down server")
+		_ = sdNotify("STOPPING=1")
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		return s.Shutdown(ctx)
+	}
+}
+
+// createPIDFile writes the process ID to the named file.
+// It fails if the file refers to another running process.
+// Stale files of processes, which are not running anymore, are replaced.
+func createPIDFile(name string) error {
+	if b, err := os.ReadFile(name); err == nil {
+		// during a graceful restart, the file is taken over from the parent process
+		pid, err := strconv.Atoi(strings.TrimSpace(string(b)))
+		if err == nil && pid != os.Getpid() && pid != os.Getppid() && processAlive(pid) {
+			return fmt.Errorf("%w (PID %d)", errAlreadyRunning, pid)
+		}
+		log.Warn().Str("pid-file", name).Msg("Replacing PID file")
+		if err = os.Remove(name); err != nil {
+			return err
+		}
+	}
+
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err = f.WriteString(strconv.Itoa(os.Getpid()) + "\n"); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// removePIDFile deletes the named file, if it contains the ID of the current process.
+func removePIDFile(name string) {
+	if b, err := os.ReadFile(name); err != nil || strings.TrimSpace(string(b)) != strconv.Itoa(os.Getpid()) {
+		return
+	} else if err = os.Remove(name); err != nil {
+		log.Warn().Str("pid-file", name).Err(err).Msg("Cannot remove PID file")
+	}
+}
@@ -0,0 +1,48 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !unix
+
+package main
+
+import (
+	"net"
+	"os"
+)
+
+// restartSignals is empty, because graceful restarts are not supported on this platform.
+var restartSignals []os.Signal
+
+// reloadSignals is empty, because there is no equivalent of SIGHUP on this platform.
+var reloadSignals []os.Signal
+
+// processAlive reports whether a process with the given ID exists.
+func processAlive(pid int) bool {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	_ = p.Release()
+	return true
+}
+
+// inheritedListeners returns nil, because graceful restarts are not supported on this platform.
+func inheritedListeners() ([]net.Listener, error) {
+	return nil, nil
+}
+
+// restart is not supported on this platform.
+func restart([]net.Listener) error {
+	return errNotSupported
+}
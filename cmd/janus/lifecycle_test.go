@@ -0,0 +1,59 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	. "github.com/stretchr/testify/require"
+)
+
+func Test_createPIDFile(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "janus.pid")
+	NoError(t, createPIDFile(p))
+	b, err := os.ReadFile(p)
+	NoError(t, err)
+	Equal(t, strconv.Itoa(os.Getpid())+"\n", string(b))
+
+	removePIDFile(p)
+	NoFileExists(t, p)
+}
+
+func Test_createPIDFile_Running(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "janus.pid")
+	NoError(t, os.WriteFile(p, []byte("1"), 0600))
+	ErrorIs(t, createPIDFile(p), errAlreadyRunning)
+
+	// files of other processes must be retained
+	removePIDFile(p)
+	FileExists(t, p)
+}
+
+func Test_createPIDFile_Stale(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "janus.pid")
+	NoError(t, os.WriteFile(p, []byte("garbage"), 0600))
+	NoError(t, createPIDFile(p))
+}
+
+func Test_restartFunc(t *testing.T) {
+	for _, a := range []app{{User: "nobody"}, {Group: "nogroup"}, {Chroot: true}, {Sandbox: true}} {
+		True(t, confined(a))
+		ErrorIs(t, restartFunc(a, nil)(), errRestartConfined)
+	}
+	False(t, confined(app{}))
+}
@@ -0,0 +1,106 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build unix
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// listenFDsEnv is the environment variable telling a new process how many listeners it inherited.
+const listenFDsEnv = "JANUS_LISTEN_FDS"
+
+// restartSignals trigger a graceful restart.
+var restartSignals = []os.Signal{syscall.SIGUSR2}
+
+// reloadSignals trigger reloading the TLS certificates.
+var reloadSignals = []os.Signal{syscall.SIGHUP}
+
+// processAlive reports whether a process with the given ID exists.
+func processAlive(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
+
+// inheritedListeners returns the listeners passed by the parent process during a graceful restart.
+// If the process was started regularly, nil is returned.
+func inheritedListeners() ([]net.Listener, error) {
+	n, err := strconv.Atoi(os.Getenv(listenFDsEnv))
+	if err != nil || n <= 0 {
+		return nil, nil
+	}
+	_ = os.Unsetenv(listenFDsEnv)
+
+	ls := make([]net.Listener, n)
+	for i := range ls {
+		// file descriptors 0-2 are stdin, stdout and stderr
+		f := os.NewFile(uintptr(3+i), "listener")
+		if ls[i], err = net.FileListener(f); err != nil {
+			return nil, err
+		}
+		_ = f.Close()
+	}
+	return ls, nil
+}
+
+// restart starts a new instance of the executable with the same arguments,
+// which inherits the given listeners and serves requests alongside the current process.
+// It fails, if the new process exits within one second e.g., due to an invalid configuration.
+func restart(ls []net.Listener) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	cmd := exec.Command(exe, os.Args[1:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	cmd.Env = append(os.Environ(), listenFDsEnv+"="+strconv.Itoa(len(ls)))
+	for _, l := range ls {
+		fl, ok := l.(interface{ File() (*os.File, error) })
+		if !ok {
+			return fmt.Errorf("cannot pass listener %s to new process", l.Addr())
+		}
+		f, err := fl.File()
+		if err != nil {
+			return err
+		}
+		defer func() { _ = f.Close() }()
+		cmd.ExtraFiles = append(cmd.ExtraFiles, f)
+	}
+
+	if err = cmd.Start(); err != nil {
+		return err
+	}
+
+	exited := make(chan error, 1)
+	go func() { exited <- cmd.Wait() }()
+	select {
+	case err = <-exited:
+		return fmt.Errorf("new process exited prematurely: %v", err)
+	case <-time.After(time.Second):
+		log.Info().Int("pid", cmd.Process.Pid).Msg("Started new process")
+		return nil
+	}
+}
@@ -0,0 +1,556 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"math"
+	"net"
+	"net/http"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	// errURITooLong indicates that the request URI exceeds the configured maximum length.
+	errURITooLong = errors.New("request URI too long")
+	// errUploadTooSlow indicates that a client sends the request body slower than the minimum transfer rate.
+	errUploadTooSlow = errors.New("request body transfer rate too low")
+	// errTooManyRequests indicates that a client exceeds the number of simultaneous requests.
+	errTooManyRequests = errors.New("too many concurrent requests")
+	// errOverloaded indicates that the server handles the maximum number of simultaneous requests.
+	errOverloaded = errors.New("too many concurrent requests in total")
+	// errPathEscape indicates that the request path refers to a parent directory.
+	errPathEscape = errors.New("path escapes the server root")
+	// errInternalPath indicates that the request path refers to data, which the server keeps below the server root.
+	errInternalPath = errors.New("path refers to internal data")
+	// errRateLimited indicates that a client exceeds its request rate.
+	errRateLimited = fmt.Errorf("%w: request rate exceeded", errTooManyRequests)
+	// errQuotaExceeded indicates that an upload would exceed the storage quota of a client.
+	errQuotaExceeded = errors.New("storage quota exceeded")
+)
+
+// limitURILength rejects requests with a URI longer than n bytes.
+// If n is not positive, h is returned as is.
+func limitURILength(n int, h http.Handler) http.Handler {
+	if n <= 0 {
+		return h
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(r.RequestURI) > n {
+			renderError(w, r, errURITooLong, "request URI too long", http.StatusRequestURITooLong)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// rejectPathEscape rejects requests, whose path contains ".." elements, hence could refer to files outside the server root.
+func rejectPathEscape(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, e := range strings.FieldsFunc(r.URL.Path, func(c rune) bool { return c == '/' || c == '\\' }) {
+			if e == ".." {
+				renderError(w, r, errPathEscape, "invalid path", http.StatusBadRequest)
+				return
+			}
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// internalDirs are the directories below the server root, in which the server keeps its own data.
+var internalDirs = map[string]bool{casDir: true, uploadsDir: true}
+
+// internalPath reports whether the path refers to one of the internalDirs or a file below.
+func internalPath(p string) bool {
+	e := strings.TrimPrefix(path.Clean("/"+p), "/")
+	if i := strings.IndexByte(e, '/'); i >= 0 {
+		e = e[:i]
+	}
+	return internalDirs[e]
+}
+
+// rejectInternalPaths hides the internalDirs, so that they can neither be read, listed nor written by clients.
+func rejectInternalPaths(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if internalPath(r.URL.Path) {
+			renderError(w, r, errInternalPath, "file not found", http.StatusNotFound)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// limitConnRequests closes keep-alive connections after they served n requests.
+// If n is not positive, h is returned as is.
+func limitConnRequests(n int, h http.Handler) http.Handler {
+	if n <= 0 {
+		return h
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ci := connInfoFrom(r.Context()); ci != nil && ci.nextRequest() >= int64(n) {
+			w.Header().Set("Connection", "close")
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// limitUploadRate aborts requests, whose body is transferred slower than bps bytes per second
+// during any period of the given duration.
+// If bps is not positive, h is returned as is.
+func limitUploadRate(bps int64, period time.Duration, h http.Handler) http.Handler {
+	if bps <= 0 || period <= 0 {
+		return h
+	}
+
+	min := int64(float64(bps) * period.Seconds())
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Body == nil || r.Body == http.NoBody {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		b := &minRateBody{ReadCloser: r.Body}
+		r.Body = b
+		done := make(chan struct{})
+		defer close(done)
+		go b.watch(r, min, period, done)
+		h.ServeHTTP(w, r)
+	})
+}
+
+// minRateBody counts the bytes read from a request body.
+type minRateBody struct {
+	io.ReadCloser
+	n    int64
+	eof  int32
+	slow int32
+}
+
+func (b *minRateBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	atomic.AddInt64(&b.n, int64(n))
+	if atomic.LoadInt32(&b.slow) == 1 {
+		return n, errUploadTooSlow
+	} else if errors.Is(err, io.EOF) {
+		atomic.StoreInt32(&b.eof, 1)
+	}
+	return n, err
+}
+
+// watch checks the transfer rate periodically until the body is read completely or done is closed.
+// If less than min bytes were received within a period, a pending Read is interrupted.
+func (b *minRateBody) watch(r *http.Request, min int64, period time.Duration, done <-chan struct{}) {
+	t := time.NewTicker(period)
+	defer t.Stop()
+
+	last := int64(0)
+	for {
+		select {
+		case <-done:
+			return
+		case <-t.C:
+			n := atomic.LoadInt64(&b.n)
+			if atomic.LoadInt32(&b.eof) == 1 {
+				return
+			} else if n-last < min {
+				atomic.StoreInt32(&b.slow, 1)
+				log.Warn().Str("client", r.RemoteAddr).Int64("bytes", n-last).Dur("period", period).
+					Msg("Aborting slow upload")
+				if ci := connInfoFrom(r.Context()); ci != nil && ci.conn != nil {
+					_ = ci.conn.SetReadDeadline(time.Now())
+				}
+				return
+			}
+			last = n
+		}
+	}
+}
+
+// limitRequestsPerIP restricts the number of simultaneous requests of a single client IP to n.
+// Excess requests are rejected with "429 Too Many Requests".
+// If n is not positive, h is returned as is.
+func limitRequestsPerIP(n int, h http.Handler) http.Handler {
+	if n <= 0 {
+		return h
+	}
+
+	var mu sync.Mutex
+	inflight := map[string]int{}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip := clientIP(r)
+		mu.Lock()
+		if inflight[ip] >= n {
+			mu.Unlock()
+			w.Header().Set("Retry-After", "1")
+			renderError(w, r, errTooManyRequests, "too many concurrent requests", http.StatusTooManyRequests)
+			return
+		}
+		inflight[ip]++
+		mu.Unlock()
+
+		defer func() {
+			mu.Lock()
+			if inflight[ip]--; inflight[ip] == 0 {
+				delete(inflight, ip)
+			}
+			mu.Unlock()
+		}()
+		h.ServeHTTP(w, r)
+	})
+}
+
+// limitConcurrentRequests rejects requests, while n requests are being handled, so that a burst of clients cannot
+// exhaust memory and file descriptors. Unlike --max-connections, idle keep-alive connections do not count.
+// If n is not positive, h is returned as is.
+func limitConcurrentRequests(n int, h http.Handler) http.Handler {
+	if n <= 0 {
+		return h
+	}
+
+	sem := make(chan struct{}, n)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case sem <- struct{}{}:
+			defer func() { <-sem }()
+			h.ServeHTTP(w, r)
+		default:
+			w.Header().Set("Retry-After", "1")
+			renderError(w, r, errOverloaded, "server busy", http.StatusServiceUnavailable)
+		}
+	})
+}
+
+// clientIP returns the IP address of the client, which sent the request.
+func clientIP(r *http.Request) string {
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
+
+// identityLimitStates is the maximum number of clients, whose limit state is kept.
+const identityLimitStates = 10000
+
+// identityLimit restricts the requests of a user, a group (prefixed with "@") or everyone ("public").
+type identityLimit struct {
+	principal string
+	rate      float64
+	bandwidth int64
+	quota     int64
+}
+
+// parseIdentityLimit parses a limit of the form "<principal> [rate=<requests per second>] [bandwidth=<KB/s>] [quota=<size>]".
+// The size may have one of the suffixes K, M, G or T.
+func parseIdentityLimit(spec string) (identityLimit, error) {
+	fs := strings.Fields(spec)
+	if len(fs) < 2 {
+		return identityLimit{}, fmt.Errorf("invalid limit %q", spec)
+	}
+	l := identityLimit{principal: fs[0]}
+	for _, f := range fs[1:] {
+		k, v, _ := strings.Cut(f, "=")
+		var err error
+		switch k {
+		case "rate":
+			l.rate, err = strconv.ParseFloat(v, 64)
+			err = positive(err, l.rate > 0)
+		case "bandwidth":
+			l.bandwidth, err = strconv.ParseInt(v, 10, 64)
+			err = positive(err, l.bandwidth > 0)
+			l.bandwidth *= 1024
+		case "quota":
+			l.quota, err = parseSize(v)
+			err = positive(err, l.quota > 0)
+		default:
+			err = errors.New("unknown key")
+		}
+		if err != nil {
+			return identityLimit{}, fmt.Errorf("invalid %s in limit %q", k, spec)
+		}
+	}
+	return l, nil
+}
+
+// positive returns an error, if err is not nil or the value is not positive.
+func positive(err error, ok bool) error {
+	if err == nil && !ok {
+		return errors.New("not positive")
+	}
+	return err
+}
+
+// parseSize parses a number of bytes with an optional suffix K, M, G or T (powers of 1024).
+func parseSize(s string) (int64, error) {
+	mul := int64(1)
+	if i := strings.IndexAny(s, "KMGT"); i >= 0 && i == len(s)-1 {
+		mul = 1 << (10 * (strings.Index("KMGT", s[i:]) + 1))
+		s = s[:i]
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	return n * mul, nil
+}
+
+// identityLimits enforces request rate, bandwidth and storage quota per client.
+// Authenticated clients are distinguished by their name, anonymous ones by their IP address.
+type identityLimits struct {
+	limits []identityLimit
+	mu     sync.Mutex
+	states *lru[string, *limitState]
+}
+
+// limitState holds the token buckets of a client.
+type limitState struct {
+	requests *tokenBucket
+	bytes    *tokenBucket
+}
+
+// newIdentityLimits parses the limits. If there are none, nil is returned.
+func newIdentityLimits(specs []string) (*identityLimits, error) {
+	if len(specs) == 0 {
+		return nil, nil
+	}
+	il := &identityLimits{states: newLRU[string, *limitState](identityLimitStates, nil)}
+	for _, s := range specs {
+		l, err := parseIdentityLimit(s)
+		if err != nil {
+			return nil, err
+		}
+		il.limits = append(il.limits, l)
+	}
+	return il, nil
+}
+
+// match returns the first limit, which applies to the identity, or nil if there is none.
+func (il *identityLimits) match(id *identity) *identityLimit {
+	for i := range il.limits {
+		if id.is(il.limits[i].principal) {
+			return &il.limits[i]
+		}
+	}
+	return nil
+}
+
+// state returns the limit state of the client, creating it if necessary.
+func (il *identityLimits) state(key string, l *identityLimit, now time.Time) *limitState {
+	il.mu.Lock()
+	defer il.mu.Unlock()
+	if s, ok := il.states.Get(key); ok {
+		return s
+	}
+	s := &limitState{}
+	if l.rate > 0 {
+		s.requests = newTokenBucket(l.rate, math.Max(l.rate, 1), now)
+	}
+	if l.bandwidth > 0 {
+		s.bytes = newTokenBucket(float64(l.bandwidth), float64(l.bandwidth), now)
+	}
+	il.states.Add(key, s)
+	return s
+}
+
+// limitIdentities rejects requests exceeding the request rate or storage quota of the client,
+// and throttles request and response bodies to its bandwidth.
+// The quota applies to the directory the client is served from i.e., its home or tenant directory.
+// If no limits are configured, h is returned as is.
+func limitIdentities(a app, h http.Handler) http.Handler {
+	if a.limits == nil {
+		return h
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := identityFrom(r.Context())
+		l := a.limits.match(id)
+		if l == nil {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		key := "ip:" + clientIP(r)
+		if id != nil {
+			key = "user:" + id.name
+		}
+		now := time.Now()
+		s := a.limits.state(key, l, now)
+		if s.requests != nil && !s.requests.allow(now) {
+			w.Header().Set("Retry-After", "1")
+			renderError(w, r, errRateLimited, "too many requests", http.StatusTooManyRequests)
+			return
+		}
+
+		if l.quota > 0 && (r.Method == http.MethodPost || r.Method == http.MethodPut || r.Method == http.MethodPatch) {
+			used, err := dirSize(rootDir(a, r))
+			if err != nil {
+				renderError(w, r, err, "cannot determine storage usage", http.StatusInternalServerError)
+				return
+			} else if used+r.ContentLength > l.quota {
+				renderError(w, r, errQuotaExceeded, "storage quota exceeded", http.StatusInsufficientStorage)
+				return
+			}
+			r.Body = http.MaxBytesReader(w, r.Body, l.quota-used)
+		}
+
+		if s.bytes != nil {
+			w = &throttledWriter{ResponseWriter: w, ctx: r.Context(), tb: s.bytes}
+			if r.Body != nil && r.Body != http.NoBody {
+				r.Body = &throttledBody{ReadCloser: r.Body, ctx: r.Context(), tb: s.bytes}
+			}
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// dirSize returns the total size of all files in the directory and its subdirectories.
+// A missing directory has a size of 0.
+func dirSize(dir string) (size int64, err error) {
+	err = filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		} else if err != nil || d.IsDir() {
+			return err
+		}
+		fi, err := d.Info()
+		if err == nil {
+			size += fi.Size()
+		}
+		return err
+	})
+	return size, err
+}
+
+// tokenBucket allows events at a rate with bursts of up to the given size.
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// newTokenBucket creates a full token bucket.
+func newTokenBucket(rate, burst float64, now time.Time) *tokenBucket {
+	return &tokenBucket{rate: rate, burst: burst, tokens: burst, last: now}
+}
+
+// refill adds the tokens accumulated since the last call. The caller must hold the lock.
+func (tb *tokenBucket) refill(now time.Time) {
+	if now.After(tb.last) {
+		tb.tokens = math.Min(tb.burst, tb.tokens+now.Sub(tb.last).Seconds()*tb.rate)
+		tb.last = now
+	}
+}
+
+// allow takes a token, if one is available.
+func (tb *tokenBucket) allow(now time.Time) bool {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+	tb.refill(now)
+	if tb.tokens < 1 {
+		return false
+	}
+	tb.tokens--
+	return true
+}
+
+// take takes n tokens and returns the duration to wait until they are available.
+func (tb *tokenBucket) take(n int, now time.Time) time.Duration {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+	tb.refill(now)
+	tb.tokens -= float64(n)
+	if tb.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-tb.tokens / tb.rate * float64(time.Second))
+}
+
+// wait takes n tokens and sleeps until they are available or the context is done.
+func (tb *tokenBucket) wait(ctx context.Context, n int) error {
+	d := tb.take(n, time.Now())
+	if d <= 0 {
+		return nil
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// throttleChunk is the maximum number of bytes transferred at once by throttled readers and writers.
+const throttleChunk = 16 * 1024
+
+// throttledWriter limits the transfer rate of a response body.
+type throttledWriter struct {
+	http.ResponseWriter
+	ctx context.Context
+	tb  *tokenBucket
+}
+
+func (w *throttledWriter) Write(p []byte) (n int, err error) {
+	for len(p) > 0 {
+		c := p
+		if len(c) > throttleChunk {
+			c = c[:throttleChunk]
+		}
+		if err = w.tb.wait(w.ctx, len(c)); err != nil {
+			return n, err
+		}
+		m, err := w.ResponseWriter.Write(c)
+		n += m
+		if err != nil {
+			return n, err
+		}
+		p = p[m:]
+	}
+	return n, nil
+}
+
+// throttledBody limits the transfer rate of a request body.
+type throttledBody struct {
+	io.ReadCloser
+	ctx context.Context
+	tb  *tokenBucket
+}
+
+func (b *throttledBody) Read(p []byte) (int, error) {
+	if len(p) > throttleChunk {
+		p = p[:throttleChunk]
+	}
+	n, err := b.ReadCloser.Read(p)
+	if werr := b.tb.wait(b.ctx, n); werr != nil && err == nil {
+		err = werr
+	}
+	return n, err
+}
@@ -0,0 +1,291 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/stretchr/testify/require"
+)
+
+func Test_limitURILength(t *testing.T) {
+	h := limitURILength(16, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/short", nil))
+	Equal(t, http.StatusOK, w.Code)
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/"+strings.Repeat("x", 16), nil))
+	Equal(t, http.StatusRequestURITooLong, w.Code)
+}
+
+func Test_rejectPathEscape(t *testing.T) {
+	h := rejectPathEscape(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	for p, status := range map[string]int{
+		"/a/b.txt":     http.StatusOK,
+		"/a/..b/c..":   http.StatusOK,
+		"/../etc":      http.StatusBadRequest,
+		"/a/../../etc": http.StatusBadRequest,
+		"/a\\..\\etc":  http.StatusBadRequest,
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.URL.Path = p
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		Equal(t, status, w.Code, p)
+	}
+}
+
+func Test_rejectInternalPaths(t *testing.T) {
+	h := rejectInternalPaths(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	for p, status := range map[string]int{
+		"/a/b.txt":                          http.StatusOK,
+		"/a/" + casDir + "/":                http.StatusOK,
+		"/" + casDir + "-old":               http.StatusOK,
+		"/" + casDir:                        http.StatusNotFound,
+		"/" + casDir + "/sha256/" + sumData: http.StatusNotFound,
+		"//./" + casDir + "/sha256/":        http.StatusNotFound,
+		"/" + uploadsDir + "/":              http.StatusNotFound,
+		"/" + uploadsDir + "/0123.part":     http.StatusNotFound,
+	} {
+		for _, m := range []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodDelete} {
+			r := httptest.NewRequest(m, "/", nil)
+			r.URL.Path = p
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			Equal(t, status, w.Code, m+" "+p)
+		}
+	}
+}
+
+func Test_limitConnRequests(t *testing.T) {
+	h := limitConnRequests(2, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r = r.WithContext(withConnInfo(r.Context(), nil))
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	Empty(t, w.Header().Get("Connection"))
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	Equal(t, "close", w.Header().Get("Connection"))
+}
+
+func Test_limitUploadRate(t *testing.T) {
+	h := limitUploadRate(1024, 10*time.Millisecond, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := io.ReadAll(r.Body); errors.Is(err, errUploadTooSlow) {
+			w.WriteHeader(http.StatusRequestTimeout)
+		}
+	}))
+
+	pr, pw := io.Pipe()
+	go func() {
+		_, _ = pw.Write([]byte("x"))
+		time.Sleep(50 * time.Millisecond)
+		_ = pw.Close()
+	}()
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/", pr))
+	Equal(t, http.StatusRequestTimeout, w.Code)
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/", strings.NewReader("fast")))
+	Equal(t, http.StatusOK, w.Code)
+}
+
+func Test_limitRequestsPerIP(t *testing.T) {
+	block, entered := make(chan struct{}), make(chan struct{})
+	h := limitRequestsPerIP(1, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/block" {
+			close(entered)
+			<-block
+		}
+	}))
+
+	go h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/block", nil))
+	<-entered
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	Equal(t, http.StatusTooManyRequests, w.Code)
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.RemoteAddr = "192.0.2.2:1234"
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	Equal(t, http.StatusOK, w.Code)
+	close(block)
+}
+
+func Test_limitConcurrentRequests(t *testing.T) {
+	block, entered := make(chan struct{}), make(chan struct{})
+	h := limitConcurrentRequests(1, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/block" {
+			close(entered)
+			<-block
+		}
+	}))
+
+	done := make(chan struct{})
+	go func() {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/block", nil))
+		close(done)
+	}()
+	<-entered
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.RemoteAddr = "192.0.2.2:1234"
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	Equal(t, http.StatusServiceUnavailable, w.Code)
+	Equal(t, "1", w.Header().Get("Retry-After"))
+	Equal(t, "JANUS_UNAVAILABLE", w.Header().Get("X-Janus-Error"))
+
+	close(block)
+	<-done
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	Equal(t, http.StatusOK, w.Code)
+}
+
+func Test_clientIP(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	Equal(t, "192.0.2.1", clientIP(r))
+	r.RemoteAddr = "[2001:db8::1]:80"
+	Equal(t, "2001:db8::1", clientIP(r))
+	r.RemoteAddr = "@"
+	Equal(t, "@", clientIP(r))
+}
+
+func Test_parseIdentityLimit(t *testing.T) {
+	l, err := parseIdentityLimit("@ci rate=2.5 bandwidth=1024 quota=10G")
+	NoError(t, err)
+	Equal(t, identityLimit{principal: "@ci", rate: 2.5, bandwidth: 1 << 20, quota: 10 << 30}, l)
+
+	for _, spec := range []string{"public", "alice rate=0", "alice bandwidth=-1", "alice quota=1X", "alice speed=1"} {
+		_, err := parseIdentityLimit(spec)
+		Error(t, err, spec)
+	}
+}
+
+func Test_parseSize(t *testing.T) {
+	for s, n := range map[string]int64{"512": 512, "2K": 2048, "3M": 3 << 20, "1G": 1 << 30, "1T": 1 << 40} {
+		v, err := parseSize(s)
+		NoError(t, err)
+		Equal(t, n, v, s)
+	}
+	_, err := parseSize("G")
+	Error(t, err)
+	_, err = parseSize("1KB")
+	Error(t, err)
+}
+
+func Test_identityLimits_match(t *testing.T) {
+	il, err := newIdentityLimits(nil)
+	NoError(t, err)
+	Nil(t, il)
+
+	il, err = newIdentityLimits([]string{"alice rate=1", "@ci rate=2", "public rate=3"})
+	NoError(t, err)
+	Equal(t, 1.0, il.match(&identity{name: "alice", groups: []string{"ci"}}).rate)
+	Equal(t, 2.0, il.match(&identity{name: "bob", groups: []string{"ci"}}).rate)
+	Equal(t, 3.0, il.match(&identity{name: "bob"}).rate)
+	Equal(t, 3.0, il.match(nil).rate)
+
+	il, err = newIdentityLimits([]string{"@ci rate=2"})
+	NoError(t, err)
+	Nil(t, il.match(nil))
+
+	_, err = newIdentityLimits([]string{"@ci rate=fast"})
+	Error(t, err)
+}
+
+func Test_limitIdentities(t *testing.T) {
+	root := t.TempDir()
+	NoError(t, os.WriteFile(filepath.Join(root, "a.bin"), make([]byte, 600), 0600))
+	il, err := newIdentityLimits([]string{"alice rate=2 quota=1K", "public bandwidth=1"})
+	NoError(t, err)
+	a := app{ServerRoot: root, limits: il}
+	h := limitIdentities(a, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			_, _ = w.Write(make([]byte, 1024+512))
+		} else if _, err := io.Copy(io.Discard, r.Body); err != nil {
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+		}
+	}))
+	serve := func(id *identity, method, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, "/", strings.NewReader(body))
+		if id != nil {
+			r = withIdentity(r, id)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, r)
+		return rec
+	}
+
+	alice := &identity{name: "alice"}
+	Equal(t, http.StatusOK, serve(alice, http.MethodPost, strings.Repeat("x", 400)).Code)
+	rec := serve(alice, http.MethodPost, strings.Repeat("x", 500))
+	Equal(t, http.StatusInsufficientStorage, rec.Code)
+	Equal(t, string(codeQuotaExceeded), rec.Header().Get("X-Janus-Error"))
+	rec = serve(alice, http.MethodGet, "")
+	Equal(t, http.StatusTooManyRequests, rec.Code)
+	Equal(t, string(codeTooManyRequests), rec.Header().Get("X-Janus-Error"))
+
+	start := time.Now()
+	rec = serve(nil, http.MethodGet, "")
+	Equal(t, http.StatusOK, rec.Code)
+	Equal(t, 1024+512, rec.Body.Len())
+	GreaterOrEqual(t, time.Since(start), 400*time.Millisecond)
+}
+
+func Test_dirSize(t *testing.T) {
+	root := t.TempDir()
+	NoError(t, os.MkdirAll(filepath.Join(root, "sub"), 0700))
+	NoError(t, os.WriteFile(filepath.Join(root, "a"), make([]byte, 10), 0600))
+	NoError(t, os.WriteFile(filepath.Join(root, "sub", "b"), make([]byte, 5), 0600))
+	n, err := dirSize(root)
+	NoError(t, err)
+	Equal(t, int64(15), n)
+
+	n, err = dirSize(filepath.Join(root, "missing"))
+	NoError(t, err)
+	Zero(t, n)
+}
+
+func Test_tokenBucket(t *testing.T) {
+	now := time.Now()
+	tb := newTokenBucket(2, 2, now)
+	True(t, tb.allow(now))
+	True(t, tb.allow(now))
+	False(t, tb.allow(now))
+	True(t, tb.allow(now.Add(500*time.Millisecond)))
+	False(t, tb.allow(now.Add(500*time.Millisecond)))
+
+	tb = newTokenBucket(1000, 1000, now)
+	Zero(t, tb.take(1000, now))
+	Equal(t, 500*time.Millisecond, tb.take(500, now))
+	Equal(t, 500*time.Millisecond, tb.take(500, now.Add(500*time.Millisecond)))
+}
@@ -0,0 +1,121 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"expvar"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// connStats exposes the number of active and rejected connections.
+var connStats = expvar.NewMap("connections")
+
+// limitListener accepts at most a fixed number of simultaneous connections.
+// Excess connections are passed to shed, which is responsible for closing them.
+type limitListener struct {
+	net.Listener
+	sem  chan struct{}
+	shed func(net.Conn)
+}
+
+// limitListeners wraps the given Listeners, so that at most n connections are open simultaneously
+// across all of them.
+// If n is not positive, ls is returned as is.
+func limitListeners(ls []net.Listener, n int, shed func(net.Conn)) []net.Listener {
+	if n <= 0 {
+		return ls
+	}
+
+	sem := make(chan struct{}, n)
+	lls := make([]net.Listener, len(ls))
+	for i, l := range ls {
+		lls[i] = &limitListener{l, sem, shed}
+	}
+	return lls
+}
+
+func (l *limitListener) Accept() (net.Conn, error) {
+	for {
+		c, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+
+		select {
+		case l.sem <- struct{}{}:
+			connStats.Add("active", 1)
+			return &limitConn{Conn: c, release: l.release}, nil
+		default:
+			connStats.Add("rejected", 1)
+			log.Warn().Str("client", c.RemoteAddr().String()).Msg("Too many connections")
+			l.shed(c)
+		}
+	}
+}
+
+func (l *limitListener) release() {
+	connStats.Add("active", -1)
+	<-l.sem
+}
+
+// limitConn releases its slot in the limitListener when it is closed.
+type limitConn struct {
+	net.Conn
+	once    sync.Once
+	release func()
+}
+
+func (c *limitConn) Close() error {
+	err := c.Conn.Close()
+	c.once.Do(c.release)
+	return err
+}
+
+// reject503 answers a plain HTTP connection with "503 Service Unavailable" and closes it.
+func reject503(c net.Conn) {
+	_ = c.SetWriteDeadline(time.Now().Add(time.Second))
+	_, _ = c.Write([]byte("HTTP/1.1 503 Service Unavailable\r\n" +
+		"Connection: close\r\nContent-Length: 0\r\nRetry-After: 1\r\n\r\n"))
+	_ = c.Close()
+}
+
+// connInfo holds the state of a client connection shared by all of its requests.
+type connInfo struct {
+	conn     net.Conn
+	requests int64
+}
+
+// withConnInfo attaches a new connInfo to the Context of a connection.
+// It is intended to be used as http.Server.ConnContext.
+func withConnInfo(ctx context.Context, c net.Conn) context.Context {
+	return context.WithValue(ctx, connection, &connInfo{conn: c})
+}
+
+// connInfoFrom returns the connInfo of the connection a request was received on, or nil.
+func connInfoFrom(ctx context.Context) *connInfo {
+	ci, _ := ctx.Value(connection).(*connInfo)
+	return ci
+}
+
+// nextRequest increments the number of requests and returns the new value.
+func (ci *connInfo) nextRequest() int64 {
+	return atomic.AddInt64(&ci.requests, 1)
+}
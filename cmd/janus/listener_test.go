@@ -0,0 +1,61 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+	"testing"
+
+	. "github.com/stretchr/testify/require"
+)
+
+func Test_limitListener(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	NoError(t, err)
+	l := limitListeners([]net.Listener{ln}, 1, reject503)[0]
+	defer func() { _ = l.Close() }()
+
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			defer func() { _ = c.Close() }()
+		}
+	}()
+
+	c1, err := net.Dial("tcp", ln.Addr().String())
+	NoError(t, err)
+	defer func() { _ = c1.Close() }()
+
+	c2, err := net.Dial("tcp", ln.Addr().String())
+	NoError(t, err)
+	defer func() { _ = c2.Close() }()
+
+	resp, err := http.ReadResponse(bufio.NewReader(c2), nil)
+	NoError(t, err)
+	defer func() { _ = resp.Body.Close() }()
+	Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+}
+
+func Test_limitListeners_Unlimited(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	NoError(t, err)
+	defer func() { _ = ln.Close() }()
+	Same(t, ln, limitListeners([]net.Listener{ln}, 0, reject503)[0])
+}
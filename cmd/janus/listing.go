@@ -0,0 +1,109 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"expvar"
+	"fmt"
+	"html"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+)
+
+// listingStats exposes the effectiveness of the directory listing cache.
+var listingStats = expvar.NewMap("listing_cache")
+
+// dirListing is a rendered directory listing.
+type dirListing struct {
+	modTime time.Time
+	body    []byte
+}
+
+// listingCache holds rendered directory listings.
+// An entry is considered stale as soon as the modification time of the directory changes.
+type listingCache struct {
+	lru *lru[string, dirListing]
+}
+
+// newListingCache creates a cache for at most size directories.
+// If size is not positive, caching is disabled and nil is returned.
+func newListingCache(size int) *listingCache {
+	if size <= 0 {
+		return nil
+	}
+	return &listingCache{lru: newLRU[string, dirListing](int64(size), nil)}
+}
+
+// serveListing renders the listing of the given directory, taking cached listings into account.
+// If c is nil, the listing is rendered for every request.
+func (c *listingCache) serveListing(w http.ResponseWriter, r *http.Request, b *brand, dir string, fi os.FileInfo) {
+	var l dirListing
+	ok := false
+	if c != nil {
+		l, ok = c.lru.Get(dir)
+	}
+	if ok && l.modTime.Equal(fi.ModTime()) {
+		listingStats.Add("hits", 1)
+	} else {
+		body, err := renderListing(r.Context(), dir)
+		if err != nil {
+			if c != nil {
+				c.lru.Remove(dir)
+			}
+			renderError(w, r, err, "cannot read directory", http.StatusInternalServerError)
+			return
+		}
+		l = dirListing{fi.ModTime(), body}
+		if c != nil {
+			listingStats.Add("misses", 1)
+			c.lru.Add(dir, l)
+		}
+	}
+
+	page := &bytes.Buffer{}
+	if err := b.writeHead(page, r.URL.Path); err != nil {
+		renderError(w, r, err, "cannot render directory listing", http.StatusInternalServerError)
+		return
+	}
+	page.Write(l.body)
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	http.ServeContent(w, r, "", l.modTime, bytes.NewReader(page.Bytes()))
+}
+
+// renderListing generates an HTML listing of the given directory just like http.FileServer.
+// Reading the directory stops as soon as the context is done.
+func renderListing(ctx context.Context, dir string) ([]byte, error) {
+	es, err := readDirContext(ctx, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	b := &bytes.Buffer{}
+	b.WriteString("<pre>\n")
+	for _, e := range es {
+		name := e.Name()
+		if e.IsDir() {
+			name += "/"
+		}
+		u := url.URL{Path: name}
+		_, _ = fmt.Fprintf(b, "<a href=\"%s\">%s</a>\n", u.String(), html.EscapeString(name))
+	}
+	b.WriteString("</pre>\n")
+	return b.Bytes(), nil
+}
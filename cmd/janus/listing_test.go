@@ -0,0 +1,77 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/stretchr/testify/require"
+)
+
+func Test_renderListing(t *testing.T) {
+	d := t.TempDir()
+	NoError(t, os.Mkdir(filepath.Join(d, "sub"), 0700))
+	NoError(t, os.WriteFile(filepath.Join(d, "a&b?.txt"), nil, 0600))
+
+	b, err := renderListing(context.Background(), d)
+	NoError(t, err)
+	Equal(t, "<pre>\n<a href=\"a&b%3F.txt\">a&amp;b?.txt</a>\n<a href=\"sub/\">sub/</a>\n</pre>\n", string(b))
+}
+
+func Test_listingCache_serveListing(t *testing.T) {
+	d := t.TempDir()
+	c := newListingCache(1)
+	get := func() string {
+		fi, err := os.Stat(d)
+		NoError(t, err)
+		w := httptest.NewRecorder()
+		c.serveListing(w, httptest.NewRequest(http.MethodGet, "/", nil), nil, d, fi)
+		return w.Body.String()
+	}
+
+	hits := listingStats.Get("hits")
+	Contains(t, get(), "<title>/</title>")
+	True(t, strings.HasSuffix(get(), "<pre>\n</pre>\n"))
+	NotEqual(t, hits, listingStats.Get("hits"))
+
+	NoError(t, os.WriteFile(filepath.Join(d, "new"), nil, 0600))
+	NoError(t, os.Chtimes(d, time.Now(), time.Now().Add(time.Minute)))
+	Contains(t, get(), `<a href="new">new</a>`)
+}
+
+func Test_newListingCache_Disabled(t *testing.T) {
+	Nil(t, newListingCache(0))
+}
+
+func Test_listingCache_serveListing_Disabled(t *testing.T) {
+	d := t.TempDir()
+	NoError(t, os.WriteFile(filepath.Join(d, "a"), nil, 0600))
+	fi, err := os.Stat(d)
+	NoError(t, err)
+
+	var c *listingCache
+	w := httptest.NewRecorder()
+	c.serveListing(w, httptest.NewRequest(http.MethodGet, "/dir/", nil), &brand{title: "ACME", css: themeCSS}, d, fi)
+	Equal(t, http.StatusOK, w.Code)
+	Contains(t, w.Body.String(), "<title>/dir/ - ACME</title>")
+	Contains(t, w.Body.String(), `<a href="a">a</a>`)
+}
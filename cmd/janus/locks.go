@@ -0,0 +1,338 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/rand"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	errLocked             = errors.New("resource is locked")
+	errLockTokenMismatch  = errors.New("lock token does not match the resource")
+	errInvalidLockRequest = errors.New("invalid lock request")
+)
+
+// lockTokenRegexp matches the lock tokens submitted in the If header.
+var lockTokenRegexp = regexp.MustCompile(`<(opaquelocktoken:[^>]+)>`)
+
+// lock is a WebDAV write lock on a file or directory.
+type lock struct {
+	token     string
+	name      string // file system path
+	href      string // request path
+	exclusive bool
+	infinite  bool
+	owner     string
+	timeout   time.Duration
+	expires   time.Time
+}
+
+// covers reports whether the lock applies to the named file.
+// If descendants is true, locks on files within the named directory apply as well.
+func (l *lock) covers(name string, descendants bool) bool {
+	return l.name == name ||
+		l.infinite && within(l.name, name) ||
+		descendants && within(name, l.name)
+}
+
+// within reports whether name is located in the directory dir.
+func within(dir, name string) bool {
+	return strings.HasPrefix(name, strings.TrimSuffix(dir, string(filepath.Separator))+string(filepath.Separator))
+}
+
+// lockManager keeps track of the active locks, so that clients do not overwrite each other's changes.
+type lockManager struct {
+	mu      sync.Mutex
+	locks   map[string]*lock
+	timeout time.Duration
+	now     func() time.Time
+}
+
+// newLockManager creates a lockManager, which grants locks for at most timeout.
+func newLockManager(timeout time.Duration) *lockManager {
+	return &lockManager{locks: map[string]*lock{}, timeout: timeout, now: time.Now}
+}
+
+// expire removes locks that were not refreshed in time.
+// The caller must hold the mutex.
+func (m *lockManager) expire() {
+	now := m.now()
+	for t, l := range m.locks {
+		if now.After(l.expires) {
+			delete(m.locks, t)
+		}
+	}
+}
+
+// lock grants a new lock, unless it conflicts with an existing lock.
+func (m *lockManager) lock(l lock) (*lock, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.expire()
+	for _, o := range m.locks {
+		if o.covers(l.name, l.infinite) && (l.exclusive || o.exclusive) {
+			return nil, errLocked
+		}
+	}
+
+	l.token = newLockToken()
+	l.timeout = m.clamp(l.timeout)
+	l.expires = m.now().Add(l.timeout)
+	m.locks[l.token] = &l
+	return &l, nil
+}
+
+// refresh extends the lifetime of a lock on the named file.
+func (m *lockManager) refresh(token, name string, timeout time.Duration) (*lock, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.expire()
+	l, ok := m.locks[token]
+	if !ok || !l.covers(name, false) {
+		return nil, errLockTokenMismatch
+	}
+	l.timeout = m.clamp(timeout)
+	l.expires = m.now().Add(l.timeout)
+	c := *l
+	return &c, nil
+}
+
+// unlock removes the lock identified by token, if it applies to the named file.
+func (m *lockManager) unlock(token, name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.expire()
+	if l, ok := m.locks[token]; !ok || !l.covers(name, false) {
+		return errLockTokenMismatch
+	}
+	delete(m.locks, token)
+	return nil
+}
+
+// check returns errLocked, if the named file is locked by a lock whose token was not submitted.
+// If m is nil, nothing is locked.
+func (m *lockManager) check(name string, tokens []string, descendants bool) error {
+	if m == nil {
+		return nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.expire()
+	for t, l := range m.locks {
+		if l.covers(name, descendants) && !contains(tokens, t) {
+			return errLocked
+		}
+	}
+	return nil
+}
+
+// clamp limits the requested timeout to the maximum timeout.
+func (m *lockManager) clamp(timeout time.Duration) time.Duration {
+	if timeout <= 0 || timeout > m.timeout {
+		return m.timeout
+	}
+	return timeout
+}
+
+// newLockToken generates a random lock token in the opaquelocktoken URI scheme.
+func newLockToken() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	b[6], b[8] = b[6]&0x0f|0x40, b[8]&0x3f|0x80
+	return fmt.Sprintf("opaquelocktoken:%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// lockTokens returns the lock tokens submitted in the If header.
+func lockTokens(r *http.Request) (tokens []string) {
+	for _, m := range lockTokenRegexp.FindAllStringSubmatch(r.Header.Get("If"), -1) {
+		tokens = append(tokens, m[1])
+	}
+	return tokens
+}
+
+// parseTimeout parses the Timeout header e.g., "Second-600" or "Infinite".
+// Zero means the maximum timeout.
+func parseTimeout(s string) time.Duration {
+	for _, t := range strings.Split(s, ",") {
+		t = strings.TrimSpace(t)
+		if n, err := strconv.ParseInt(strings.TrimPrefix(t, "Second-"), 10, 32); err == nil && strings.HasPrefix(t, "Second-") {
+			return time.Duration(n) * time.Second
+		}
+	}
+	return 0
+}
+
+// lockInfo is the body of a LOCK request.
+type lockInfo struct {
+	XMLName   xml.Name  `xml:"DAV: lockinfo"`
+	Exclusive *struct{} `xml:"lockscope>exclusive"`
+	Shared    *struct{} `xml:"lockscope>shared"`
+	Write     *struct{} `xml:"locktype>write"`
+	Owner     struct {
+		Href string `xml:"href"`
+		Text string `xml:",chardata"`
+	} `xml:"owner"`
+}
+
+// owner renders the owner of a lock, which is either a URL (e.g., "mailto:") or plain text.
+func owner(li lockInfo) string {
+	if li.Owner.Href != "" {
+		return "<D:href>" + escapeXML(li.Owner.Href) + "</D:href>"
+	}
+	return escapeXML(strings.TrimSpace(li.Owner.Text))
+}
+
+// handleLocks serves LOCK and UNLOCK requests and rejects modifications of locked files with "423 Locked".
+// Uploads are checked by handleFileUpload, as the name of the file is part of the request body.
+// If locking is disabled, h is returned as is.
+func handleLocks(a app, h http.Handler) http.Handler {
+	if a.locks == nil {
+		return h
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := filepath.Join(rootDir(a, r), r.URL.Path)
+		switch r.Method {
+		case "LOCK":
+			handleLock(a, w, r, name)
+		case "UNLOCK":
+			token := strings.Trim(r.Header.Get("Lock-Token"), "<> ")
+			if token == "" {
+				renderError(w, r, errInvalidLockRequest, "missing lock token", http.StatusBadRequest)
+			} else if err := a.locks.unlock(token, name); err != nil {
+				renderError(w, r, err, "lock token does not match the resource", http.StatusConflict)
+			} else {
+				audit(r, "unlock").Str("result", "ok").Msg("File unlocked")
+				w.WriteHeader(http.StatusNoContent)
+			}
+		case http.MethodPut, http.MethodPatch, http.MethodDelete:
+			if err := a.locks.check(name, lockTokens(r), r.Method == http.MethodDelete); err != nil {
+				renderError(w, r, err, "resource is locked", http.StatusLocked)
+				return
+			}
+			h.ServeHTTP(w, r)
+		default:
+			h.ServeHTTP(w, r)
+		}
+	})
+}
+
+// handleLock creates or refreshes a lock.
+// Like WebDAV servers, an empty file is created, if the file does not exist yet.
+func handleLock(a app, w http.ResponseWriter, r *http.Request, name string) {
+	timeout := parseTimeout(r.Header.Get("Timeout"))
+	b, err := io.ReadAll(io.LimitReader(r.Body, 64*1024))
+	if err != nil {
+		renderError(w, r, err, "cannot read lock request", http.StatusBadRequest)
+		return
+	} else if len(strings.TrimSpace(string(b))) == 0 {
+		tokens := lockTokens(r)
+		if len(tokens) == 0 {
+			renderError(w, r, errInvalidLockRequest, "missing lock token", http.StatusBadRequest)
+			return
+		}
+		l, err := a.locks.refresh(tokens[0], name, timeout)
+		if err != nil {
+			renderError(w, r, err, "lock token does not match the resource", http.StatusPreconditionFailed)
+			return
+		}
+		writeLockDiscovery(w, l, http.StatusOK)
+		return
+	}
+
+	var li lockInfo
+	if err := xml.Unmarshal(b, &li); err != nil || li.Write == nil || (li.Exclusive == nil) == (li.Shared == nil) {
+		renderError(w, r, errInvalidLockRequest, "invalid lock request", http.StatusBadRequest)
+		return
+	}
+	depth := r.Header.Get("Depth")
+	if depth != "" && depth != "0" && !strings.EqualFold(depth, "infinity") {
+		renderError(w, r, errInvalidLockRequest, "invalid lock request", http.StatusBadRequest)
+		return
+	}
+
+	l, err := a.locks.lock(lock{
+		name:      name,
+		href:      r.URL.Path,
+		exclusive: li.Exclusive != nil,
+		infinite:  depth != "0",
+		owner:     owner(li),
+		timeout:   timeout,
+	})
+	if err != nil {
+		renderError(w, r, err, "resource is locked", http.StatusLocked)
+		return
+	}
+
+	status := http.StatusOK
+	if _, err := os.Stat(name); os.IsNotExist(err) {
+		f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err == nil {
+			err = f.Close()
+		}
+		if err != nil {
+			_ = a.locks.unlock(l.token, name)
+			renderError(w, r, err, "cannot create file", http.StatusConflict)
+			return
+		}
+		status = http.StatusCreated
+		a.sitemap.changed()
+	}
+
+	audit(r, "lock").Str("token", l.token).Str("result", "ok").Msg("File locked")
+	w.Header().Set("Lock-Token", "<"+l.token+">")
+	writeLockDiscovery(w, l, status)
+}
+
+// writeLockDiscovery renders the lockdiscovery property of a lock.
+func writeLockDiscovery(w http.ResponseWriter, l *lock, status int) {
+	scope, depth := "shared", "0"
+	if l.exclusive {
+		scope = "exclusive"
+	}
+	if l.infinite {
+		depth = "infinity"
+	}
+
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.WriteHeader(status)
+	_, _ = fmt.Fprintf(w, `<?xml version="1.0" encoding="utf-8"?>
+<D:prop xmlns:D="DAV:"><D:lockdiscovery><D:activelock>`+
+		`<D:locktype><D:write/></D:locktype><D:lockscope><D:%s/></D:lockscope><D:depth>%s</D:depth>`+
+		`<D:owner>%s</D:owner><D:timeout>Second-%d</D:timeout>`+
+		`<D:locktoken><D:href>%s</D:href></D:locktoken><D:lockroot><D:href>%s</D:href></D:lockroot>`+
+		`</D:activelock></D:lockdiscovery></D:prop>
+`, scope, depth, l.owner, int64(l.timeout/time.Second), l.token, escapeXML(l.href))
+}
+
+// escapeXML escapes s for use in XML character data.
+func escapeXML(s string) string {
+	var sb strings.Builder
+	_ = xml.EscapeText(&sb, []byte(s))
+	return sb.String()
+}
@@ -0,0 +1,164 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/stretchr/testify/require"
+)
+
+const lockBody = `<?xml version="1.0" encoding="utf-8"?>
+<D:lockinfo xmlns:D="DAV:">
+  <D:lockscope><D:%s/></D:lockscope>
+  <D:locktype><D:write/></D:locktype>
+  <D:owner><D:href>mailto:alice@example.com</D:href></D:owner>
+</D:lockinfo>`
+
+func Test_lockManager(t *testing.T) {
+	now := time.Now()
+	m := newLockManager(time.Minute)
+	m.now = func() time.Time { return now }
+
+	dir := filepath.Join("root", "docs")
+	l, err := m.lock(lock{name: dir, infinite: true, exclusive: true})
+	NoError(t, err)
+	True(t, strings.HasPrefix(l.token, "opaquelocktoken:"))
+	Equal(t, time.Minute, l.timeout)
+
+	_, err = m.lock(lock{name: filepath.Join(dir, "a.docx"), exclusive: false})
+	ErrorIs(t, err, errLocked)
+	_, err = m.lock(lock{name: "root", infinite: true})
+	ErrorIs(t, err, errLocked)
+	_, err = m.lock(lock{name: "root"})
+	NoError(t, err)
+
+	ErrorIs(t, m.check(filepath.Join(dir, "a.docx"), nil, false), errLocked)
+	NoError(t, m.check(filepath.Join(dir, "a.docx"), []string{l.token}, false))
+	NoError(t, m.check(filepath.Join("root", "docs2"), nil, false))
+	ErrorIs(t, m.check("root", []string{l.token}, false), errLocked)
+
+	ErrorIs(t, m.unlock(l.token, "root"), errLockTokenMismatch)
+	NoError(t, m.unlock(l.token, filepath.Join(dir, "a.docx")))
+	ErrorIs(t, m.unlock(l.token, dir), errLockTokenMismatch)
+	Nil(t, (*lockManager)(nil).check(dir, nil, true))
+}
+
+func Test_lockManager_expire(t *testing.T) {
+	now := time.Now()
+	m := newLockManager(time.Hour)
+	m.now = func() time.Time { return now }
+
+	l, err := m.lock(lock{name: "a", exclusive: true, timeout: time.Minute})
+	NoError(t, err)
+	Equal(t, time.Minute, l.timeout)
+
+	now = now.Add(50 * time.Second)
+	l, err = m.refresh(l.token, "a", 2*time.Hour)
+	NoError(t, err)
+	Equal(t, time.Hour, l.timeout)
+
+	now = now.Add(time.Hour + time.Second)
+	NoError(t, m.check("a", nil, false))
+	_, err = m.refresh(l.token, "a", 0)
+	ErrorIs(t, err, errLockTokenMismatch)
+}
+
+func Test_parseTimeout(t *testing.T) {
+	Equal(t, 600*time.Second, parseTimeout("Second-600"))
+	Equal(t, 30*time.Second, parseTimeout("Infinite, Second-30"))
+	Equal(t, time.Duration(0), parseTimeout("Infinite"))
+	Equal(t, time.Duration(0), parseTimeout(""))
+}
+
+func Test_lockTokens(t *testing.T) {
+	r := httptest.NewRequest(http.MethodPut, "/a", nil)
+	r.Header.Set("If", `<http://localhost/a> (<opaquelocktoken:1>) (Not <opaquelocktoken:2> ["etag"])`)
+	Equal(t, []string{"opaquelocktoken:1", "opaquelocktoken:2"}, lockTokens(r))
+}
+
+func Test_handleLocks(t *testing.T) {
+	dir := t.TempDir()
+	a := app{ServerRoot: dir, locks: newLockManager(time.Minute)}
+	h := handleLocks(a, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	serve := func(method, body string, header ...string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, "/report.docx", strings.NewReader(body))
+		for i := 0; i < len(header); i += 2 {
+			r.Header.Set(header[i], header[i+1])
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	w := serve("LOCK", strings.Replace(lockBody, "%s", "exclusive", 1), "Timeout", "Second-30")
+	Equal(t, http.StatusCreated, w.Code)
+	FileExists(t, filepath.Join(dir, "report.docx"))
+	token := strings.Trim(w.Header().Get("Lock-Token"), "<>")
+	Contains(t, w.Body.String(), "<D:locktoken><D:href>"+token+"</D:href></D:locktoken>")
+	Contains(t, w.Body.String(), "<D:owner><D:href>mailto:alice@example.com</D:href></D:owner><D:timeout>Second-30</D:timeout>")
+	Contains(t, w.Body.String(), "<D:lockroot><D:href>/report.docx</D:href></D:lockroot>")
+
+	Equal(t, http.StatusLocked, serve("LOCK", strings.Replace(lockBody, "%s", "shared", 1)).Code)
+	Equal(t, http.StatusLocked, serve(http.MethodPut, "data").Code)
+	Equal(t, http.StatusLocked, serve(http.MethodDelete, "").Code)
+	Equal(t, http.StatusNoContent, serve(http.MethodPut, "data", "If", "(<"+token+">)").Code)
+	Equal(t, http.StatusNoContent, serve(http.MethodGet, "").Code)
+
+	Equal(t, http.StatusOK, serve("LOCK", "", "If", "(<"+token+">)").Code)
+	Equal(t, http.StatusPreconditionFailed, serve("LOCK", "", "If", "(<opaquelocktoken:x>)").Code)
+	Equal(t, http.StatusBadRequest, serve("LOCK", "<lockinfo/>").Code)
+
+	Equal(t, http.StatusBadRequest, serve("UNLOCK", "").Code)
+	Equal(t, http.StatusConflict, serve("UNLOCK", "", "Lock-Token", "<opaquelocktoken:x>").Code)
+	Equal(t, http.StatusNoContent, serve("UNLOCK", "", "Lock-Token", "<"+token+">").Code)
+	Equal(t, http.StatusNoContent, serve(http.MethodDelete, "").Code)
+}
+
+func Test_handleFileUpload_Locked(t *testing.T) {
+	dir := t.TempDir()
+	a := app{ServerRoot: dir, EnableUpload: true, locks: newLockManager(time.Minute)}
+	l, err := a.locks.lock(lock{name: filepath.Join(dir, "file"), exclusive: true})
+	NoError(t, err)
+
+	upload := func(header ...string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/", io.NopCloser(bytes.NewBufferString(
+			"--xxx\r\nContent-Disposition: form-data; name=\"file\"; filename=\"file\"\r\n\r\ndata\r\n--xxx--\r\n")))
+		r.Header.Set("Content-Type", "multipart/form-data; boundary=xxx")
+		for i := 0; i < len(header); i += 2 {
+			r.Header.Set(header[i], header[i+1])
+		}
+		w := httptest.NewRecorder()
+		handleFileUpload(a).ServeHTTP(w, r)
+		return w
+	}
+
+	Equal(t, http.StatusLocked, upload().Code)
+	NoFileExists(t, filepath.Join(dir, "file"))
+	Equal(t, http.StatusOK, upload("If", "(<"+l.token+">)").Code)
+	b, err := os.ReadFile(filepath.Join(dir, "file"))
+	NoError(t, err)
+	Equal(t, "data", string(b))
+}
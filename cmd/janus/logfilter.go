@@ -0,0 +1,73 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// sampleRate is the fraction of requests written to the access log in the form "1/N".
+type sampleRate uint64
+
+// UnmarshalFlag parses a sample rate of the form "1/N" or "N".
+func (sr *sampleRate) UnmarshalFlag(v string) error {
+	n, err := strconv.ParseUint(strings.TrimPrefix(v, "1/"), 10, 32)
+	if err != nil || n == 0 {
+		return fmt.Errorf("invalid sample rate %q (must be 1/N with N > 0)", v)
+	}
+	*sr = sampleRate(n)
+	return nil
+}
+
+// MarshalFlag returns the sample rate in the form "1/N".
+func (sr sampleRate) MarshalFlag() (string, error) {
+	return sr.String(), nil
+}
+
+func (sr sampleRate) String() string {
+	return "1/" + strconv.FormatUint(uint64(sr), 10)
+}
+
+// logFilter decides, which requests are written to the access log.
+type logFilter struct {
+	rate     uint64
+	patterns []string
+	prefix   string
+	n        uint64
+}
+
+// newLogFilter creates a logFilter, which writes every Nth request to the access log and
+// omits requests for paths (relative to the prefix) matching any of the patterns.
+// If all requests are to be logged, nil is returned.
+func newLogFilter(rate sampleRate, patterns []string, prefix string) *logFilter {
+	if rate <= 1 && len(patterns) == 0 {
+		return nil
+	}
+	return &logFilter{rate: uint64(rate), patterns: patterns, prefix: strings.TrimRight(prefix, "/")}
+}
+
+// keep reports whether the request is written to the access log.
+// Failed requests (status code 400 and above) are always logged.
+func (lf *logFilter) keep(p string, status int) bool {
+	if lf == nil || status >= 400 {
+		return true
+	} else if matchPath(lf.patterns, strings.TrimPrefix(p, lf.prefix)) {
+		return false
+	}
+	return lf.rate <= 1 || (atomic.AddUint64(&lf.n, 1)-1)%lf.rate == 0
+}
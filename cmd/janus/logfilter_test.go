@@ -0,0 +1,72 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog/log"
+	. "github.com/stretchr/testify/require"
+)
+
+func Test_sampleRate_UnmarshalFlag(t *testing.T) {
+	var sr sampleRate
+	NoError(t, sr.UnmarshalFlag("1/100"))
+	Equal(t, sampleRate(100), sr)
+	NoError(t, sr.UnmarshalFlag("10"))
+	Equal(t, "1/10", sr.String())
+
+	Error(t, sr.UnmarshalFlag("1/0"))
+	Error(t, sr.UnmarshalFlag("2/3"))
+	Error(t, sr.UnmarshalFlag("often"))
+}
+
+func Test_logFilter_keep(t *testing.T) {
+	Nil(t, newLogFilter(1, nil, "/"))
+	True(t, (*logFilter)(nil).keep("/", http.StatusOK))
+
+	lf := newLogFilter(3, []string{"/_janus/health", "/favicon.ico"}, "/files/")
+	False(t, lf.keep("/files/_janus/health", http.StatusOK))
+	True(t, lf.keep("/files/_janus/health", http.StatusServiceUnavailable))
+
+	var kept []bool
+	for i := 0; i < 6; i++ {
+		kept = append(kept, lf.keep("/files/a.txt", http.StatusOK))
+	}
+	Equal(t, []bool{true, false, false, true, false, false}, kept)
+	True(t, lf.keep("/files/a.txt", http.StatusNotFound))
+}
+
+func Test_logHandler_Filter(t *testing.T) {
+	b := &bytes.Buffer{}
+	orig := log.Logger
+	log.Logger = log.Output(b)
+	t.Cleanup(func() { log.Logger = orig })
+
+	h := logHandler(newLogFilter(1, []string{"/favicon.ico"}, "/"), http.NotFoundHandler())
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/favicon.ico", nil))
+	Contains(t, b.String(), `"status":404`)
+
+	b.Reset()
+	h = logHandler(newLogFilter(1, []string{"/favicon.ico"}, "/"), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/favicon.ico", nil))
+	Empty(t, strings.TrimSpace(b.String()))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/a.txt", nil))
+	Contains(t, b.String(), `"path":"/a.txt"`)
+}
@@ -0,0 +1,121 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"container/list"
+	"sync"
+)
+
+// lru is a size-bounded cache, which evicts the least recently used entries first.
+// The size of an entry is determined by the cost function.
+type lru[K comparable, V any] struct {
+	mu    sync.Mutex
+	max   int64
+	size  int64
+	cost  func(V) int64
+	ll    *list.List
+	items map[K]*list.Element
+	// evicted is called with every entry removed or replaced, if set.
+	// It is called while the cache is locked, hence it must not access the cache.
+	evicted func(K, V)
+}
+
+type lruEntry[K comparable, V any] struct {
+	key  K
+	val  V
+	cost int64
+}
+
+// newLRU creates a cache holding entries with a total cost of at most max.
+// If cost is nil, every entry has a cost of 1.
+func newLRU[K comparable, V any](max int64, cost func(V) int64) *lru[K, V] {
+	if cost == nil {
+		cost = func(V) int64 { return 1 }
+	}
+	return &lru[K, V]{max: max, cost: cost, ll: list.New(), items: map[K]*list.Element{}}
+}
+
+// Get looks up the value of the given key and marks it as recently used.
+func (c *lru[K, V]) Get(k K) (v V, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.items[k]; ok {
+		c.ll.MoveToFront(e)
+		return e.Value.(*lruEntry[K, V]).val, true
+	}
+	return
+}
+
+// Add inserts or replaces a value and evicts old entries until the cache fits into its bounds.
+// Values exceeding the maximum size on their own are not cached at all.
+func (c *lru[K, V]) Add(k K, v V) {
+	n := c.cost(v)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.items[k]; ok {
+		c.removeElement(e)
+	}
+	if n > c.max {
+		return
+	}
+
+	c.items[k] = c.ll.PushFront(&lruEntry[K, V]{k, v, n})
+	c.size += n
+	for c.size > c.max {
+		c.removeElement(c.ll.Back())
+	}
+}
+
+// Remove deletes the entry with the given key, if present.
+func (c *lru[K, V]) Remove(k K) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.items[k]; ok {
+		c.removeElement(e)
+	}
+}
+
+// Purge deletes all entries.
+func (c *lru[K, V]) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for c.ll.Len() > 0 {
+		c.removeElement(c.ll.Back())
+	}
+}
+
+// Len returns the number of cached entries.
+func (c *lru[K, V]) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ll.Len()
+}
+
+// Size returns the total cost of all cached entries.
+func (c *lru[K, V]) Size() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.size
+}
+
+func (c *lru[K, V]) removeElement(e *list.Element) {
+	ent := c.ll.Remove(e).(*lruEntry[K, V])
+	delete(c.items, ent.key)
+	c.size -= ent.cost
+	if c.evicted != nil {
+		c.evicted(ent.key, ent.val)
+	}
+}
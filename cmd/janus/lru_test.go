@@ -0,0 +1,73 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"testing"
+
+	. "github.com/stretchr/testify/require"
+)
+
+func Test_lru_Add(t *testing.T) {
+	c := newLRU[string, int](2, nil)
+	c.Add("a", 1)
+	c.Add("b", 2)
+	_, _ = c.Get("a")
+	c.Add("c", 3)
+
+	Equal(t, 2, c.Len())
+	_, ok := c.Get("b")
+	False(t, ok)
+	v, ok := c.Get("a")
+	True(t, ok)
+	Equal(t, 1, v)
+}
+
+func Test_lru_Cost(t *testing.T) {
+	c := newLRU[string, []byte](4, func(b []byte) int64 { return int64(len(b)) })
+	c.Add("a", []byte("12"))
+	c.Add("b", []byte("12345"))
+	c.Add("c", []byte("123"))
+
+	_, ok := c.Get("b")
+	False(t, ok)
+	Equal(t, int64(3), c.Size())
+
+	c.Remove("c")
+	Equal(t, 0, c.Len())
+	Equal(t, int64(0), c.Size())
+}
+
+func Test_lru_evicted(t *testing.T) {
+	c := newLRU[string, int](1, nil)
+	var evicted []int
+	c.evicted = func(_ string, v int) { evicted = append(evicted, v) }
+	c.Add("a", 1)
+	c.Add("a", 2)
+	c.Add("b", 3)
+	c.Remove("b")
+	Equal(t, []int{1, 2, 3}, evicted)
+}
+
+func Test_lru_Purge(t *testing.T) {
+	c := newLRU[string, int](2, nil)
+	c.Add("a", 1)
+	c.Add("b", 2)
+	c.Purge()
+	Zero(t, c.Len())
+	Zero(t, c.Size())
+	_, ok := c.Get("a")
+	False(t, ok)
+}
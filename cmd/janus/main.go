@@ -15,15 +15,24 @@
 package main
 
 import (
+	"bufio"
 	"context"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"mime"
 	"net"
 	"net/http"
+	"net/url"
 	"os"
 	"path"
 	"path/filepath"
+	"runtime"
+	"strconv"
 	"strings"
 	"text/template"
 	"time"
@@ -33,10 +42,21 @@ import (
 	"github.com/mattn/go-isatty"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
+	"golang.org/x/crypto/acme/autocert"
 )
 
 var version = "unknown"
 
+// IP families supported for binding.
+const (
+	dualStack = "dual"
+	ipv4      = "ipv4"
+	ipv6      = "ipv6"
+)
+
+// errNotSupported indicates that a feature is not available on the current platform.
+var errNotSupported = errors.New("not supported on " + runtime.GOOS)
+
 func main() {
 	zerolog.DurationFieldInteger = true
 	zerolog.TimeFieldFormat = zerolog.TimeFormatUnixMs
@@ -45,47 +65,654 @@ func main() {
 		log.Logger = log.Output(w)
 	}
 
-	app := loadConfig(os.Args...)
-	if listen, err := resolveIP(app.ListenAddress); err != nil {
+	app := loadConfig(os.Args[1:]...)
+	switch app.command {
+	case "check":
+		os.Exit(runCheck(app, os.Stdout, os.Stderr))
+	case "replay":
+		os.Exit(runReplay(app.replay, os.Stdout, os.Stderr))
+	case "bench":
+		os.Exit(runBench(app.bench, os.Stdout, os.Stderr))
+	case "backup":
+		os.Exit(runBackup(app, os.Stdout, os.Stderr))
+	case "restore":
+		os.Exit(runRestore(app, os.Stdin, os.Stdout, os.Stderr))
+	case "config show":
+		if err := showConfig(app, os.Stdout); err != nil {
+			log.Fatal().Err(err).Msg("Cannot show configuration")
+		}
+		os.Exit(0)
+	}
+	if err := openAuditLog(app.AuditLog); err != nil {
+		log.Fatal().Str("audit-log", app.AuditLog).Err(err).Msg("Cannot open audit log")
+	}
+	if app.EnrollTOTP != "" {
+		uri, err := enrollTOTP(app.UsersFile, app.EnrollTOTP)
+		if err != nil {
+			log.Fatal().Str("users-file", app.UsersFile).Str("user", app.EnrollTOTP).Err(err).Msg("Cannot enroll TOTP")
+		}
+		fmt.Println(uri)
+		os.Exit(0)
+	}
+
+	addrs, err := resolveIPs(app.ListenAddress, app.IPFamily)
+	if err != nil {
 		log.Fatal().Str("listen", app.ListenAddress).Err(err).Msg("Cannot resolve IP")
-	} else {
-		app.ListenAddress = listen
+	} else if !app.ListenAllAddresses {
+		addrs = addrs[:1]
+	}
+	app.ListenAddress = addrs[0]
+	if err := checkMirrorRoots(app); err != nil {
+		log.Fatal().Strs("mirror-root", app.MirrorRoots).Err(err).Msg("Invalid mirror root")
+	}
+
+	if err := setOutboundCAs(app.OutboundCAs); err != nil {
+		log.Fatal().Err(err).Msg("Cannot load CA certificates for outbound connections")
+	}
+	if app.upstream, err = newUpstream(app); err != nil {
+		log.Fatal().Str("mirror-upstream", app.MirrorUpstream).Err(err).Msg("Invalid mirror upstream")
+	}
+	certs, err := newCertStore(app.TLSCerts, app.TLSKeys)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Cannot load TLS certificates")
+	}
+	if app.acme, err = newACMEManager(app); err != nil {
+		log.Fatal().Err(err).Msg("Invalid ACME configuration")
+	}
+	tlsCfg, err := newTLSConfig(app, certs)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Invalid TLS configuration")
+	}
+	if app.certRules, err = parseCertRules(app.TLSClientRules); err != nil {
+		log.Fatal().Err(err).Msg("Invalid client certificate rule")
+	} else if len(app.certRules) > 0 && len(app.TLSClientCAs) == 0 {
+		log.Fatal().Msg("Client certificate rules require a client CA")
+	}
+	if app.saml, err = newSAMLAuth(app); err != nil {
+		log.Fatal().Err(err).Msg("Invalid SAML configuration")
+	}
+	if app.oidc, err = newOIDCAuth(app); err != nil {
+		log.Fatal().Err(err).Msg("Invalid OpenID Connect configuration")
+	}
+	if app.jwt, err = newJWTAuth(app); err != nil {
+		log.Fatal().Err(err).Msg("Invalid JWT configuration")
+	}
+	if app.accounts, err = loadAccounts(app.UsersFile, app.GroupsFile); err != nil {
+		log.Fatal().Str("users-file", app.UsersFile).Err(err).Msg("Cannot load users")
+	}
+	app.sessions = newSessionStore(app.SessionLifetime)
+	if app.limits, err = newIdentityLimits(app.Limits); err != nil {
+		log.Fatal().Err(err).Msg("Invalid limit")
+	}
+	if app.ipFilter, err = newIPFilter(app.AllowCIDRs, app.DenyCIDRs, app.CIDRScope); err != nil {
+		log.Fatal().Err(err).Msg("Invalid IP filter")
+	}
+	if app.headers, err = headerRules(app); err != nil {
+		log.Fatal().Err(err).Msg("Invalid header rule")
+	}
+	if app.pools, err = newWorkPools(app.WorkPools); err != nil {
+		log.Fatal().Err(err).Msg("Invalid work pool")
+	}
+	if app.tenants, err = loadTenants(app.TenantsFile); err != nil {
+		log.Fatal().Err(err).Msg("Cannot load tenants")
+	} else if len(app.tenants) > 0 && app.HomeDirs {
+		log.Fatal().Msg("Tenants cannot be combined with home directories")
+	}
+	if app.maint, err = newMaintenance(app.Maintenance, app.MaintenancePage); err != nil {
+		log.Fatal().Str("maintenance-page", app.MaintenancePage).Err(err).Msg("Cannot load maintenance page")
+	}
+	if app.roles, err = parseRoles(app.Roles); err != nil {
+		log.Fatal().Err(err).Msg("Invalid role")
+	} else if len(app.roles) > 0 {
+		app.shares = newShareLinks(app.ShareLifetime)
+	}
+	if err := appendConflict(app); err != nil {
+		log.Fatal().Err(err).Msg("Cannot enable appending")
+	}
+	if app.CAS && (app.EnableAccessFiles || pathRoles(app.roles)) {
+		// blobs are served by their digest, hence access rules of the linked paths cannot be applied
+		log.Fatal().Msg("Content-addressable storage cannot be combined with access files or roles restricted to paths")
+	}
+	if app.translations, err = loadTranslations(app.Translations); err != nil {
+		log.Fatal().Str("translations", app.Translations).Err(err).Msg("Cannot load translations")
+	}
+	if app.baseURL, err = parseBaseURL(app.BaseURL); err != nil {
+		log.Fatal().Err(err).Msg("Invalid base URL")
+	}
+	if app.brand, err = newBrand(app); err != nil {
+		log.Fatal().Err(err).Msg("Cannot load brand")
+	}
+	slowFSThreshold = app.SlowFSThreshold
+	if templates, err = loadTemplates(app.Templates, app.Prefix, app.brand); err != nil {
+		log.Fatal().Str("templates", app.Templates).Err(err).Msg("Cannot load templates")
+	}
+	if app.signer, err = newSigner(app.SigningKey, app.SigningKeyID); err != nil {
+		log.Fatal().Err(err).Msg("Cannot load signing key")
+	}
+	if app.APT {
+		app.apt = newAPTRepo(app.signer)
+	}
+	app.sitemap = newSitemap(app)
+	app.faults = newFaults(app)
+	if app.statsd, err = newStatsd(app.StatsD, app.StatsDPrefix, app.StatsDFormat, app.StatsDTags); err != nil {
+		log.Fatal().Err(err).Msg("Cannot connect to StatsD")
+	}
+	if app.otlp, err = newOTLPMetrics(app.OTLPEndpoint, app.OTLPInterval); err != nil {
+		log.Fatal().Err(err).Msg("Cannot export metrics via OTLP")
+	}
+	if app.notifier, err = newNotifier(app); err != nil {
+		log.Fatal().Err(err).Msg("Cannot configure notifications")
+	}
+	if app.chat, err = newChat(app.ChatTargets, app.ChatMatrixToken, app.ChatTemplate); err != nil {
+		log.Fatal().Err(err).Msg("Cannot configure chat")
+	}
+	app.capture = newCapture(app.Capture, app.CaptureSample, app.CapturePaths, app.Prefix, app.CaptureMaxBodyKB*1024)
+	if app.Integrity {
+		app.integrity = newIntegrityHashes()
+	}
+	if app.Torrent {
+		app.torrents = newTorrents(app.TorrentTrackers)
+	}
+	if app.Locks {
+		app.locks = newLockManager(app.LockTimeout)
+	}
+	if app.Resumable {
+		if app.uploads, err = newResumableUploads(app.ServerRoot, app.ResumableExpiry); err != nil {
+			log.Fatal().Err(err).Msg("Cannot create directory for resumable uploads")
+		}
+	}
+	app.progress = newUploadProgress(app.UploadStallTimeout)
+	app.assets = newAssets(app.AssetPaths)
+	if app.icap, err = newICAPClient(app.ICAP, app.ICAPMethod, app.ICAPTimeout); err != nil {
+		log.Fatal().Err(err).Msg("Invalid ICAP service")
+	} else if app.icap != nil && app.Append {
+		log.Fatal().Msg("Content inspection cannot be combined with appending, since appended data is not inspected")
+	}
+	if app.HistoryDir != "" {
+		if app.Chroot {
+			log.Fatal().Msg("History cannot be combined with chroot")
+		}
+		if app.history, err = newHistory(app); err != nil {
+			log.Fatal().Err(err).Msg("Cannot create history directory")
+		}
+	}
+	if app.QuarantineDir != "" {
+		if app.Resumable || app.Append || app.Maven || app.CAS {
+			// these uploads bypass the quarantine, hence they would be published without review
+			log.Fatal().Msg("Quarantine cannot be combined with resumable uploads, appending, Maven deployments or content-addressable storage")
+		} else if app.Chroot {
+			log.Fatal().Msg("Quarantine cannot be combined with chroot")
+		}
+		if app.quarantine, err = newQuarantine(app.QuarantineDir); err != nil {
+			log.Fatal().Err(err).Msg("Cannot create quarantine directory")
+		}
+	}
+	app.icons = newIcons(app)
+	if app.robots, err = app.Robots.content(); err != nil {
+		log.Fatal().Err(err).Msg("Cannot load robots.txt")
 	}
 
 	log.Info().
 		Bool("enable-upload", app.EnableUpload).
-		Str("listen", app.ListenAddress).
+		Bool("upload-token", app.UploadToken != "").
+		Bool("drop-box", app.DropBox).
+		Bool("cas", app.CAS).
+		Int("roles", len(app.roles)).
+		Dur("retention", app.Retention).
+		Str("audit-log", app.AuditLog).
+		Strs("listen", addrs).
+		Str("ip-family", app.IPFamily).
+		Bool("tls", tlsCfg != nil).
+		Dur("tls-reload-interval", app.TLSReloadInterval).
+		Bool("tls-ocsp-stapling", app.TLSOCSPStapling).
+		Bool("acme", app.acme != nil).
+		Int("tls-client-rules", len(app.certRules)).
+		Bool("saml", app.saml != nil).
+		Bool("oidc", app.oidc != nil).
+		Bool("auth-jwt", app.jwt != nil).
+		Str("users-file", app.UsersFile).
+		Bool("enable-access-files", app.EnableAccessFiles).
+		Bool("home-dirs", app.HomeDirs).
+		Dur("session-lifetime", app.SessionLifetime).
+		Int("max-connections", app.MaxConnections).
+		Int("max-concurrent-requests", app.MaxConcurrentReqs).
+		Dur("read-timeout", app.ReadTimeout).
+		Dur("read-header-timeout", app.ReadHeaderTimeout).
+		Dur("write-timeout", app.WriteTimeout).
+		Dur("idle-timeout", app.IdleTimeout).
+		Dur("request-timeout", app.RequestTimeout).
+		Int("max-header-bytes", app.MaxHeaderBytes).
+		Bool("disable-keep-alive", app.DisableKeepAlive).
+		Int("max-requests-per-connection", app.MaxConnRequests).
+		Uint32("min-upload-rate", app.MinUploadRateKB).
+		Int("max-requests-per-ip", app.MaxRequestsPerIP).
+		Strs("allow-cidr", app.AllowCIDRs).
+		Strs("deny-cidr", app.DenyCIDRs).
+		Dur("hsts-max-age", app.HSTSMaxAge).
+		Str("frame-options", app.FrameOptions).
+		Bool("nosniff", app.NoSniff).
+		Int("max-uri-length", app.MaxURILength).
 		Uint32("client-body-buffer-size", app.BufferSizeKB).
+		Int("listing-cache-size", app.ListingCacheSize).
+		Int64("file-cache-size", app.FileCacheSizeKB).
+		Int("handle-cache-size", app.HandleCacheSize).
+		Int("negative-cache-size", app.NegativeCacheSize).
+		Stringer("log-sample", app.LogSample).
+		Strs("log-exclude-path", app.LogExcludePaths).
+		Dur("slow-fs-threshold", app.SlowFSThreshold).
+		Bool("enable-metrics", app.EnableMetrics).
+		Str("statsd", app.StatsD).
+		Str("otlp-endpoint", app.OTLPEndpoint).
+		Bool("admin-api", app.AdminToken != "").
+		Bool("maintenance", app.Maintenance).
 		Str("prefix", app.Prefix).
+		Str("templates", app.Templates).
+		Int("locations", len(app.locations)).
 		Str("server-root", app.ServerRoot).
+		Strs("mirror-root", app.MirrorRoots).
+		Str("mirror-upstream", app.MirrorUpstream).
+		Bool("chroot", app.Chroot).
+		Bool("sandbox", app.Sandbox).
 		Msg("Starting server")
 
-	p := path.Join(app.Prefix, "/*path")
-	h := logHandler(http.StripPrefix(strings.TrimRight(app.Prefix, "/"), handleRequest(app)))
+	ls, err := inheritedListeners()
+	if err != nil {
+		log.Fatal().Err(err).Msg("Cannot use inherited listener")
+	}
+	for i := len(ls); i < len(addrs); i++ {
+		l, err := net.Listen(network(app.IPFamily), addrs[i])
+		if err != nil {
+			log.Fatal().Str("listen", addrs[i]).Err(err).Msg("Cannot listen")
+		}
+		ls = append(ls, l)
+	}
 
-	r := httprouter.New()
-	r.Handler(http.MethodGet, p, h)
-	r.Handler(http.MethodPost, p, h)
+	app.addrs = make([]string, len(ls))
+	for i, l := range ls {
+		app.addrs[i] = l.Addr().String()
+	}
+	log.Info().Strs("addresses", app.addrs).Msg("Listening")
+	if app.acme != nil {
+		// bind before dropping privileges, because the HTTP port is privileged
+		l, err := net.Listen(network(app.IPFamily), app.ACMEHTTPListen)
+		if err != nil {
+			log.Fatal().Str("acme-http-listen", app.ACMEHTTPListen).Err(err).Msg("Cannot listen")
+		}
+		go func() {
+			err := serveACMEChallenges(app.acme, l, app.addrs[0])
+			log.Error().Err(err).Msg("Stopped answering ACME challenges")
+		}()
+	}
+	if app.PortFile != "" {
+		if err := writePortFile(app.PortFile, ls[0].Addr()); err != nil {
+			log.Fatal().Str("port-file", app.PortFile).Err(err).Msg("Cannot create port file")
+		}
+	}
+
+	if app.PIDFile != "" {
+		if err := createPIDFile(app.PIDFile); err != nil {
+			log.Fatal().Str("pid-file", app.PIDFile).Err(err).Msg("Cannot create PID file")
+		}
+	}
+
+	creds, err := lookupCredentials(app.User, app.Group)
+	if err != nil {
+		log.Fatal().Str("user", app.User).Str("group", app.Group).Err(err).Msg("Cannot look up user")
+	}
+	if app.Chroot {
+		if err := chroot(app.ServerRoot); err != nil {
+			log.Fatal().Str("server-root", app.ServerRoot).Err(err).Msg("Cannot change root directory")
+		}
+		app.ServerRoot = "/"
+	}
+	if err := creds.apply(); err != nil {
+		log.Fatal().Str("user", app.User).Str("group", app.Group).Err(err).Msg("Cannot drop privileges")
+	}
+	if app.Sandbox {
+		ro, rw := sandboxDirs(app)
+		if err := sandbox(ro, rw); err != nil {
+			log.Fatal().Err(err).Msg("Cannot enable sandbox")
+		}
+	}
+
+	if app.scopes, err = newScopes(app); err != nil {
+		log.Fatal().Err(err).Msg("Invalid location")
+	}
+	r := newRouter(app, newHandler(app))
 
 	s := &http.Server{
 		Addr:              app.ListenAddress,
 		Handler:           r,
-		ReadHeaderTimeout: 30 * time.Second,
+		ReadTimeout:       app.ReadTimeout,
+		ReadHeaderTimeout: app.ReadHeaderTimeout,
+		WriteTimeout:      app.WriteTimeout,
+		IdleTimeout:       app.IdleTimeout,
+		MaxHeaderBytes:    app.MaxHeaderBytes,
+		ConnContext:       withConnInfo,
+		TLSConfig:         tlsCfg,
 	}
+	s.SetKeepAlivesEnabled(!app.DisableKeepAlive)
 
-	log.Fatal().Err(s.ListenAndServe()).Msg("Stopping server")
+	go sdWatchdog(func() error {
+		_, err := os.Stat(app.ServerRoot)
+		return err
+	})
+	if err := sdNotify("READY=1\nMAINPID=" + strconv.Itoa(os.Getpid())); err != nil {
+		log.Warn().Err(err).Msg("Cannot notify systemd")
+	}
+
+	shed := reject503
+	if tlsCfg != nil {
+		shed = closeConn
+	}
+	if certs != nil {
+		go certs.watch(app.TLSReloadInterval)
+		if app.TLSOCSPStapling {
+			go certs.stapleOCSP()
+		}
+	}
+	if app.otlp != nil {
+		go app.otlp.run()
+	}
+	if app.history != nil {
+		go app.history.run(app.HistoryInterval)
+	}
+	if app.SweepAge > 0 {
+		go newSweeper(app).run(app.SweepInterval)
+	}
+	sls := tlsListeners(limitListeners(ls, app.MaxConnections, shed), tlsCfg)
+	err = serve(s, sls, app.ShutdownTimeout, restartFunc(app, ls))
+	if app.PIDFile != "" && !confined(app) {
+		// a confined process cannot remove the file reliably, hence the next start replaces it as stale
+		removePIDFile(app.PIDFile)
+	}
+	if app.otlp != nil {
+		if err := app.otlp.export(time.Now()); err != nil {
+			log.Warn().Err(err).Msg("Cannot export metrics")
+		}
+	}
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Fatal().Err(err).Msg("Stopping server")
+	}
+	log.Info().Msg("Server stopped")
 }
 
 // app holds all application properties.
+// Every option can be set via an environment variable derived from its long name (see envKey),
+// unless it is tagged with no-env.
 //
 //nolint:lll
 type app struct {
-	BufferSizeKB  uint32 `short:"b" long:"client-body-buffer-size" description:"total number of kilobytes stored in memory (per upload)" default:"8"`
-	ServerRoot    string `short:"d" long:"server-root" description:"root directory to serve" env:"JANUS_SERVER_ROOT" default:"."`
-	ListenAddress string `short:"l" long:"listen" description:"host address and port to bind to" env:"JANUS_LISTEN" default:":8080"`
-	Prefix        string `short:"p" long:"prefix" description:"prefix for the HTTP URLs" env:"JANUS_PREFIX" default:"/"`
-	EnableUpload  bool   `short:"u" long:"enable-upload" description:"enable upload of files by adding \"?upload\"" env:"JANUS_ENABLE_UPLOAD"`
-	Version       bool   `short:"v" long:"version" description:"print version information"`
+	BufferSizeKB         uint32            `short:"b" long:"client-body-buffer-size" description:"total number of kilobytes stored in memory (per upload)" default:"8"`
+	ServerRoot           string            `short:"d" long:"server-root" description:"root directory to serve" default:"."`
+	MirrorRoots          []string          `long:"mirror-root" description:"directory with a copy of the server root e.g., on NFS, which files are downloaded from, if they are missing or cannot be read in the server root (tried in the given order)" env-delim:","`
+	MirrorUpstream       string            `long:"mirror-upstream" description:"base URL of an HTTP server, from which missing files are fetched and stored in the server root e.g., \"https://origin.example.com/releases/\""`
+	ListenAddress        string            `short:"l" long:"listen" description:"host address and port to bind to" default:":8080"`
+	ListenAllAddresses   bool              `long:"listen-all-addresses" description:"bind to all addresses of the interface given in listen instead of the primary one"`
+	IPFamily             string            `long:"ip-family" description:"IP family to bind to (ipv6 binds to IPv6 addresses only)" choice:"dual" choice:"ipv4" choice:"ipv6" default:"dual"`
+	TLSCerts             []string          `long:"tls-cert" description:"PEM encoded certificate (chain) file; repeat for multiple virtual hosts" env-delim:","`
+	TLSKeys              []string          `long:"tls-key" description:"PEM encoded private key file matching the certificate at the same position" env-delim:","`
+	TLSReloadInterval    time.Duration     `long:"tls-reload-interval" description:"interval for checking the certificate and key files for changes (0 disables the check)" default:"1m"`
+	TLSMinVersion        string            `long:"tls-min-version" description:"minimum TLS version accepted" choice:"1.2" choice:"1.3" default:"1.2"`
+	TLSCiphers           []string          `long:"tls-ciphers" description:"TLS 1.2 cipher suite to enable e.g., \"TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384\" (default: all secure ones)" env-delim:","`
+	TLSOCSPStapling      bool              `long:"tls-ocsp-stapling" description:"fetch OCSP responses for the certificates and staple them in handshakes"`
+	TLSClientCAs         []string          `long:"tls-client-ca" description:"PEM encoded CA certificate file for verifying client certificates (enables mutual TLS)" env-delim:","`
+	ACME                 bool              `long:"acme" description:"obtain and renew TLS certificates for the acme-hosts automatically via ACME e.g., from Let's Encrypt (accepts the terms of service of the CA)"`
+	ACMEHosts            []string          `long:"acme-host" description:"host name, for which a certificate is obtained via ACME e.g., \"files.example.com\"" env-delim:","`
+	ACMECache            string            `long:"acme-cache" description:"directory outside the server root to store the certificates and account key obtained via ACME in"`
+	ACMEEmail            string            `long:"acme-email" description:"contact email address of the ACME account for notifications about expiring certificates"`
+	ACMEDirectory        string            `long:"acme-directory" description:"directory URL of the ACME CA e.g., for the staging environment of Let's Encrypt (default: Let's Encrypt)"`
+	ACMEHTTPListen       string            `long:"acme-http-listen" description:"host address and port to answer HTTP-01 challenges and redirect other requests to HTTPS on" default:":80"`
+	TLSClientRules       []string          `long:"tls-client-rule" description:"access rule for client certificates e.g., \"CN=backup rw /backups/\" or \"OU=ops ro\" (first match wins)" env-delim:"\n"`
+	OutboundCAs          []string          `long:"outbound-ca" description:"PEM encoded CA certificate file trusted by integrations (in addition to the system roots) e.g., of a TLS-intercepting proxy (proxies are read from HTTPS_PROXY and NO_PROXY)" env-delim:","`
+	SAMLIDPMetadata      string            `long:"saml-idp-metadata" description:"file or URL of the SAML identity provider metadata (enables SAML login)"`
+	SAMLURL              string            `long:"saml-url" description:"public URL of the server including the prefix e.g., \"https://files.example.com/\""`
+	SAMLCert             string            `long:"saml-cert" description:"PEM encoded certificate of the SAML service provider"`
+	SAMLKey              string            `long:"saml-key" description:"PEM encoded RSA private key of the SAML service provider"`
+	SAMLRoleAttribute    string            `long:"saml-role-attribute" description:"SAML attribute holding the roles of a user" default:"Role"`
+	SAMLRoles            map[string]string `long:"saml-role" description:"access (ro or rw) granted to users with the given role e.g., \"engineering:rw\" (default: rw for every user)" env-delim:","`
+	OIDCIssuer           string            `long:"oidc-issuer" description:"issuer URL of the OpenID Connect provider e.g., \"https://login.example.com/realms/corp\" (enables OpenID Connect login)"`
+	OIDCClientID         string            `long:"oidc-client-id" description:"client ID registered at the OpenID Connect provider"`
+	OIDCClientSecret     string            `long:"oidc-client-secret" description:"client secret registered at the OpenID Connect provider" secret:"true"`
+	OIDCURL              string            `long:"oidc-url" description:"public URL of the server including the prefix, whose \"_janus/oidc/callback\" is the redirect URI (default: base-url)"`
+	OIDCScopes           []string          `long:"oidc-scope" description:"scope requested from the OpenID Connect provider in addition to openid (default: profile and email)" env-delim:","`
+	OIDCUserClaim        string            `long:"oidc-user-claim" description:"claim of the ID token holding the user name (falls back to sub)" default:"preferred_username"`
+	OIDCGroupsClaim      string            `long:"oidc-groups-claim" description:"claim of the ID token holding the groups of a user" default:"groups"`
+	OIDCRoles            map[string]string `long:"oidc-role" description:"access (ro or rw) granted to users in the given group e.g., \"engineering:rw\" (default: rw for every user)" env-delim:","`
+	AuthJWTJWKSURL       string            `long:"auth-jwt-jwks-url" description:"URL of the JSON Web Key Set verifying JWT bearer tokens e.g., \"https://gitlab.example.com/oauth/discovery/keys\" (enables JWT authentication)"`
+	AuthJWTKey           string            `long:"auth-jwt-key" description:"PEM encoded RSA or ECDSA public key verifying JWT bearer tokens (instead of auth-jwt-jwks-url)"`
+	AuthJWTIssuer        string            `long:"auth-jwt-issuer" description:"required issuer (iss) of JWT bearer tokens"`
+	AuthJWTAudience      string            `long:"auth-jwt-audience" description:"required audience (aud) of JWT bearer tokens e.g., \"https://files.example.com\""`
+	AuthJWTUserClaim     string            `long:"auth-jwt-user-claim" description:"claim of JWT bearer tokens holding the user name" default:"sub"`
+	AuthJWTGroupsClaim   string            `long:"auth-jwt-groups-claim" description:"claim of JWT bearer tokens holding the groups" default:"groups"`
+	AuthJWTRoles         map[string]string `long:"auth-jwt-role" description:"access (ro or rw) granted to JWT bearer tokens with the given group e.g., \"ci:rw\" (default: rw for every valid token)" env-delim:","`
+	AuthJWTLogClaims     []string          `long:"auth-jwt-log-claim" description:"claim of JWT bearer tokens added to the access log in addition to iss and sub e.g., \"project_path\"" env-delim:","`
+	UsersFile            string            `long:"users-file" description:"file with local users and bcrypt or APR1 password hashes as created by \"htpasswd -B\" or \"htpasswd -m\" (enables login)"`
+	EnableAccessFiles    bool              `long:"enable-access-files" description:"evaluate access rules in \".janusaccess\" files of the requested directory and its parents"`
+	HomeDirs             bool              `long:"home-dirs" description:"serve each authenticated user from \"<server-root>/<user>\" (created on first access)"`
+	GroupsFile           string            `long:"groups-file" description:"file assigning local users to groups, one \"<group>: <user>...\" per line"`
+	TenantsFile          string            `long:"tenants-file" description:"file mapping bearer tokens, users and groups to tenants, each served from its own directory, one \"<tenant> <dir> [token=<sha256>] [group=<group>] [max-requests=<n>]\" per line"`
+	SessionLifetime      time.Duration     `long:"session-lifetime" description:"duration, after which users must log in again" default:"12h"`
+	EnrollTOTP           string            `long:"enroll-totp" description:"generate a TOTP secret for the given user in the users file, print its otpauth URI and exit" no-env:"true"`
+	Prefix               string            `short:"p" long:"prefix" description:"prefix for the HTTP URLs" default:"/"`
+	BaseURL              string            `long:"base-url" description:"external URL used in links and forms, if janus runs behind a reverse proxy e.g., \"https://files.example.com/downloads/\" (default: derived from the request)"`
+	EnableUpload         bool              `short:"u" long:"enable-upload" description:"enable upload of files by adding \"?upload\""`
+	UploadToken          string            `long:"upload-token" description:"token required in the X-Janus-Token header or the \"token\" query parameter for uploads and other requests except GET and HEAD" secret:"true"`
+	DropBox              bool              `long:"drop-box" description:"accept uploads, but deny downloads and directory listings (implies enable-upload)"`
+	Roles                []string          `long:"role" description:"permissions (read, write, delete, share) of a user, @group or public for path patterns e.g., \"@staff read,write /team/\" (replaces enable-upload)" env-delim:"\n"`
+	Retention            time.Duration     `long:"retention" description:"period after upload, during which files cannot be overwritten or deleted (0 disables the retention)" default:"0s"`
+	AuditLog             string            `long:"audit-log" description:"file to append audit events (uploads, deletions and denied attempts) to (default: the regular log)"`
+	ShareLifetime        time.Duration     `long:"share-lifetime" description:"duration, for which share links created via \"?share\" are valid" default:"24h"`
+	Maven                bool              `long:"maven" description:"accept Maven and Gradle deployments via PUT, validating checksum files (requires uploads)"`
+	Git                  bool              `long:"git" description:"serve bare Git repositories below the server root over the dumb HTTP protocol"`
+	GitUpdateServerInfo  bool              `long:"git-update-server-info" description:"run \"git update-server-info\" when a repository has changed instead of generating info/refs"`
+	GoProxy              bool              `long:"goproxy" description:"serve the server root as Go module proxy (GOPROXY protocol) with module zips stored as \"<module>/@v/<version>.zip\""`
+	APT                  bool              `long:"apt" description:"generate APT repository metadata (Packages, Release) for directories containing .deb files"`
+	SigningKey           string            `long:"signing-key" description:"armored OpenPGP private key without passphrase for signing generated metadata e.g., APT Release files"`
+	SigningKeyID         string            `long:"signing-key-id" description:"ID of the OpenPGP key used for signing via gpg and its agent (alternative to signing-key)"`
+	ListingCacheSize     int               `long:"listing-cache-size" description:"maximum number of cached directory listings (0 disables the cache)" default:"0"`
+	FileCacheSizeKB      int64             `long:"file-cache-size" description:"total number of kilobytes of small files cached in memory (0 disables the cache)" default:"0"`
+	FileCacheMaxKB       int64             `long:"file-cache-max-file-size" description:"maximum size of a cached file in kilobytes" default:"64"`
+	HandleCacheSize      int               `long:"handle-cache-size" description:"maximum number of large files kept open for serving range requests e.g., of video players (0 disables the cache)" default:"0"`
+	HandleCacheMinKB     int64             `long:"handle-cache-min-file-size" description:"minimum size of a file kept open in kilobytes" default:"1024"`
+	ReadaheadKB          int               `long:"readahead" description:"number of kilobytes read at once when serving range requests from open files (0 disables readahead)" default:"256"`
+	NegativeCacheSize    int               `long:"negative-cache-size" description:"maximum number of paths remembered as not found, so that repeated requests do not hit the filesystem (0 disables the cache)" default:"0"`
+	NegativeCacheTTL     time.Duration     `long:"negative-cache-ttl" description:"duration, after which a path remembered as not found is looked up again" default:"10s"`
+	MaxConnections       int               `long:"max-connections" description:"maximum number of simultaneous connections (0 means unlimited)" default:"0"`
+	MaxConcurrentReqs    int               `long:"max-concurrent-requests" description:"maximum number of requests handled simultaneously (0 means unlimited)" default:"0"`
+	ReadTimeout          time.Duration     `long:"read-timeout" description:"maximum duration for reading the entire request including the body (0 means no timeout)" default:"0s"`
+	ReadHeaderTimeout    time.Duration     `long:"read-header-timeout" description:"maximum duration for reading the request headers" default:"30s"`
+	WriteTimeout         time.Duration     `long:"write-timeout" description:"maximum duration before timing out writes of the response (0 means no timeout)" default:"0s"`
+	IdleTimeout          time.Duration     `long:"idle-timeout" description:"maximum duration to wait for the next request on a keep-alive connection (0 means read timeout)" default:"0s"`
+	RequestTimeout       time.Duration     `long:"request-timeout" description:"maximum duration for handling a request (0 means no timeout)" default:"0s"`
+	RequestTimeoutExempt []string          `long:"request-timeout-exempt" description:"path pattern exempt from the request timeout e.g., \"/downloads/\" or \"/logs/*.log\"" env-delim:","`
+	MaxHeaderBytes       int               `long:"max-header-bytes" description:"maximum number of bytes of the request headers" default:"1048576"`
+	MaxURILength         int               `long:"max-uri-length" description:"maximum length of the request URI (0 means unlimited)" default:"8192"`
+	DisableKeepAlive     bool              `long:"disable-keep-alive" description:"close connections after each request"`
+	MaxConnRequests      int               `long:"max-requests-per-connection" description:"maximum number of requests served per keep-alive connection (0 means unlimited)" default:"0"`
+	MinUploadRateKB      uint32            `long:"min-upload-rate" description:"minimum transfer rate of request bodies in kilobytes per second (0 disables the check)" default:"0"`
+	MinUploadRatePeriod  time.Duration     `long:"min-upload-rate-period" description:"period, during which the minimum transfer rate must be reached" default:"10s"`
+	UploadStallTimeout   time.Duration     `long:"upload-stall-timeout" description:"duration without receiving data, after which an upload is logged and reported as stalled at \"/_janus/progress/<id>\" (0 disables progress tracking)" default:"1m"`
+	Limits               []string          `long:"limit" description:"request rate, bandwidth (KB/s) and storage quota of a user, @group or public e.g., \"@ci rate=50 bandwidth=10240 quota=10G\" (first match wins)" env-delim:"\n"`
+	WorkPools            []string          `long:"work-pool" description:"maximum number of concurrent (workers) and waiting (queue) disk-heavy operations of a class (checksum or metadata) e.g., \"checksum workers=4 queue=16\"" env-delim:"\n"`
+	MaxRequestsPerIP     int               `long:"max-requests-per-ip" description:"maximum number of simultaneous requests per client IP (0 means unlimited)" default:"0"`
+	AllowCIDRs           []string          `long:"allow-cidr" description:"network of clients, which are permitted e.g., \"10.0.0.0/8\" (default: all)" env-delim:","`
+	DenyCIDRs            []string          `long:"deny-cidr" description:"network of clients, which are denied e.g., \"192.0.2.0/24\" (takes precedence over allow-cidr)" env-delim:","`
+	CIDRScope            string            `long:"cidr-scope" description:"requests restricted by allow-cidr and deny-cidr (write permits GET and HEAD requests of all clients)" choice:"all" choice:"write" default:"all"`
+	HSTSMaxAge           time.Duration     `long:"hsts-max-age" description:"max-age of the Strict-Transport-Security header, which makes browsers use HTTPS only (0 disables the header)" default:"0s"`
+	CSP                  string            `long:"content-security-policy" description:"Content-Security-Policy header e.g., \"default-src 'self'\""`
+	FrameOptions         string            `long:"frame-options" description:"X-Frame-Options header, which prevents embedding in other sites e.g., \"DENY\" or \"SAMEORIGIN\""`
+	NoSniff              bool              `long:"nosniff" description:"send \"X-Content-Type-Options: nosniff\", so that browsers do not guess the content type"`
+	Headers              []string          `long:"header" description:"response header added for a path pattern e.g., \"/public/ Access-Control-Allow-Origin: *\" (an empty value removes the header)" env-delim:"\n"`
+	Preload              map[string]string `long:"preload" description:"Link header sent as 103 Early Hints for a path e.g., \"/index.html:</app.js>; rel=preload; as=script\"" env-delim:"\n"`
+	Capture              string            `long:"capture" description:"directory to record requests including headers and bodies to for replaying them via \"janus replay\""`
+	CaptureSample        sampleRate        `long:"capture-sample" description:"fraction of requests recorded e.g., \"1/100\"" default:"1/1"`
+	CapturePaths         []string          `long:"capture-path" description:"path pattern of requests recorded e.g., \"/releases/\" (default: all)" env-delim:","`
+	CaptureMaxBodyKB     int64             `long:"capture-max-body" description:"maximum number of kilobytes recorded per request body" default:"64"`
+	FaultLatency         time.Duration     `long:"fault-latency" description:"delay added to requests matching fault-path for testing clients" default:"0s"`
+	FaultErrorRate       float64           `long:"fault-error-rate" description:"fraction of requests matching fault-path answered with a random 5xx status code e.g., 0.1" default:"0"`
+	FaultResetRate       float64           `long:"fault-reset-rate" description:"fraction of requests matching fault-path, whose connection is reset without a response" default:"0"`
+	FaultTruncateRate    float64           `long:"fault-truncate-rate" description:"fraction of requests matching fault-path, whose response body is cut off halfway" default:"0"`
+	FaultPaths           []string          `long:"fault-path" description:"path pattern of requests faults are injected into e.g., \"/releases/\" (default: all)" env-delim:","`
+	LogSample            sampleRate        `long:"log-sample" description:"fraction of successful requests written to the access log e.g., \"1/100\" (failed requests are always logged)" default:"1/1"`
+	LogExcludePaths      []string          `long:"log-exclude-path" description:"path pattern of successful requests omitted from the access log e.g., \"/_janus/health\" or \"/favicon.ico\"" env-delim:","`
+	SlowFSThreshold      time.Duration     `long:"slow-fs-threshold" description:"duration, after which a filesystem operation (open, stat, readdir or copy) is logged as slow e.g., \"500ms\" (0 disables the log)" default:"0s"`
+	EnableMetrics        bool              `long:"enable-metrics" description:"expose metrics at \"/_janus/metrics\""`
+	StatsD               string            `long:"statsd" description:"address of a StatsD server to send request counts, durations and bytes to via UDP e.g., \"localhost:8125\""`
+	StatsDPrefix         string            `long:"statsd-prefix" description:"prefix of the metric names" default:"janus."`
+	StatsDFormat         string            `long:"statsd-format" description:"format of the metrics (dogstatsd adds method and status class as tags)" choice:"statsd" choice:"dogstatsd" default:"statsd"`
+	StatsDTags           []string          `long:"statsd-tag" description:"tag added to all metrics in DogStatsD format e.g., \"env:prod\"" env-delim:","`
+	OTLPEndpoint         string            `long:"otlp-endpoint" description:"base URL of an OpenTelemetry collector to export metrics to via OTLP/HTTP e.g., \"http://localhost:4318\" (resource attributes are read from OTEL_RESOURCE_ATTRIBUTES)"`
+	OTLPInterval         time.Duration     `long:"otlp-interval" description:"interval for exporting metrics via OTLP" default:"1m"`
+	SMTPServer           string            `long:"smtp-server" description:"host and port of the SMTP server for sending notifications e.g., \"smtp.example.com:587\""`
+	SMTPUser             string            `long:"smtp-user" description:"user name for authenticating at the SMTP server"`
+	SMTPPassword         string            `long:"smtp-password" description:"password for authenticating at the SMTP server" secret:"true"`
+	SMTPFrom             string            `long:"smtp-from" description:"sender address of notifications e.g., \"janus@example.com\""`
+	NotifyRules          []string          `long:"notify" description:"email recipients notified about uploads to a path pattern e.g., \"/reports/ alice@example.com,bob@example.com\"" env-delim:"\n"`
+	NotifySubject        string            `long:"notify-subject" description:"template of the notification subject" default:"New file: {{.Name}}"`
+	NotifyBody           string            `long:"notify-body" description:"file with the template of the notification body (fields: Name, Path, URL, Size, User, Time)"`
+	ChatTargets          []string          `long:"chat" description:"Slack or Teams webhook, or Matrix homeserver, to post messages about uploads and deletions to e.g., \"slack https://hooks.slack.com/services/... events=upload path=/reports/\" or \"matrix https://matrix.example.com room=!abc:example.com\"" env-delim:"\n"`
+	ChatMatrixToken      string            `long:"chat-matrix-token" description:"access token of the Matrix user posting messages" secret:"true"`
+	ChatTemplate         string            `long:"chat-template" description:"template of chat messages (fields: Event, Name, Path, URL, Link, Size, User, Time)" default:"{{.Event}}: {{.Name}} ({{.Size}} bytes){{if .User}} by {{.User}}{{end}} {{.Link}}"`
+	AdminToken           string            `long:"admin-token" description:"bearer token for the admin API at \"/_janus/admin/\" (disabled if empty)" secret:"true"`
+	Maintenance          bool              `long:"maintenance" description:"start in maintenance mode, which rejects all requests except for the API with 503 Service Unavailable"`
+	MaintenancePage      string            `long:"maintenance-page" description:"HTML file served in maintenance mode"`
+	BrandTitle           string            `long:"brand-title" description:"name of the organization shown in the header and title of all pages"`
+	BrandLogo            string            `long:"brand-logo" description:"image file shown in the header of all pages"`
+	BrandCSS             string            `long:"brand-css" description:"style sheet added to all pages e.g., for overriding the colors of the theme"`
+	Translations         string            `long:"translations" description:"directory with JSON message catalogs for the UI named after their language e.g., \"de.json\""`
+	Templates            string            `long:"templates" description:"directory with HTML templates replacing the upload page, directory listings and error pages (upload.html, listing.html and error.html)"`
+	CAS                  bool              `long:"cas" description:"store uploads by their SHA-256 digest and serve them at \"/cas/sha256/<digest>\" (the uploaded path points to the digest), accepting uploads via PUT as well"`
+	Torrent              bool              `long:"torrent" description:"generate torrents of files, which list janus as web seed, when adding \"?torrent\""`
+	TorrentTrackers      []string          `long:"torrent-tracker" description:"announce URL of a BitTorrent tracker added to generated torrents (default: trackerless)" env-delim:","`
+	Locks                bool              `long:"locks" description:"support WebDAV locking via LOCK and UNLOCK, so that clients do not overwrite each other's changes"`
+	LockTimeout          time.Duration     `long:"lock-timeout" description:"maximum duration of a lock, unless it is refreshed" default:"10m"`
+	Resumable            bool              `long:"resumable" description:"accept resumable uploads via the tus protocol, whose state survives restarts"`
+	ResumableExpiry      time.Duration     `long:"resumable-expiry" description:"duration, after which incomplete resumable uploads are discarded" default:"24h"`
+	ICAP                 string            `long:"icap" description:"URL of an ICAP service (e.g., anti-virus or DLP), which inspects uploads before they are accepted e.g., \"icap://dlp.example.com:1344/reqmod\""`
+	ICAPMethod           string            `long:"icap-method" description:"ICAP method supported by the service" choice:"REQMOD" choice:"RESPMOD" default:"REQMOD"`
+	ICAPTimeout          time.Duration     `long:"icap-timeout" description:"maximum duration of the inspection of an upload" default:"1m"`
+	QuarantineDir        string            `long:"quarantine-dir" description:"directory outside the server root, in which uploads are kept until approved via the admin API (requires admin-token)"`
+	AssetPaths           []string          `long:"asset-path" description:"path pattern, below which uploads are published as hashed assets e.g., \"/static/\" (\"app.js\" is stored as \"app.<hash>.js\" and recorded in manifest.json)" env-delim:","`
+	Append               bool              `long:"append" description:"append the request body to a file via PATCH, optionally at the offset given by Content-Range e.g., for log shippers"`
+	HistoryDir           string            `long:"history-dir" description:"directory outside the server root, in which snapshots of the files are recorded periodically (enables \"/_janus/admin/history\")"`
+	HistoryPaths         []string          `long:"history-path" description:"path below the server root, whose files are recorded in snapshots e.g., \"/shared/\" (default: /)" env-delim:","`
+	HistoryInterval      time.Duration     `long:"history-interval" description:"interval, at which snapshots are recorded" default:"1h"`
+	HistoryKeep          int               `long:"history-keep" description:"number of snapshots kept" default:"168"`
+	SweepAge             time.Duration     `long:"sweep-age" description:"minimum age of orphaned temporary files (e.g., of interrupted uploads), which are removed at startup and periodically (0 disables the removal)" default:"24h"`
+	SweepInterval        time.Duration     `long:"sweep-interval" description:"interval, at which orphaned temporary files are removed after startup (0 removes them only at startup)" default:"1h"`
+	Integrity            bool              `long:"integrity" description:"respond with Subresource Integrity hashes (sha384) of files, or of all scripts and style sheets in a directory, when adding \"?integrity\""`
+	Sitemap              string            `long:"sitemap" description:"public URL of the server including the prefix e.g., \"https://files.example.com/\" (enables \"/sitemap.xml\")"`
+	SitemapExclude       []string          `long:"sitemap-exclude" description:"path pattern omitted from the sitemap e.g., \"/drafts/\" or \"/*.tmp\"" env-delim:","`
+	SitemapInterval      time.Duration     `long:"sitemap-interval" description:"interval, after which the sitemap is regenerated (0 regenerates it only when files are changed via janus)" default:"1h"`
+	Robots               robotsPolicy      `long:"robots" description:"robots.txt served to crawlers: disallow-all, allow-all or file=<name> (default: the one in the server root, if any)"`
+	NoIndex              bool              `long:"noindex" description:"ask search engines not to index any response by sending \"X-Robots-Tag: noindex, nofollow\""`
+	Chroot               bool              `long:"chroot" description:"confine the process to the server root (requires root privileges)"`
+	Sandbox              bool              `long:"sandbox" description:"restrict file system access to the server root (Linux only)"`
+	User                 string            `long:"user" description:"user to switch to after binding the listen address"`
+	Group                string            `long:"group" description:"group to switch to after binding the listen address (default: primary group of the user)"`
+	PIDFile              string            `long:"pid-file" description:"file to write the process ID to"`
+	ShutdownTimeout      time.Duration     `long:"shutdown-timeout" description:"maximum duration to wait for in-flight requests when shutting down" default:"30s"`
+	PortFile             string            `long:"port-file" description:"file to write the bound port to (useful with port 0)"`
+	Config               string            `short:"c" long:"config" description:"INI file with options e.g., \"role = public read\" (environment variables and arguments take precedence)" no-ini:"true"`
+	Version              bool              `short:"v" long:"version" description:"print version information" no-env:"true"`
+
+	// replay holds the options of the replay command.
+	replay replayOptions
+	// bench holds the options of the bench command.
+	bench benchOptions
+	// backup holds the options of the backup command.
+	backup backupOptions
+	// restore holds the options of the restore command.
+	restore restoreOptions
+	// statsd sends metrics to StatsD, if configured.
+	statsd *statsd
+	// chat posts messages about uploads and deletions, if configured.
+	chat *chat
+	// notifier sends emails about uploads, if configured.
+	notifier *notifier
+	// otlp exports metrics via OTLP, if configured.
+	otlp *otlpMetrics
+	// capture records requests, if enabled.
+	capture *capture
+	// faults injects faults into requests, if configured.
+	faults *faults
+	// command is the name of the command given on the command line, if any.
+	command string
+	// sources maps the long name of each option to the source of its value.
+	sources map[string]string
+	// locations holds the sections of the config file, which override options for a path prefix.
+	locations []location
+	// acme obtains TLS certificates via ACME, if enabled.
+	acme *autocert.Manager
+	// addrs holds the actual addresses of all listeners, which are only known after binding.
+	addrs []string
+	// certRules holds the parsed client certificate rules.
+	certRules []certRule
+	// saml is the SAML service provider, if configured.
+	saml *samlAuth
+	// oidc is the OpenID Connect client, if configured.
+	oidc *oidcAuth
+	// jwt verifies JWT bearer tokens, if configured.
+	jwt *jwtAuth
+	// accounts holds the local users, if configured.
+	accounts *accounts
+	// sessions holds the sessions of logged in users.
+	sessions *sessionStore
+	// limits holds the limits per client, if configured.
+	limits *identityLimits
+	// ipFilter permits or denies clients by their IP address, if configured.
+	ipFilter *ipFilter
+	// headers are added to responses according to the header rules.
+	headers []headerRule
+	// upstream fetches missing files from the upstream server, if configured.
+	upstream *upstream
+	// pools restricts concurrent disk-heavy operations, if configured.
+	pools workPools
+	// tenants holds the tenants, if configured.
+	tenants tenants
+	// roles holds the parsed roles.
+	roles []role
+	// shares issues share links, if roles are defined.
+	shares *shareLinks
+	// maint holds the state of the maintenance mode.
+	maint *maintenance
+	// translations holds the message catalogs of the UI, if configured.
+	translations translations
+	// brand describes how the UI presents itself.
+	brand *brand
+	// signer signs generated metadata, if configured.
+	signer signer
+	// apt generates APT repository metadata, if enabled.
+	apt *aptRepo
+	// torrents generates torrents, if enabled.
+	torrents *torrents
+	// icons holds the built-in favicon and web manifest.
+	icons *icons
+	// baseURL is the external URL of janus, if configured.
+	baseURL *url.URL
+	// locks keeps track of WebDAV locks, if enabled.
+	locks *lockManager
+	// uploads stores the state of resumable uploads, if enabled.
+	uploads *resumableUploads
+	// progress tracks the bytes received by uploads, if enabled.
+	progress *uploadProgress
+	// icap inspects uploads, if configured.
+	icap *icapClient
+	// quarantine keeps uploads until they are reviewed, if enabled.
+	quarantine *quarantine
+	// history records snapshots of the files, if enabled.
+	history *history
+	// assets publishes uploads as hashed assets, if enabled.
+	assets *assets
+	// integrity computes Subresource Integrity hashes, if enabled.
+	integrity *integrityHashes
+	// sitemap generates the sitemap, if enabled.
+	sitemap *sitemap
+	// robots holds the robots.txt according to the robots policy, if set.
+	robots []byte
+	// scopes holds the application as configured for each location.
+	scopes scopes
 }
 
 // ctxKey is used for looking up Context values in Handlers.
@@ -93,6 +720,10 @@ type ctxKey int
 
 const (
 	logger ctxKey = iota
+	connection
+	requestID
+	principal
+	language
 )
 
 // ctxResponseWriter captures request time and HTTP status code.
@@ -103,21 +734,63 @@ type ctxResponseWriter struct {
 }
 
 func (w *ctxResponseWriter) WriteHeader(status int) {
-	w.status = status
+	if status >= http.StatusOK {
+		// informational responses are followed by the final one
+		w.status = status
+	}
 	w.ResponseWriter.WriteHeader(status)
 }
 
+// Hijack delegates to the underlying ResponseWriter, if it implements http.Hijacker.
+func (w *ctxResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if hj, ok := w.ResponseWriter.(http.Hijacker); ok {
+		return hj.Hijack()
+	}
+	return nil, nil, http.ErrNotSupported
+}
+
+// Flush delegates to the underlying ResponseWriter, if it implements http.Flusher.
+func (w *ctxResponseWriter) Flush() {
+	if fl, ok := w.ResponseWriter.(http.Flusher); ok {
+		fl.Flush()
+	}
+}
+
+// ReadFrom delegates to the underlying ResponseWriter, if it implements io.ReaderFrom.
+// Otherwise, wrapping the ResponseWriter would prevent net/http from using sendfile(2) or splice(2)
+// for copying files to plain TCP connections.
+func (w *ctxResponseWriter) ReadFrom(src io.Reader) (int64, error) {
+	if rf, ok := w.ResponseWriter.(io.ReaderFrom); ok {
+		return rf.ReadFrom(src)
+	}
+	return io.Copy(struct{ io.Writer }{w.ResponseWriter}, src)
+}
+
 // loadConfig parses the given command line arguments.
-// If an argument is undefined, it takes environment variables into consideration.
+// If an argument is undefined, it takes environment variables and the config file into consideration.
 func loadConfig(args ...string) (app app) {
-	p := flags.NewParser(&app, flags.Default)
-	if _, err := p.ParseArgs(args); err != nil {
+	p := newParser(&app)
+	_, err := p.ParseArgs(args)
+	flagged, filed := setOptions(p), map[string]bool{}
+	if err == nil && app.Config != "" {
+		p, filed, err = parseConfigFile(&app, app.Config, args)
+	}
+	if err != nil {
 		var fErr *flags.Error
-		if errors.As(err, &fErr) && fErr.Type != flags.ErrHelp {
+		if !errors.As(err, &fErr) {
+			fmt.Fprintln(os.Stderr, err)
+		} else if fErr.Type != flags.ErrHelp {
 			p.WriteHelp(os.Stderr)
 		}
 		os.Exit(1)
-	} else if app.Version {
+	}
+	var cmds []string
+	for c := p.Active; c != nil; c = c.Active {
+		cmds = append(cmds, c.Name)
+	}
+	app.command = strings.Join(cmds, " ")
+	app.sources = optionSources(p, flagged, filed)
+	if app.Version {
 		fmt.Println("janus version " + version)
 		os.Exit(0)
 	}
@@ -129,56 +802,279 @@ func loadConfig(args ...string) (app app) {
 	return
 }
 
-// resolveIP attempts to resolve the primary IP of the given bind address
+// resolveIPs attempts to resolve the IPs of the given bind address
 // in the form "[iface_or_host]:port".
 //
 // If the first part is empty or not an interface, the input is returned.
-// Otherwise ip:port is returned.
-func resolveIP(listen string) (string, error) {
-	hp := strings.SplitN(listen, ":", 3)
-	if len(hp) != 2 {
-		return "", errors.New("invalid listen address")
+// Otherwise ip:port is returned for every address of the interface, IPv4 addresses first,
+// unless restricted by family.
+func resolveIPs(listen, family string) ([]string, error) {
+	host, port, err := net.SplitHostPort(listen)
+	if err != nil {
+		return nil, errors.New("invalid listen address")
 	}
 
-	iface, err := net.InterfaceByName(hp[0])
+	iface, err := net.InterfaceByName(host)
 	if err != nil {
 		// assume it's an IP address
-		return listen, nil
+		return []string{listen}, nil
 	}
 
 	addrs, err := iface.Addrs()
 	if err != nil {
-		log.Fatal().Str("interface", hp[0]).Err(err).Msg("Cannot resolve IP")
+		log.Fatal().Str("interface", host).Err(err).Msg("Cannot resolve IP")
 	}
 
+	var v4, v6 []string
 	for _, addr := range addrs {
-		if ip := addr.(*net.IPNet).IP.To4(); ip != nil {
-			log.Info().Stringer("IP", ip).Str("interface", hp[0]).Msg("Resolving IP for bind address")
-			return ip.String() + ":" + hp[1], nil
+		ip := addr.(*net.IPNet).IP
+		if ip.To4() != nil && family != ipv6 {
+			v4 = append(v4, net.JoinHostPort(ip.String(), port))
+		} else if ip.To4() == nil && family != ipv4 {
+			s := ip.String()
+			if ip.IsLinkLocalUnicast() {
+				s += "%" + iface.Name
+			}
+			v6 = append(v6, net.JoinHostPort(s, port))
+		}
+	}
+
+	if ips := append(v4, v6...); len(ips) > 0 {
+		log.Info().Strs("IPs", ips).Str("interface", host).Msg("Resolving IP for bind address")
+		return ips, nil
+	}
+	return nil, errors.New("interface does not have a suitable IP address")
+}
+
+// network returns the network name for net.Listen according to the IP family.
+func network(family string) string {
+	switch family {
+	case ipv4:
+		return "tcp4"
+	case ipv6:
+		return "tcp6"
+	default:
+		return "tcp"
+	}
+}
+
+// writePortFile writes the port of the given address to the named file.
+func writePortFile(name string, addr net.Addr) error {
+	_, port, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(name, []byte(port+"\n"), 0644)
+}
+
+// sandboxDirs returns the directories, which must remain accessible after enabling the sandbox.
+func sandboxDirs(a app) (ro, rw []string) {
+	// load MIME types before access to /etc is denied
+	_ = mime.TypeByExtension(".html")
+	// certificate and key files are read again when they are renewed
+	for _, f := range append(a.TLSCerts, a.TLSKeys...) {
+		ro = append(ro, filepath.Dir(f))
+	}
+	if a.ACME {
+		// load the root CAs before access to /etc is denied, since the ACME CA is contacted later on
+		_, _ = x509.SystemCertPool()
+		rw = append(rw, a.ACMECache)
+	}
+	if a.Capture != "" {
+		rw = append(rw, a.Capture)
+	}
+	if a.QuarantineDir != "" {
+		rw = append(rw, a.QuarantineDir)
+	}
+	if a.HistoryDir != "" {
+		rw = append(rw, a.HistoryDir)
+	}
+	if a.MirrorUpstream != "" {
+		// load the root CAs before access to /etc is denied, since the upstream server is contacted later on
+		_, _ = x509.SystemCertPool()
+	}
+	ro = append(ro, a.MirrorRoots...)
+	if uploadEnabled(a) || a.MirrorUpstream != "" {
+		return ro, append(rw, a.ServerRoot, os.TempDir())
+	}
+	return append(ro, a.ServerRoot), rw
+}
+
+// newRouter routes the methods supported by the enabled features to h.
+// The router does not answer OPTIONS requests itself, so that h determines the methods allowed for a path.
+func newRouter(a app, h http.Handler) *httprouter.Router {
+	ms := routedMethods(a)
+	for _, s := range a.scopes {
+		ms = append(ms, routedMethods(s.app)...)
+	}
+
+	r := httprouter.New()
+	r.HandleOPTIONS = false
+	p := path.Join(a.Prefix, "/*path")
+	routed := map[string]bool{}
+	for _, m := range ms {
+		if !routed[m] {
+			r.Handler(m, p, h)
+			routed[m] = true
+		}
+	}
+	if path.Clean(a.Prefix) != "/" {
+		// browsers and crawlers look for favicon.ico and robots.txt at the root of the host
+		r.Handler(http.MethodGet, "/favicon.ico", h)
+		r.Handler(http.MethodHead, "/favicon.ico", h)
+		if a.robots != nil {
+			r.Handler(http.MethodGet, "/robots.txt", h)
+			r.Handler(http.MethodHead, "/robots.txt", h)
 		}
 	}
-	return "", errors.New("interface does not have an IPv4 address")
+	return r
+}
+
+// routedMethods returns the HTTP methods, which are accepted according to the options.
+func routedMethods(a app) []string {
+	ms := []string{http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPost}
+	if len(a.roles) > 0 {
+		ms = append(ms, http.MethodDelete)
+	}
+	if (a.Maven || a.CAS) && uploadEnabled(a) {
+		ms = append(ms, http.MethodPut)
+	}
+	if a.locks != nil {
+		ms = append(ms, "LOCK", "UNLOCK")
+	}
+	if a.uploads != nil || (a.Append && uploadEnabled(a)) {
+		ms = append(ms, http.MethodPatch)
+	}
+	return ms
+}
+
+// newHandler assembles the chain of handlers, which every request passes through.
+// The handlers are applied from the innermost to the outermost one.
+func newHandler(a app) http.Handler {
+	h := a.scopes.handler(a, newFileHandler)
+	h = handleMaintenance(a.maint, h)
+	h = limitConcurrentRequests(a.MaxConcurrentReqs, h)
+	h = handleAPI(a, h)
+	h = limitDuration(a.RequestTimeout, a.RequestTimeoutExempt, h)
+	h = handleOptions(a, h)
+	h = addHeaders(a.headers, h)
+	h = rejectInternalPaths(h)
+	h = rejectPathEscape(h)
+	h = http.StripPrefix(strings.TrimRight(a.Prefix, "/"), h)
+	h = handleRobots(a.robots, a.NoIndex, a.Prefix, h)
+	h = serveIcons(a, h)
+	h = limitURILength(a.MaxURILength, h)
+	h = limitConnRequests(a.MaxConnRequests, h)
+	h = limitRequestsPerIP(a.MaxRequestsPerIP, h)
+	h = limitUploadRate(int64(a.MinUploadRateKB)*1024, a.MinUploadRatePeriod, h)
+	h = trackProgress(a, h)
+	h = localize(a.translations, h)
+	h = captureRequests(a.capture, h)
+	h = injectFaults(a.faults, h)
+	h = reportStats(recorders(a), h)
+	h = filterIPs(a.ipFilter, h)
+	return logHandler(newLogFilter(a.LogSample, a.LogExcludePaths, a.Prefix), h)
+}
+
+// newFileHandler assembles the chain of handlers serving files, including authentication and authorization.
+// It is created for every location, so that their options apply.
+func newFileHandler(a app) http.Handler {
+	var h http.Handler = handleRequest(a)
+	h = serveGit(a, h)
+	h = serveGoProxy(a, h)
+	h = serveAPT(a, h)
+	h = serveSitemap(a, h)
+	h = serveCAS(a, h)
+	h = handleLocks(a, h)
+	h = requirePreconditions(a, h)
+	h = handleEarlyHints(a.Preload, h)
+	h = restrictDropBox(a, h)
+	h = authorizeAccessFiles(a, h)
+	h = authorizeRoles(a, h)
+	h = limitIdentities(a, h)
+	h = requireHomeDir(a, h)
+	h = requireTenant(a, h)
+	authed := h
+	h = authorizeClientCert(a.certRules, h)
+	h = a.saml.require(h)
+	h = a.oidc.require(h)
+	h = requireLogin(a, h)
+	h = authenticateTokens(a.tenants, authed, h)
+	h = a.jwt.authenticate(authed, h)
+	h = requireUploadToken(a.UploadToken, h)
+	return h
 }
 
 // handleRequest processes all requests and delegates them to other handlers.
 func handleRequest(a app) http.HandlerFunc {
-	upTmpl := template.Must(template.New("upload").Parse(`
-<!DOCTYPE html>
-<meta charset="UTF-8">
-<title>Upload</title>
-<form action="http://{{.}}" enctype="multipart/form-data" method="POST">
+	upTmpl := template.Must(template.New("upload").Parse(`<form action="{{html .Action}}" enctype="multipart/form-data" method="POST">
   <input type="file" name="file" />
-  <input type="submit" value="Upload" />
+  <input type="submit" value="{{call .T "Upload"}}" />
 </form>
-`))
+{{if .Progress}}<progress hidden></progress> <span></span>
+<script>
+document.forms[0].addEventListener("submit", function (e) {
+  var id = Array.from(crypto.getRandomValues(new Uint8Array(16)), function (b) { return ("0" + b.toString(16)).slice(-2); }).join("");
+  var p = document.querySelector("progress"), s = p.nextElementSibling;
+  e.target.action += (e.target.action.indexOf("?") < 0 ? "?" : "&") + "X-Progress-ID=" + id;
+  p.hidden = false;
+  setInterval(function () {
+    fetch("{{js .Progress}}" + id).then(function (r) { return r.ok ? r.json() : null; }).then(function (u) {
+      if (u && u.expected > 0) {
+        p.max = u.expected;
+        p.value = u.received;
+        s.textContent = Math.floor(100 * u.received / u.expected) + "%" + (u.stalled ? " ({{js (call .T "stalled")}})" : "");
+      }
+    });
+  }, 1000);
+});
+</script>
+{{end}}`))
 
 	upHandler := handleUploadPage(a, upTmpl)
+	lc := newListingCache(a.ListingCacheSize)
+	fc := newFileCache(a.FileCacheSizeKB*1024, a.FileCacheMaxKB*1024)
+	hc := newHandleCache(a.HandleCacheSize, a.HandleCacheMinKB*1024, a.ReadaheadKB*1024)
+	nc := newNegativeCache(a.NegativeCacheSize, a.NegativeCacheTTL)
+	appends := &fileMutexes{}
+	fd := newFileDigests()
 	return func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate") // HTTP 1.1
-		w.Header().Set("Pragma", "no-cache")                                   // HTTP 1.0
-		w.Header().Set("Expires", "0")                                         // Proxies
+		for _, hr := range noCacheHeaders {
+			hr.set(w.Header())
+		}
+		cacheAsset(a, w, r)
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			// any modification may create a file, which is known to be missing
+			nc.purge()
+		}
+
+		if a.uploads != nil && r.Header.Get("Tus-Resumable") != "" {
+			handleResumableUpload(a).ServeHTTP(w, r)
+			return
+		} else if r.Method == http.MethodPatch && a.Append && uploadEnabled(a) {
+			handleAppend(a, appends).ServeHTTP(w, r)
+			return
+		} else if r.Method == http.MethodDelete && len(a.roles) > 0 {
+			handleDelete(a).ServeHTTP(w, r)
+			return
+		} else if r.Method == http.MethodPut && (a.Maven || a.CAS) && uploadEnabled(a) {
+			handleMavenDeploy(a).ServeHTTP(w, r)
+			return
+		} else if _, ok := r.URL.Query()["share"]; ok && a.shares != nil {
+			handleShare(a).ServeHTTP(w, r)
+			return
+		} else if _, ok := r.URL.Query()["integrity"]; ok && a.integrity != nil && (r.Method == http.MethodGet || r.Method == http.MethodHead) {
+			handleIntegrity(a).ServeHTTP(w, r)
+			return
+		} else if _, ok := r.URL.Query()["torrent"]; ok && a.torrents != nil && (r.Method == http.MethodGet || r.Method == http.MethodHead) {
+			handleTorrent(a).ServeHTTP(w, r)
+			return
+		} else if _, ok := r.URL.Query()["stat"]; ok && (r.Method == http.MethodGet || r.Method == http.MethodHead) {
+			handleStat(a, fd).ServeHTTP(w, r)
+			return
+		}
 
-		if a.EnableUpload {
+		if uploadEnabled(a) {
 			if r.Method == http.MethodPost {
 				handleFileUpload(a).ServeHTTP(w, r)
 				return
@@ -188,19 +1084,76 @@ func handleRequest(a app) http.HandlerFunc {
 			}
 		}
 
-		p := path.Join(a.ServerRoot, r.URL.Path)
+		cacheable := nc.cacheable(r)
+		if cacheable && nc.missing(r.URL.Path, time.Now()) {
+			http.NotFound(w, r)
+			return
+		}
+		p := readPath(a, r)
+		if err := a.upstream.fetch(r, p); err != nil {
+			renderError(w, r, err, "cannot fetch file from upstream", http.StatusBadGateway)
+			return
+		}
+		if strings.HasSuffix(r.URL.Path, "/") {
+			if fi, err := statFS(r.Context(), p); err == nil && fi.IsDir() && strings.Contains(r.Header.Get("Accept"), "application/json") {
+				handleStat(a, fd).ServeHTTP(w, r)
+				return
+			} else if err == nil && fi.IsDir() && !exists(path.Join(p, "index.html")) {
+				if !templates.serveListing(w, r, p) {
+					lc.serveListing(w, r, a.brand, p, fi)
+				}
+				return
+			}
+		}
+		if fc != nil && fc.serveFile(w, r, p) {
+			return
+		}
+		if hc != nil && hc.serveFile(w, r, p) {
+			return
+		}
+		if fi, err := statFS(r.Context(), p); err == nil && fi.Mode().IsRegular() {
+			w.Header().Set("ETag", fileETag(fi))
+		}
+		if cacheable {
+			nc.serveFile(w, r, p)
+			return
+		}
 		http.ServeFile(w, r, p)
 	}
 }
 
+// exists reports whether the named file or directory exists.
+func exists(name string) bool {
+	_, err := os.Stat(name)
+	return err == nil
+}
+
 // logHandler enriches the Request Context with logging capabilities.
-func logHandler(h http.Handler) http.Handler {
+// The access log entry is written, if the filter keeps the request.
+// It includes the subject and alternative names of a verified client certificate.
+func logHandler(lf *logFilter, h http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		crw := &ctxResponseWriter{http.StatusOK, time.Now(), w}
+		id := r.Header.Get("X-Request-Id")
+		if id == "" || len(id) > 64 {
+			id = newRequestID()
+		}
+		w.Header().Set("X-Request-Id", id)
+
 		l := log.Info()
-		h.ServeHTTP(crw, r.WithContext(context.WithValue(r.Context(), logger, l)))
+		ctx := context.WithValue(context.WithValue(r.Context(), logger, l), requestID, id)
+		h.ServeHTTP(crw, r.WithContext(ctx))
+		if !lf.keep(r.URL.Path, crw.status) {
+			l.Discard()
+			return
+		}
 
+		if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 {
+			c := r.TLS.VerifiedChains[0][0]
+			l.Str("client-cn", c.Subject.CommonName).Strs("client-san", subjectAltNames(c))
+		}
 		l.
+			Str("request-id", id).
 			Str("method", r.Method).
 			Str("path", r.URL.Path).
 			Int("status", crw.status).
@@ -211,17 +1164,58 @@ func logHandler(h http.Handler) http.Handler {
 	})
 }
 
+// newRequestID generates a random identifier for correlating log entries of a request.
+func newRequestID() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// requestIDFrom returns the request ID stored in the Context, if any.
+func requestIDFrom(ctx context.Context) string {
+	id, _ := ctx.Value(requestID).(string)
+	return id
+}
+
+// uploadPage describes the file upload form.
+type uploadPage struct {
+	Action string
+	// Progress is the URL of the upload progress endpoint without the ID, if progress tracking is enabled.
+	Progress string
+	T        func(string) string
+}
+
 // handleUploadPage renders the file upload page.
+// If the requested path is not a directory, the client is redirected to the upload page of its parent directory.
+// The redirect is relative, so that it works behind reverse proxies regardless of the scheme and prefix.
 func handleUploadPage(a app, t *template.Template) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		p := path.Join(a.ServerRoot, r.URL.Path)
+		p := path.Join(rootDir(a, r), r.URL.Path)
 		if stat, err := os.Stat(p); err != nil || !stat.IsDir() {
-			http.Redirect(w, r, path.Dir(r.URL.Path)+"?"+r.URL.RawQuery, http.StatusTemporaryRedirect)
+			parent := "./"
+			if strings.HasSuffix(r.URL.Path, "/") {
+				parent = "../"
+			}
+			w.Header().Set("Location", parent+"?"+r.URL.RawQuery)
+			w.WriteHeader(http.StatusTemporaryRedirect)
 			return
 		}
 
-		if err := t.Execute(w, path.Join(r.Host, r.RequestURI)); err != nil {
-			renderError(w, err, "upload page not available", http.StatusInternalServerError)
+		page := uploadPage{Action: strings.TrimSuffix(publicPath(a, r.URL.Path), "/") + "/", T: func(m string) string { return tr(r, m) }}
+		if tok := r.URL.Query().Get("token"); tok != "" && a.UploadToken != "" {
+			page.Action += "?" + url.Values{"token": {tok}}.Encode()
+		}
+		if a.progress != nil {
+			page.Progress = publicPath(a, apiPrefix+"progress") + "/"
+		}
+		if templates.serveUpload(w, r, page.Action, page.Progress) {
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := a.brand.writeHead(w, page.T("Upload")); err != nil {
+			renderError(w, r, err, "upload page not available", http.StatusInternalServerError)
+		} else if err := t.Execute(w, page); err != nil {
+			renderError(w, r, err, "upload page not available", http.StatusInternalServerError)
 		}
 	}
 }
@@ -229,14 +1223,26 @@ func handleUploadPage(a app, t *template.Template) http.HandlerFunc {
 // handleFileUpload processes multipart/form-data file upload requests.
 func handleFileUpload(a app) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		if err := r.ParseMultipartForm(int64(a.BufferSizeKB * 1024)); err != nil {
-			renderError(w, err, "cannot parse multipart form", http.StatusInternalServerError)
+		if err := r.ParseMultipartForm(int64(a.BufferSizeKB * 1024)); errors.Is(err, errUploadTooSlow) {
+			w.Header().Set("Connection", "close")
+			renderError(w, r, err, "upload too slow", http.StatusRequestTimeout)
+			return
+		} else if err != nil {
+			renderError(w, r, err, "cannot parse multipart form", http.StatusInternalServerError)
 			return
 		}
 
 		f, h, err := r.FormFile("file")
 		if err != nil {
-			renderError(w, err, "invalid file", http.StatusBadRequest)
+			renderError(w, r, err, "invalid file", http.StatusBadRequest)
+			return
+		} else if a.EnableAccessFiles && filepath.Base(h.Filename) == accessFileName {
+			_ = r.MultipartForm.RemoveAll()
+			renderError(w, r, errAccessDenied, "access files cannot be uploaded", http.StatusForbidden)
+			return
+		} else if internalPath(path.Join(r.URL.Path, filepath.Base(h.Filename))) {
+			_ = r.MultipartForm.RemoveAll()
+			renderError(w, r, errInternalPath, "invalid file name", http.StatusForbidden)
 			return
 		}
 
@@ -250,32 +1256,104 @@ func handleFileUpload(a app) http.HandlerFunc {
 			}
 		}()
 
-		p := filepath.Join(a.ServerRoot, r.URL.Path, h.Filename)
-		newFile, err := os.Create(p)
-		if err != nil {
-			renderError(w, err, "cannot create destination file", http.StatusInternalServerError)
+		p := filepath.Join(rootDir(a, r), r.URL.Path, h.Filename)
+		if err := a.locks.check(p, lockTokens(r), false); err != nil {
+			renderError(w, r, err, "resource is locked", http.StatusLocked)
+			return
+		} else if err := checkPreconditions(r, p); err != nil {
+			renderError(w, r, err, "the file was modified in the meantime", http.StatusPreconditionFailed)
+			return
+		} else if retained(p, a.Retention, time.Now()) {
+			audit(r, "upload").Str("name", h.Filename).Str("result", "denied").Msg("Overwrite denied by retention")
+			renderError(w, r, errRetained, "file cannot be overwritten during its retention period", http.StatusForbidden)
 			return
 		}
-		defer newFile.Close()
 
-		if _, err := io.Copy(newFile, f); err != nil || newFile.Close() != nil {
-			_ = os.Remove(newFile.Name())
-			renderError(w, err, "cannot write file", http.StatusInternalServerError)
+		if err := a.icap.inspect(r, path.Join(r.URL.Path, h.Filename), f); err != nil {
+			renderUploadError(w, r, h.Filename, err)
 			return
 		}
 
+		name := filepath.Base(p)
+		if a.quarantine != nil {
+			quarantineUpload(a, w, r, name, f)
+			return
+		} else if a.assets.applies(r.URL.Path) {
+			if name, err = a.assets.publish(a, rootDir(a, r), filepath.Dir(p), name, f); err != nil {
+				renderError(w, r, err, "cannot write file", http.StatusInternalServerError)
+				return
+			}
+		} else if a.CAS {
+			digest, err := storeBlob(rootDir(a, r), f)
+			if err == nil {
+				err = linkBlob(rootDir(a, r), digest, p)
+			}
+			if err != nil {
+				renderError(w, r, err, "cannot write file", http.StatusInternalServerError)
+				return
+			}
+			setDigest(w, a.Prefix, digest)
+		} else {
+			create := replaceFile
+			if a.DropBox {
+				// submissions must not replace each other
+				create = createUnique
+			}
+			newFile, err := create(p)
+			if err != nil {
+				renderError(w, r, err, "cannot create destination file", http.StatusInternalServerError)
+				return
+			}
+			defer newFile.Close()
+
+			if _, err := io.Copy(newFile, f); err != nil || newFile.Close() != nil {
+				_ = os.Remove(newFile.Name())
+				renderError(w, r, err, "cannot write file", http.StatusInternalServerError)
+				return
+			}
+			name = filepath.Base(newFile.Name())
+		}
+
 		if e, ok := r.Context().Value(logger).(*zerolog.Event); ok {
-			e.Str("name", h.Filename).Int64("size", h.Size)
+			e.Str("name", name).Int64("size", h.Size)
 		}
-		_, _ = renderMsg(w, h.Filename+" uploaded successfully.\n")
+		audit(r, "upload").Str("name", name).Int64("size", h.Size).Str("result", "ok").Msg("File uploaded")
+		a.sitemap.changed()
+		a.notifier.uploaded(r, externalURL(a, r, path.Join(r.URL.Path, name)), path.Join(r.URL.Path, name), h.Size)
+		notifyChat(a, r, "upload", path.Join(r.URL.Path, name), h.Size)
+		renderUploaded(a, w, r, path.Join(r.URL.Path, name), http.StatusOK)
 	}
 }
 
-// renderError sets the HTTP status code and renders an error message.
-func renderError(w http.ResponseWriter, err error, m string, status int) {
-	log.Err(err).Msg(m)
+// renderError sets the HTTP status code and renders an error message in the language of the client.
+// The error code is sent in the X-Janus-Error header, and as part of a JSON body, if the client accepts JSON.
+func renderError(w http.ResponseWriter, r *http.Request, err error, m string, status int) {
+	if clientGone(r, err) {
+		log.Debug().Str("request-id", requestIDFrom(r.Context())).Err(err).Msg(m)
+		w.WriteHeader(statusClientClosedRequest)
+		return
+	}
+	code := codeOf(err, status)
+	log.Err(err).Str("request-id", requestIDFrom(r.Context())).Str("code", string(code)).Msg(m)
+	w.Header().Set("X-Janus-Error", string(code))
+	if strings.Contains(r.Header.Get("Accept"), "application/json") {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		if err := json.NewEncoder(w).Encode(apiError{Code: code, Message: tr(r, m)}); err != nil {
+			log.Err(err).Msg("cannot render message")
+		}
+		return
+	} else if templates.renderError(w, r, code, m, status) {
+		return
+	}
 	w.WriteHeader(status)
-	_, _ = renderMsg(w, "Error: "+m+"\n")
+	_, _ = renderMsg(w, fmt.Sprintf(tr(r, "Error: %s"), tr(r, m))+"\n")
+}
+
+// apiError is the JSON representation of an error.
+type apiError struct {
+	Code    errorCode `json:"code"`
+	Message string    `json:"message"`
 }
 
 func renderMsg(w io.Writer, m string) (n int, err error) {
@@ -16,6 +16,7 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"io"
 	"net"
 	"net/http"
@@ -23,6 +24,7 @@ import (
 	"os"
 	"path"
 	"testing"
+	"time"
 
 	. "github.com/stretchr/testify/require"
 	"golang.org/x/net/nettest"
@@ -36,6 +38,45 @@ func Test_ctxResponseWriter_WriteHeader(t *testing.T) {
 	Equal(t, http.StatusTeapot, r.Code)
 }
 
+// readerFromRecorder records whether ReadFrom was invoked.
+type readerFromRecorder struct {
+	*httptest.ResponseRecorder
+	called bool
+}
+
+func (r *readerFromRecorder) ReadFrom(src io.Reader) (int64, error) {
+	r.called = true
+	return io.Copy(r.ResponseRecorder, src)
+}
+
+func Test_ctxResponseWriter_ReadFrom(t *testing.T) {
+	rf := &readerFromRecorder{ResponseRecorder: httptest.NewRecorder()}
+	w := ctxResponseWriter{ResponseWriter: rf}
+	n, err := io.Copy(&w, io.LimitReader(bytes.NewBufferString("data"), 4))
+	NoError(t, err)
+	Equal(t, int64(4), n)
+	True(t, rf.called)
+
+	r := httptest.NewRecorder()
+	w = ctxResponseWriter{ResponseWriter: r}
+	_, err = w.ReadFrom(bytes.NewBufferString("data"))
+	NoError(t, err)
+	Equal(t, "data", r.Body.String())
+}
+
+func Test_ctxResponseWriter_Flush(t *testing.T) {
+	r := httptest.NewRecorder()
+	w := ctxResponseWriter{ResponseWriter: r}
+	w.Flush()
+	True(t, r.Flushed)
+}
+
+func Test_ctxResponseWriter_Hijack(t *testing.T) {
+	w := ctxResponseWriter{ResponseWriter: httptest.NewRecorder()}
+	_, _, err := w.Hijack()
+	ErrorIs(t, err, http.ErrNotSupported)
+}
+
 func Test_handleFileUpload(t *testing.T) {
 	a := app{ServerRoot: ".", EnableUpload: false}
 	h := handleFileUpload(a)
@@ -59,7 +100,7 @@ data
 
 	// initialize handler
 	a := app{ServerRoot: "tmp", EnableUpload: true}
-	h := logHandler(handleRequest(a))
+	h := logHandler(nil, handleRequest(a))
 
 	// take care of filesystem
 	_ = os.MkdirAll("tmp", 0700)
@@ -76,6 +117,47 @@ data
 	Equal(t, "data", string(d))
 }
 
+func Test_newRouter(t *testing.T) {
+	a := app{ServerRoot: ".", Prefix: "/"}
+	r := newRouter(a, handleOptions(a, handleRequest(a)))
+	serve := func(method, target string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(method, target, nil))
+		return w
+	}
+
+	w := serve(http.MethodHead, "/main.go")
+	Equal(t, http.StatusOK, w.Code)
+	NotEmpty(t, w.Header().Get("Content-Length"))
+	Empty(t, w.Body.String())
+
+	w = serve(http.MethodOptions, "/main.go")
+	Equal(t, http.StatusNoContent, w.Code)
+	Equal(t, "GET, HEAD, OPTIONS", w.Header().Get("Allow"))
+
+	w = serve(http.MethodDelete, "/main.go")
+	Equal(t, http.StatusMethodNotAllowed, w.Code)
+	Equal(t, "GET, HEAD, OPTIONS, POST", w.Header().Get("Allow"))
+}
+
+func Test_logHandler_RequestID(t *testing.T) {
+	var id string
+	h := logHandler(nil, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id = requestIDFrom(r.Context())
+	}))
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	Len(t, id, 16)
+	Equal(t, id, w.Header().Get("X-Request-Id"))
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("X-Request-Id", "upstream-id")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	Equal(t, "upstream-id", id)
+}
+
 func Test_handleUploadPage_UploadDisabled(t *testing.T) {
 	a := app{ServerRoot: ".", EnableUpload: false}
 	HTTPBodyContains(t, handleRequest(a), http.MethodGet, "http://localhost/",
@@ -84,9 +166,33 @@ func Test_handleUploadPage_UploadDisabled(t *testing.T) {
 
 func Test_handleUploadPage_UploadEnabled(t *testing.T) {
 	a := app{ServerRoot: ".", EnableUpload: true}
-	exp := `<form action="http://localhost" enctype="multipart/form-data" method="POST">`
+	exp := `<form action="/" enctype="multipart/form-data" method="POST">`
 	HTTPBodyContains(t, handleRequest(a), http.MethodGet, "http://localhost/",
 		map[string][]string{"upload": {""}}, exp)
+
+	a.Prefix = "/files/"
+	exp = `<form action="/files/tmp/" enctype="multipart/form-data" method="POST">`
+	HTTPBodyContains(t, handleRequest(a), http.MethodGet, "http://localhost/tmp",
+		map[string][]string{"upload": {""}}, exp)
+
+	a.baseURL, _ = parseBaseURL("https://example.com/downloads/")
+	exp = `<form action="/downloads/tmp/" enctype="multipart/form-data" method="POST">`
+	HTTPBodyContains(t, handleRequest(a), http.MethodGet, "http://localhost/tmp/",
+		map[string][]string{"upload": {""}}, exp)
+}
+
+func Test_handleUploadPage_Redirect(t *testing.T) {
+	a := app{ServerRoot: ".", EnableUpload: true, Prefix: "/files/"}
+	for target, loc := range map[string]string{
+		"http://localhost/main.go?upload":     "./?upload",
+		"http://localhost/missing/?upload":    "../?upload",
+		"http://localhost/tmp/missing?upload": "./?upload",
+	} {
+		w := httptest.NewRecorder()
+		handleRequest(a).ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+		Equal(t, http.StatusTemporaryRedirect, w.Code, target)
+		Equal(t, loc, w.Header().Get("Location"), target)
+	}
 }
 
 func Test_loadConfigDefault(t *testing.T) {
@@ -95,37 +201,62 @@ func Test_loadConfigDefault(t *testing.T) {
 	Equal(t, ":8080", a.ListenAddress)
 	Equal(t, "/", a.Prefix)
 	Equal(t, ".", a.ServerRoot)
+	Equal(t, 30*time.Second, a.ReadHeaderTimeout)
+	Zero(t, a.ReadTimeout)
+	Zero(t, a.WriteTimeout)
 }
 
 func Test_loadConfigParams(t *testing.T) {
-	a := loadConfig("-d", "/tmp", "-l", "lo:8081", "-p", "test", "-u")
+	a := loadConfig("-d", "/tmp", "-l", "lo:8081", "-p", "test", "-u", "--write-timeout", "1h")
 	Equal(t, true, a.EnableUpload)
 	Equal(t, "lo:8081", a.ListenAddress)
 	Equal(t, "/test", a.Prefix)
 	Equal(t, "/tmp", a.ServerRoot)
+	Equal(t, time.Hour, a.WriteTimeout)
 }
 
-func Test_resolveIP(t *testing.T) {
+func Test_loadConfigFile(t *testing.T) {
+	cfg := path.Join(t.TempDir(), "janus.ini")
+	NoError(t, os.WriteFile(cfg, []byte(`; roles replace enable-upload
+listen = :9090
+enable-upload = true
+write-timeout = 1m
+role = public read
+role = "@staff read,write /team/"
+`), 0600))
+	t.Setenv("JANUS_LISTEN", ":9091")
+
+	a := loadConfig("-c", cfg, "--write-timeout", "1h")
+	Equal(t, ":9091", a.ListenAddress)
+	Equal(t, true, a.EnableUpload)
+	Equal(t, []string{"public read", "@staff read,write /team/"}, a.Roles)
+	Equal(t, time.Hour, a.WriteTimeout)
+	Equal(t, 30*time.Second, a.ReadHeaderTimeout)
+}
+
+func Test_resolveIPs_Primary(t *testing.T) {
 	iface, _ := nettest.LoopbackInterface()
 	ips, _ := iface.Addrs()
 	ip := ips[0].(*net.IPNet).IP.String()
 
-	tests := []struct{ name, listen, exp, err string }{
-		{"<empty>", "", "", "invalid listen address"},
-		{":", ":", ":", ""},
-		{"str", "3128", "", "invalid listen address"},
-		{":port", ":3128", ":3128", ""},
-		{"iface:", iface.Name + ":", ip + ":", ""},
-		{"iface:port", iface.Name + ":3128", ip + ":3128", ""},
-		{"host:port", "xxx:3128", "xxx:3128", ""},
-		{"::", "::", "", "invalid listen address"},
+	tests := []struct{ name, listen, family, exp, err string }{
+		{"<empty>", "", dualStack, "", "invalid listen address"},
+		{":", ":", dualStack, ":", ""},
+		{"str", "3128", dualStack, "", "invalid listen address"},
+		{":port", ":3128", dualStack, ":3128", ""},
+		{"iface:", iface.Name + ":", dualStack, ip + ":", ""},
+		{"iface:port", iface.Name + ":3128", dualStack, ip + ":3128", ""},
+		{"host:port", "xxx:3128", dualStack, "xxx:3128", ""},
+		{"::", "::", dualStack, "", "invalid listen address"},
+		{"[::]:port", "[::]:3128", dualStack, "[::]:3128", ""},
+		{"[::1]:port", "[::1]:3128", ipv6, "[::1]:3128", ""},
 	}
 
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
-			ip, err := resolveIP(test.listen)
-			Equal(t, test.exp, ip)
+			ips, err := resolveIPs(test.listen, test.family)
 			if err == nil {
+				Equal(t, test.exp, ips[0])
 				Empty(t, test.err)
 			} else {
 				Equal(t, test.err, err.Error())
@@ -134,8 +265,55 @@ func Test_resolveIP(t *testing.T) {
 	}
 }
 
+func Test_resolveIPs_IPv6(t *testing.T) {
+	if !nettest.SupportsIPv6() {
+		t.Skip("IPv6 is not supported")
+	}
+
+	iface, _ := nettest.LoopbackInterface()
+	ips, err := resolveIPs(iface.Name+":3128", ipv6)
+	NoError(t, err)
+	Equal(t, []string{"[::1]:3128"}, ips)
+}
+
+func Test_resolveIPs(t *testing.T) {
+	iface, _ := nettest.LoopbackInterface()
+	ips, err := resolveIPs(iface.Name+":3128", dualStack)
+	NoError(t, err)
+	Contains(t, ips, "127.0.0.1:3128")
+	if nettest.SupportsIPv6() {
+		Equal(t, "[::1]:3128", ips[len(ips)-1])
+	}
+
+	ips, err = resolveIPs("localhost:3128", dualStack)
+	NoError(t, err)
+	Equal(t, []string{"localhost:3128"}, ips)
+}
+
+func Test_network(t *testing.T) {
+	Equal(t, "tcp", network(dualStack))
+	Equal(t, "tcp4", network(ipv4))
+	Equal(t, "tcp6", network(ipv6))
+}
+
 func Test_renderError(t *testing.T) {
 	w := httptest.NewRecorder()
-	renderError(w, io.ErrUnexpectedEOF, "test", http.StatusInternalServerError)
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	renderError(w, r, io.ErrUnexpectedEOF, "test", http.StatusInternalServerError)
 	Equal(t, http.StatusInternalServerError, w.Code)
+	Equal(t, "JANUS_INTERNAL_ERROR", w.Header().Get("X-Janus-Error"))
+	Equal(t, "Error: test\n", w.Body.String())
+
+	w = httptest.NewRecorder()
+	r.Header.Set("Accept", "application/json")
+	renderError(w, r, errRetained, "file cannot be overwritten", http.StatusForbidden)
+	Equal(t, http.StatusForbidden, w.Code)
+	Equal(t, "application/json", w.Header().Get("Content-Type"))
+	JSONEq(t, `{"code":"JANUS_RETAINED","message":"file cannot be overwritten"}`, w.Body.String())
+
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest(http.MethodGet, "/", nil)
+	r = r.WithContext(context.WithValue(r.Context(), language, catalog{"Error: %s": "Fehler: %s", "test": "Test"}))
+	renderError(w, r, io.ErrUnexpectedEOF, "test", http.StatusInternalServerError)
+	Equal(t, "Fehler: Test\n", w.Body.String())
 }
@@ -0,0 +1,100 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/rs/zerolog/log"
+)
+
+// errMaintenance indicates that requests are rejected, because the server is under maintenance.
+var errMaintenance = errors.New("under maintenance")
+
+// maintenance holds the state of the maintenance mode.
+type maintenance struct {
+	enabled atomic.Bool
+	page    []byte
+}
+
+// newMaintenance creates the maintenance mode with the (optional) HTML page served to clients.
+func newMaintenance(enabled bool, page string) (*maintenance, error) {
+	m := &maintenance{}
+	m.enabled.Store(enabled)
+	if page != "" {
+		b, err := os.ReadFile(filepath.Clean(page))
+		if err != nil {
+			return nil, err
+		}
+		m.page = b
+	}
+	return m, nil
+}
+
+// handleMaintenance sends "503 Service Unavailable" while the maintenance mode is enabled.
+// If m is nil, h is returned as is.
+func handleMaintenance(m *maintenance, h http.Handler) http.Handler {
+	if m == nil {
+		return h
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !m.enabled.Load() {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("Retry-After", "60")
+		if m.page == nil {
+			renderError(w, r, errMaintenance, "service under maintenance", http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		_, _ = w.Write(m.page)
+	})
+}
+
+// handleMaintenanceMode reports the maintenance mode (GET) or changes it (POST with "enabled=true|false").
+func handleMaintenanceMode(m *maintenance) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead:
+		case http.MethodPost:
+			on, err := strconv.ParseBool(r.FormValue("enabled"))
+			if err != nil {
+				renderError(w, r, err, "invalid value of enabled", http.StatusBadRequest)
+				return
+			}
+			m.enabled.Store(on)
+			audit(r, "maintenance").Bool("enabled", on).Str("result", "ok").Msg("Maintenance mode changed")
+		default:
+			w.Header().Set("Allow", "GET, POST")
+			renderError(w, r, errMethodNotAllowed, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(map[string]bool{"enabled": m.enabled.Load()}); err != nil {
+			log.Err(err).Msg("cannot render message")
+		}
+	}
+}
@@ -0,0 +1,77 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	. "github.com/stretchr/testify/require"
+)
+
+func Test_newMaintenance(t *testing.T) {
+	page := filepath.Join(t.TempDir(), "maintenance.html")
+	NoError(t, os.WriteFile(page, []byte("<h1>Back soon</h1>"), 0600))
+
+	m, err := newMaintenance(true, page)
+	NoError(t, err)
+	True(t, m.enabled.Load())
+	Equal(t, "<h1>Back soon</h1>", string(m.page))
+
+	_, err = newMaintenance(false, page+".missing")
+	Error(t, err)
+}
+
+func Test_handleMaintenance(t *testing.T) {
+	m, err := newMaintenance(false, "")
+	NoError(t, err)
+	h := handleMaintenance(m, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	HTTPStatusCode(t, h.ServeHTTP, http.MethodGet, "/a.txt", nil, http.StatusOK)
+	m.enabled.Store(true)
+	HTTPStatusCode(t, h.ServeHTTP, http.MethodGet, "/a.txt", nil, http.StatusServiceUnavailable)
+	HTTPBodyContains(t, h.ServeHTTP, http.MethodGet, "/a.txt", nil, "service under maintenance")
+
+	m.page = []byte("<h1>Back soon</h1>")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	Equal(t, http.StatusServiceUnavailable, w.Code)
+	Equal(t, "text/html; charset=utf-8", w.Header().Get("Content-Type"))
+	Equal(t, "<h1>Back soon</h1>", w.Body.String())
+}
+
+func Test_handleMaintenanceMode(t *testing.T) {
+	m, err := newMaintenance(false, "")
+	NoError(t, err)
+	h := handleMaintenanceMode(m)
+	serve := func(method, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, "/_janus/admin/maintenance", strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	JSONEq(t, `{"enabled":false}`, serve(http.MethodGet, "").Body.String())
+	JSONEq(t, `{"enabled":true}`, serve(http.MethodPost, "enabled=true").Body.String())
+	True(t, m.enabled.Load())
+	Equal(t, http.StatusBadRequest, serve(http.MethodPost, "enabled=maybe").Code)
+	Equal(t, http.StatusMethodNotAllowed, serve(http.MethodDelete, "").Code)
+	JSONEq(t, `{"enabled":false}`, serve(http.MethodPost, "enabled=false").Body.String())
+}
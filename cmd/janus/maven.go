@@ -0,0 +1,216 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// errChecksumMismatch indicates that a deployed file does not match its checksum.
+var errChecksumMismatch = errors.New("checksum mismatch")
+
+// checksumAlgs maps the extensions of Maven checksum files to their hash functions.
+var checksumAlgs = map[string]func() hash.Hash{
+	".md5":    md5.New,
+	".sha1":   sha1.New,
+	".sha256": sha256.New,
+	".sha512": sha512.New,
+}
+
+// checksumHeaders maps the checksum headers sent by Maven and Gradle to their hash functions.
+var checksumHeaders = map[string]func() hash.Hash{
+	"X-Checksum-Md5":    md5.New,
+	"X-Checksum-Sha1":   sha1.New,
+	"X-Checksum-Sha256": sha256.New,
+	"X-Checksum-Sha512": sha512.New,
+}
+
+// handleMavenDeploy stores files deployed via PUT at the requested path, creating missing directories.
+// Checksum files (.md5, .sha1, .sha256, .sha512) are validated against the deployed artifact,
+// and artifacts are validated against the checksum headers of the request, if present.
+// If the content-addressable store already holds the content announced by X-Checksum-Sha256, the file is linked to
+// it without reading the body, so that clients sending "Expect: 100-continue" skip the transfer.
+func handleMavenDeploy(a app) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := path.Base(r.URL.Path)
+		if strings.HasSuffix(r.URL.Path, "/") {
+			renderError(w, r, errors.New("missing file name"), "invalid file", http.StatusBadRequest)
+			return
+		} else if a.EnableAccessFiles && name == accessFileName {
+			renderError(w, r, errAccessDenied, "access files cannot be uploaded", http.StatusForbidden)
+			return
+		}
+
+		p := filepath.Join(rootDir(a, r), filepath.FromSlash(r.URL.Path))
+		if retained(p, a.Retention, time.Now()) {
+			audit(r, "upload").Str("name", name).Str("result", "denied").Msg("Overwrite denied by retention")
+			renderError(w, r, errRetained, "file cannot be overwritten during its retention period", http.StatusForbidden)
+			return
+		}
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			renderError(w, r, err, "cannot create destination file", http.StatusInternalServerError)
+			return
+		}
+
+		if digest, ok := storedDigest(a, r); ok {
+			deployStored(a, w, r, p, digest)
+			return
+		}
+
+		size, err := deploy(r, p, a.icap)
+		if errors.Is(err, errChecksumMismatch) {
+			audit(r, "upload").Str("name", name).Str("result", "denied").Msg("Checksum mismatch")
+			renderError(w, r, err, "checksum mismatch", http.StatusBadRequest)
+			return
+		} else if errors.Is(err, errUploadTooSlow) {
+			w.Header().Set("Connection", "close")
+			renderError(w, r, err, "upload too slow", http.StatusRequestTimeout)
+			return
+		} else if err != nil {
+			renderUploadError(w, r, name, err)
+			return
+		}
+		if a.CAS {
+			digest, err := storeFile(rootDir(a, r), p)
+			if err != nil {
+				renderError(w, r, err, "cannot write file", http.StatusInternalServerError)
+				return
+			}
+			setDigest(w, a.Prefix, digest)
+		}
+
+		if e, ok := r.Context().Value(logger).(*zerolog.Event); ok {
+			e.Str("name", name).Int64("size", size)
+		}
+		audit(r, "upload").Str("name", name).Int64("size", size).Str("result", "ok").Msg("File deployed")
+		a.sitemap.changed()
+		a.notifier.uploaded(r, externalURL(a, r, r.URL.Path), r.URL.Path, size)
+		notifyChat(a, r, "upload", r.URL.Path, size)
+		renderUploaded(a, w, r, r.URL.Path, http.StatusCreated)
+	}
+}
+
+// deployStored links the named file to the stored blob with the given digest instead of receiving the body.
+func deployStored(a app, w http.ResponseWriter, r *http.Request, name, digest string) {
+	if err := linkBlob(rootDir(a, r), digest, name); err != nil {
+		renderError(w, r, err, "cannot write file", http.StatusInternalServerError)
+		return
+	}
+	fi, err := os.Stat(name)
+	if err != nil {
+		renderError(w, r, err, "cannot write file", http.StatusInternalServerError)
+		return
+	}
+	setDigest(w, a.Prefix, digest)
+
+	base := path.Base(r.URL.Path)
+	if e, ok := r.Context().Value(logger).(*zerolog.Event); ok {
+		e.Str("name", base).Int64("size", fi.Size()).Bool("deduplicated", true)
+	}
+	audit(r, "upload").Str("name", base).Int64("size", fi.Size()).Str("digest", digest).Str("result", "ok").
+		Msg("File deployed from stored content")
+	a.sitemap.changed()
+	a.notifier.uploaded(r, externalURL(a, r, r.URL.Path), r.URL.Path, fi.Size())
+	notifyChat(a, r, "upload", r.URL.Path, fi.Size())
+	renderUploaded(a, w, r, r.URL.Path, http.StatusCreated)
+}
+
+// deploy writes the request body to a temporary file, validates it and replaces the named file with it.
+// The file is inspected by the content inspection service, if configured.
+func deploy(r *http.Request, name string, ic *icapClient) (int64, error) {
+	f, err := os.CreateTemp(filepath.Dir(name), ".janus-deploy-*")
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = os.Remove(f.Name()) }()
+	defer f.Close()
+
+	hs := map[string]hash.Hash{}
+	ws := []io.Writer{f}
+	for hdr, newHash := range checksumHeaders {
+		if r.Header.Get(hdr) != "" {
+			hs[hdr] = newHash()
+			ws = append(ws, hs[hdr])
+		}
+	}
+	size, err := io.Copy(io.MultiWriter(ws...), r.Body)
+	if err != nil {
+		return 0, err
+	}
+	for hdr, h := range hs {
+		if !strings.EqualFold(hex.EncodeToString(h.Sum(nil)), strings.TrimSpace(r.Header.Get(hdr))) {
+			return 0, fmt.Errorf("%w: %s", errChecksumMismatch, hdr)
+		}
+	}
+
+	if newHash, ok := checksumAlgs[filepath.Ext(name)]; ok {
+		if err := verifyChecksumFile(f, strings.TrimSuffix(name, filepath.Ext(name)), newHash); err != nil {
+			return 0, err
+		}
+	}
+	if err := ic.inspect(r, r.URL.Path, f); err != nil {
+		return 0, err
+	} else if err := f.Close(); err != nil {
+		return 0, err
+	}
+	return size, os.Rename(f.Name(), name)
+}
+
+// verifyChecksumFile checks whether the checksum file matches the artifact, if the artifact exists.
+// Checksum files may contain the file name after the checksum, like the output of sha1sum.
+func verifyChecksumFile(f *os.File, artifact string, newHash func() hash.Hash) error {
+	af, err := os.Open(filepath.Clean(artifact))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer af.Close()
+
+	b := make([]byte, 1024)
+	n, err := f.ReadAt(b, 0)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	fields := strings.Fields(string(b[:n]))
+	if len(fields) == 0 {
+		return fmt.Errorf("%w: empty checksum file", errChecksumMismatch)
+	}
+
+	h := newHash()
+	if _, err := io.Copy(h, af); err != nil {
+		return err
+	}
+	if !strings.EqualFold(hex.EncodeToString(h.Sum(nil)), fields[0]) {
+		return fmt.Errorf("%w: %s", errChecksumMismatch, filepath.Base(artifact))
+	}
+	return nil
+}
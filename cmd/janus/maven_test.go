@@ -0,0 +1,113 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/stretchr/testify/require"
+)
+
+func Test_handleMavenDeploy(t *testing.T) {
+	d := t.TempDir()
+	h := handleMavenDeploy(app{ServerRoot: d, EnableUpload: true, EnableAccessFiles: true})
+	put := func(p, body string, hdr ...string) int {
+		r := httptest.NewRequest(http.MethodPut, p, strings.NewReader(body))
+		for i := 0; i < len(hdr); i += 2 {
+			r.Header.Set(hdr[i], hdr[i+1])
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w.Code
+	}
+	jar := "/com/acme/lib/1.0/lib-1.0.jar"
+	sum := fmt.Sprintf("%x", sha1.Sum([]byte("jar")))
+
+	Equal(t, http.StatusCreated, put(jar, "jar", "X-Checksum-Sha1", sum))
+	b, err := os.ReadFile(filepath.Join(d, filepath.FromSlash(jar)))
+	NoError(t, err)
+	Equal(t, "jar", string(b))
+
+	Equal(t, http.StatusCreated, put(jar+".sha1", sum+"  lib-1.0.jar\n"))
+	Equal(t, http.StatusBadRequest, put(jar+".md5", "0123456789abcdef0123456789abcdef"))
+	NoFileExists(t, filepath.Join(d, filepath.FromSlash(jar+".md5")))
+	Equal(t, http.StatusBadRequest, put(jar, "modified", "X-Checksum-Sha1", sum))
+	b, err = os.ReadFile(filepath.Join(d, filepath.FromSlash(jar)))
+	NoError(t, err)
+	Equal(t, "jar", string(b))
+
+	// checksum files of missing artifacts cannot be validated
+	Equal(t, http.StatusCreated, put("/other.pom.sha1", sum))
+	Equal(t, http.StatusBadRequest, put("/com/", "dir"))
+	Equal(t, http.StatusForbidden, put("/"+accessFileName, "read: public"))
+
+	es, err := os.ReadDir(filepath.Join(d, "com", "acme", "lib", "1.0"))
+	NoError(t, err)
+	Len(t, es, 2, "temporary files must be removed")
+}
+
+func Test_handleMavenDeploy_CAS(t *testing.T) {
+	const sumJar = "0163f1eea7894350060624d315234d40c508ab251ba121714e234503045faadd"
+	d := t.TempDir()
+	h := handleMavenDeploy(app{ServerRoot: d, EnableUpload: true, CAS: true})
+	for i := 0; i < 2; i++ {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodPut, "/a.jar", strings.NewReader("jar")))
+		Equal(t, http.StatusCreated, w.Code)
+		Equal(t, sumJar, w.Header().Get("X-Checksum-Sha256"))
+	}
+	FileExists(t, blobName(d, sumJar))
+	b, err := os.ReadFile(filepath.Join(d, "a.jar"))
+	NoError(t, err)
+	Equal(t, "jar", string(b))
+}
+
+func Test_handleMavenDeploy_Retention(t *testing.T) {
+	d := t.TempDir()
+	NoError(t, os.WriteFile(filepath.Join(d, "a.jar"), []byte("jar"), 0600))
+	h := handleMavenDeploy(app{ServerRoot: d, EnableUpload: true, Retention: time.Hour})
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodPut, "/a.jar", strings.NewReader("new")))
+	Equal(t, http.StatusForbidden, w.Code)
+	Equal(t, string(codeRetained), w.Header().Get("X-Janus-Error"))
+}
+
+func Test_verifyChecksumFile(t *testing.T) {
+	d := t.TempDir()
+	artifact := filepath.Join(d, "a.jar")
+	sumFile := filepath.Join(d, "a.jar.sha1")
+	verify := func(content string) error {
+		NoError(t, os.WriteFile(sumFile, []byte(content), 0600))
+		f, err := os.Open(sumFile)
+		NoError(t, err)
+		defer f.Close()
+		return verifyChecksumFile(f, artifact, sha1.New)
+	}
+
+	NoError(t, verify("anything"))
+	NoError(t, os.WriteFile(artifact, []byte("jar"), 0600))
+	NoError(t, verify(fmt.Sprintf("%X\n", sha1.Sum([]byte("jar")))))
+	ErrorIs(t, verify("0000"), errChecksumMismatch)
+	ErrorIs(t, verify(""), errChecksumMismatch)
+}
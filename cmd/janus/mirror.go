@@ -0,0 +1,76 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"expvar"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/rs/zerolog/log"
+)
+
+// mirrorStats counts the requests served from each mirror root.
+var mirrorStats = expvar.NewMap("mirror_failover")
+
+// checkMirrorRoots verifies that all mirror roots are directories, which remain accessible.
+func checkMirrorRoots(a app) error {
+	if len(a.MirrorRoots) > 0 && a.Chroot {
+		return errors.New("mirror roots cannot be combined with chroot")
+	}
+	for _, m := range a.MirrorRoots {
+		if fi, err := os.Stat(m); err != nil {
+			return err
+		} else if !fi.IsDir() {
+			return fmt.Errorf("%s is not a directory", m)
+		}
+	}
+	return nil
+}
+
+// readPath returns the path of the requested file or directory.
+// If it cannot be accessed below the root directory (because it is missing or the storage fails), the mirror roots
+// are tried in the configured order, and the first one having it is used instead.
+// Only downloads fail over, whereas uploads and other modifications always go to the root directory.
+func readPath(a app, r *http.Request) string {
+	p := path.Join(rootDir(a, r), r.URL.Path)
+	if len(a.MirrorRoots) == 0 || (r.Method != http.MethodGet && r.Method != http.MethodHead) {
+		return p
+	}
+	_, err := os.Stat(p)
+	if err == nil {
+		return p
+	} else if !errors.Is(err, os.ErrNotExist) {
+		log.Warn().Str("request-id", requestIDFrom(r.Context())).Str("path", p).Err(err).
+			Msg("Cannot access file, trying mirror roots")
+	}
+
+	rel, err := filepath.Rel(a.ServerRoot, p)
+	if err != nil {
+		return p
+	}
+	for _, m := range a.MirrorRoots {
+		mp := filepath.Join(m, rel)
+		if _, err := os.Stat(mp); err == nil {
+			mirrorStats.Add(m, 1)
+			return mp
+		}
+	}
+	return p
+}
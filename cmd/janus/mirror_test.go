@@ -0,0 +1,61 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/stretchr/testify/require"
+)
+
+func Test_checkMirrorRoots(t *testing.T) {
+	d := t.TempDir()
+	NoError(t, checkMirrorRoots(app{MirrorRoots: []string{d}}))
+	EqualError(t, checkMirrorRoots(app{MirrorRoots: []string{d}, Chroot: true}), "mirror roots cannot be combined with chroot")
+
+	f := filepath.Join(d, "file")
+	NoError(t, os.WriteFile(f, nil, 0600))
+	EqualError(t, checkMirrorRoots(app{MirrorRoots: []string{f}}), f+" is not a directory")
+	Error(t, checkMirrorRoots(app{MirrorRoots: []string{filepath.Join(d, "missing")}}))
+}
+
+func Test_handleRequest_MirrorRoots(t *testing.T) {
+	root, m1, m2 := t.TempDir(), t.TempDir(), t.TempDir()
+	NoError(t, os.WriteFile(filepath.Join(root, "a.txt"), []byte("root"), 0600))
+	NoError(t, os.WriteFile(filepath.Join(m1, "a.txt"), []byte("m1"), 0600))
+	NoError(t, os.MkdirAll(filepath.Join(m2, "sub"), 0700))
+	NoError(t, os.WriteFile(filepath.Join(m2, "sub", "b.txt"), []byte("m2"), 0600))
+
+	h := handleRequest(app{ServerRoot: root, MirrorRoots: []string{m1, m2}})
+	serve := func(method, target string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(method, target, nil))
+		return w
+	}
+
+	Equal(t, "root", serve(http.MethodGet, "/a.txt").Body.String())
+	w := serve(http.MethodGet, "/sub/b.txt")
+	Equal(t, http.StatusOK, w.Code)
+	Equal(t, "m2", w.Body.String())
+	Contains(t, serve(http.MethodGet, "/sub/").Body.String(), "b.txt")
+	Equal(t, http.StatusNotFound, serve(http.MethodGet, "/missing.txt").Code)
+
+	NoError(t, os.Remove(filepath.Join(root, "a.txt")))
+	Equal(t, "m1", serve(http.MethodGet, "/a.txt").Body.String())
+}
@@ -0,0 +1,84 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"expvar"
+	"net/http"
+	"time"
+)
+
+// negativeCacheStats exposes the effectiveness of the negative cache.
+var negativeCacheStats = expvar.NewMap("negative_cache")
+
+// negativeCache remembers paths, which were not found, so that bots probing nonexistent paths over and over again
+// do not cause filesystem lookups. Entries expire after the TTL, hence files created by other processes are found
+// eventually, whereas uploads via janus clear the cache immediately.
+// Authenticated clients bypass the cache, because they may be served from other directories or be about to upload.
+type negativeCache struct {
+	lru *lru[string, time.Time]
+	ttl time.Duration
+}
+
+// newNegativeCache creates a cache holding at most max paths for the given duration.
+// If max or ttl is not positive, caching is disabled and nil is returned.
+func newNegativeCache(max int, ttl time.Duration) *negativeCache {
+	if max <= 0 || ttl <= 0 {
+		return nil
+	}
+	return &negativeCache{lru: newLRU[string, time.Time](int64(max), nil), ttl: ttl}
+}
+
+// cacheable reports whether the request may be answered from the cache.
+func (c *negativeCache) cacheable(r *http.Request) bool {
+	return c != nil && (r.Method == http.MethodGet || r.Method == http.MethodHead) && identityFrom(r.Context()) == nil
+}
+
+// missing reports whether the path is known to be missing.
+func (c *negativeCache) missing(p string, now time.Time) bool {
+	exp, ok := c.lru.Get(p)
+	if ok && now.After(exp) {
+		c.lru.Remove(p)
+		ok = false
+	}
+	if ok {
+		negativeCacheStats.Add("hits", 1)
+	} else {
+		negativeCacheStats.Add("misses", 1)
+	}
+	return ok
+}
+
+// add remembers that the path is missing.
+func (c *negativeCache) add(p string, now time.Time) {
+	c.lru.Add(p, now.Add(c.ttl))
+}
+
+// purge forgets all missing paths e.g., because a file may have been created.
+// If c is nil, purge does nothing.
+func (c *negativeCache) purge() {
+	if c != nil {
+		c.lru.Purge()
+	}
+}
+
+// serveFile serves the named file and remembers the requested path, if it was not found.
+func (c *negativeCache) serveFile(w http.ResponseWriter, r *http.Request, name string) {
+	crw := &ctxResponseWriter{http.StatusOK, time.Now(), w}
+	http.ServeFile(crw, r, name)
+	if crw.status == http.StatusNotFound {
+		c.add(r.URL.Path, crw.time)
+	}
+}
@@ -0,0 +1,75 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/stretchr/testify/require"
+)
+
+func Test_negativeCache(t *testing.T) {
+	Nil(t, newNegativeCache(0, time.Second))
+	Nil(t, newNegativeCache(1, 0))
+
+	c := newNegativeCache(1, time.Minute)
+	now := time.Now()
+	False(t, c.missing("/a", now))
+	c.add("/a", now)
+	True(t, c.missing("/a", now))
+	False(t, c.missing("/a", now.Add(2*time.Minute)), "expired entries must be looked up again")
+	c.add("/a", now)
+	c.add("/b", now)
+	False(t, c.missing("/a", now), "cache must be bounded")
+	c.purge()
+	False(t, c.missing("/b", now))
+
+	r := httptest.NewRequest(http.MethodGet, "/a", nil)
+	True(t, c.cacheable(r))
+	False(t, c.cacheable(withIdentity(r, &identity{name: "alice"})))
+	False(t, c.cacheable(httptest.NewRequest(http.MethodPost, "/a", nil)))
+	False(t, (*negativeCache)(nil).cacheable(r))
+}
+
+func Test_handleRequest_NegativeCache(t *testing.T) {
+	root := t.TempDir()
+	h := handleRequest(app{ServerRoot: root, NegativeCacheSize: 10, NegativeCacheTTL: time.Minute, EnableUpload: true})
+	serve := func(method, target string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(method, target, nil))
+		return w
+	}
+
+	hits := func() int64 {
+		if v := negativeCacheStats.Get("hits"); v != nil {
+			return v.(interface{ Value() int64 }).Value()
+		}
+		return 0
+	}
+	before := hits()
+	Equal(t, http.StatusNotFound, serve(http.MethodGet, "/a.txt").Code)
+	NoError(t, os.WriteFile(filepath.Join(root, "a.txt"), []byte("a"), 0600))
+	Equal(t, http.StatusNotFound, serve(http.MethodGet, "/a.txt").Code, "missing path must be cached")
+	Equal(t, before+1, hits())
+
+	// uploads clear the cache
+	serve(http.MethodPost, "/")
+	Equal(t, http.StatusOK, serve(http.MethodGet, "/a.txt").Code)
+}
@@ -0,0 +1,197 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"mime"
+	"net"
+	"net/http"
+	"net/mail"
+	"net/smtp"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// defaultNotifyBody is the body of notification emails, unless a template file is given.
+const defaultNotifyBody = `{{.Name}} ({{.Size}} bytes) was uploaded{{if .User}} by {{.User}}{{end}} at {{.Time.Format "2006-01-02 15:04:05 MST"}}.
+
+{{.URL}}
+`
+
+// notifyRule assigns recipients to uploads matching a path pattern.
+type notifyRule struct {
+	pattern    string
+	recipients []string
+}
+
+// notification holds the data available to the subject and body templates.
+type notification struct {
+	Name string
+	Path string
+	URL  string
+	Size int64
+	User string
+	Time time.Time
+}
+
+// notifier sends emails via SMTP when files are uploaded.
+type notifier struct {
+	addr    string
+	auth    smtp.Auth
+	from    string
+	rules   []notifyRule
+	subject *template.Template
+	body    *template.Template
+	send    func(addr string, a smtp.Auth, from string, to []string, msg []byte) error
+}
+
+// parseNotifyRule parses a rule like "/reports/ alice@example.com,bob@example.com".
+func parseNotifyRule(spec string) (notifyRule, error) {
+	fs := strings.Fields(spec)
+	if len(fs) != 2 {
+		return notifyRule{}, fmt.Errorf("invalid notification rule %q (must be \"<path> <recipient>[,<recipient>...]\")", spec)
+	}
+	r := notifyRule{pattern: fs[0]}
+	for _, rcpt := range strings.Split(fs[1], ",") {
+		addr, err := mail.ParseAddress(rcpt)
+		if err != nil {
+			return notifyRule{}, fmt.Errorf("invalid recipient %q in notification rule %q", rcpt, spec)
+		}
+		r.recipients = append(r.recipients, addr.Address)
+	}
+	return r, nil
+}
+
+// newNotifier creates a notifier according to the SMTP and notification options.
+// If no SMTP server is configured, nil is returned.
+func newNotifier(a app) (*notifier, error) {
+	if a.SMTPServer == "" {
+		return nil, nil
+	}
+	host, _, err := net.SplitHostPort(a.SMTPServer)
+	if err != nil {
+		return nil, err
+	} else if _, err := mail.ParseAddress(a.SMTPFrom); err != nil {
+		return nil, fmt.Errorf("invalid sender %q", a.SMTPFrom)
+	}
+
+	n := &notifier{addr: a.SMTPServer, from: a.SMTPFrom, send: smtp.SendMail}
+	if a.SMTPUser != "" {
+		n.auth = smtp.PlainAuth("", a.SMTPUser, a.SMTPPassword, host)
+	}
+	for _, spec := range a.NotifyRules {
+		r, err := parseNotifyRule(spec)
+		if err != nil {
+			return nil, err
+		}
+		n.rules = append(n.rules, r)
+	}
+	if n.subject, err = template.New("subject").Parse(a.NotifySubject); err != nil {
+		return nil, err
+	}
+	body := defaultNotifyBody
+	if a.NotifyBody != "" {
+		b, err := os.ReadFile(filepath.Clean(a.NotifyBody))
+		if err != nil {
+			return nil, err
+		}
+		body = string(b)
+	}
+	if n.body, err = template.New("body").Parse(body); err != nil {
+		return nil, err
+	}
+	return n, nil
+}
+
+// recipients returns the recipients of all rules matching the path.
+func (n *notifier) recipients(p string) (to []string) {
+	seen := map[string]bool{}
+	for _, r := range n.rules {
+		if !matchPath([]string{r.pattern}, p) {
+			continue
+		}
+		for _, rcpt := range r.recipients {
+			if !seen[rcpt] {
+				seen[rcpt] = true
+				to = append(to, rcpt)
+			}
+		}
+	}
+	return to
+}
+
+// uploaded sends a notification about the file at path p (relative to the prefix), which is available at u,
+// to all matching recipients.
+// The email is sent in the background, so that the client does not wait for the SMTP server.
+func (n *notifier) uploaded(r *http.Request, u, p string, size int64) {
+	if n == nil {
+		return
+	}
+	to := n.recipients(p)
+	if len(to) == 0 {
+		return
+	}
+
+	data := notification{
+		Name: path.Base(p),
+		Path: p,
+		URL:  u,
+		Size: size,
+		Time: time.Now(),
+	}
+	if id := identityFrom(r.Context()); id != nil {
+		data.User = id.name
+	}
+
+	msg, err := n.message(to, data)
+	if err != nil {
+		log.Err(err).Str("path", p).Msg("Cannot render notification")
+		return
+	}
+	go func() {
+		if err := n.send(n.addr, n.auth, n.from, to, msg); err != nil {
+			log.Err(err).Str("path", p).Strs("to", to).Msg("Cannot send notification")
+			return
+		}
+		log.Info().Str("path", p).Strs("to", to).Msg("Notification sent")
+	}()
+}
+
+// message renders the email including its headers.
+func (n *notifier) message(to []string, data notification) ([]byte, error) {
+	subject, body := &strings.Builder{}, &bytes.Buffer{}
+	if err := n.subject.Execute(subject, data); err != nil {
+		return nil, err
+	} else if err := n.body.Execute(body, data); err != nil {
+		return nil, err
+	}
+
+	b := &bytes.Buffer{}
+	fmt.Fprintf(b, "From: %s\r\n", n.from)
+	fmt.Fprintf(b, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", strings.TrimSpace(subject.String())))
+	fmt.Fprintf(b, "Date: %s\r\n", data.Time.Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\nContent-Type: text/plain; charset=utf-8\r\nContent-Transfer-Encoding: 8bit\r\n\r\n")
+	b.WriteString(strings.ReplaceAll(strings.ReplaceAll(body.String(), "\r\n", "\n"), "\n", "\r\n"))
+	return b.Bytes(), nil
+}
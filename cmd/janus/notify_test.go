@@ -0,0 +1,127 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/stretchr/testify/require"
+)
+
+func Test_parseNotifyRule(t *testing.T) {
+	_, err := parseNotifyRule("/reports/ alice@example.com,Bob <bob@example.com>")
+	Error(t, err, "display names contain spaces")
+
+	r, err := parseNotifyRule("/reports/*.pdf alice@example.com,bob@example.com")
+	NoError(t, err)
+	Equal(t, notifyRule{pattern: "/reports/*.pdf", recipients: []string{"alice@example.com", "bob@example.com"}}, r)
+
+	_, err = parseNotifyRule("/reports/")
+	Error(t, err)
+	_, err = parseNotifyRule("/reports/ alice")
+	EqualError(t, err, `invalid recipient "alice" in notification rule "/reports/ alice"`)
+}
+
+func Test_newNotifier(t *testing.T) {
+	n, err := newNotifier(app{})
+	NoError(t, err)
+	Nil(t, n)
+
+	_, err = newNotifier(app{SMTPServer: "smtp.example.com", SMTPFrom: "janus@example.com"})
+	Error(t, err, "missing port")
+	_, err = newNotifier(app{SMTPServer: "smtp.example.com:587", SMTPFrom: "janus"})
+	EqualError(t, err, `invalid sender "janus"`)
+	_, err = newNotifier(app{SMTPServer: "smtp.example.com:587", SMTPFrom: "janus@example.com", NotifySubject: "{{.Name"})
+	Error(t, err)
+
+	body := filepath.Join(t.TempDir(), "body.txt")
+	NoError(t, os.WriteFile(body, []byte("{{.Path}}"), 0600))
+	n, err = newNotifier(app{SMTPServer: "smtp.example.com:587", SMTPFrom: "janus@example.com", SMTPUser: "janus",
+		NotifyRules: []string{"/reports/ alice@example.com"}, NotifySubject: "{{.Name}}", NotifyBody: body})
+	NoError(t, err)
+	NotNil(t, n.auth)
+	Len(t, n.rules, 1)
+}
+
+func Test_notifier_recipients(t *testing.T) {
+	n := &notifier{rules: []notifyRule{
+		{"/reports/", []string{"alice@example.com"}},
+		{"/reports/*.pdf", []string{"bob@example.com", "alice@example.com"}},
+	}}
+	Equal(t, []string{"alice@example.com", "bob@example.com"}, n.recipients("/reports/weekly.pdf"))
+	Equal(t, []string{"alice@example.com"}, n.recipients("/reports/2024/weekly.pdf"))
+	Empty(t, n.recipients("/other.pdf"))
+}
+
+func Test_notifier_uploaded(t *testing.T) {
+	type mail struct {
+		addr, from string
+		to         []string
+		msg        string
+	}
+	sent := make(chan mail, 1)
+	n, err := newNotifier(app{SMTPServer: "smtp.example.com:587", SMTPFrom: "janus@example.com",
+		NotifyRules: []string{"/reports/ alice@example.com,bob@example.com"}, NotifySubject: "Neuer Bericht: {{.Name}}"})
+	NoError(t, err)
+	n.send = func(addr string, a smtp.Auth, from string, to []string, msg []byte) error {
+		sent <- mail{addr, from, to, string(msg)}
+		return nil
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "http://files.example.com/reports/", nil)
+	r = withIdentity(r, &identity{name: "carol"})
+	n.uploaded(r, externalURL(app{Prefix: "/files/"}, r, "/reports/weekly report.pdf"), "/reports/weekly report.pdf", 1234)
+
+	var m mail
+	select {
+	case m = <-sent:
+	case <-time.After(5 * time.Second):
+		FailNow(t, "notification not sent")
+	}
+	Equal(t, "smtp.example.com:587", m.addr)
+	Equal(t, "janus@example.com", m.from)
+	Equal(t, []string{"alice@example.com", "bob@example.com"}, m.to)
+	Contains(t, m.msg, "To: alice@example.com, bob@example.com\r\n")
+	Contains(t, m.msg, "Subject: Neuer Bericht: weekly report.pdf\r\n")
+	Contains(t, m.msg, "\r\n\r\nweekly report.pdf (1234 bytes) was uploaded by carol at ")
+	Contains(t, m.msg, "\r\n\r\nhttp://files.example.com/files/reports/weekly%20report.pdf\r\n")
+
+	n.uploaded(r, "http://files.example.com/other.pdf", "/other.pdf", 1)
+	var nilNotifier *notifier
+	nilNotifier.uploaded(r, "http://files.example.com/reports/a.pdf", "/reports/a.pdf", 1)
+	select {
+	case m = <-sent:
+		FailNow(t, "unexpected notification", m.msg)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func Test_notifier_message(t *testing.T) {
+	n, err := newNotifier(app{SMTPServer: "smtp.example.com:587", SMTPFrom: "janus@example.com", NotifySubject: "Bericht für {{.User}}"})
+	NoError(t, err)
+	b, err := n.message([]string{"alice@example.com"}, notification{User: "Zoë", Time: time.Unix(0, 0).UTC()})
+	NoError(t, err)
+	Contains(t, string(b), "Subject: =?utf-8?q?Bericht_f=C3=BCr_Zo=C3=AB?=\r\n")
+	Contains(t, string(b), "Date: Thu, 01 Jan 1970 00:00:00 +0000\r\n")
+	True(t, strings.HasSuffix(string(b), "\r\n"))
+	NotContains(t, strings.ReplaceAll(string(b), "\r\n", ""), "\n")
+}
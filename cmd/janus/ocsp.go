@@ -0,0 +1,151 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"golang.org/x/crypto/ocsp"
+)
+
+// ocspRetryInterval is the delay before fetching an OCSP response again after a failure.
+const ocspRetryInterval = 5 * time.Minute
+
+// ocspClient is used for querying OCSP responders.
+var ocspClient = &http.Client{Timeout: 30 * time.Second}
+
+// stapleOCSP fetches OCSP responses for all certificates and staples them in subsequent handshakes.
+// Responses are refreshed halfway through their validity period, and after the certificates were reloaded.
+// It does not return.
+func (cs *certStore) stapleOCSP() {
+	for {
+		t := time.NewTimer(time.Until(cs.staple()))
+		select {
+		case <-t.C:
+		case <-cs.reloaded:
+			t.Stop()
+		}
+	}
+}
+
+// staple fetches an OCSP response for every certificate and attaches it.
+// It returns the time, at which the responses should be refreshed.
+func (cs *certStore) staple() time.Time {
+	cs.mu.RLock()
+	certs := cs.certs
+	cs.mu.RUnlock()
+
+	next := time.Now().Add(24 * time.Hour)
+	staples := make(map[string][]byte, len(certs))
+	for _, c := range certs {
+		resp, raw, err := fetchOCSP(c)
+		if err != nil {
+			log.Warn().Str("subject", c.Leaf.Subject.CommonName).Err(err).Msg("Cannot fetch OCSP response")
+			if r := time.Now().Add(ocspRetryInterval); r.Before(next) {
+				next = r
+			}
+			continue
+		}
+
+		log.Debug().Str("subject", c.Leaf.Subject.CommonName).Time("next-update", resp.NextUpdate).Msg("Fetched OCSP response")
+		staples[string(c.Certificate[0])] = raw
+		if !resp.NextUpdate.IsZero() {
+			if r := resp.ThisUpdate.Add(resp.NextUpdate.Sub(resp.ThisUpdate) / 2); r.Before(next) {
+				next = r
+			}
+		}
+	}
+
+	// certificates might have been reloaded in the meantime, hence they are matched by their content
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	stapled := make([]tls.Certificate, len(cs.certs))
+	for i, c := range cs.certs {
+		if raw, ok := staples[string(c.Certificate[0])]; ok {
+			c.OCSPStaple = raw
+		} else if c.OCSPStaple != nil && ocspExpired(c.OCSPStaple) {
+			c.OCSPStaple = nil
+		}
+		stapled[i] = c
+	}
+	cs.certs = stapled
+	return next
+}
+
+// fetchOCSP queries the OCSP responder of a certificate.
+// The issuer must be the second certificate in the chain.
+// Only responses with status "good" are returned.
+func fetchOCSP(c tls.Certificate) (*ocsp.Response, []byte, error) {
+	if len(c.Leaf.OCSPServer) == 0 {
+		return nil, nil, errors.New("certificate does not specify an OCSP server")
+	} else if len(c.Certificate) < 2 {
+		return nil, nil, errors.New("certificate chain does not contain the issuer")
+	}
+	issuer, err := x509.ParseCertificate(c.Certificate[1])
+	if err != nil {
+		return nil, nil, err
+	}
+
+	req, err := ocsp.CreateRequest(c.Leaf, issuer, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	hr, err := ocspClient.Post(c.Leaf.OCSPServer[0], "application/ocsp-request", bytes.NewReader(req))
+	if err != nil {
+		return nil, nil, err
+	}
+	defer func() { _ = hr.Body.Close() }()
+	if hr.StatusCode != http.StatusOK {
+		return nil, nil, fmt.Errorf("OCSP server responded with %s", hr.Status)
+	}
+
+	raw, err := io.ReadAll(io.LimitReader(hr.Body, 1<<20))
+	if err != nil {
+		return nil, nil, err
+	}
+	resp, err := ocsp.ParseResponseForCert(raw, c.Leaf, issuer)
+	if err != nil {
+		return nil, nil, err
+	} else if resp.Status != ocsp.Good {
+		return nil, nil, fmt.Errorf("certificate status is %s", ocspStatus(resp.Status))
+	}
+	return resp, raw, nil
+}
+
+// ocspExpired reports whether a previously verified OCSP response must not be stapled anymore.
+func ocspExpired(raw []byte) bool {
+	resp, err := ocsp.ParseResponse(raw, nil)
+	return err != nil || !resp.NextUpdate.IsZero() && resp.NextUpdate.Before(time.Now())
+}
+
+// ocspStatus returns a human-readable representation of an OCSP certificate status.
+func ocspStatus(status int) string {
+	switch status {
+	case ocsp.Good:
+		return "good"
+	case ocsp.Revoked:
+		return "revoked"
+	default:
+		return "unknown"
+	}
+}
@@ -0,0 +1,148 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ocsp"
+)
+
+// writeTestChain creates a CA and a certificate issued by it, which refers to the given OCSP server.
+// It returns the paths of the PEM encoded chain and key files, as well as the CA and its key.
+func writeTestChain(t *testing.T, ocspServer string) (certFile, keyFile string, ca *x509.Certificate, caKey crypto.Signer) {
+	t.Helper()
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	NoError(t, err)
+	caTmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "Test CA"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		IsCA:         true,
+
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, caTmpl, caTmpl, caKey.Public(), caKey)
+	NoError(t, err)
+	ca, err = x509.ParseCertificate(der)
+	NoError(t, err)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "a.example.com"},
+		DNSNames:     []string{"a.example.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		OCSPServer:   []string{ocspServer},
+	}
+	leaf, err := x509.CreateCertificate(rand.Reader, tmpl, ca, &key.PublicKey, caKey)
+	NoError(t, err)
+	kb, err := x509.MarshalECPrivateKey(key)
+	NoError(t, err)
+
+	d := t.TempDir()
+	certFile, keyFile = filepath.Join(d, "chain.crt"), filepath.Join(d, "server.key")
+	chain := append(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: leaf}),
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})...)
+	NoError(t, os.WriteFile(certFile, chain, 0600))
+	NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: kb}), 0600))
+	return certFile, keyFile, ca, caKey
+}
+
+func Test_certStore_staple(t *testing.T) {
+	status := ocsp.Good
+	var ca *x509.Certificate
+	var caKey crypto.Signer
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		req, err := ocsp.ParseRequest(b)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		resp, _ := ocsp.CreateResponse(ca, ca, ocsp.Response{
+			Status:       status,
+			SerialNumber: req.SerialNumber,
+			ThisUpdate:   time.Now().Add(-time.Minute),
+			NextUpdate:   time.Now().Add(time.Hour),
+			RevokedAt:    time.Now().Add(-time.Minute),
+		}, caKey)
+		_, _ = w.Write(resp)
+	}))
+	defer srv.Close()
+
+	c, k, ca, caKey := writeTestChain(t, srv.URL)
+	cs, err := newCertStore([]string{c}, []string{k})
+	NoError(t, err)
+	next := cs.staple()
+	WithinDuration(t, time.Now().Add(29*time.Minute), next, 2*time.Minute)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	NoError(t, err)
+	cfg, err := newTLSConfig(app{TLSMinVersion: "1.2"}, cs)
+	NoError(t, err)
+	l := tlsListeners([]net.Listener{ln}, cfg)[0]
+	defer func() { _ = l.Close() }()
+	go func() {
+		if c, err := l.Accept(); err == nil {
+			_ = c.(*tls.Conn).Handshake()
+			_ = c.Close()
+		}
+	}()
+
+	conn, err := tls.Dial("tcp", ln.Addr().String(), &tls.Config{ServerName: "a.example.com", InsecureSkipVerify: true}) //nolint:gosec
+	NoError(t, err)
+	defer func() { _ = conn.Close() }()
+	resp, err := ocsp.ParseResponseForCert(conn.ConnectionState().OCSPResponse, conn.ConnectionState().PeerCertificates[0], ca)
+	NoError(t, err)
+	Equal(t, ocsp.Good, resp.Status)
+
+	status = ocsp.Revoked
+	_, _, err = fetchOCSP(cs.certs[0])
+	EqualError(t, err, "certificate status is revoked")
+}
+
+func Test_fetchOCSP_Invalid(t *testing.T) {
+	c, k := writeTestCert(t, "a.example.com")
+	cs, err := newCertStore([]string{c}, []string{k})
+	NoError(t, err)
+	_, _, err = fetchOCSP(cs.certs[0])
+	Error(t, err)
+	WithinDuration(t, time.Now().Add(ocspRetryInterval), cs.staple(), time.Minute)
+	Nil(t, cs.certs[0].OCSPStaple)
+}
@@ -0,0 +1,430 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/rs/zerolog/log"
+)
+
+// oidcCookie is the name of the cookie holding the ID of an OpenID Connect session.
+const oidcCookie = "janus_oidc"
+
+// oidcStateCookie is the name of the cookie binding a pending login to the browser, which started it.
+const oidcStateCookie = "janus_oidc_state"
+
+// oidcMaxPending is the maximum number of pending logins, which bounds the memory used by abandoned logins.
+const oidcMaxPending = 10000
+
+// oidcLoginTimeout is the maximum duration between redirecting a user to the identity provider and the callback.
+const oidcLoginTimeout = 10 * time.Minute
+
+// errInvalidIDToken indicates that the ID token returned by the identity provider cannot be trusted.
+var errInvalidIDToken = errors.New("invalid ID token")
+
+// oidcProvider holds the endpoints of an OpenID Connect provider as published in its discovery document.
+type oidcProvider struct {
+	Issuer        string `json:"issuer"`
+	AuthURL       string `json:"authorization_endpoint"`
+	TokenURL      string `json:"token_endpoint"`
+	JWKSURL       string `json:"jwks_uri"`
+	EndSessionURL string `json:"end_session_endpoint"`
+}
+
+// oidcLogin is a pending login, which is identified by the state parameter.
+type oidcLogin struct {
+	nonce   string
+	next    string
+	expires time.Time
+}
+
+// oidcAuth authenticates users via OpenID Connect (authorization code flow) and maps their groups to roles.
+type oidcAuth struct {
+	provider     oidcProvider
+	keys         *jwks
+	client       *http.Client
+	clientID     string
+	clientSecret string
+	redirectURL  string
+	scopes       []string
+	userClaim    string
+	groupsClaim  string
+	// roles maps groups to the access they grant (true means read-write).
+	roles    map[string]bool
+	prefix   string
+	sessions *sessionStore
+
+	mu      sync.Mutex
+	pending map[string]oidcLogin
+}
+
+// newOIDCAuth discovers the endpoints of the OpenID Connect provider and creates a client, whose callback is served
+// at "/_janus/oidc/callback".
+// If no issuer is configured, nil is returned.
+func newOIDCAuth(a app) (*oidcAuth, error) {
+	if a.OIDCIssuer == "" {
+		return nil, nil
+	} else if a.OIDCClientID == "" {
+		return nil, errors.New("OpenID Connect requires a client ID")
+	} else if a.SAMLIDPMetadata != "" {
+		return nil, errors.New("OpenID Connect cannot be combined with SAML")
+	}
+
+	rootURL := a.OIDCURL
+	if rootURL == "" {
+		rootURL = a.BaseURL
+	}
+	if rootURL == "" {
+		return nil, errors.New("OpenID Connect requires the root URL")
+	}
+	root, err := url.Parse(strings.TrimRight(rootURL, "/") + "/")
+	if err != nil {
+		return nil, err
+	}
+
+	roles := make(map[string]bool, len(a.OIDCRoles))
+	for g, acc := range a.OIDCRoles {
+		if acc != "ro" && acc != "rw" {
+			return nil, fmt.Errorf("invalid access for OpenID Connect group %q (must be ro or rw): %s", g, acc)
+		}
+		roles[g] = acc == "rw"
+	}
+
+	if len(a.OIDCScopes) == 0 {
+		a.OIDCScopes = []string{"profile", "email"}
+	}
+	oa := &oidcAuth{
+		client:       &http.Client{Timeout: 30 * time.Second, Transport: outboundTransport},
+		clientID:     a.OIDCClientID,
+		clientSecret: a.OIDCClientSecret,
+		redirectURL:  root.ResolveReference(&url.URL{Path: strings.TrimPrefix(apiPrefix, "/") + "oidc/callback"}).String(),
+		scopes:       append([]string{"openid"}, a.OIDCScopes...),
+		userClaim:    a.OIDCUserClaim,
+		groupsClaim:  a.OIDCGroupsClaim,
+		roles:        roles,
+		prefix:       a.Prefix,
+		sessions:     newSessionStore(a.SessionLifetime),
+		pending:      map[string]oidcLogin{},
+	}
+	if oa.provider, err = oa.discover(a.OIDCIssuer); err != nil {
+		return nil, fmt.Errorf("cannot discover OpenID Connect provider: %w", err)
+	}
+	oa.keys = newJWKS(oa.provider.JWKSURL)
+	log.Info().Str("issuer", oa.provider.Issuer).Str("client-id", oa.clientID).Str("redirect-url", oa.redirectURL).
+		Msg("Authenticating via OpenID Connect")
+	return oa, nil
+}
+
+// discover fetches the discovery document of the issuer.
+func (oa *oidcAuth) discover(issuer string) (p oidcProvider, err error) {
+	res, err := oa.client.Get(strings.TrimRight(issuer, "/") + "/.well-known/openid-configuration")
+	if err != nil {
+		return p, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return p, fmt.Errorf("unexpected response: %s", res.Status)
+	} else if err = json.NewDecoder(res.Body).Decode(&p); err != nil {
+		return p, err
+	}
+
+	if strings.TrimRight(p.Issuer, "/") != strings.TrimRight(issuer, "/") {
+		return p, fmt.Errorf("issuer mismatch: %s", p.Issuer)
+	} else if p.AuthURL == "" || p.TokenURL == "" || p.JWKSURL == "" {
+		return p, errors.New("incomplete discovery document")
+	}
+	return p, nil
+}
+
+// register adds the callback and logout endpoints to mux.
+func (oa *oidcAuth) register(mux *http.ServeMux) {
+	if oa == nil {
+		return
+	}
+	mux.HandleFunc(apiPrefix+"oidc/callback", oa.handleCallback)
+	mux.HandleFunc(apiPrefix+"oidc/logout", oa.handleLogout)
+}
+
+// require redirects browsers without a valid session to the identity provider.
+// Other requests without a session are rejected, because they cannot follow the login flow.
+// Authenticated users are permitted according to their groups (see access).
+// If oa is nil, h is returned as is.
+func (oa *oidcAuth) require(h http.Handler) http.Handler {
+	if oa == nil {
+		return h
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := r.Cookie(oidcCookie)
+		if err != nil {
+			oa.startLogin(w, r)
+			return
+		}
+		s, ok := oa.sessions.lookup(c.Value, time.Now())
+		if !ok {
+			oa.startLogin(w, r)
+			return
+		}
+
+		readWrite, ok := oa.access(s.groups)
+		if ok && (readWrite || r.Method == http.MethodGet || r.Method == http.MethodHead) {
+			h.ServeHTTP(w, withIdentity(r, &identity{name: s.user, groups: s.groups}))
+			return
+		}
+
+		log.Warn().Str("request-id", requestIDFrom(r.Context())).Str("user", s.user).
+			Str("method", r.Method).Str("path", r.URL.Path).Msg("OpenID Connect user not authorized")
+		renderError(w, r, errAccessDenied, "access denied", http.StatusForbidden)
+	})
+}
+
+// access determines whether the groups grant any access and if so, whether it includes writing.
+// If no roles are configured, every authenticated user has read-write access.
+func (oa *oidcAuth) access(groups []string) (readWrite, ok bool) {
+	if len(oa.roles) == 0 {
+		return true, true
+	}
+	for _, g := range groups {
+		if rw, found := oa.roles[g]; found {
+			readWrite, ok = readWrite || rw, true
+		}
+	}
+	return readWrite, ok
+}
+
+// startLogin redirects GET and HEAD requests to the authorization endpoint of the identity provider.
+func (oa *oidcAuth) startLogin(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		renderError(w, r, errAccessDenied, "authentication required", http.StatusUnauthorized)
+		return
+	}
+	state, err1 := randomToken()
+	nonce, err2 := randomToken()
+	if err1 != nil || err2 != nil {
+		renderError(w, r, errors.New("no randomness"), "cannot start login", http.StatusInternalServerError)
+		return
+	}
+
+	now := time.Now()
+	oa.mu.Lock()
+	for k, l := range oa.pending {
+		if now.After(l.expires) {
+			delete(oa.pending, k)
+		}
+	}
+	if len(oa.pending) >= oidcMaxPending {
+		oa.mu.Unlock()
+		renderError(w, r, errors.New("too many pending logins"), "cannot start login", http.StatusServiceUnavailable)
+		return
+	}
+	// return to the original URL (including the prefix) after logging in
+	oa.pending[state] = oidcLogin{nonce: nonce, next: localURL(r.RequestURI, oa.prefix), expires: now.Add(oidcLoginTimeout)}
+	oa.mu.Unlock()
+
+	// only the browser, which started the login, may complete it (prevents login CSRF)
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    stateHash(state),
+		Path:     oa.prefix,
+		MaxAge:   int(oidcLoginTimeout.Seconds()),
+		Secure:   r.TLS != nil,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	q := url.Values{
+		"response_type": {"code"},
+		"client_id":     {oa.clientID},
+		"redirect_uri":  {oa.redirectURL},
+		"scope":         {strings.Join(oa.scopes, " ")},
+		"state":         {state},
+		"nonce":         {nonce},
+	}
+	sep := "?"
+	if strings.Contains(oa.provider.AuthURL, "?") {
+		sep = "&"
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	http.Redirect(w, r, oa.provider.AuthURL+sep+q.Encode(), http.StatusFound)
+}
+
+// handleCallback completes the login by exchanging the authorization code for an ID token.
+// Afterwards, the client is redirected to the URL it originally requested.
+func (oa *oidcAuth) handleCallback(w http.ResponseWriter, r *http.Request) {
+	if e := r.FormValue("error"); e != "" {
+		log.Warn().Str("request-id", requestIDFrom(r.Context())).Str("error", e).
+			Str("description", r.FormValue("error_description")).Msg("OpenID Connect login failed")
+		renderError(w, r, errAccessDenied, "login failed", http.StatusForbidden)
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{Name: oidcStateCookie, Path: oa.prefix, MaxAge: -1, HttpOnly: true})
+	if c, err := r.Cookie(oidcStateCookie); err != nil ||
+		subtle.ConstantTimeCompare([]byte(c.Value), []byte(stateHash(r.FormValue("state")))) != 1 {
+		renderError(w, r, errAccessDenied, "login expired, please try again", http.StatusBadRequest)
+		return
+	}
+
+	oa.mu.Lock()
+	l, ok := oa.pending[r.FormValue("state")]
+	delete(oa.pending, r.FormValue("state"))
+	oa.mu.Unlock()
+	if !ok || time.Now().After(l.expires) {
+		renderError(w, r, errAccessDenied, "login expired, please try again", http.StatusBadRequest)
+		return
+	}
+
+	claims, err := oa.exchange(r.Context(), r.FormValue("code"), l.nonce)
+	if err != nil {
+		log.Warn().Str("request-id", requestIDFrom(r.Context())).Err(err).Msg("OpenID Connect login failed")
+		renderError(w, r, errAccessDenied, "login failed", http.StatusForbidden)
+		return
+	}
+
+	user := claimStrings(claims, oa.userClaim)
+	if len(user) == 0 {
+		user = claimStrings(claims, "sub")
+	}
+	groups := claimStrings(claims, oa.groupsClaim)
+	id, err := oa.sessions.create(user[0], time.Now(), groups...)
+	if err != nil {
+		renderError(w, r, err, "cannot create session", http.StatusInternalServerError)
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcCookie,
+		Value:    id,
+		Path:     oa.prefix,
+		MaxAge:   int(oa.sessions.lifetime.Seconds()),
+		Secure:   r.TLS != nil,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	log.Info().Str("request-id", requestIDFrom(r.Context())).Str("user", user[0]).Strs("groups", groups).
+		Msg("Logged in")
+	http.Redirect(w, r, l.next, http.StatusSeeOther)
+}
+
+// handleLogout revokes the current session and redirects to the end session endpoint of the identity provider,
+// if it has one.
+func (oa *oidcAuth) handleLogout(w http.ResponseWriter, r *http.Request) {
+	if c, err := r.Cookie(oidcCookie); err == nil {
+		oa.sessions.revoke(c.Value)
+	}
+	http.SetCookie(w, &http.Cookie{Name: oidcCookie, Path: oa.prefix, MaxAge: -1, HttpOnly: true})
+	if oa.provider.EndSessionURL == "" {
+		_, _ = w.Write([]byte(tr(r, "Logged out")))
+		return
+	}
+	http.Redirect(w, r, oa.provider.EndSessionURL, http.StatusSeeOther)
+}
+
+// exchange redeems the authorization code at the token endpoint and returns the claims of the verified ID token.
+func (oa *oidcAuth) exchange(ctx context.Context, code, nonce string) (jwt.MapClaims, error) {
+	form := url.Values{"grant_type": {"authorization_code"}, "code": {code}, "redirect_uri": {oa.redirectURL}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, oa.provider.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(oa.clientID), url.QueryEscape(oa.clientSecret))
+
+	res, err := oa.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("token endpoint returned %s", res.Status)
+	}
+	var tok struct {
+		IDToken string `json:"id_token"`
+	}
+	if err = json.NewDecoder(res.Body).Decode(&tok); err != nil {
+		return nil, err
+	}
+	return oa.verify(tok.IDToken, nonce, time.Now())
+}
+
+// verify checks the signature, issuer, audience, expiry and nonce of an ID token and returns its claims.
+func (oa *oidcAuth) verify(idToken, nonce string, now time.Time) (jwt.MapClaims, error) {
+	claims := jwt.MapClaims{}
+	if _, err := jwt.ParseWithClaims(idToken, claims, oa.keys.keyFunc, jwt.WithValidMethods(jwtMethods)); err != nil {
+		return nil, fmt.Errorf("%w: %v", errInvalidIDToken, err)
+	}
+	switch {
+	case !claims.VerifyIssuer(oa.provider.Issuer, true):
+		return nil, fmt.Errorf("%w: issuer mismatch", errInvalidIDToken)
+	case !claims.VerifyAudience(oa.clientID, true):
+		return nil, fmt.Errorf("%w: audience mismatch", errInvalidIDToken)
+	case !claims.VerifyExpiresAt(now.Unix(), true):
+		return nil, fmt.Errorf("%w: expired", errInvalidIDToken)
+	case claims["nonce"] != nonce:
+		return nil, fmt.Errorf("%w: nonce mismatch", errInvalidIDToken)
+	case len(claimStrings(claims, "sub")) == 0:
+		return nil, fmt.Errorf("%w: missing subject", errInvalidIDToken)
+	}
+	return claims, nil
+}
+
+// claimStrings returns the value of a claim, which is either a string or an array of strings.
+func claimStrings(claims jwt.MapClaims, name string) []string {
+	switch v := claims[name].(type) {
+	case string:
+		if v != "" {
+			return []string{v}
+		}
+	case []interface{}:
+		var ss []string
+		for _, e := range v {
+			if s, ok := e.(string); ok {
+				ss = append(ss, s)
+			}
+		}
+		return ss
+	}
+	return nil
+}
+
+// stateHash returns the hash of the state parameter, which is stored in the state cookie.
+func stateHash(state string) string {
+	h := sha256.Sum256([]byte(state))
+	return base64.RawURLEncoding.EncodeToString(h[:])
+}
+
+// randomToken returns a random, URL-safe string, which cannot be guessed.
+func randomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
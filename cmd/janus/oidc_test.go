@@ -0,0 +1,233 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	. "github.com/stretchr/testify/require"
+)
+
+// testIDP is an OpenID Connect provider, which issues ID tokens for a fixed set of claims.
+type testIDP struct {
+	*httptest.Server
+	key    *rsa.PrivateKey
+	claims jwt.MapClaims
+	// nonce is the nonce of the last authorization request.
+	nonce string
+}
+
+func newTestIDP(t *testing.T) *testIDP {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	NoError(t, err)
+	idp := &testIDP{key: key}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(oidcProvider{Issuer: idp.URL, AuthURL: idp.URL + "/auth",
+			TokenURL: idp.URL + "/token", JWKSURL: idp.URL + "/jwks"})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string][]jsonWebKey{"keys": {{
+			Kty: "RSA", Kid: "k1", Use: "sig",
+			N: base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			E: base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if id, secret, _ := r.BasicAuth(); id != "janus" || secret != "s3cr3t" || r.FormValue("code") != "c0de" {
+			http.Error(w, "invalid_client", http.StatusUnauthorized)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]string{"id_token": idp.sign(t, idp.nonce)})
+	})
+	idp.Server = httptest.NewServer(mux)
+	t.Cleanup(idp.Close)
+	return idp
+}
+
+// sign creates an ID token with the configured claims.
+func (idp *testIDP) sign(t *testing.T, nonce string) string {
+	t.Helper()
+	claims := jwt.MapClaims{"iss": idp.URL, "aud": "janus", "exp": time.Now().Add(time.Minute).Unix(), "nonce": nonce}
+	for k, v := range idp.claims {
+		claims[k] = v
+	}
+	tok := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	tok.Header["kid"] = "k1"
+	s, err := tok.SignedString(idp.key)
+	NoError(t, err)
+	return s
+}
+
+// login runs the authorization code flow for the given request and returns the session cookie.
+func (idp *testIDP) login(t *testing.T, h http.Handler, target string) *http.Cookie {
+	t.Helper()
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+	Equal(t, http.StatusFound, w.Code)
+	loc, err := url.Parse(w.Header().Get("Location"))
+	NoError(t, err)
+	Equal(t, idp.URL+"/auth", loc.Scheme+"://"+loc.Host+loc.Path)
+	Equal(t, "openid profile email", loc.Query().Get("scope"))
+	idp.nonce = loc.Query().Get("nonce")
+	cs := w.Result().Cookies()
+	Len(t, cs, 1)
+	Equal(t, oidcStateCookie, cs[0].Name)
+
+	r := httptest.NewRequest(http.MethodGet, "/_janus/oidc/callback?code=c0de&state="+loc.Query().Get("state"), nil)
+	r.AddCookie(cs[0])
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	Equal(t, http.StatusSeeOther, w.Code)
+	Equal(t, target, w.Header().Get("Location"))
+	for _, c := range w.Result().Cookies() {
+		if c.Name == oidcCookie {
+			return c
+		}
+	}
+	t.Fatal("no session cookie")
+	return nil
+}
+
+func newTestOIDCAuth(t *testing.T, idp *testIDP, roles map[string]string) *oidcAuth {
+	t.Helper()
+	oa, err := newOIDCAuth(app{OIDCIssuer: idp.URL, OIDCClientID: "janus", OIDCClientSecret: "s3cr3t",
+		OIDCURL: "https://files.example.com/", OIDCUserClaim: "preferred_username", OIDCGroupsClaim: "groups",
+		OIDCRoles: roles, Prefix: "/", SessionLifetime: time.Hour})
+	NoError(t, err)
+	return oa
+}
+
+func Test_newOIDCAuth(t *testing.T) {
+	oa, err := newOIDCAuth(app{})
+	NoError(t, err)
+	Nil(t, oa)
+
+	_, err = newOIDCAuth(app{OIDCIssuer: "https://login.example.com"})
+	EqualError(t, err, "OpenID Connect requires a client ID")
+	_, err = newOIDCAuth(app{OIDCIssuer: "https://login.example.com", OIDCClientID: "janus"})
+	EqualError(t, err, "OpenID Connect requires the root URL")
+
+	idp := newTestIDP(t)
+	_, err = newOIDCAuth(app{OIDCIssuer: idp.URL, OIDCClientID: "janus", BaseURL: "https://files.example.com/",
+		OIDCRoles: map[string]string{"eng": "admin"}})
+	ErrorContains(t, err, `invalid access for OpenID Connect group "eng"`)
+
+	oa = newTestOIDCAuth(t, idp, nil)
+	Equal(t, "https://files.example.com/_janus/oidc/callback", oa.redirectURL)
+	Equal(t, idp.URL+"/token", oa.provider.TokenURL)
+}
+
+func Test_oidcAuth_require(t *testing.T) {
+	idp := newTestIDP(t)
+	oa := newTestOIDCAuth(t, idp, map[string]string{"eng": "rw", "guest": "ro"})
+	mux := http.NewServeMux()
+	oa.register(mux)
+	mux.Handle("/", oa.require(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(identityFrom(r.Context()).name))
+	})))
+
+	serve := func(method string, c *http.Cookie) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, "/a.txt", nil)
+		if c != nil {
+			r.AddCookie(c)
+		}
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+		return w
+	}
+
+	Equal(t, http.StatusUnauthorized, serve(http.MethodPost, nil).Code)
+
+	idp.claims = jwt.MapClaims{"sub": "123", "preferred_username": "alice", "groups": []string{"guest"}}
+	c := idp.login(t, mux, "/a.txt?x=1")
+	w := serve(http.MethodGet, c)
+	Equal(t, http.StatusOK, w.Code)
+	Equal(t, "alice", w.Body.String())
+	Equal(t, http.StatusForbidden, serve(http.MethodPost, c).Code)
+
+	idp.claims = jwt.MapClaims{"sub": "456", "groups": []string{"guest", "eng"}}
+	c = idp.login(t, mux, "/a.txt")
+	w = serve(http.MethodPost, c)
+	Equal(t, http.StatusOK, w.Code)
+	Equal(t, "456", w.Body.String())
+
+	idp.claims = jwt.MapClaims{"sub": "789", "groups": "other"}
+	Equal(t, http.StatusForbidden, serve(http.MethodGet, idp.login(t, mux, "/a.txt")).Code)
+
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/_janus/oidc/callback?code=c0de&state=forged", nil))
+	Equal(t, http.StatusBadRequest, w.Code)
+
+	// a login started by another browser cannot be completed without its state cookie
+	w = serve(http.MethodGet, nil)
+	loc, err := url.Parse(w.Header().Get("Location"))
+	NoError(t, err)
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/_janus/oidc/callback?code=c0de&state="+loc.Query().Get("state"), nil))
+	Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func Test_oidcAuth_startLogin_MaxPending(t *testing.T) {
+	idp := newTestIDP(t)
+	oa := newTestOIDCAuth(t, idp, nil)
+	for i := 0; i < oidcMaxPending; i++ {
+		oa.pending[strconv.Itoa(i)] = oidcLogin{expires: time.Now().Add(time.Minute)}
+	}
+
+	w := httptest.NewRecorder()
+	oa.startLogin(w, httptest.NewRequest(http.MethodGet, "/a.txt", nil))
+	Equal(t, http.StatusServiceUnavailable, w.Code)
+	Len(t, oa.pending, oidcMaxPending)
+}
+
+func Test_oidcAuth_verify(t *testing.T) {
+	idp := newTestIDP(t)
+	oa := newTestOIDCAuth(t, idp, nil)
+	idp.claims = jwt.MapClaims{"sub": "123"}
+
+	claims, err := oa.verify(idp.sign(t, "n1"), "n1", time.Now())
+	NoError(t, err)
+	Equal(t, []string{"123"}, claimStrings(claims, "sub"))
+
+	_, err = oa.verify(idp.sign(t, "n1"), "n2", time.Now())
+	ErrorIs(t, err, errInvalidIDToken)
+
+	idp.claims["aud"] = "other"
+	_, err = oa.verify(idp.sign(t, "n1"), "n1", time.Now())
+	ErrorIs(t, err, errInvalidIDToken)
+
+	// unsigned tokens must never be accepted
+	none, err := jwt.NewWithClaims(jwt.SigningMethodNone, jwt.MapClaims{"sub": "123", "iss": idp.URL, "aud": "janus",
+		"nonce": "n1"}).SignedString(jwt.UnsafeAllowNoneSignatureType)
+	NoError(t, err)
+	_, err = oa.verify(none, "n1", time.Now())
+	ErrorIs(t, err, errInvalidIDToken)
+	True(t, strings.Contains(err.Error(), "signing method"))
+}
@@ -0,0 +1,71 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// allowedMethods returns the methods supported for the requested path, depending on the enabled features and
+// whether the path refers to a directory or a file.
+func allowedMethods(a app, r *http.Request) []string {
+	ms := []string{http.MethodGet, http.MethodHead, http.MethodOptions}
+	if strings.HasPrefix(r.URL.Path, apiPrefix) {
+		return append(ms, http.MethodPost)
+	}
+
+	fi, err := os.Stat(filepath.Join(rootDir(a, r), r.URL.Path))
+	dir := strings.HasSuffix(r.URL.Path, "/") || (err == nil && fi.IsDir())
+	if dir && uploadEnabled(a) {
+		ms = append(ms, http.MethodPost)
+	}
+	if !dir && (a.Maven || a.CAS) && uploadEnabled(a) {
+		ms = append(ms, http.MethodPut)
+	}
+	if !dir && (a.uploads != nil || (a.Append && uploadEnabled(a))) {
+		ms = append(ms, http.MethodPatch)
+	}
+	if err == nil && len(a.roles) > 0 {
+		ms = append(ms, http.MethodDelete)
+	}
+	if a.locks != nil {
+		ms = append(ms, "LOCK", "UNLOCK")
+	}
+	sort.Strings(ms)
+	return ms
+}
+
+// handleOptions answers OPTIONS requests with the methods supported for the requested path.
+// As browsers send CORS preflight requests without credentials, no authentication is required.
+func handleOptions(a app, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodOptions {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("Allow", strings.Join(allowedMethods(a.scopes.of(a, r.URL.Path), r), ", "))
+		if a.uploads != nil {
+			w.Header().Set("Tus-Resumable", tusVersion)
+			w.Header().Set("Tus-Version", tusVersion)
+			w.Header().Set("Tus-Extension", "creation")
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
@@ -0,0 +1,70 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/stretchr/testify/require"
+)
+
+func Test_allowedMethods(t *testing.T) {
+	dir := t.TempDir()
+	NoError(t, os.WriteFile(filepath.Join(dir, "a.txt"), []byte("a"), 0600))
+	allowed := func(a app, p string) []string {
+		return allowedMethods(a, httptest.NewRequest(http.MethodOptions, p, nil))
+	}
+
+	a := app{ServerRoot: dir}
+	Equal(t, []string{"GET", "HEAD", "OPTIONS"}, allowed(a, "/"))
+	Equal(t, []string{"GET", "HEAD", "OPTIONS", "POST"}, allowed(a, "/_janus/login"))
+
+	a.EnableUpload = true
+	Equal(t, []string{"GET", "HEAD", "OPTIONS", "POST"}, allowed(a, "/"))
+	Equal(t, []string{"GET", "HEAD", "OPTIONS"}, allowed(a, "/a.txt"))
+
+	a.Maven, a.roles, a.locks = true, []role{{}}, newLockManager(time.Minute)
+	Equal(t, []string{"DELETE", "GET", "HEAD", "LOCK", "OPTIONS", "PUT", "UNLOCK"}, allowed(a, "/a.txt"))
+	Equal(t, []string{"GET", "HEAD", "LOCK", "OPTIONS", "PUT", "UNLOCK"}, allowed(a, "/b.txt"))
+	Equal(t, []string{"GET", "HEAD", "LOCK", "OPTIONS", "POST", "UNLOCK"}, allowed(a, "/new/"))
+
+	a.Append = true
+	Equal(t, []string{"DELETE", "GET", "HEAD", "LOCK", "OPTIONS", "PATCH", "PUT", "UNLOCK"}, allowed(a, "/a.txt"))
+	Equal(t, []string{"GET", "HEAD", "LOCK", "OPTIONS", "POST", "UNLOCK"}, allowed(a, "/new/"))
+}
+
+func Test_handleOptions(t *testing.T) {
+	uploads, err := newResumableUploads(t.TempDir(), time.Hour)
+	NoError(t, err)
+	a := app{ServerRoot: t.TempDir(), EnableUpload: true, uploads: uploads}
+	h := handleOptions(a, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}))
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodOptions, "/big.iso", nil))
+	Equal(t, http.StatusNoContent, w.Code)
+	Equal(t, "GET, HEAD, OPTIONS, PATCH", w.Header().Get("Allow"))
+	Equal(t, "creation", w.Header().Get("Tus-Extension"))
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/big.iso", nil))
+	Equal(t, http.StatusTeapot, w.Code)
+}
@@ -0,0 +1,322 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"expvar"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// durationBounds are the upper bounds (in milliseconds) of the buckets of the request duration histogram.
+var durationBounds = []float64{5, 10, 25, 50, 100, 250, 500, 1000, 2500, 5000, 10000}
+
+// exportedVars names the expvar maps, whose values are exported as gauges.
+var exportedVars = []string{"connections", "file_cache", "listing_cache"}
+
+// requestKey identifies the requests counted together.
+type requestKey struct {
+	method string
+	status string
+}
+
+// otlpMetrics aggregates request metrics and exports them periodically to an OpenTelemetry collector
+// via OTLP/HTTP in JSON encoding.
+type otlpMetrics struct {
+	endpoint string
+	headers  map[string]string
+	resource []otlpAttr
+	interval time.Duration
+	client   *http.Client
+
+	mu       sync.Mutex
+	start    time.Time
+	requests map[requestKey]int64
+	sent     int64
+	received int64
+	count    uint64
+	sum      float64
+	buckets  []uint64
+}
+
+// newOTLPMetrics creates an exporter sending metrics to the collector at the base URL endpoint.
+// If endpoint is empty, nil is returned.
+// Resource attributes and headers are taken from the standard OpenTelemetry environment variables.
+func newOTLPMetrics(endpoint string, interval time.Duration) (*otlpMetrics, error) {
+	if endpoint == "" {
+		return nil, nil
+	}
+	if u, err := url.Parse(endpoint); err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+		return nil, fmt.Errorf("invalid URL %q", endpoint)
+	} else if interval <= 0 {
+		return nil, errors.New("export interval must be positive")
+	}
+
+	name := os.Getenv("OTEL_SERVICE_NAME")
+	if name == "" {
+		name = "janus"
+	}
+	res := []otlpAttr{strAttr("service.name", name), strAttr("service.version", version)}
+	for k, v := range parseKeyValues(os.Getenv("OTEL_RESOURCE_ATTRIBUTES")) {
+		if k != "service.name" {
+			res = append(res, strAttr(k, v))
+		}
+	}
+	sort.Slice(res[2:], func(i, j int) bool { return res[2+i].Key < res[2+j].Key })
+
+	return &otlpMetrics{
+		endpoint: strings.TrimRight(endpoint, "/") + "/v1/metrics",
+		headers:  parseKeyValues(os.Getenv("OTEL_EXPORTER_OTLP_HEADERS")),
+		resource: res,
+		interval: interval,
+		client:   &http.Client{Timeout: 10 * time.Second, Transport: outboundTransport},
+		start:    time.Now(),
+		requests: map[requestKey]int64{},
+		buckets:  make([]uint64, len(durationBounds)+1),
+	}, nil
+}
+
+// parseKeyValues parses a comma-separated list of key-value pairs e.g., "k1=v1,k2=v2", with URL encoded values.
+func parseKeyValues(s string) map[string]string {
+	kvs := map[string]string{}
+	for _, kv := range strings.Split(s, ",") {
+		k, v, ok := strings.Cut(kv, "=")
+		if !ok || strings.TrimSpace(k) == "" {
+			continue
+		}
+		if uv, err := url.PathUnescape(strings.TrimSpace(v)); err == nil {
+			v = uv
+		}
+		kvs[strings.TrimSpace(k)] = v
+	}
+	return kvs
+}
+
+// request aggregates the metrics of a request.
+func (m *otlpMetrics) request(method string, status int, d time.Duration, sent, received int64) {
+	ms := float64(d) / float64(time.Millisecond)
+	i := sort.SearchFloat64s(durationBounds, ms)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.requests[requestKey{method, strconv.Itoa(status/100) + "xx"}]++
+	m.sent += sent
+	m.received += received
+	m.count++
+	m.sum += ms
+	m.buckets[i]++
+}
+
+// run exports the metrics at the configured interval. It never returns.
+func (m *otlpMetrics) run() {
+	for range time.NewTicker(m.interval).C {
+		if err := m.export(time.Now()); err != nil {
+			log.Warn().Err(err).Str("endpoint", m.endpoint).Msg("Cannot export metrics")
+		}
+	}
+}
+
+// export sends the cumulative metrics to the collector.
+func (m *otlpMetrics) export(now time.Time) error {
+	b, err := json.Marshal(m.snapshot(now))
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, m.endpoint, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range m.headers {
+		req.Header.Set(k, v)
+	}
+
+	res, err := m.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode/100 != 2 {
+		return fmt.Errorf("unexpected status %s", res.Status)
+	}
+	return nil
+}
+
+// snapshot renders the current state of all metrics as OTLP request.
+func (m *otlpMetrics) snapshot(now time.Time) otlpRequest {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	start, ts := nanos(m.start), nanos(now)
+
+	keys := make([]requestKey, 0, len(m.requests))
+	for k := range m.requests {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].method < keys[j].method || keys[i].method == keys[j].method && keys[i].status < keys[j].status
+	})
+	var reqs []otlpDataPoint
+	for _, k := range keys {
+		reqs = append(reqs, otlpDataPoint{
+			Attributes: []otlpAttr{strAttr("http.request.method", k.method), strAttr("http.response.status_class", k.status)},
+			Start:      start, Time: ts, AsInt: strconv.FormatInt(m.requests[k], 10),
+		})
+	}
+
+	buckets := make([]string, len(m.buckets))
+	for i, c := range m.buckets {
+		buckets[i] = strconv.FormatUint(c, 10)
+	}
+	sum := m.sum
+	ms := []otlpMetric{
+		{Name: "janus.requests", Unit: "{request}", Sum: &otlpSum{Temporality: cumulative, Monotonic: true, DataPoints: reqs}},
+		{Name: "janus.request.duration", Unit: "ms", Histogram: &otlpHistogram{Temporality: cumulative, DataPoints: []otlpHistogramPoint{{
+			Start: start, Time: ts, Count: strconv.FormatUint(m.count, 10), Sum: &sum, BucketCounts: buckets, Bounds: durationBounds,
+		}}}},
+		{Name: "janus.bytes_sent", Unit: "By", Sum: &otlpSum{Temporality: cumulative, Monotonic: true, DataPoints: []otlpDataPoint{{
+			Start: start, Time: ts, AsInt: strconv.FormatInt(m.sent, 10),
+		}}}},
+		{Name: "janus.bytes_received", Unit: "By", Sum: &otlpSum{Temporality: cumulative, Monotonic: true, DataPoints: []otlpDataPoint{{
+			Start: start, Time: ts, AsInt: strconv.FormatInt(m.received, 10),
+		}}}},
+	}
+	for _, name := range exportedVars {
+		vm, ok := expvar.Get(name).(*expvar.Map)
+		if !ok {
+			continue
+		}
+		vm.Do(func(kv expvar.KeyValue) {
+			if v, ok := kv.Value.(*expvar.Int); ok {
+				ms = append(ms, otlpMetric{Name: "janus." + name + "." + kv.Key, Gauge: &otlpGauge{DataPoints: []otlpDataPoint{{
+					Time: ts, AsInt: strconv.FormatInt(v.Value(), 10),
+				}}}})
+			}
+		})
+	}
+
+	return otlpRequest{ResourceMetrics: []otlpResourceMetrics{{
+		Resource:     otlpResource{Attributes: m.resource},
+		ScopeMetrics: []otlpScopeMetrics{{Scope: otlpScope{Name: "janus", Version: version}, Metrics: ms}},
+	}}}
+}
+
+// nanos renders a point in time as Unix nanoseconds, which are encoded as string in JSON.
+func nanos(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
+
+// cumulative is the aggregation temporality of metrics, which accumulate since the start of the server.
+const cumulative = 2
+
+// otlpRequest is the JSON representation of an ExportMetricsServiceRequest.
+// See https://github.com/open-telemetry/opentelemetry-proto/blob/main/opentelemetry/proto/metrics/v1/metrics.proto
+type otlpRequest struct {
+	ResourceMetrics []otlpResourceMetrics `json:"resourceMetrics"`
+}
+
+// otlpResourceMetrics holds the metrics of a resource i.e., the server.
+type otlpResourceMetrics struct {
+	Resource     otlpResource       `json:"resource"`
+	ScopeMetrics []otlpScopeMetrics `json:"scopeMetrics"`
+}
+
+// otlpResource describes the server by its attributes.
+type otlpResource struct {
+	Attributes []otlpAttr `json:"attributes"`
+}
+
+// otlpScopeMetrics holds the metrics of an instrumentation scope.
+type otlpScopeMetrics struct {
+	Scope   otlpScope    `json:"scope"`
+	Metrics []otlpMetric `json:"metrics"`
+}
+
+// otlpScope identifies the instrumentation scope.
+type otlpScope struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// otlpMetric is a named metric of a single type.
+type otlpMetric struct {
+	Name      string         `json:"name"`
+	Unit      string         `json:"unit,omitempty"`
+	Sum       *otlpSum       `json:"sum,omitempty"`
+	Gauge     *otlpGauge     `json:"gauge,omitempty"`
+	Histogram *otlpHistogram `json:"histogram,omitempty"`
+}
+
+// otlpSum is a counter.
+type otlpSum struct {
+	Temporality int             `json:"aggregationTemporality"`
+	Monotonic   bool            `json:"isMonotonic"`
+	DataPoints  []otlpDataPoint `json:"dataPoints"`
+}
+
+// otlpGauge is a value, which may go up and down.
+type otlpGauge struct {
+	DataPoints []otlpDataPoint `json:"dataPoints"`
+}
+
+// otlpHistogram is a distribution of values in buckets.
+type otlpHistogram struct {
+	Temporality int                  `json:"aggregationTemporality"`
+	DataPoints  []otlpHistogramPoint `json:"dataPoints"`
+}
+
+// otlpDataPoint is a single value of a sum or gauge.
+type otlpDataPoint struct {
+	Attributes []otlpAttr `json:"attributes,omitempty"`
+	Start      string     `json:"startTimeUnixNano,omitempty"`
+	Time       string     `json:"timeUnixNano"`
+	AsInt      string     `json:"asInt"`
+}
+
+// otlpHistogramPoint is the state of a histogram.
+type otlpHistogramPoint struct {
+	Start        string    `json:"startTimeUnixNano"`
+	Time         string    `json:"timeUnixNano"`
+	Count        string    `json:"count"`
+	Sum          *float64  `json:"sum,omitempty"`
+	BucketCounts []string  `json:"bucketCounts"`
+	Bounds       []float64 `json:"explicitBounds"`
+}
+
+// otlpAttr is a key-value pair with a string value.
+type otlpAttr struct {
+	Key   string `json:"key"`
+	Value struct {
+		String string `json:"stringValue"`
+	} `json:"value"`
+}
+
+// strAttr creates an attribute with a string value.
+func strAttr(k, v string) otlpAttr {
+	a := otlpAttr{Key: k}
+	a.Value.String = v
+	return a
+}
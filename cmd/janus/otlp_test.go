@@ -0,0 +1,105 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	. "github.com/stretchr/testify/require"
+)
+
+func Test_newOTLPMetrics(t *testing.T) {
+	m, err := newOTLPMetrics("", time.Minute)
+	NoError(t, err)
+	Nil(t, m)
+
+	_, err = newOTLPMetrics("collector:4318", time.Minute)
+	EqualError(t, err, `invalid URL "collector:4318"`)
+	_, err = newOTLPMetrics("http://collector:4318", 0)
+	Error(t, err)
+
+	t.Setenv("OTEL_SERVICE_NAME", "files")
+	t.Setenv("OTEL_RESOURCE_ATTRIBUTES", "service.name=ignored,host.name=web%201,deployment.environment=prod")
+	t.Setenv("OTEL_EXPORTER_OTLP_HEADERS", "Authorization=Bearer%20secret")
+	m, err = newOTLPMetrics("http://collector:4318/", time.Minute)
+	NoError(t, err)
+	Equal(t, "http://collector:4318/v1/metrics", m.endpoint)
+	Equal(t, map[string]string{"Authorization": "Bearer secret"}, m.headers)
+	Equal(t, []otlpAttr{
+		strAttr("service.name", "files"), strAttr("service.version", version),
+		strAttr("deployment.environment", "prod"), strAttr("host.name", "web 1"),
+	}, m.resource)
+}
+
+func Test_parseKeyValues(t *testing.T) {
+	Equal(t, map[string]string{"a": "1", "b": "x=y"}, parseKeyValues(" a = 1 ,b=x=y,,invalid"))
+	Empty(t, parseKeyValues(""))
+}
+
+func Test_otlpMetrics_snapshot(t *testing.T) {
+	m, err := newOTLPMetrics("http://collector:4318", time.Minute)
+	NoError(t, err)
+	m.request(http.MethodGet, http.StatusOK, 3*time.Millisecond, 100, 0)
+	m.request(http.MethodGet, http.StatusNotFound, 20*time.Millisecond, 10, 0)
+	m.request(http.MethodPost, http.StatusCreated, 20*time.Second, 5, 1000)
+
+	ms := m.snapshot(time.Now()).ResourceMetrics[0].ScopeMetrics[0].Metrics
+	Equal(t, "janus.requests", ms[0].Name)
+	dps := ms[0].Sum.DataPoints
+	Len(t, dps, 3)
+	Equal(t, []otlpAttr{strAttr("http.request.method", "GET"), strAttr("http.response.status_class", "2xx")}, dps[0].Attributes)
+	Equal(t, "1", dps[0].AsInt)
+	Equal(t, "4xx", dps[1].Attributes[1].Value.String)
+	Equal(t, "POST", dps[2].Attributes[0].Value.String)
+
+	h := ms[1].Histogram.DataPoints[0]
+	Equal(t, "3", h.Count)
+	Equal(t, []string{"1", "0", "1", "0", "0", "0", "0", "0", "0", "0", "0", "1"}, h.BucketCounts)
+	InDelta(t, 20023.0, *h.Sum, 0.001)
+	Equal(t, "115", ms[2].Sum.DataPoints[0].AsInt)
+	Equal(t, "1000", ms[3].Sum.DataPoints[0].AsInt)
+}
+
+func Test_otlpMetrics_export(t *testing.T) {
+	var got otlpRequest
+	var auth string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/metrics" || r.Header.Get("Content-Type") != "application/json" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		auth = r.Header.Get("Authorization")
+		b, _ := io.ReadAll(r.Body)
+		_ = json.Unmarshal(b, &got)
+	}))
+	defer srv.Close()
+
+	t.Setenv("OTEL_EXPORTER_OTLP_HEADERS", "Authorization=secret")
+	m, err := newOTLPMetrics(srv.URL, time.Minute)
+	NoError(t, err)
+	m.request(http.MethodGet, http.StatusOK, time.Millisecond, 1, 0)
+	NoError(t, m.export(time.Now()))
+	Equal(t, "secret", auth)
+	Equal(t, "janus", got.ResourceMetrics[0].ScopeMetrics[0].Scope.Name)
+	Equal(t, cumulative, got.ResourceMetrics[0].ScopeMetrics[0].Metrics[0].Sum.Temporality)
+
+	m.endpoint = srv.URL + "/other"
+	Error(t, m.export(time.Now()))
+}
@@ -0,0 +1,62 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+
+	"github.com/rs/zerolog/log"
+)
+
+// outboundTransport is used by all integrations, which connect to other services via HTTP(S) e.g., chat webhooks,
+// OTLP collectors, OCSP responders, ACME CAs and SAML identity providers.
+// It honors the proxy configured in HTTPS_PROXY, HTTP_PROXY and NO_PROXY.
+var outboundTransport http.RoundTripper = http.DefaultTransport
+
+// setOutboundCAs makes outbound connections trust the CA certificates in the given files in addition to the
+// system roots e.g., the CA of a TLS-intercepting proxy.
+func setOutboundCAs(files []string) error {
+	t, err := newOutboundTransport(files)
+	if err != nil {
+		return err
+	}
+	outboundTransport = t
+	ocspClient.Transport = t
+	return nil
+}
+
+// newOutboundTransport creates a Transport, which trusts the system roots and the CA certificates in the given files.
+// Proxies are taken from the environment.
+func newOutboundTransport(files []string) (*http.Transport, error) {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.Proxy = http.ProxyFromEnvironment
+	if len(files) == 0 {
+		return t, nil
+	}
+
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		log.Warn().Err(err).Msg("Cannot load system root CAs")
+		pool = x509.NewCertPool()
+	}
+	if err := appendCerts(pool, files); err != nil {
+		return nil, err
+	}
+	t.TLSClientConfig = &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+	log.Info().Strs("outbound-ca", files).Msg("Trusting additional CAs for outbound connections")
+	return t, nil
+}
@@ -0,0 +1,52 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	. "github.com/stretchr/testify/require"
+)
+
+func Test_newOutboundTransport(t *testing.T) {
+	c, k := writeTestCert(t, "localhost")
+	cert, err := tls.LoadX509KeyPair(c, k)
+	NoError(t, err)
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	srv.TLS = &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+	srv.StartTLS()
+	defer srv.Close()
+	_, port, _ := net.SplitHostPort(srv.Listener.Addr().String())
+	u := "https://localhost:" + port
+
+	tr, err := newOutboundTransport(nil)
+	NoError(t, err)
+	_, err = (&http.Client{Transport: tr}).Get(u)
+	Error(t, err, "the certificate must not be trusted by default")
+
+	tr, err = newOutboundTransport([]string{c})
+	NoError(t, err)
+	res, err := (&http.Client{Transport: tr}).Get(u)
+	NoError(t, err)
+	_ = res.Body.Close()
+	Equal(t, http.StatusOK, res.StatusCode)
+
+	_, err = newOutboundTransport([]string{k})
+	Error(t, err)
+}
@@ -0,0 +1,119 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"expvar"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Classes of disk-heavy operations, which are executed by work pools.
+const (
+	// poolChecksum computes digests of entire files e.g., integrity hashes, torrents and file digests.
+	poolChecksum = "checksum"
+	// poolMetadata generates repository metadata from package files e.g., APT indexes and Go module info.
+	poolMetadata = "metadata"
+)
+
+// errPoolFull indicates that the queue of a work pool is full.
+var errPoolFull = errors.New("work pool queue full")
+
+// poolStats exposes the number of operations rejected by the work pools.
+var poolStats = expvar.NewMap("work_pools")
+
+// workPool restricts the number of concurrent operations of a class, so that a burst of expensive requests cannot
+// starve ordinary file serving. Up to queue operations wait for one of the workers, further ones are rejected.
+type workPool struct {
+	class   string
+	workers chan struct{}
+	pending chan struct{}
+}
+
+// workPools holds the work pools by class. Operations of classes without a pool are not restricted.
+type workPools map[string]*workPool
+
+// parseWorkPool parses a work pool of the form "<class> workers=<n> [queue=<n>]".
+func parseWorkPool(spec string) (*workPool, error) {
+	fs := strings.Fields(spec)
+	if len(fs) < 2 || (fs[0] != poolChecksum && fs[0] != poolMetadata) {
+		return nil, fmt.Errorf("invalid work pool %q (class must be %s or %s)", spec, poolChecksum, poolMetadata)
+	}
+	workers, queue := 0, 0
+	for _, f := range fs[1:] {
+		k, v, _ := strings.Cut(f, "=")
+		n, err := strconv.Atoi(v)
+		switch k {
+		case "workers":
+			workers, err = n, positive(err, n > 0)
+		case "queue":
+			queue, err = n, positive(err, n >= 0)
+		default:
+			err = errors.New("unknown key")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s in work pool %q", k, spec)
+		}
+	}
+	if workers == 0 {
+		return nil, fmt.Errorf("missing workers in work pool %q", spec)
+	}
+	return &workPool{class: fs[0], workers: make(chan struct{}, workers), pending: make(chan struct{}, workers+queue)}, nil
+}
+
+// newWorkPools creates the work pools according to the specs. The last pool of a class wins.
+func newWorkPools(specs []string) (workPools, error) {
+	ps := workPools{}
+	for _, spec := range specs {
+		p, err := parseWorkPool(spec)
+		if err != nil {
+			return nil, err
+		}
+		ps[p.class] = p
+	}
+	return ps, nil
+}
+
+// acquire waits for a worker of the given class and returns a function, which releases it.
+// If the queue is full or the request is canceled while waiting, an error is rendered and ok is false.
+func (ps workPools) acquire(w http.ResponseWriter, r *http.Request, class string) (release func(), ok bool) {
+	p := ps[class]
+	if p == nil {
+		return func() {}, true
+	}
+
+	select {
+	case p.pending <- struct{}{}:
+	default:
+		poolStats.Add(class+"_rejected", 1)
+		w.Header().Set("Retry-After", "1")
+		renderError(w, r, fmt.Errorf("%w: %s", errPoolFull, class), "server busy", http.StatusServiceUnavailable)
+		return nil, false
+	}
+	select {
+	case p.workers <- struct{}{}:
+		return func() {
+			<-p.workers
+			<-p.pending
+		}, true
+	case <-r.Context().Done():
+		<-p.pending
+		renderError(w, r, r.Context().Err(), "request canceled", http.StatusServiceUnavailable)
+		return nil, false
+	}
+}
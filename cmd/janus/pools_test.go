@@ -0,0 +1,85 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	. "github.com/stretchr/testify/require"
+)
+
+func Test_parseWorkPool(t *testing.T) {
+	p, err := parseWorkPool("checksum workers=2 queue=3")
+	NoError(t, err)
+	Equal(t, poolChecksum, p.class)
+	Equal(t, 2, cap(p.workers))
+	Equal(t, 5, cap(p.pending))
+
+	p, err = parseWorkPool("metadata workers=1 queue=0")
+	NoError(t, err)
+	Equal(t, 1, cap(p.pending))
+
+	for _, spec := range []string{"checksum", "thumbnail workers=1", "checksum queue=1", "checksum workers=0", "checksum workers=1 queue=-1", "checksum workers=1 size=2"} {
+		_, err = parseWorkPool(spec)
+		Error(t, err, spec)
+	}
+}
+
+func Test_workPools_acquire(t *testing.T) {
+	ps, err := newWorkPools([]string{"checksum workers=1 queue=1"})
+	NoError(t, err)
+	acquire := func(ctx context.Context) (func(), *httptest.ResponseRecorder) {
+		w := httptest.NewRecorder()
+		release, _ := ps.acquire(w, httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx), poolChecksum)
+		return release, w
+	}
+
+	release, _ := acquire(context.Background())
+	NotNil(t, release)
+
+	// the second operation waits in the queue until it is canceled
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan *httptest.ResponseRecorder)
+	go func() {
+		r, w := acquire(ctx)
+		Nil(t, r)
+		done <- w
+	}()
+	Eventually(t, func() bool { return len(ps[poolChecksum].pending) == 2 }, time.Second, time.Millisecond)
+
+	// the queue is full
+	r, w := acquire(context.Background())
+	Nil(t, r)
+	Equal(t, http.StatusServiceUnavailable, w.Code)
+	Equal(t, "1", w.Header().Get("Retry-After"))
+
+	cancel()
+	// nobody receives the response of a client, which disconnected
+	Equal(t, statusClientClosedRequest, (<-done).Code)
+	release()
+	Empty(t, ps[poolChecksum].pending)
+
+	// classes without a pool are not restricted
+	release, ok := ps.acquire(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil), poolMetadata)
+	True(t, ok)
+	release()
+	release, ok = workPools(nil).acquire(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil), poolMetadata)
+	True(t, ok)
+	release()
+}
@@ -0,0 +1,123 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var errPreconditionFailed = errors.New("precondition failed")
+
+// fileETag returns a strong entity tag derived from the modification time and the size of a file.
+func fileETag(fi os.FileInfo) string {
+	return `"` + strconv.FormatInt(fi.ModTime().UnixNano(), 16) + "-" + strconv.FormatInt(fi.Size(), 16) + `"`
+}
+
+// contentETag returns the entity tag of the content of the named file, as served from the file cache.
+func contentETag(name string) (string, error) {
+	sum, err := contentSum(name)
+	if err != nil {
+		return "", err
+	}
+	return hashETag(sum), nil
+}
+
+// contentSum returns the SHA-256 digest of the content of the named file.
+func contentSum(name string) ([]byte, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
+// checkPreconditions evaluates If-Match, If-Unmodified-Since and If-None-Match for the named file.
+// If the file was modified in the meantime (or does not exist, but If-Match is given), errPreconditionFailed is returned.
+// It is returned as well, if the file matches If-None-Match i.e., it exists ("*") or already has the uploaded content.
+func checkPreconditions(r *http.Request, name string) error {
+	fi, _ := os.Stat(name)
+
+	if im := r.Header.Get("If-Match"); im != "" {
+		if fi == nil || !matchETag(im, name, fi) {
+			return errPreconditionFailed
+		}
+	} else if ius := r.Header.Get("If-Unmodified-Since"); ius != "" && fi != nil {
+		if t, err := http.ParseTime(ius); err == nil && fi.ModTime().Truncate(time.Second).After(t) {
+			return errPreconditionFailed
+		}
+	}
+	if inm := r.Header.Get("If-None-Match"); inm != "" && fi != nil && matchETag(inm, name, fi) {
+		return errPreconditionFailed
+	}
+	return nil
+}
+
+// matchETag reports whether one of the entity tags listed in If-Match (or If-None-Match) denotes the current version
+// of the file. Besides the entity tags served, the SHA-256 digest of the content is accepted as "sha256:<digest>".
+// Weak entity tags never match, as required for strong comparison.
+func matchETag(ifMatch, name string, fi os.FileInfo) bool {
+	var sum []byte
+	for _, t := range strings.Split(ifMatch, ",") {
+		switch t = strings.TrimSpace(t); {
+		case t == "*" || t == fileETag(fi):
+			return true
+		case strings.HasPrefix(t, "W/") || !fi.Mode().IsRegular():
+			continue
+		case sum == nil:
+			var err error
+			if sum, err = contentSum(name); err != nil {
+				return false
+			}
+		}
+		if t == hashETag(sum) || t == `"sha256:`+hex.EncodeToString(sum)+`"` {
+			return true
+		}
+	}
+	return false
+}
+
+// requirePreconditions rejects PUT, PATCH and DELETE requests with "412 Precondition Failed",
+// if the file does not match the preconditions.
+// Uploads are checked by handleFileUpload, as the name of the file is part of the request body.
+func requirePreconditions(a app, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut && r.Method != http.MethodPatch && r.Method != http.MethodDelete {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		name := filepath.Join(rootDir(a, r), r.URL.Path)
+		if err := checkPreconditions(r, name); err != nil {
+			renderError(w, r, err, "the file was modified in the meantime", http.StatusPreconditionFailed)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
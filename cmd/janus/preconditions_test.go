@@ -0,0 +1,127 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/stretchr/testify/require"
+)
+
+func Test_fileETag(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "a.txt")
+	NoError(t, os.WriteFile(name, []byte("data"), 0600))
+	mtime := time.Unix(1700000000, 5)
+	NoError(t, os.Chtimes(name, mtime, mtime))
+
+	fi, err := os.Stat(name)
+	NoError(t, err)
+	Equal(t, `"17979cfe362a0005-4"`, fileETag(fi))
+
+	etag, err := contentETag(name)
+	NoError(t, err)
+	Equal(t, `"3a6eb0790f39ac87c94f3856b2dd2c5d"`, etag)
+}
+
+func Test_checkPreconditions(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "a.txt")
+	NoError(t, os.WriteFile(name, []byte("data"), 0600))
+	mtime := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	NoError(t, os.Chtimes(name, mtime, mtime))
+	fi, err := os.Stat(name)
+	NoError(t, err)
+
+	check := func(name string, header ...string) error {
+		r := httptest.NewRequest(http.MethodPut, "/a.txt", nil)
+		for i := 0; i < len(header); i += 2 {
+			r.Header.Set(header[i], header[i+1])
+		}
+		return checkPreconditions(r, name)
+	}
+
+	NoError(t, check(name))
+	NoError(t, check(name, "If-Match", fileETag(fi)))
+	NoError(t, check(name, "If-Match", `"x", `+fileETag(fi)))
+	NoError(t, check(name, "If-Match", `"3a6eb0790f39ac87c94f3856b2dd2c5d"`))
+	NoError(t, check(name, "If-Match", "*"))
+	ErrorIs(t, check(name, "If-Match", `"x"`), errPreconditionFailed)
+	ErrorIs(t, check(name, "If-Match", "W/"+fileETag(fi)), errPreconditionFailed)
+	ErrorIs(t, check(name+".new", "If-Match", "*"), errPreconditionFailed)
+
+	NoError(t, check(name, "If-Unmodified-Since", mtime.Format(http.TimeFormat)))
+	ErrorIs(t, check(name, "If-Unmodified-Since", mtime.Add(-time.Second).Format(http.TimeFormat)), errPreconditionFailed)
+	NoError(t, check(name, "If-Unmodified-Since", "yesterday"))
+	NoError(t, check(name+".new", "If-Unmodified-Since", mtime.Add(-time.Second).Format(http.TimeFormat)))
+	NoError(t, check(name, "If-Match", "*", "If-Unmodified-Since", mtime.Add(-time.Second).Format(http.TimeFormat)))
+
+	// uploads of content, which the file has already, can be skipped
+	ErrorIs(t, check(name, "If-None-Match", `"sha256:`+sumData+`"`), errPreconditionFailed)
+	ErrorIs(t, check(name, "If-None-Match", `"3a6eb0790f39ac87c94f3856b2dd2c5d"`), errPreconditionFailed)
+	ErrorIs(t, check(name, "If-None-Match", "*"), errPreconditionFailed)
+	NoError(t, check(name, "If-None-Match", `"sha256:`+strings.Repeat("0", 64)+`"`))
+	NoError(t, check(name+".new", "If-None-Match", "*"))
+	ErrorIs(t, check(name, "If-Match", "*", "If-None-Match", fileETag(fi)), errPreconditionFailed)
+}
+
+func Test_requirePreconditions(t *testing.T) {
+	dir := t.TempDir()
+	NoError(t, os.WriteFile(filepath.Join(dir, "a.txt"), []byte("data"), 0600))
+	h := requirePreconditions(app{ServerRoot: dir}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	for method, status := range map[string]int{
+		http.MethodPut:    http.StatusPreconditionFailed,
+		http.MethodDelete: http.StatusPreconditionFailed,
+		http.MethodGet:    http.StatusNoContent,
+	} {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(method, "/a.txt", nil)
+		r.Header.Set("If-Match", `"x"`)
+		h.ServeHTTP(w, r)
+		Equal(t, status, w.Code, method)
+	}
+}
+
+func Test_handleRequest_ETag(t *testing.T) {
+	dir := t.TempDir()
+	NoError(t, os.WriteFile(filepath.Join(dir, "a.txt"), []byte("data"), 0600))
+	a := app{ServerRoot: dir, EnableUpload: true}
+	h := handleRequest(a)
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/a.txt", nil))
+	etag := w.Header().Get("ETag")
+	NotEmpty(t, etag)
+
+	upload := func(ifMatch string) int {
+		r := httptest.NewRequest(http.MethodPost, "/", bytes.NewBufferString(
+			"--xxx\r\nContent-Disposition: form-data; name=\"file\"; filename=\"a.txt\"\r\n\r\nnew\r\n--xxx--\r\n"))
+		r.Header.Set("Content-Type", "multipart/form-data; boundary=xxx")
+		r.Header.Set("If-Match", ifMatch)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w.Code
+	}
+	Equal(t, http.StatusOK, upload(etag))
+	Equal(t, http.StatusPreconditionFailed, upload(etag))
+}
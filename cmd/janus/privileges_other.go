@@ -0,0 +1,38 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !unix
+
+package main
+
+// credentials are not supported on this platform.
+type credentials struct{}
+
+// lookupCredentials fails if a user or group is given.
+func lookupCredentials(usr, grp string) (*credentials, error) {
+	if usr != "" || grp != "" {
+		return nil, errNotSupported
+	}
+	return nil, nil
+}
+
+// apply is a no-op.
+func (c *credentials) apply() error {
+	return nil
+}
+
+// chroot is not supported on this platform.
+func chroot(string) error {
+	return errNotSupported
+}
@@ -0,0 +1,102 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"syscall"
+
+	"github.com/rs/zerolog/log"
+)
+
+// credentials identify the user and group the process switches to.
+type credentials struct {
+	uid, gid int
+}
+
+// lookupCredentials resolves the given user and group (names or numeric IDs).
+// If no group is given, the primary group of the user is used.
+// If neither is given, nil is returned.
+func lookupCredentials(usr, grp string) (*credentials, error) {
+	if usr == "" && grp == "" {
+		return nil, nil
+	}
+
+	c := &credentials{-1, -1}
+	if usr != "" {
+		u, err := user.Lookup(usr)
+		if err != nil {
+			if u, err = user.LookupId(usr); err != nil {
+				return nil, err
+			}
+		}
+		c.uid, _ = strconv.Atoi(u.Uid)
+		c.gid, _ = strconv.Atoi(u.Gid)
+	}
+	if grp != "" {
+		g, err := user.LookupGroup(grp)
+		if err != nil {
+			if g, err = user.LookupGroupId(grp); err != nil {
+				return nil, err
+			}
+		}
+		c.gid, _ = strconv.Atoi(g.Gid)
+	}
+	return c, nil
+}
+
+// apply switches the process to the user and group and clears supplementary groups.
+// Calling apply on nil credentials is a no-op.
+func (c *credentials) apply() error {
+	if c == nil {
+		return nil
+	}
+
+	// the group must be changed first, because it is not permitted after giving up root
+	if err := syscall.Setgroups([]int{c.gid}); err != nil {
+		return err
+	} else if err := syscall.Setgid(c.gid); err != nil {
+		return err
+	}
+	if c.uid >= 0 {
+		if err := syscall.Setuid(c.uid); err != nil {
+			return err
+		}
+	}
+
+	log.Info().Int("uid", syscall.Getuid()).Int("gid", syscall.Getgid()).Msg("Dropped privileges")
+	return nil
+}
+
+// chroot changes the root directory of the process to dir.
+// Afterwards, no file outside of dir can be accessed anymore.
+func chroot(dir string) error {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	} else if err = syscall.Chroot(abs); err != nil {
+		return err
+	} else if err = os.Chdir("/"); err != nil {
+		return err
+	}
+
+	log.Info().Str("dir", abs).Msg("Changed root directory")
+	return nil
+}
@@ -0,0 +1,238 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// progressHeader is the request header or query parameter, which identifies a multipart upload
+	// (as known from the nginx upload progress module).
+	progressHeader = "X-Progress-ID"
+	// progressRetention is the duration, for which the progress of a finished upload can be queried.
+	progressRetention = time.Minute
+	// progressMaxUploads is the maximum number of tracked uploads.
+	progressMaxUploads = 10000
+)
+
+// progressIDPattern matches the IDs of multipart uploads, which must not be guessable by others.
+var progressIDPattern = regexp.MustCompile(`^[0-9A-Za-z_-]{16,64}$`)
+
+// progressReport is the JSON representation of the progress of an upload.
+// The expected number of bytes is -1, if the client did not announce it.
+type progressReport struct {
+	ID       string    `json:"id"`
+	State    string    `json:"state"`
+	Received int64     `json:"received"`
+	Expected int64     `json:"expected"`
+	Updated  time.Time `json:"updated"`
+	Stalled  bool      `json:"stalled,omitempty"`
+}
+
+// progress tracks the bytes received by an upload.
+// The counters are updated atomically, because the body is read concurrently to queries.
+type progress struct {
+	id       string
+	expected int64
+	received int64
+	updated  int64
+	stalled  int32
+	// state is guarded by the mutex of uploadProgress.
+	state string
+	timer *time.Timer
+}
+
+// report returns the current progress.
+func (p *progress) report() progressReport {
+	return progressReport{ID: p.id, State: p.state, Received: atomic.LoadInt64(&p.received), Expected: p.expected,
+		Updated: time.Unix(0, atomic.LoadInt64(&p.updated)).UTC(), Stalled: atomic.LoadInt32(&p.stalled) == 1}
+}
+
+// progressBody counts the bytes read from a request body and restarts the stall timer.
+type progressBody struct {
+	io.ReadCloser
+	p            *progress
+	stallTimeout time.Duration
+}
+
+func (b progressBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 {
+		atomic.AddInt64(&b.p.received, int64(n))
+		atomic.StoreInt64(&b.p.updated, time.Now().UnixNano())
+		atomic.StoreInt32(&b.p.stalled, 0)
+		b.p.timer.Reset(b.stallTimeout)
+	}
+	return n, err
+}
+
+// uploadProgress tracks the bytes received by uploads in progress, so that clients can display the progress.
+// Uploads, which do not receive any data for stallTimeout, are logged and reported as stalled.
+type uploadProgress struct {
+	stallTimeout time.Duration
+	mu           sync.Mutex
+	uploads      map[string]*progress
+}
+
+// newUploadProgress creates a tracker of upload progress.
+// If the stall timeout is not positive, tracking is disabled and nil is returned.
+func newUploadProgress(stallTimeout time.Duration) *uploadProgress {
+	if stallTimeout <= 0 {
+		return nil
+	}
+	return &uploadProgress{stallTimeout: stallTimeout, uploads: map[string]*progress{}}
+}
+
+// start begins tracking an upload, which has received offset of expected bytes so far.
+// It returns nil, if the upload is tracked already or too many uploads are tracked.
+func (up *uploadProgress) start(r *http.Request, id string, offset, expected int64) *progress {
+	up.mu.Lock()
+	defer up.mu.Unlock()
+	if p, ok := up.uploads[id]; (ok && p.state == "uploading") || len(up.uploads) >= progressMaxUploads {
+		return nil
+	}
+
+	p := &progress{id: id, expected: expected, received: offset, updated: time.Now().UnixNano(), state: "uploading"}
+	p.timer = time.AfterFunc(up.stallTimeout, func() {
+		atomic.StoreInt32(&p.stalled, 1)
+		log.Warn().Str("request-id", requestIDFrom(r.Context())).Str("upload", id).
+			Int64("received", atomic.LoadInt64(&p.received)).Int64("expected", expected).
+			Dur("stall-timeout", up.stallTimeout).Msg("Upload stalled")
+	})
+	up.uploads[id] = p
+	return p
+}
+
+// finish stops tracking an upload and keeps its final state for progressRetention.
+func (up *uploadProgress) finish(p *progress, state string) {
+	p.timer.Stop()
+	up.mu.Lock()
+	p.state = state
+	up.mu.Unlock()
+
+	time.AfterFunc(progressRetention, func() {
+		up.mu.Lock()
+		defer up.mu.Unlock()
+		if up.uploads[p.id] == p {
+			delete(up.uploads, p.id)
+		}
+	})
+}
+
+// report returns the progress of an upload, if it is tracked.
+func (up *uploadProgress) report(id string) (progressReport, bool) {
+	up.mu.Lock()
+	defer up.mu.Unlock()
+	if p, ok := up.uploads[id]; ok {
+		return p.report(), true
+	}
+	return progressReport{}, false
+}
+
+// progressID returns the ID of the multipart upload given in the X-Progress-ID header or query parameter.
+func progressID(r *http.Request) (string, bool) {
+	id := r.Header.Get(progressHeader)
+	if id == "" {
+		id = r.URL.Query().Get(progressHeader)
+	}
+	return id, progressIDPattern.MatchString(id)
+}
+
+// trackProgress counts the bytes received by multipart uploads with an X-Progress-ID
+// and by PATCH requests of resumable uploads.
+// If tracking is disabled, h is returned as is.
+func trackProgress(a app, h http.Handler) http.Handler {
+	if a.progress == nil {
+		return h
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Body == nil || r.Body == http.NoBody {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		var p *progress
+		tus := r.Method == http.MethodPatch && a.uploads != nil && r.URL.Query().Get("tus") != ""
+		if id, ok := progressID(r); ok && r.Method == http.MethodPost {
+			p = a.progress.start(r, id, 0, r.ContentLength)
+		} else if tus {
+			if st, err := a.uploads.load(r.URL.Query().Get("tus")); err == nil {
+				p = a.progress.start(r, st.ID, st.Offset, st.Length)
+			}
+		}
+		if p == nil {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		r.Body = progressBody{r.Body, p, a.progress.stallTimeout}
+		crw := &ctxResponseWriter{http.StatusOK, time.Now(), w}
+		h.ServeHTTP(crw, r)
+
+		state := "done"
+		if crw.status >= http.StatusBadRequest {
+			state = "failed"
+		} else if tus && atomic.LoadInt64(&p.received) < p.expected {
+			state = "paused"
+		}
+		a.progress.finish(p, state)
+	})
+}
+
+// handleProgress reports the progress of the upload with the ID given in the path in JSON.
+// Resumable uploads, which are not in progress, are reported as paused.
+// Since the ID cannot be guessed, no authentication is required, just like for the upload itself.
+func handleProgress(a app) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := strings.TrimPrefix(r.URL.Path, apiPrefix+"progress/")
+		pr, ok := a.progress.report(id)
+		if !ok && a.uploads != nil {
+			st, err := a.uploads.load(id)
+			if errors.Is(err, errUnknownUpload) {
+				renderError(w, r, err, "unknown upload", http.StatusNotFound)
+				return
+			} else if err != nil {
+				renderError(w, r, err, "cannot load upload", http.StatusInternalServerError)
+				return
+			}
+			pr = progressReport{ID: st.ID, State: "paused", Received: st.Offset, Expected: st.Length}
+			if fi, err := os.Stat(a.uploads.partName(id)); err == nil {
+				pr.Updated = fi.ModTime().UTC()
+			}
+		} else if !ok {
+			renderError(w, r, errUnknownUpload, "unknown upload", http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		if err := json.NewEncoder(w).Encode(pr); err != nil {
+			log.Err(err).Msg("cannot render upload progress")
+		}
+	}
+}
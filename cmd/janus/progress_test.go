@@ -0,0 +1,116 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/stretchr/testify/require"
+)
+
+func Test_progressID(t *testing.T) {
+	r := httptest.NewRequest(http.MethodPost, "/?X-Progress-ID=0123456789abcdef", nil)
+	id, ok := progressID(r)
+	True(t, ok)
+	Equal(t, "0123456789abcdef", id)
+
+	r.Header.Set("X-Progress-ID", "too-short")
+	_, ok = progressID(r)
+	False(t, ok)
+	_, ok = progressID(httptest.NewRequest(http.MethodPost, "/?X-Progress-ID=../../0123456789abcdef", nil))
+	False(t, ok)
+}
+
+func Test_trackProgress(t *testing.T) {
+	a := app{progress: newUploadProgress(time.Hour)}
+	query := func(id string) (progressReport, int) {
+		w := httptest.NewRecorder()
+		handleAPI(a, http.NotFoundHandler()).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/_janus/progress/"+id, nil))
+		var pr progressReport
+		if w.Code == http.StatusOK {
+			NoError(t, json.NewDecoder(w.Body).Decode(&pr))
+		}
+		return pr, w.Code
+	}
+
+	h := trackProgress(a, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, err := io.CopyN(io.Discard, r.Body, 3)
+		NoError(t, err)
+		pr, status := query("0123456789abcdef")
+		Equal(t, http.StatusOK, status)
+		Equal(t, progressReport{ID: "0123456789abcdef", State: "uploading", Received: 3, Expected: 5, Updated: pr.Updated}, pr)
+		_, _ = io.Copy(io.Discard, r.Body)
+	}))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/?X-Progress-ID=0123456789abcdef", strings.NewReader("hello")))
+	pr, _ := query("0123456789abcdef")
+	Equal(t, "done", pr.State)
+	Equal(t, int64(5), pr.Received)
+
+	h = trackProgress(a, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/", strings.NewReader("hello")))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/?X-Progress-ID=fedcba9876543210", strings.NewReader("hello")))
+	pr, _ = query("fedcba9876543210")
+	Equal(t, "failed", pr.State)
+	Zero(t, pr.Received)
+
+	_, status := query("unknown-upload-id")
+	Equal(t, http.StatusNotFound, status)
+}
+
+func Test_trackProgress_Stalled(t *testing.T) {
+	a := app{progress: newUploadProgress(10 * time.Millisecond)}
+	h := trackProgress(a, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		Eventually(t, func() bool {
+			pr, _ := a.progress.report("0123456789abcdef")
+			return pr.Stalled
+		}, time.Second, time.Millisecond)
+		_, _ = io.Copy(io.Discard, r.Body)
+	}))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/?X-Progress-ID=0123456789abcdef", strings.NewReader("hello")))
+}
+
+func Test_handleProgress_Resumable(t *testing.T) {
+	u, err := newResumableUploads(t.TempDir(), time.Hour)
+	NoError(t, err)
+	st, err := u.create(uploadState{Path: "/big.iso", Length: 10})
+	NoError(t, err)
+	NoError(t, u.append(&st, strings.NewReader("hello")))
+
+	a := app{uploads: u, progress: newUploadProgress(time.Hour)}
+	w := httptest.NewRecorder()
+	handleProgress(a).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/_janus/progress/"+st.ID, nil))
+	Equal(t, http.StatusOK, w.Code)
+	var pr progressReport
+	NoError(t, json.NewDecoder(w.Body).Decode(&pr))
+	Equal(t, "paused", pr.State)
+	Equal(t, int64(5), pr.Received)
+	Equal(t, int64(10), pr.Expected)
+
+	h := trackProgress(a, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.CopyN(io.Discard, r.Body, 2)
+	}))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPatch, "/big.iso?tus="+st.ID, strings.NewReader("world")))
+	pr, _ = a.progress.report(st.ID)
+	Equal(t, "paused", pr.State)
+	Equal(t, int64(7), pr.Received)
+}
@@ -0,0 +1,325 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// errUnknownQuarantined indicates that there is no quarantined upload with the requested ID.
+var errUnknownQuarantined = errors.New("unknown quarantined upload")
+
+// quarantinedUpload describes an upload pending review.
+type quarantinedUpload struct {
+	ID   string    `json:"id"`
+	Root string    `json:"root"`
+	Path string    `json:"path"`
+	Size int64     `json:"size"`
+	User string    `json:"user,omitempty"`
+	Time time.Time `json:"time"`
+}
+
+// quarantine keeps uploads outside the server root until an admin approves or rejects them.
+type quarantine struct {
+	dir string
+}
+
+// newQuarantine creates the quarantine directory.
+func newQuarantine(dir string) (*quarantine, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &quarantine{dir: dir}, nil
+}
+
+// dataName returns the name of the file holding the uploaded data.
+func (qa *quarantine) dataName(id string) string {
+	return filepath.Join(qa.dir, id)
+}
+
+// stateName returns the name of the file describing an upload.
+func (qa *quarantine) stateName(id string) string {
+	return filepath.Join(qa.dir, id+".json")
+}
+
+// add stores the uploaded data along with its description.
+func (qa *quarantine) add(q quarantinedUpload, src io.Reader) (quarantinedUpload, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return q, err
+	}
+	q.ID, q.Time = hex.EncodeToString(b), time.Now().UTC()
+
+	f, err := os.OpenFile(qa.dataName(q.ID), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return q, err
+	}
+	if q.Size, err = io.Copy(f, src); err == nil {
+		err = f.Close()
+	} else {
+		_ = f.Close()
+	}
+	if err == nil {
+		err = qa.save(q)
+	}
+	if err != nil {
+		qa.remove(q.ID)
+	}
+	return q, err
+}
+
+// save persists the description of an upload atomically.
+func (qa *quarantine) save(q quarantinedUpload) error {
+	b, err := json.Marshal(q)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(qa.dir, ".state-*")
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(b); err == nil {
+		err = f.Close()
+	} else {
+		_ = f.Close()
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), qa.stateName(q.ID))
+	}
+	if err != nil {
+		_ = os.Remove(f.Name())
+	}
+	return err
+}
+
+// load reads the description of an upload.
+func (qa *quarantine) load(id string) (quarantinedUpload, error) {
+	var q quarantinedUpload
+	if _, err := hex.DecodeString(id); err != nil || len(id) != 32 {
+		return q, errUnknownQuarantined
+	}
+	b, err := os.ReadFile(qa.stateName(id))
+	if os.IsNotExist(err) {
+		return q, errUnknownQuarantined
+	} else if err != nil {
+		return q, err
+	}
+	return q, json.Unmarshal(b, &q)
+}
+
+// list returns all uploads pending review, the oldest first.
+func (qa *quarantine) list() ([]quarantinedUpload, error) {
+	names, err := filepath.Glob(filepath.Join(qa.dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	qs := []quarantinedUpload{}
+	for _, name := range names {
+		q, err := qa.load(strings.TrimSuffix(filepath.Base(name), ".json"))
+		if err != nil {
+			log.Warn().Err(err).Str("file", name).Msg("Cannot read quarantined upload")
+			continue
+		}
+		qs = append(qs, q)
+	}
+	sort.Slice(qs, func(i, j int) bool { return qs[i].Time.Before(qs[j].Time) })
+	return qs, nil
+}
+
+// remove deletes the description and the data of an upload.
+func (qa *quarantine) remove(id string) {
+	_ = os.Remove(qa.stateName(id))
+	_ = os.Remove(qa.dataName(id))
+}
+
+// approve moves the data of an upload to its destination and returns its path relative to the root,
+// which differs from the uploaded path, if the file was published as hashed asset or renamed in drop box mode.
+func (qa *quarantine) approve(a app, q quarantinedUpload) (string, error) {
+	name := filepath.Join(q.Root, filepath.FromSlash(q.Path))
+	if err := a.locks.check(name, nil, false); err != nil {
+		return "", err
+	} else if retained(name, a.Retention, time.Now()) {
+		return "", errRetained
+	}
+
+	dir := path.Dir(q.Path)
+	if a.assets.applies(strings.TrimSuffix(dir, "/") + "/") {
+		f, err := os.Open(qa.dataName(q.ID))
+		if err != nil {
+			return "", err
+		}
+		defer f.Close()
+		hashed, err := a.assets.publish(a, q.Root, filepath.Dir(name), filepath.Base(name), f)
+		if err != nil {
+			return "", err
+		}
+		qa.remove(q.ID)
+		return path.Join(dir, hashed), nil
+	}
+
+	if a.DropBox {
+		// submissions must not replace each other
+		f, err := createUnique(name)
+		if err != nil {
+			return "", err
+		}
+		_ = f.Close()
+		name = f.Name()
+	}
+	if err := moveFile(qa.dataName(q.ID), name); err != nil {
+		return "", err
+	} else if a.CAS {
+		if _, err := storeFile(q.Root, name); err != nil {
+			return "", err
+		}
+	}
+	qa.remove(q.ID)
+	return path.Join(dir, filepath.Base(name)), nil
+}
+
+// moveFile renames a file. If it resides on another file system, it is copied to a temporary file next to its
+// destination first, so that the destination is replaced atomically.
+func moveFile(src, dst string) error {
+	if err := os.Rename(src, dst); err == nil {
+		return nil
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.CreateTemp(filepath.Dir(dst), ".janus-move-*")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.Remove(out.Name()) }()
+	if _, err := io.Copy(out, in); err != nil {
+		_ = out.Close()
+		return err
+	} else if err := out.Chmod(0644); err != nil {
+		_ = out.Close()
+		return err
+	} else if err := out.Close(); err != nil {
+		return err
+	} else if err := os.Rename(out.Name(), dst); err != nil {
+		return err
+	}
+	return os.Remove(src)
+}
+
+// quarantineUpload stores an upload for review instead of its destination.
+func quarantineUpload(a app, w http.ResponseWriter, r *http.Request, name string, src io.Reader) {
+	q, err := a.quarantine.add(quarantinedUpload{Root: rootDir(a, r), Path: path.Join(r.URL.Path, name), User: userName(r)}, src)
+	if err != nil {
+		renderError(w, r, err, "cannot write file", http.StatusInternalServerError)
+		return
+	}
+
+	audit(r, "upload").Str("name", name).Str("id", q.ID).Int64("size", q.Size).Str("result", "quarantined").
+		Msg("File quarantined")
+	notifyChat(a, r, "quarantine", q.Path, q.Size)
+	w.WriteHeader(http.StatusAccepted)
+	_, _ = renderMsg(w, fmt.Sprintf(tr(r, "%s submitted for review."), name)+"\n")
+}
+
+// handleQuarantineList lists the uploads pending review in JSON.
+func handleQuarantineList(qa *quarantine) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET")
+			renderError(w, r, errMethodNotAllowed, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		qs, err := qa.list()
+		if err != nil {
+			renderError(w, r, err, "cannot list quarantined uploads", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(qs); err != nil {
+			log.Err(err).Msg("cannot render message")
+		}
+	}
+}
+
+// handleQuarantineReview serves the data of a quarantined upload for review (GET), or approves or rejects it
+// (POST with "action=approve|reject").
+func handleQuarantineReview(a app) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q, err := a.quarantine.load(path.Base(r.URL.Path))
+		if err != nil {
+			renderError(w, r, err, "unknown quarantined upload", http.StatusNotFound)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet, http.MethodHead:
+			w.Header().Set("Content-Disposition", `attachment; filename="`+url.PathEscape(path.Base(q.Path))+`"`)
+			http.ServeFile(w, r, a.quarantine.dataName(q.ID))
+			return
+		case http.MethodPost:
+		default:
+			w.Header().Set("Allow", "GET, POST")
+			renderError(w, r, errMethodNotAllowed, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		switch action := r.FormValue("action"); action {
+		case "approve":
+			p, err := a.quarantine.approve(a, q)
+			if errors.Is(err, errLocked) {
+				renderError(w, r, err, "resource is locked", http.StatusLocked)
+				return
+			} else if errors.Is(err, errRetained) {
+				renderError(w, r, err, "file cannot be overwritten during its retention period", http.StatusForbidden)
+				return
+			} else if err != nil {
+				renderError(w, r, err, "cannot approve upload", http.StatusConflict)
+				return
+			}
+			audit(r, "approve").Str("id", q.ID).Str("path", p).Str("uploader", q.User).Str("result", "ok").
+				Msg("Quarantined file approved")
+			a.sitemap.changed()
+			a.notifier.uploaded(r, externalURL(a, r, p), p, q.Size)
+			notifyChat(a, r, "upload", p, q.Size)
+		case "reject":
+			a.quarantine.remove(q.ID)
+			audit(r, "reject").Str("id", q.ID).Str("path", q.Path).Str("uploader", q.User).Str("result", "ok").
+				Msg("Quarantined file rejected")
+			notifyChat(a, r, "reject", q.Path, q.Size)
+		default:
+			renderError(w, r, fmt.Errorf("invalid action %q", action), "action must be approve or reject", http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,126 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	. "github.com/stretchr/testify/require"
+)
+
+func Test_quarantine(t *testing.T) {
+	dir := t.TempDir()
+	NoError(t, os.Mkdir(filepath.Join(dir, "inbox"), 0700))
+	qa, err := newQuarantine(t.TempDir())
+	NoError(t, err)
+	a := app{ServerRoot: dir, EnableUpload: true, DropBox: true, AdminToken: "secret", quarantine: qa}
+	h := handleRequest(a)
+	api := handleAPI(a, http.NotFoundHandler())
+
+	upload := func(data string) int {
+		r := httptest.NewRequest(http.MethodPost, "/inbox/", bytes.NewBufferString(
+			"--xxx\r\nContent-Disposition: form-data; name=\"file\"; filename=\"a.txt\"\r\n\r\n"+data+"\r\n--xxx--\r\n"))
+		r.Header.Set("Content-Type", "multipart/form-data; boundary=xxx")
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w.Code
+	}
+	admin := func(method, p string, form url.Values) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, adminPrefix+p, strings.NewReader(form.Encode()))
+		r.Header.Set("Authorization", "Bearer secret")
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		api.ServeHTTP(w, r)
+		return w
+	}
+
+	Equal(t, http.StatusAccepted, upload("one"))
+	Equal(t, http.StatusAccepted, upload("two"))
+	NoFileExists(t, filepath.Join(dir, "inbox", "a.txt"))
+
+	var qs []quarantinedUpload
+	w := admin(http.MethodGet, "quarantine", nil)
+	Equal(t, http.StatusOK, w.Code)
+	NoError(t, json.Unmarshal(w.Body.Bytes(), &qs))
+	Len(t, qs, 2)
+	Equal(t, "/inbox/a.txt", qs[0].Path)
+	Equal(t, int64(3), qs[0].Size)
+
+	w = admin(http.MethodGet, "quarantine/"+qs[0].ID, nil)
+	Equal(t, http.StatusOK, w.Code)
+	Equal(t, "one", w.Body.String())
+	Contains(t, w.Header().Get("Content-Disposition"), "a.txt")
+
+	Equal(t, http.StatusBadRequest, admin(http.MethodPost, "quarantine/"+qs[0].ID, url.Values{"action": {"delete"}}).Code)
+	Equal(t, http.StatusNoContent, admin(http.MethodPost, "quarantine/"+qs[0].ID, url.Values{"action": {"approve"}}).Code)
+	Equal(t, http.StatusNoContent, admin(http.MethodPost, "quarantine/"+qs[1].ID, url.Values{"action": {"reject"}}).Code)
+	Equal(t, http.StatusNotFound, admin(http.MethodPost, "quarantine/"+qs[1].ID, url.Values{"action": {"approve"}}).Code)
+
+	data, err := os.ReadFile(filepath.Join(dir, "inbox", "a.txt"))
+	NoError(t, err)
+	Equal(t, "one", string(data))
+	NoFileExists(t, filepath.Join(dir, "inbox", "a-1.txt"))
+	qs, err = qa.list()
+	NoError(t, err)
+	Empty(t, qs)
+	entries, err := os.ReadDir(qa.dir)
+	NoError(t, err)
+	Empty(t, entries)
+
+	// approved submissions do not replace each other in drop box mode
+	Equal(t, http.StatusAccepted, upload("three"))
+	qs, err = qa.list()
+	NoError(t, err)
+	Equal(t, http.StatusNoContent, admin(http.MethodPost, "quarantine/"+qs[0].ID, url.Values{"action": {"approve"}}).Code)
+	FileExists(t, filepath.Join(dir, "inbox", "a-1.txt"))
+
+	r := httptest.NewRequest(http.MethodGet, adminPrefix+"quarantine", nil)
+	w = httptest.NewRecorder()
+	api.ServeHTTP(w, r)
+	Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func Test_moveFile(t *testing.T) {
+	dir := t.TempDir()
+	src, dst := filepath.Join(dir, "src"), filepath.Join(dir, "dst")
+	NoError(t, os.WriteFile(src, []byte("data"), 0600))
+	NoError(t, moveFile(src, dst))
+	NoFileExists(t, src)
+	FileExists(t, dst)
+	Error(t, moveFile(src, dst))
+}
+
+func Test_checkConfig_Quarantine(t *testing.T) {
+	a := app{ServerRoot: t.TempDir(), ListenAddress: ":0", EnableUpload: true, AdminToken: "s3cr3t",
+		QuarantineDir: t.TempDir(), CAS: true}
+	errs := checkConfig(a)
+	Len(t, errs, 1)
+	EqualError(t, errs[0], "quarantine-dir: quarantine cannot be combined with resumable uploads, appending, Maven deployments or content-addressable storage")
+
+	a.CAS, a.Chroot = false, true
+	errs = checkConfig(a)
+	Len(t, errs, 1)
+	EqualError(t, errs[0], "quarantine-dir: quarantine cannot be combined with chroot")
+	_, rw := sandboxDirs(a)
+	Contains(t, rw, a.QuarantineDir)
+}
@@ -0,0 +1,112 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// replayOptions holds the options of the replay command.
+type replayOptions struct {
+	Target string `long:"target" description:"base URL of the instance to send the requests to e.g., \"http://localhost:8080\"" required:"true"`
+	Args   struct {
+		Files []string `positional-arg-name:"file" description:"captured request or directory of captured requests" required:"1"`
+	} `positional-args:"true"`
+}
+
+// runReplay sends the captured requests in chronological order to the target, reports the responses
+// and returns the exit code.
+func runReplay(o replayOptions, stdout, stderr io.Writer) int {
+	names, err := capturedFiles(o.Args.Files)
+	if err != nil {
+		_, _ = fmt.Fprintln(stderr, err)
+		return 1
+	}
+
+	c := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	code := 0
+	for _, name := range names {
+		start := time.Now()
+		res, err := replay(c, o.Target, name)
+		if err != nil {
+			_, _ = fmt.Fprintf(stderr, "%s: %v\n", name, err)
+			code = 1
+			continue
+		}
+		_, _ = fmt.Fprintf(stdout, "%s\t%s\t%s\t%d\t%s\n", filepath.Base(name), res.Request.Method,
+			res.Request.URL.RequestURI(), res.StatusCode, time.Since(start).Round(time.Millisecond))
+	}
+	return code
+}
+
+// capturedFiles expands directories to the captured requests they contain, sorted by name.
+func capturedFiles(args []string) (names []string, err error) {
+	for _, a := range args {
+		fi, err := os.Stat(a)
+		if err != nil {
+			return nil, err
+		} else if !fi.IsDir() {
+			names = append(names, a)
+			continue
+		}
+		ns, err := filepath.Glob(filepath.Join(a, "*.http"))
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, ns...)
+	}
+	return names, nil
+}
+
+// replay sends the captured request to the target. The response body is discarded.
+// Captured requests with truncated bodies are sent with the truncated body.
+func replay(c *http.Client, target, name string) (*http.Response, error) {
+	f, err := os.Open(filepath.Clean(name))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	cr, err := http.ReadRequest(bufio.NewReader(f))
+	if err != nil {
+		return nil, err
+	}
+	body, err := io.ReadAll(cr.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := http.NewRequest(cr.Method, strings.TrimRight(target, "/")+cr.RequestURI, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	r.Header = cr.Header.Clone()
+	r.Header.Del("Content-Length")
+	r.Header.Del(captureTruncatedHeader)
+	res, err := c.Do(r)
+	if err != nil {
+		return nil, err
+	}
+	_, _ = io.Copy(io.Discard, res.Body)
+	return res, res.Body.Close()
+}
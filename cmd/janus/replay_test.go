@@ -0,0 +1,81 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	. "github.com/stretchr/testify/require"
+)
+
+func Test_capturedFiles(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"2.http", "1.http", "notes.txt"} {
+		NoError(t, os.WriteFile(filepath.Join(dir, name), nil, 0600))
+	}
+
+	names, err := capturedFiles([]string{dir, filepath.Join(dir, "notes.txt")})
+	NoError(t, err)
+	Equal(t, []string{
+		filepath.Join(dir, "1.http"), filepath.Join(dir, "2.http"), filepath.Join(dir, "notes.txt"),
+	}, names)
+
+	_, err = capturedFiles([]string{filepath.Join(dir, "missing")})
+	Error(t, err)
+}
+
+func Test_runReplay(t *testing.T) {
+	var got []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		got = append(got, r.Method+" "+r.RequestURI+" "+r.Header.Get("Authorization")+" "+string(b)+" "+
+			r.Header.Get(captureTruncatedHeader))
+		if r.Method == http.MethodGet {
+			http.Redirect(w, r, "/elsewhere", http.StatusFound)
+		}
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	NoError(t, os.WriteFile(filepath.Join(dir, "1.http"), []byte("PUT /a.txt?x=1 HTTP/1.1\r\nHost: example.com\r\n"+
+		"Authorization: Bearer secret\r\nContent-Length: 4\r\n"+captureTruncatedHeader+": true\r\n\r\nabcd"), 0600))
+	NoError(t, os.WriteFile(filepath.Join(dir, "2.http"), []byte("GET /b/ HTTP/1.1\r\nHost: example.com\r\n\r\n"), 0600))
+	NoError(t, os.WriteFile(filepath.Join(dir, "3.http"), []byte("garbage"), 0600))
+
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	o := replayOptions{Target: srv.URL + "/"}
+	o.Args.Files = []string{dir}
+	Equal(t, 1, runReplay(o, stdout, stderr))
+	Equal(t, []string{"PUT /a.txt?x=1 Bearer secret abcd ", "GET /b/   "}, got)
+
+	lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+	Len(t, lines, 2)
+	True(t, strings.HasPrefix(lines[0], "1.http\tPUT\t/a.txt?x=1\t200\t"), lines[0])
+	True(t, strings.HasPrefix(lines[1], "2.http\tGET\t/b/\t302\t"), lines[1])
+	Contains(t, stderr.String(), "3.http: ")
+
+	o.Args.Files = []string{filepath.Join(dir, "1.http")}
+	stdout.Reset()
+	stderr.Reset()
+	Equal(t, 0, runReplay(o, stdout, stderr))
+	Empty(t, stderr.String())
+}
@@ -0,0 +1,276 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	// errInvalidArchiveEntry indicates that an archive entry would be written outside its destination.
+	errInvalidArchiveEntry = errors.New("invalid archive entry")
+	// errConflict indicates that a restored file exists already.
+	errConflict = errors.New("file exists")
+)
+
+// restoreOptions holds the options of the restore command.
+type restoreOptions struct {
+	Merge    bool   `long:"merge" description:"import into a server root, which is not empty, instead of requiring an empty one"`
+	Conflict string `long:"conflict" description:"how to handle files, which exist already when merging" choice:"skip" choice:"overwrite" choice:"rename" choice:"fail" default:"skip"`
+	Metadata string `long:"metadata" description:"directory to extract the configuration and the files referenced by it to (default: not extracted)"`
+	Args     struct {
+		Archive string `positional-arg-name:"archive" description:"archive (tar.gz) created by \"janus backup\", or \"-\" for stdin"`
+	} `positional-args:"true" required:"true"`
+}
+
+// restoreStats summarizes a restore.
+type restoreStats struct {
+	files   int
+	bytes   int64
+	skipped int
+	renamed int
+}
+
+// runRestore extracts an archive created by runBackup into the server root and returns the exit code.
+func runRestore(a app, stdin io.Reader, stdout, stderr io.Writer) int {
+	o := a.restore
+	if !o.Merge {
+		if es, err := os.ReadDir(a.ServerRoot); err == nil && len(es) > 0 {
+			_, _ = fmt.Fprintf(stderr, "server root %s is not empty (consider --merge)\n", a.ServerRoot)
+			return 1
+		}
+	}
+
+	r := stdin
+	if o.Args.Archive != "-" {
+		f, err := os.Open(o.Args.Archive)
+		if err != nil {
+			_, _ = fmt.Fprintln(stderr, err)
+			return 1
+		}
+		defer f.Close()
+		r = f
+	}
+
+	st, err := restore(r, a.ServerRoot, o.Metadata, o.Conflict)
+	if err != nil {
+		_, _ = fmt.Fprintln(stderr, err)
+		return 1
+	}
+	_, _ = fmt.Fprintf(stdout, "Restored %d files (%d bytes) to %s, skipped %d, renamed %d\n",
+		st.files, st.bytes, a.ServerRoot, st.skipped, st.renamed)
+	return 0
+}
+
+// restore extracts the entries below "root/" into root, and the ones below "janus/" into meta, if set.
+// Files, which exist already, are handled according to the conflict policy.
+func restore(r io.Reader, root, meta, conflict string) (restoreStats, error) {
+	var st restoreStats
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return st, err
+	}
+	tr := tar.NewReader(zr)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return st, nil
+		} else if err != nil {
+			return st, err
+		}
+
+		dest, base, ok := root, "root", true
+		rel, found := cutPrefix(hdr.Name, "root")
+		if !found {
+			dest, base = meta, "janus"
+			rel, ok = cutPrefix(hdr.Name, "janus")
+		}
+		if !ok {
+			return st, fmt.Errorf("%w: %s", errInvalidArchiveEntry, hdr.Name)
+		} else if dest == "" || rel == "" {
+			continue
+		}
+		// symbolic links restored before may redirect the entry, hence its parent is resolved
+		name := filepath.Join(dest, filepath.FromSlash(rel))
+		parent, err := resolveBelow(dest, filepath.Dir(name))
+		if err != nil {
+			return st, fmt.Errorf("%w: %s", err, hdr.Name)
+		}
+		name = filepath.Join(parent, filepath.Base(name))
+		// only the content of the server root is counted
+		cnt := &st
+		if base == "janus" {
+			cnt = &restoreStats{}
+		}
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(name, hdr.FileInfo().Mode().Perm()|0700); err != nil {
+				return st, err
+			}
+		case tar.TypeSymlink:
+			// the target is cleaned, so that ".." elements only refer to ancestors of the resolved parent,
+			// hence links restored later cannot climb out of the destination via this one
+			link := path.Clean(hdr.Linkname)
+			if path.IsAbs(link) {
+				return st, fmt.Errorf("%w: %s -> %s", errInvalidArchiveEntry, hdr.Name, hdr.Linkname)
+			} else if _, err := resolveBelow(dest, filepath.Join(parent, filepath.FromSlash(link))); err != nil {
+				return st, fmt.Errorf("%w: %s -> %s", err, hdr.Name, hdr.Linkname)
+			}
+			err = restoreFile(cnt, name, 0, conflict, func(n string) error { return os.Symlink(link, n) })
+		case tar.TypeLink:
+			lrel, ok := cutPrefix(hdr.Linkname, base)
+			if !ok || lrel == "" {
+				return st, fmt.Errorf("%w: %s -> %s", errInvalidArchiveEntry, hdr.Name, hdr.Linkname)
+			}
+			target := filepath.Join(dest, filepath.FromSlash(lrel))
+			var tp string
+			if tp, err = resolveBelow(dest, filepath.Dir(target)); err != nil {
+				return st, fmt.Errorf("%w: %s -> %s", err, hdr.Name, hdr.Linkname)
+			}
+			target = filepath.Join(tp, filepath.Base(target))
+			err = restoreFile(cnt, name, 0, conflict, func(n string) error { return os.Link(target, n) })
+		case tar.TypeReg:
+			err = restoreFile(cnt, name, hdr.Size, conflict, func(n string) error { return writeEntry(n, tr, hdr) })
+		}
+		if err != nil {
+			return st, err
+		}
+	}
+}
+
+// resolveBelow resolves the symbolic links of the named path and reports errInvalidArchiveEntry,
+// unless the result is located below root. Missing elements are kept as they are, since they cannot be links.
+func resolveBelow(root, name string) (string, error) {
+	r, err := resolveExisting(root)
+	if err != nil {
+		return "", err
+	}
+	p, err := resolveExisting(name)
+	if err != nil {
+		return "", err
+	}
+	if rel, err := filepath.Rel(r, p); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", errInvalidArchiveEntry
+	}
+	return p, nil
+}
+
+// resolveExisting resolves the symbolic links of the longest existing ancestor of the named path
+// and appends the missing elements.
+func resolveExisting(name string) (string, error) {
+	name, rest := filepath.Clean(name), ""
+	for {
+		r, err := filepath.EvalSymlinks(name)
+		if err == nil {
+			return filepath.Join(r, rest), nil
+		} else if parent := filepath.Dir(name); !errors.Is(err, os.ErrNotExist) || parent == name {
+			return "", err
+		} else {
+			rest = filepath.Join(filepath.Base(name), rest)
+			name = parent
+		}
+	}
+}
+
+// restoreFile creates the named file of the given size via create,
+// unless it exists and the conflict policy says otherwise.
+func restoreFile(st *restoreStats, name string, size int64, conflict string, create func(string) error) error {
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return err
+	}
+	if _, err := os.Lstat(name); err == nil {
+		switch conflict {
+		case "skip":
+			st.skipped++
+			return nil
+		case "overwrite":
+			tmp := filepath.Join(filepath.Dir(name), ".janus-restore-"+filepath.Base(name))
+			_ = os.Remove(tmp)
+			if err := create(tmp); err != nil {
+				return err
+			}
+			st.files++
+			st.bytes += size
+			return os.Rename(tmp, name)
+		case "rename":
+			f, err := createUnique(name)
+			if err != nil {
+				return err
+			}
+			_ = f.Close()
+			if err := os.Remove(f.Name()); err != nil {
+				return err
+			} else if err := create(f.Name()); err != nil {
+				return err
+			}
+			st.files++
+			st.bytes += size
+			st.renamed++
+			return nil
+		default:
+			return fmt.Errorf("%w: %s", errConflict, name)
+		}
+	}
+	if err := create(name); err != nil {
+		return err
+	}
+	st.files++
+	st.bytes += size
+	return nil
+}
+
+// writeEntry writes the content of the current archive entry to the named file and restores its mode and time.
+func writeEntry(name string, r io.Reader, hdr *tar.Header) error {
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL|oNoFollow, hdr.FileInfo().Mode().Perm()|0200)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if _, err := io.Copy(f, r); err != nil {
+		_ = os.Remove(name)
+		return err
+	} else if err := f.Chmod(hdr.FileInfo().Mode().Perm()); err != nil {
+		return err
+	} else if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Chtimes(name, hdr.ModTime, hdr.ModTime)
+}
+
+// cutPrefix returns the path of an archive entry relative to the given top-level directory.
+// It reports false, if the entry is not located below it or its path is not clean.
+func cutPrefix(name, dir string) (string, bool) {
+	name = strings.TrimSuffix(name, "/")
+	if name == dir {
+		return "", true
+	} else if !strings.HasPrefix(name, dir+"/") {
+		return "", false
+	}
+	rel := strings.TrimPrefix(name, dir+"/")
+	if path.Clean(rel) != rel || rel == ".." || strings.HasPrefix(rel, "../") || path.IsAbs(rel) {
+		return "", false
+	}
+	return rel, true
+}
@@ -0,0 +1,204 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/stretchr/testify/require"
+)
+
+// archiveOf creates a backup of the directory tree.
+func archiveOf(t *testing.T, root string) []byte {
+	buf := &bytes.Buffer{}
+	_, err := backup(app{ServerRoot: root}, buf)
+	NoError(t, err)
+	return buf.Bytes()
+}
+
+func Test_restore(t *testing.T) {
+	src := t.TempDir()
+	NoError(t, os.MkdirAll(filepath.Join(src, "docs"), 0700))
+	NoError(t, os.WriteFile(filepath.Join(src, "docs", "a.txt"), []byte("data"), 0600))
+	NoError(t, os.Link(filepath.Join(src, "docs", "a.txt"), filepath.Join(src, "docs", "b.txt")))
+	NoError(t, os.Symlink("a.txt", filepath.Join(src, "docs", "c.txt")))
+	b := archiveOf(t, src)
+
+	root, meta := filepath.Join(t.TempDir(), "root"), t.TempDir()
+	st, err := restore(bytes.NewReader(b), root, meta, "fail")
+	NoError(t, err)
+	Equal(t, restoreStats{files: 3, bytes: 4}, st)
+
+	for _, name := range []string{"a.txt", "b.txt", "c.txt"} {
+		d, err := os.ReadFile(filepath.Join(root, "docs", name))
+		NoError(t, err)
+		Equal(t, "data", string(d))
+	}
+	fa, err := os.Stat(filepath.Join(root, "docs", "a.txt"))
+	NoError(t, err)
+	fb, err := os.Stat(filepath.Join(root, "docs", "b.txt"))
+	NoError(t, err)
+	True(t, os.SameFile(fa, fb))
+	afi, err := os.Stat(filepath.Join(src, "docs", "a.txt"))
+	NoError(t, err)
+	WithinDuration(t, afi.ModTime(), fa.ModTime(), time.Second)
+	FileExists(t, filepath.Join(meta, "config.txt"))
+}
+
+func Test_restore_Conflict(t *testing.T) {
+	src := t.TempDir()
+	NoError(t, os.WriteFile(filepath.Join(src, "a.txt"), []byte("new"), 0600))
+	NoError(t, os.WriteFile(filepath.Join(src, "b.txt"), []byte("new"), 0600))
+	b := archiveOf(t, src)
+
+	prepare := func() string {
+		root := t.TempDir()
+		NoError(t, os.WriteFile(filepath.Join(root, "a.txt"), []byte("old"), 0600))
+		return root
+	}
+	content := func(name string) string {
+		d, err := os.ReadFile(name)
+		NoError(t, err)
+		return string(d)
+	}
+
+	root := prepare()
+	st, err := restore(bytes.NewReader(b), root, "", "skip")
+	NoError(t, err)
+	Equal(t, restoreStats{files: 1, bytes: 3, skipped: 1}, st)
+	Equal(t, "old", content(filepath.Join(root, "a.txt")))
+	Equal(t, "new", content(filepath.Join(root, "b.txt")))
+
+	root = prepare()
+	_, err = restore(bytes.NewReader(b), root, "", "overwrite")
+	NoError(t, err)
+	Equal(t, "new", content(filepath.Join(root, "a.txt")))
+
+	root = prepare()
+	st, err = restore(bytes.NewReader(b), root, "", "rename")
+	NoError(t, err)
+	Equal(t, 1, st.renamed)
+	Equal(t, "old", content(filepath.Join(root, "a.txt")))
+	Equal(t, "new", content(filepath.Join(root, "a-1.txt")))
+
+	root = prepare()
+	_, err = restore(bytes.NewReader(b), root, "", "fail")
+	ErrorIs(t, err, errConflict)
+}
+
+func Test_restore_InvalidEntry(t *testing.T) {
+	for _, hdr := range []*tar.Header{
+		{Name: "root/../evil.txt", Typeflag: tar.TypeReg},
+		{Name: "/etc/evil.txt", Typeflag: tar.TypeReg},
+		{Name: "root/link", Typeflag: tar.TypeSymlink, Linkname: "../../etc"},
+		{Name: "root/link", Typeflag: tar.TypeSymlink, Linkname: "/etc"},
+		{Name: "root/hard", Typeflag: tar.TypeLink, Linkname: "/etc/passwd"},
+	} {
+		buf := &bytes.Buffer{}
+		zw := gzip.NewWriter(buf)
+		tw := tar.NewWriter(zw)
+		NoError(t, tw.WriteHeader(hdr))
+		NoError(t, tw.Close())
+		NoError(t, zw.Close())
+
+		root := t.TempDir()
+		_, err := restore(buf, root, "", "fail")
+		ErrorIs(t, err, errInvalidArchiveEntry, hdr.Name)
+		es, err := os.ReadDir(root)
+		NoError(t, err)
+		Empty(t, es)
+	}
+}
+
+func Test_restore_SymlinkChain(t *testing.T) {
+	buf := &bytes.Buffer{}
+	zw := gzip.NewWriter(buf)
+	tw := tar.NewWriter(zw)
+	for _, hdr := range []*tar.Header{
+		{Name: "root/a/b", Typeflag: tar.TypeSymlink, Linkname: ".."},
+		{Name: "root/a/b/c", Typeflag: tar.TypeSymlink, Linkname: ".."},
+		{Name: "root/c/escaped", Typeflag: tar.TypeReg, Mode: 0600, Size: 4},
+	} {
+		NoError(t, tw.WriteHeader(hdr))
+		if hdr.Typeflag == tar.TypeReg {
+			_, err := tw.Write([]byte("evil"))
+			NoError(t, err)
+		}
+	}
+	NoError(t, tw.Close())
+	NoError(t, zw.Close())
+
+	parent := t.TempDir()
+	root := filepath.Join(parent, "root")
+	_, err := restore(buf, root, "", "fail")
+	ErrorIs(t, err, errInvalidArchiveEntry)
+	NoFileExists(t, filepath.Join(parent, "c", "escaped"))
+	es, err := os.ReadDir(parent)
+	NoError(t, err)
+	Len(t, es, 1)
+}
+
+func Test_resolveBelow(t *testing.T) {
+	root := t.TempDir()
+	NoError(t, os.Symlink("..", filepath.Join(root, "up")))
+	p, err := resolveBelow(root, filepath.Join(root, "a", "b"))
+	NoError(t, err)
+	r, err := filepath.EvalSymlinks(root)
+	NoError(t, err)
+	Equal(t, filepath.Join(r, "a", "b"), p)
+
+	_, err = resolveBelow(root, filepath.Join(root, "up", "x"))
+	ErrorIs(t, err, errInvalidArchiveEntry)
+	_, err = resolveBelow(root, filepath.Join(root, ".."))
+	ErrorIs(t, err, errInvalidArchiveEntry)
+}
+
+func Test_runRestore(t *testing.T) {
+	src := t.TempDir()
+	NoError(t, os.WriteFile(filepath.Join(src, "a.txt"), []byte("data"), 0600))
+	b := archiveOf(t, src)
+
+	a := app{ServerRoot: t.TempDir()}
+	a.restore.Args.Archive = "-"
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	Equal(t, 0, runRestore(a, bytes.NewReader(b), stdout, stderr))
+	Equal(t, "Restored 1 files (4 bytes) to "+a.ServerRoot+", skipped 0, renamed 0\n", stdout.String())
+
+	Equal(t, 1, runRestore(a, bytes.NewReader(b), stdout, stderr))
+	Contains(t, stderr.String(), "consider --merge")
+
+	a.restore.Merge, a.restore.Conflict = true, "skip"
+	stdout.Reset()
+	Equal(t, 0, runRestore(a, bytes.NewReader(b), stdout, stderr))
+	Contains(t, stdout.String(), "skipped 1")
+}
+
+func Test_cutPrefix(t *testing.T) {
+	for name, want := range map[string]string{"root": "", "root/": "", "root/a/b.txt": "a/b.txt", "root/dir/": "dir"} {
+		rel, ok := cutPrefix(name, "root")
+		True(t, ok, name)
+		Equal(t, want, rel, name)
+	}
+	for _, name := range []string{"rooted/a", "janus/a", "root/../a", "root/a/../../b", "root//a", "root/./a"} {
+		_, ok := cutPrefix(name, "root")
+		False(t, ok, name)
+	}
+}
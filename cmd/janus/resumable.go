@@ -0,0 +1,474 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// uploadsDir is the directory below the server root, in which the state of resumable uploads is kept.
+const uploadsDir = ".janus-uploads"
+
+// tusVersion is the supported version of the tus protocol for resumable uploads (https://tus.io/protocols/resumable-upload).
+const tusVersion = "1.0.0"
+
+var (
+	errInvalidUpload = errors.New("invalid upload")
+	errUnknownUpload = errors.New("unknown upload")
+	errUploadOffset  = errors.New("upload offset mismatch")
+)
+
+// uploadState describes an upload in progress.
+// It is persisted, so that uploads can be resumed after a restart.
+type uploadState struct {
+	ID      string    `json:"id"`
+	Root    string    `json:"root"`
+	Path    string    `json:"path"`
+	Length  int64     `json:"length"`
+	Offset  int64     `json:"offset"`
+	Expires time.Time `json:"expires"`
+	User    string    `json:"user,omitempty"`
+}
+
+// resumableUploads stores the state and the data received so far of resumable uploads.
+type resumableUploads struct {
+	dir    string
+	expiry time.Duration
+	now    func() time.Time
+	mu     sync.Mutex
+	busy   map[string]bool
+}
+
+// newResumableUploads creates the directory for resumable uploads below root.
+// Uploads, which are not completed within expiry, are discarded.
+func newResumableUploads(root string, expiry time.Duration) (*resumableUploads, error) {
+	dir := filepath.Join(root, uploadsDir)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &resumableUploads{dir: dir, expiry: expiry, now: time.Now, busy: map[string]bool{}}, nil
+}
+
+// partName returns the name of the file holding the data received so far.
+func (u *resumableUploads) partName(id string) string {
+	return filepath.Join(u.dir, id+".part")
+}
+
+// stateName returns the name of the file holding the state of an upload.
+func (u *resumableUploads) stateName(id string) string {
+	return filepath.Join(u.dir, id+".json")
+}
+
+// create starts a new upload and persists its state.
+func (u *resumableUploads) create(st uploadState) (uploadState, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return st, err
+	}
+	st.ID, st.Offset, st.Expires = hex.EncodeToString(b), 0, u.now().Add(u.expiry).UTC()
+
+	f, err := os.OpenFile(u.partName(st.ID), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return st, err
+	} else if err = f.Close(); err == nil {
+		err = u.save(st)
+	}
+	if err != nil {
+		u.remove(st.ID)
+	}
+	return st, err
+}
+
+// load reads the state of an upload.
+// Expired uploads are removed and errUnknownUpload is returned.
+func (u *resumableUploads) load(id string) (uploadState, error) {
+	var st uploadState
+	if _, err := hex.DecodeString(id); err != nil || len(id) != 32 {
+		return st, errUnknownUpload
+	}
+
+	b, err := os.ReadFile(u.stateName(id))
+	if os.IsNotExist(err) {
+		return st, errUnknownUpload
+	} else if err != nil {
+		return st, err
+	} else if err = json.Unmarshal(b, &st); err != nil {
+		return st, err
+	} else if u.now().After(st.Expires) {
+		u.remove(id)
+		return st, errUnknownUpload
+	}
+
+	// the data may have been written without updating the state, if the server crashed
+	if fi, err := os.Stat(u.partName(id)); err != nil {
+		return st, err
+	} else if fi.Size() != st.Offset {
+		st.Offset = fi.Size()
+	}
+	return st, nil
+}
+
+// save persists the state of an upload atomically.
+func (u *resumableUploads) save(st uploadState) error {
+	b, err := json.Marshal(st)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(u.dir, ".state-*")
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(b); err == nil {
+		err = f.Close()
+	} else {
+		_ = f.Close()
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), u.stateName(st.ID))
+	}
+	if err != nil {
+		_ = os.Remove(f.Name())
+	}
+	return err
+}
+
+// remove deletes the state and the data of an upload.
+func (u *resumableUploads) remove(id string) {
+	_ = os.Remove(u.stateName(id))
+	_ = os.Remove(u.partName(id))
+}
+
+// acquire marks an upload as busy and reports whether it was idle.
+// Hence, only one request at a time can append data.
+func (u *resumableUploads) acquire(id string) bool {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.busy[id] {
+		return false
+	}
+	u.busy[id] = true
+	return true
+}
+
+// release marks an upload as idle.
+func (u *resumableUploads) release(id string) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	delete(u.busy, id)
+}
+
+// append writes the data read from r to the upload and persists the new offset.
+// The data received before an error is kept, so that the client can resume the upload.
+func (u *resumableUploads) append(st *uploadState, r io.Reader) error {
+	f, err := os.OpenFile(u.partName(st.ID), os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	n, err := io.Copy(f, io.LimitReader(r, st.Length-st.Offset))
+	if serr := f.Sync(); err == nil {
+		err = serr
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	st.Offset += n
+	if serr := u.save(*st); err == nil {
+		err = serr
+	}
+	return err
+}
+
+// sweep removes expired uploads, data without state and interrupted writes of the state older than age.
+// It returns the number of files and bytes reclaimed. If u is nil, nothing is removed.
+func (u *resumableUploads) sweep(now time.Time, age time.Duration) (files int, size int64) {
+	if u == nil {
+		return 0, 0
+	}
+	es, err := os.ReadDir(u.dir)
+	if err != nil {
+		return 0, 0
+	}
+
+	for _, e := range es {
+		fi, err := e.Info()
+		if err != nil || !fi.Mode().IsRegular() {
+			continue
+		}
+		remove := now.Sub(fi.ModTime()) > age
+		id := strings.TrimSuffix(e.Name(), filepath.Ext(e.Name()))
+
+		switch {
+		case strings.HasPrefix(e.Name(), ".state-"):
+		case strings.HasSuffix(e.Name(), ".part"):
+			remove = remove && !exists(u.stateName(id))
+		case strings.HasSuffix(e.Name(), ".json"):
+			remove = u.expired(id, now, remove) && u.acquire(id)
+			if remove {
+				if pi, err := os.Stat(u.partName(id)); err == nil && os.Remove(u.partName(id)) == nil {
+					files, size = files+1, size+pi.Size()
+				}
+				u.release(id)
+			}
+		default:
+			remove = false
+		}
+		if remove && os.Remove(filepath.Join(u.dir, e.Name())) == nil {
+			files, size = files+1, size+fi.Size()
+		}
+	}
+	return files, size
+}
+
+// expired reports whether the upload has expired.
+// If the state cannot be read, the upload is considered expired, if the state file is old.
+func (u *resumableUploads) expired(id string, now time.Time, old bool) bool {
+	var st uploadState
+	b, err := os.ReadFile(u.stateName(id))
+	if err == nil {
+		err = json.Unmarshal(b, &st)
+	}
+	if err != nil {
+		return old
+	}
+	return now.After(st.Expires)
+}
+
+// parseUploadMetadata parses the Upload-Metadata header, which consists of
+// comma-separated pairs of keys and base64-encoded values.
+func parseUploadMetadata(s string) (map[string]string, error) {
+	md := map[string]string{}
+	for _, kv := range strings.Split(s, ",") {
+		if kv = strings.TrimSpace(kv); kv == "" {
+			continue
+		}
+		k, v, _ := strings.Cut(kv, " ")
+		b, err := base64.StdEncoding.DecodeString(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid metadata %q", k)
+		}
+		md[k] = string(b)
+	}
+	return md, nil
+}
+
+// handleResumableUpload implements the core protocol and the creation extension of tus.
+// An upload is created by a POST request to a directory, and its data is sent by PATCH requests to the
+// returned location, i.e., the target file with the "tus" query parameter. HEAD reports the offset to resume from.
+func handleResumableUpload(a app) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Tus-Resumable", tusVersion)
+		if r.Header.Get("Tus-Resumable") != tusVersion {
+			w.Header().Set("Tus-Version", tusVersion)
+			renderError(w, r, errInvalidUpload, "unsupported version of the tus protocol", http.StatusPreconditionFailed)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodPost:
+			createUpload(a, w, r)
+			return
+		case http.MethodHead, http.MethodPatch:
+		default:
+			w.Header().Set("Allow", "HEAD, PATCH, POST")
+			renderError(w, r, errMethodNotAllowed, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		st, err := a.uploads.load(r.URL.Query().Get("tus"))
+		if err == nil && (st.Path != r.URL.Path || st.Root != rootDir(a, r) || st.User != userName(r)) {
+			err = errUnknownUpload
+		}
+		if errors.Is(err, errUnknownUpload) {
+			renderError(w, r, err, "unknown upload", http.StatusNotFound)
+			return
+		} else if err != nil {
+			renderError(w, r, err, "cannot load upload", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Upload-Length", strconv.FormatInt(st.Length, 10))
+		w.Header().Set("Upload-Expires", st.Expires.Format(http.TimeFormat))
+		if r.Method == http.MethodPatch {
+			appendUpload(a, w, r, &st)
+			return
+		}
+		w.Header().Set("Upload-Offset", strconv.FormatInt(st.Offset, 10))
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// createUpload starts a resumable upload of the file named in the metadata to the requested directory.
+func createUpload(a app, w http.ResponseWriter, r *http.Request) {
+	length, err := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+	if err != nil || length < 0 {
+		renderError(w, r, errInvalidUpload, "invalid upload length", http.StatusBadRequest)
+		return
+	}
+	md, err := parseUploadMetadata(r.Header.Get("Upload-Metadata"))
+	if err != nil {
+		renderError(w, r, fmt.Errorf("%w: %v", errInvalidUpload, err), "invalid upload metadata", http.StatusBadRequest)
+		return
+	}
+	name := path.Base("/" + md["filename"])
+	p := path.Join(r.URL.Path, name)
+	if name == "/" {
+		renderError(w, r, errInvalidUpload, "missing file name", http.StatusBadRequest)
+		return
+	} else if name == "." || name == ".." {
+		renderError(w, r, errInvalidUpload, "invalid file name", http.StatusBadRequest)
+		return
+	} else if a.EnableAccessFiles && name == accessFileName {
+		renderError(w, r, errAccessDenied, "access files cannot be uploaded", http.StatusForbidden)
+		return
+	} else if internalPath(p) {
+		renderError(w, r, errInternalPath, "invalid file name", http.StatusForbidden)
+		return
+	}
+
+	if !checkTarget(a, w, r, filepath.Join(rootDir(a, r), p)) {
+		return
+	}
+
+	st, err := a.uploads.create(uploadState{Root: rootDir(a, r), Path: p, Length: length, User: userName(r)})
+	if err != nil {
+		renderError(w, r, err, "cannot create upload", http.StatusInternalServerError)
+		return
+	}
+	audit(r, "upload").Str("name", name).Str("id", st.ID).Int64("size", length).Str("result", "started").Msg("Resumable upload started")
+
+	loc := url.URL{Path: path.Join(a.Prefix, p), RawQuery: "tus=" + st.ID}
+	w.Header().Set("Location", loc.String())
+	w.Header().Set("Upload-Expires", st.Expires.Format(http.TimeFormat))
+	if length == 0 {
+		if err := completeUpload(a, r, st); err != nil {
+			renderUploadError(w, r, st.Path, err)
+			return
+		}
+	}
+	w.WriteHeader(http.StatusCreated)
+}
+
+// appendUpload writes the request body to the upload and completes it, once all data has been received.
+func appendUpload(a app, w http.ResponseWriter, r *http.Request, st *uploadState) {
+	if r.Header.Get("Content-Type") != "application/offset+octet-stream" {
+		renderError(w, r, errInvalidUpload, "invalid content type", http.StatusUnsupportedMediaType)
+		return
+	} else if off, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64); err != nil || off != st.Offset {
+		renderError(w, r, errUploadOffset, "upload offset mismatch", http.StatusConflict)
+		return
+	} else if !a.uploads.acquire(st.ID) {
+		renderError(w, r, errUploadOffset, "upload is in progress", http.StatusConflict)
+		return
+	}
+	defer a.uploads.release(st.ID)
+
+	if err := a.uploads.append(st, r.Body); errors.Is(err, errUploadTooSlow) {
+		w.Header().Set("Connection", "close")
+		renderError(w, r, err, "upload too slow", http.StatusRequestTimeout)
+		return
+	} else if err != nil {
+		renderError(w, r, err, "cannot write file", http.StatusInternalServerError)
+		return
+	}
+
+	if st.Offset == st.Length {
+		if !checkTarget(a, w, r, filepath.Join(st.Root, st.Path)) {
+			return
+		} else if err := completeUpload(a, r, *st); err != nil {
+			renderUploadError(w, r, st.Path, err)
+			return
+		}
+	}
+	w.Header().Set("Upload-Offset", strconv.FormatInt(st.Offset, 10))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// checkTarget reports whether the target file of an upload may be written.
+// Otherwise, an error is sent.
+func checkTarget(a app, w http.ResponseWriter, r *http.Request, name string) bool {
+	if err := a.locks.check(name, lockTokens(r), false); err != nil {
+		renderError(w, r, err, "resource is locked", http.StatusLocked)
+		return false
+	} else if err := checkPreconditions(r, name); err != nil {
+		renderError(w, r, err, "the file was modified in the meantime", http.StatusPreconditionFailed)
+		return false
+	} else if retained(name, a.Retention, time.Now()) {
+		audit(r, "upload").Str("name", filepath.Base(name)).Str("result", "denied").Msg("Overwrite denied by retention")
+		renderError(w, r, errRetained, "file cannot be overwritten during its retention period", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// completeUpload moves the received data to the target file and removes the state of the upload.
+// Uploads blocked by the content inspection service are discarded.
+func completeUpload(a app, r *http.Request, st uploadState) error {
+	name := filepath.Join(st.Root, st.Path)
+	if a.icap != nil {
+		f, err := os.Open(a.uploads.partName(st.ID))
+		if err != nil {
+			return err
+		}
+		err = a.icap.inspect(r, st.Path, f)
+		_ = f.Close()
+		if errors.Is(err, errContentBlocked) {
+			a.uploads.remove(st.ID)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if err := os.Rename(a.uploads.partName(st.ID), name); err != nil {
+		return err
+	}
+	a.uploads.remove(st.ID)
+	if a.CAS {
+		if _, err := storeFile(st.Root, name); err != nil {
+			log.Err(err).Str("name", name).Msg("Cannot store file in content-addressable storage")
+		}
+	}
+
+	audit(r, "upload").Str("name", path.Base(st.Path)).Str("id", st.ID).Int64("size", st.Length).Str("result", "ok").Msg("File uploaded")
+	a.sitemap.changed()
+	a.notifier.uploaded(r, externalURL(a, r, st.Path), st.Path, st.Length)
+	notifyChat(a, r, "upload", st.Path, st.Length)
+	return nil
+}
+
+// userName returns the name of the authenticated user, if any.
+func userName(r *http.Request) string {
+	if id := identityFrom(r.Context()); id != nil {
+		return id.name
+	}
+	return ""
+}
@@ -0,0 +1,179 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/stretchr/testify/require"
+)
+
+func Test_parseUploadMetadata(t *testing.T) {
+	md, err := parseUploadMetadata("filename d29ybGQudHh0, is_confidential,filetype dGV4dC9wbGFpbg==")
+	NoError(t, err)
+	Equal(t, map[string]string{"filename": "world.txt", "is_confidential": "", "filetype": "text/plain"}, md)
+
+	_, err = parseUploadMetadata("filename !")
+	EqualError(t, err, `invalid metadata "filename"`)
+}
+
+func Test_resumableUploads(t *testing.T) {
+	root := t.TempDir()
+	u, err := newResumableUploads(root, time.Hour)
+	NoError(t, err)
+
+	st, err := u.create(uploadState{Root: root, Path: "/a.bin", Length: 10})
+	NoError(t, err)
+	Len(t, st.ID, 32)
+	NoError(t, u.append(&st, strings.NewReader("01234")))
+	Equal(t, int64(5), st.Offset)
+
+	// the state survives a restart
+	u, err = newResumableUploads(root, time.Hour)
+	NoError(t, err)
+	loaded, err := u.load(st.ID)
+	NoError(t, err)
+	Equal(t, st, loaded)
+
+	// data written without updating the state is kept
+	f, err := os.OpenFile(u.partName(st.ID), os.O_WRONLY|os.O_APPEND, 0600)
+	NoError(t, err)
+	_, _ = f.WriteString("56")
+	NoError(t, f.Close())
+	loaded, err = u.load(st.ID)
+	NoError(t, err)
+	Equal(t, int64(7), loaded.Offset)
+
+	NoError(t, u.append(&loaded, strings.NewReader("789 and more")))
+	Equal(t, int64(10), loaded.Offset)
+	b, err := os.ReadFile(u.partName(st.ID))
+	NoError(t, err)
+	Equal(t, "0123456789", string(b))
+
+	u.now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+	_, err = u.load(st.ID)
+	ErrorIs(t, err, errUnknownUpload)
+	NoFileExists(t, u.partName(st.ID))
+	_, err = u.load("../../etc/passwd")
+	ErrorIs(t, err, errUnknownUpload)
+
+	True(t, u.acquire("x"))
+	False(t, u.acquire("x"))
+	u.release("x")
+	True(t, u.acquire("x"))
+}
+
+func Test_handleResumableUpload(t *testing.T) {
+	root := t.TempDir()
+	uploads, err := newResumableUploads(root, time.Hour)
+	NoError(t, err)
+	a := app{ServerRoot: root, EnableUpload: true, Prefix: "/files/", uploads: uploads}
+	serve := func(method, target, body string, header ...string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, target, strings.NewReader(body))
+		r.Header.Set("Tus-Resumable", tusVersion)
+		for i := 0; i < len(header); i += 2 {
+			r.Header.Set(header[i], header[i+1])
+		}
+		w := httptest.NewRecorder()
+		handleRequest(a).ServeHTTP(w, r)
+		return w
+	}
+
+	md := "filename " + base64.StdEncoding.EncodeToString([]byte("big.iso"))
+	w := serve(http.MethodPost, "/", "", "Upload-Length", "10", "Upload-Metadata", md)
+	Equal(t, http.StatusCreated, w.Code)
+	loc := w.Header().Get("Location")
+	True(t, strings.HasPrefix(loc, "/files/big.iso?tus="), loc)
+	target := strings.TrimPrefix(loc, "/files")
+
+	w = serve(http.MethodPatch, target, "01234", "Content-Type", "application/offset+octet-stream", "Upload-Offset", "0")
+	Equal(t, http.StatusNoContent, w.Code)
+	Equal(t, "5", w.Header().Get("Upload-Offset"))
+
+	// restart
+	a.uploads, err = newResumableUploads(root, time.Hour)
+	NoError(t, err)
+	w = serve(http.MethodHead, target, "")
+	Equal(t, http.StatusOK, w.Code)
+	Equal(t, "5", w.Header().Get("Upload-Offset"))
+	Equal(t, "10", w.Header().Get("Upload-Length"))
+
+	Equal(t, http.StatusConflict, serve(http.MethodPatch, target, "x", "Content-Type", "application/offset+octet-stream", "Upload-Offset", "4").Code)
+	Equal(t, http.StatusUnsupportedMediaType, serve(http.MethodPatch, target, "x", "Upload-Offset", "5").Code)
+	Equal(t, http.StatusNotFound, serve(http.MethodHead, "/other.iso"+strings.TrimPrefix(target, "/big.iso"), "").Code)
+	Equal(t, http.StatusNotFound, serve(http.MethodHead, "/big.iso?tus=0123", "").Code)
+	Equal(t, http.StatusPreconditionFailed, serve(http.MethodHead, target, "", "Tus-Resumable", "0.2.2").Code)
+	NoFileExists(t, filepath.Join(root, "big.iso"))
+
+	w = serve(http.MethodPatch, target, "56789", "Content-Type", "application/offset+octet-stream", "Upload-Offset", "5")
+	Equal(t, http.StatusNoContent, w.Code)
+	Equal(t, "10", w.Header().Get("Upload-Offset"))
+	b, err := os.ReadFile(filepath.Join(root, "big.iso"))
+	NoError(t, err)
+	Equal(t, "0123456789", string(b))
+	Equal(t, http.StatusNotFound, serve(http.MethodHead, target, "").Code)
+
+	Equal(t, http.StatusBadRequest, serve(http.MethodPost, "/", "", "Upload-Length", "-1", "Upload-Metadata", md).Code)
+	Equal(t, http.StatusBadRequest, serve(http.MethodPost, "/", "", "Upload-Length", "1").Code)
+	for name, status := range map[string]int{".": http.StatusBadRequest, "..": http.StatusBadRequest, uploadsDir: http.StatusForbidden} {
+		md := "filename " + base64.StdEncoding.EncodeToString([]byte(name))
+		Equal(t, status, serve(http.MethodPost, "/", "", "Upload-Length", "1", "Upload-Metadata", md).Code, name)
+	}
+	Equal(t, http.StatusCreated, serve(http.MethodPost, "/", "", "Upload-Length", "0", "Upload-Metadata", md).Code)
+	b, err = os.ReadFile(filepath.Join(root, "big.iso"))
+	NoError(t, err)
+	Empty(t, b)
+}
+
+func Test_resumableUploads_sweep(t *testing.T) {
+	root := t.TempDir()
+	u, err := newResumableUploads(root, time.Hour)
+	NoError(t, err)
+	now := time.Now()
+
+	u.now = func() time.Time { return now.Add(-2 * time.Hour) }
+	expired, err := u.create(uploadState{Length: 10})
+	NoError(t, err)
+	NoError(t, u.append(&expired, strings.NewReader("01234")))
+	u.now = time.Now
+	active, err := u.create(uploadState{Length: 10})
+	NoError(t, err)
+	old := now.Add(-2 * time.Hour)
+	for _, name := range []string{"0123.part", ".state-1", ".state-2"} {
+		NoError(t, os.WriteFile(filepath.Join(u.dir, name), []byte("x"), 0600))
+	}
+	NoError(t, os.Chtimes(filepath.Join(u.dir, "0123.part"), old, old))
+	NoError(t, os.Chtimes(filepath.Join(u.dir, ".state-1"), old, old))
+
+	files, _ := u.sweep(now, time.Hour)
+	Equal(t, 4, files)
+	NoFileExists(t, u.stateName(expired.ID))
+	NoFileExists(t, u.partName(expired.ID))
+	FileExists(t, u.stateName(active.ID))
+	FileExists(t, u.partName(active.ID))
+	NoFileExists(t, filepath.Join(u.dir, ".state-1"))
+	FileExists(t, filepath.Join(u.dir, ".state-2"))
+
+	files, size := (*resumableUploads)(nil).sweep(now, 0)
+	Zero(t, files)
+	Zero(t, size)
+}
@@ -0,0 +1,34 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"os"
+	"time"
+)
+
+// errRetained indicates that a file cannot be modified, because its retention period has not expired yet.
+var errRetained = errors.New("file under retention")
+
+// retained reports whether the named file is younger than the retention period.
+// Directories and files, which do not exist, are never retained.
+func retained(name string, retention time.Duration, now time.Time) bool {
+	if retention <= 0 {
+		return false
+	}
+	fi, err := os.Stat(name)
+	return err == nil && !fi.IsDir() && now.Before(fi.ModTime().Add(retention))
+}
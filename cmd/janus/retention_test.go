@@ -0,0 +1,48 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/stretchr/testify/require"
+)
+
+func Test_retained(t *testing.T) {
+	d := t.TempDir()
+	name := filepath.Join(d, "a.txt")
+	NoError(t, os.WriteFile(name, []byte("a"), 0600))
+	mod := time.Now().Add(-time.Hour)
+	NoError(t, os.Chtimes(name, mod, mod))
+
+	False(t, retained(name, 0, time.Now()))
+	True(t, retained(name, 2*time.Hour, time.Now()))
+	False(t, retained(name, 30*time.Minute, time.Now()))
+	False(t, retained(filepath.Join(d, "missing"), time.Hour, time.Now()))
+	False(t, retained(d, time.Hour, time.Now()))
+}
+
+func Test_handleDelete_Retention(t *testing.T) {
+	a := app{ServerRoot: t.TempDir(), Retention: time.Hour}
+	NoError(t, os.WriteFile(filepath.Join(a.ServerRoot, "a.txt"), []byte("a"), 0600))
+
+	w := serveDelete(a, "/a.txt")
+	Equal(t, http.StatusForbidden, w.Code)
+	FileExists(t, filepath.Join(a.ServerRoot, "a.txt"))
+}
@@ -0,0 +1,74 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// robotsPolicy determines the robots.txt served to crawlers: "disallow-all", "allow-all" or "file=<name>".
+type robotsPolicy string
+
+// UnmarshalFlag validates the robots policy.
+func (rp *robotsPolicy) UnmarshalFlag(v string) error {
+	if v != "disallow-all" && v != "allow-all" && (!strings.HasPrefix(v, "file=") || v == "file=") {
+		return fmt.Errorf("invalid robots policy %q (must be disallow-all, allow-all or file=<name>)", v)
+	}
+	*rp = robotsPolicy(v)
+	return nil
+}
+
+// content returns the robots.txt according to the policy. If no policy is set, nil is returned.
+func (rp robotsPolicy) content() ([]byte, error) {
+	switch {
+	case rp == "":
+		return nil, nil
+	case rp == "disallow-all":
+		return []byte("User-agent: *\nDisallow: /\n"), nil
+	case rp == "allow-all":
+		return []byte("User-agent: *\nDisallow:\n"), nil
+	default:
+		return os.ReadFile(filepath.Clean(strings.TrimPrefix(string(rp), "file=")))
+	}
+}
+
+// handleRobots serves the robots.txt at the root of the host and the prefix, which takes precedence over
+// a robots.txt in the server root. If noIndex is set, all responses ask search engines not to index them.
+// If neither is configured, h is returned as is.
+func handleRobots(robots []byte, noIndex bool, prefix string, h http.Handler) http.Handler {
+	if robots == nil && !noIndex {
+		return h
+	}
+
+	start := time.Now()
+	prefixed := strings.TrimRight(prefix, "/") + "/robots.txt"
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if noIndex {
+			w.Header().Set("X-Robots-Tag", "noindex, nofollow")
+		}
+		if robots != nil && (r.URL.Path == "/robots.txt" || r.URL.Path == prefixed) {
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			http.ServeContent(w, r, "", start, bytes.NewReader(robots))
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,90 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/stretchr/testify/require"
+)
+
+func Test_robotsPolicy_UnmarshalFlag(t *testing.T) {
+	var rp robotsPolicy
+	NoError(t, rp.UnmarshalFlag("disallow-all"))
+	Equal(t, robotsPolicy("disallow-all"), rp)
+	NoError(t, rp.UnmarshalFlag("allow-all"))
+	NoError(t, rp.UnmarshalFlag("file=robots.txt"))
+
+	Error(t, rp.UnmarshalFlag("file="))
+	Error(t, rp.UnmarshalFlag("deny-all"))
+}
+
+func Test_robotsPolicy_content(t *testing.T) {
+	b, err := robotsPolicy("").content()
+	NoError(t, err)
+	Nil(t, b)
+
+	b, err = robotsPolicy("disallow-all").content()
+	NoError(t, err)
+	Equal(t, "User-agent: *\nDisallow: /\n", string(b))
+
+	b, err = robotsPolicy("allow-all").content()
+	NoError(t, err)
+	Equal(t, "User-agent: *\nDisallow:\n", string(b))
+
+	name := filepath.Join(t.TempDir(), "robots.txt")
+	NoError(t, os.WriteFile(name, []byte("User-agent: Googlebot\nDisallow: /private/\n"), 0600))
+	b, err = robotsPolicy("file=" + name).content()
+	NoError(t, err)
+	Equal(t, "User-agent: Googlebot\nDisallow: /private/\n", string(b))
+
+	_, err = robotsPolicy("file=" + name + ".missing").content()
+	Error(t, err)
+}
+
+func Test_handleRobots(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "next")
+	})
+	h := handleRobots(nil, false, "/", next)
+	Equal(t, "next", getRobots(h, "/robots.txt").Body.String())
+
+	robots := []byte("User-agent: *\nDisallow: /\n")
+	h = handleRobots(robots, false, "/files/", next)
+	for _, p := range []string{"/robots.txt", "/files/robots.txt"} {
+		rec := getRobots(h, p)
+		Equal(t, http.StatusOK, rec.Code)
+		Equal(t, "text/plain; charset=utf-8", rec.Header().Get("Content-Type"))
+		Equal(t, string(robots), rec.Body.String())
+		Empty(t, rec.Header().Get("X-Robots-Tag"))
+	}
+	Equal(t, "next", getRobots(h, "/files/a/robots.txt").Body.String())
+
+	h = handleRobots(nil, true, "/", next)
+	rec := getRobots(h, "/robots.txt")
+	Equal(t, "next", rec.Body.String())
+	Equal(t, "noindex, nofollow", rec.Header().Get("X-Robots-Tag"))
+}
+
+func getRobots(h http.Handler, p string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, p, nil))
+	return rec
+}
@@ -0,0 +1,189 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	permDelete = "delete"
+	permShare  = "share"
+)
+
+// role grants permissions to a principal for all paths matching any of the patterns.
+type role struct {
+	principal string
+	perms     []string
+	patterns  []string
+}
+
+// pathRoles reports whether any of the roles is restricted to path patterns.
+func pathRoles(roles []role) bool {
+	for _, r := range roles {
+		if len(r.patterns) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// parseRoles parses roles of the form "<principal> <permission>[,<permission>...] [<path pattern>...]".
+// The principal is a user name, a group name prefixed with "@" or "public" for everyone.
+// Permissions are read, write, delete and share.
+// Path patterns are matched by matchPath. If none is given, the role applies to all paths.
+func parseRoles(specs []string) ([]role, error) {
+	roles := make([]role, len(specs))
+	for i, spec := range specs {
+		fs := strings.Fields(spec)
+		if len(fs) < 2 {
+			return nil, fmt.Errorf("invalid role: %q", spec)
+		}
+
+		perms := strings.Split(fs[1], ",")
+		for _, p := range perms {
+			if p != permRead && p != permWrite && p != permDelete && p != permShare {
+				return nil, fmt.Errorf("invalid permission %q in role (must be read, write, delete or share): %q", p, spec)
+			}
+		}
+		roles[i] = role{principal: fs[0], perms: perms, patterns: fs[2:]}
+	}
+	return roles, nil
+}
+
+// permits reports whether the role grants the permission for the path to the identity (nil means anonymous).
+func (ro role) permits(perm, p string, id *identity) bool {
+	if !id.is(ro.principal) || len(ro.patterns) > 0 && !matchPath(ro.patterns, p) {
+		return false
+	}
+	for _, rp := range ro.perms {
+		if rp == perm {
+			return true
+		}
+	}
+	return false
+}
+
+// permitted reports whether any of the roles grants the permission for the path to the identity.
+func permitted(roles []role, perm, p string, id *identity) bool {
+	for _, ro := range roles {
+		if ro.permits(perm, p, id) {
+			return true
+		}
+	}
+	return false
+}
+
+// operation returns the permission needed for a request.
+func operation(r *http.Request) string {
+	q := r.URL.Query()
+	_, upload := q["upload"]
+	_, share := q["share"]
+	_, tus := q["tus"]
+	switch {
+	case r.Method == http.MethodDelete:
+		return permDelete
+	case r.Method == http.MethodPost || r.Method == http.MethodPut || r.Method == http.MethodPatch || r.Method == "LOCK" || r.Method == "UNLOCK" || upload || tus:
+		return permWrite
+	case share:
+		return permShare
+	default:
+		return permRead
+	}
+}
+
+// uploadEnabled reports whether files can be uploaded, either by everyone or according to the roles.
+func uploadEnabled(a app) bool {
+	return a.EnableUpload || a.DropBox || len(a.roles) > 0
+}
+
+// publicRole reports whether the roles explicitly permit the request for anonymous clients.
+func publicRole(a app, r *http.Request) bool {
+	return permitted(a.roles, operation(r), r.URL.Path, nil)
+}
+
+// authorizeRoles permits requests only if a role grants the required permission to the client.
+// Otherwise, "403 Forbidden" is sent.
+// If there are no roles, h is returned as is.
+func authorizeRoles(a app, h http.Handler) http.Handler {
+	if len(a.roles) == 0 {
+		return h
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := identityFrom(r.Context())
+		perm := operation(r)
+		if permitted(a.roles, perm, r.URL.Path, id) {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		name := ""
+		if id != nil {
+			name = id.name
+		}
+		log.Warn().Str("request-id", requestIDFrom(r.Context())).Str("user", name).Str("permission", perm).
+			Str("path", r.URL.Path).Msg("Access denied by role")
+		renderError(w, r, errAccessDenied, "access denied", http.StatusForbidden)
+	})
+}
+
+// handleDelete removes a file or an empty directory.
+func handleDelete(a app) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if path.Clean(r.URL.Path) == "/" {
+			renderError(w, r, errAccessDenied, "root directory cannot be deleted", http.StatusForbidden)
+			return
+		}
+
+		p := filepath.Join(rootDir(a, r), r.URL.Path)
+		if retained(p, a.Retention, time.Now()) {
+			audit(r, "delete").Str("result", "denied").Msg("Deletion denied by retention")
+			renderError(w, r, errRetained, "file cannot be deleted during its retention period", http.StatusForbidden)
+			return
+		}
+
+		var size int64
+		if fi, err := os.Stat(p); err == nil && !fi.IsDir() {
+			size = fi.Size()
+		}
+		if err := os.Remove(p); errors.Is(err, os.ErrNotExist) {
+			renderError(w, r, err, "file not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			renderError(w, r, err, "cannot delete file", http.StatusConflict)
+			return
+		}
+
+		name := path.Base(r.URL.Path)
+		if e, ok := r.Context().Value(logger).(*zerolog.Event); ok {
+			e.Str("name", name)
+		}
+		audit(r, "delete").Str("result", "ok").Msg("File deleted")
+		a.sitemap.changed()
+		notifyChat(a, r, "delete", r.URL.Path, size)
+		_, _ = renderMsg(w, fmt.Sprintf(tr(r, "%s deleted successfully."), name)+"\n")
+	}
+}
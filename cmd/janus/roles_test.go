@@ -0,0 +1,116 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/stretchr/testify/require"
+)
+
+func Test_parseRoles(t *testing.T) {
+	roles, err := parseRoles([]string{"public read", "@staff read,write,delete /team/ /pub/*.txt"})
+	NoError(t, err)
+	Equal(t, []role{
+		{principal: "public", perms: []string{"read"}, patterns: []string{}},
+		{principal: "@staff", perms: []string{"read", "write", "delete"}, patterns: []string{"/team/", "/pub/*.txt"}},
+	}, roles)
+
+	for _, spec := range []string{"alice", "alice rw", "alice read,admin"} {
+		_, err = parseRoles([]string{spec})
+		Error(t, err, spec)
+	}
+}
+
+func Test_permitted(t *testing.T) {
+	roles, err := parseRoles([]string{"public read /pub/", "@staff read,write /team/", "alice delete,share"})
+	NoError(t, err)
+	alice := &identity{name: "alice"}
+	bob := &identity{name: "bob", groups: []string{"staff"}}
+
+	True(t, permitted(roles, permRead, "/pub/a.txt", nil))
+	False(t, permitted(roles, permRead, "/team/a.txt", nil))
+	True(t, permitted(roles, permRead, "/team/a.txt", bob))
+	True(t, permitted(roles, permWrite, "/team/", bob))
+	False(t, permitted(roles, permWrite, "/pub/", bob))
+	False(t, permitted(roles, permDelete, "/team/a.txt", bob))
+	True(t, permitted(roles, permDelete, "/team/a.txt", alice))
+	True(t, permitted(roles, permShare, "/a.txt", alice))
+	False(t, permitted(roles, permRead, "/a.txt", alice))
+}
+
+func Test_operation(t *testing.T) {
+	Equal(t, permRead, operation(httptest.NewRequest(http.MethodGet, "/a.txt", nil)))
+	Equal(t, permRead, operation(httptest.NewRequest(http.MethodHead, "/a.txt", nil)))
+	Equal(t, permWrite, operation(httptest.NewRequest(http.MethodGet, "/dir/?upload", nil)))
+	Equal(t, permWrite, operation(httptest.NewRequest(http.MethodPost, "/dir/", nil)))
+	Equal(t, permWrite, operation(httptest.NewRequest(http.MethodPut, "/dir/a.jar", nil)))
+	Equal(t, permDelete, operation(httptest.NewRequest(http.MethodDelete, "/a.txt", nil)))
+	Equal(t, permShare, operation(httptest.NewRequest(http.MethodGet, "/a.txt?share", nil)))
+}
+
+func Test_authorizeRoles(t *testing.T) {
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	a := app{}
+	ah := authorizeRoles(a, h)
+	serve := func(r *http.Request) int {
+		w := httptest.NewRecorder()
+		ah.ServeHTTP(w, r)
+		return w.Code
+	}
+	Equal(t, http.StatusOK, serve(httptest.NewRequest(http.MethodPost, "/", nil)))
+
+	var err error
+	a.roles, err = parseRoles([]string{"public read", "@staff write"})
+	NoError(t, err)
+	ah = authorizeRoles(a, h)
+	r := httptest.NewRequest(http.MethodPost, "/", nil)
+	Equal(t, http.StatusOK, serve(httptest.NewRequest(http.MethodGet, "/a.txt", nil)))
+	Equal(t, http.StatusForbidden, serve(r))
+	Equal(t, http.StatusForbidden, serve(withIdentity(r, &identity{name: "alice"})))
+	Equal(t, http.StatusOK, serve(withIdentity(r, &identity{name: "bob", groups: []string{"staff"}})))
+	Equal(t, http.StatusForbidden, serve(httptest.NewRequest(http.MethodDelete, "/a.txt", nil)))
+}
+
+func Test_handleDelete(t *testing.T) {
+	a := app{ServerRoot: t.TempDir()}
+	NoError(t, os.MkdirAll(filepath.Join(a.ServerRoot, "dir", "sub"), 0700))
+	NoError(t, os.WriteFile(filepath.Join(a.ServerRoot, "dir", "a.txt"), []byte("a"), 0600))
+
+	serve := func(p string) *httptest.ResponseRecorder {
+		return serveDelete(a, p)
+	}
+
+	w := serve("/dir/a.txt")
+	Equal(t, http.StatusOK, w.Code)
+	Equal(t, "a.txt deleted successfully.\n", w.Body.String())
+	NoFileExists(t, filepath.Join(a.ServerRoot, "dir", "a.txt"))
+	Equal(t, http.StatusNotFound, serve("/dir/a.txt").Code)
+	Equal(t, http.StatusConflict, serve("/dir").Code)
+	Equal(t, http.StatusForbidden, serve("/").Code)
+	Equal(t, http.StatusOK, serve("/dir/sub/").Code)
+	NoDirExists(t, filepath.Join(a.ServerRoot, "dir", "sub"))
+}
+
+// serveDelete sends a DELETE request for the path to handleDelete.
+func serveDelete(a app, p string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	handleDelete(a).ServeHTTP(w, httptest.NewRequest(http.MethodDelete, p, nil))
+	return w
+}
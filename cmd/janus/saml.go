@@ -0,0 +1,176 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/crewjam/saml"
+	"github.com/crewjam/saml/samlsp"
+	"github.com/rs/zerolog/log"
+)
+
+// samlAuth authenticates users via SAML 2.0 (SP-initiated SSO) and maps their attributes to roles.
+type samlAuth struct {
+	sp        *samlsp.Middleware
+	attribute string
+	// roles maps attribute values to the access they grant (true means read-write).
+	roles map[string]bool
+}
+
+// newSAMLAuth creates a SAML service provider, whose endpoints are served below "/_janus/saml/".
+// The identity provider metadata is either read from a file or fetched from a URL.
+// If no identity provider is configured, nil is returned.
+func newSAMLAuth(a app) (*samlAuth, error) {
+	if a.SAMLIDPMetadata == "" {
+		return nil, nil
+	} else if a.SAMLURL == "" || a.SAMLCert == "" || a.SAMLKey == "" {
+		return nil, errors.New("SAML requires the root URL as well as the service provider certificate and key")
+	}
+
+	root, err := url.Parse(strings.TrimRight(a.SAMLURL, "/") + "/")
+	if err != nil {
+		return nil, err
+	}
+	kp, err := tls.LoadX509KeyPair(a.SAMLCert, a.SAMLKey)
+	if err != nil {
+		return nil, err
+	}
+	key, ok := kp.PrivateKey.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("SAML service provider key must be an RSA key")
+	}
+	cert, err := x509.ParseCertificate(kp.Certificate[0])
+	if err != nil {
+		return nil, err
+	}
+	md, err := loadIDPMetadata(a.SAMLIDPMetadata)
+	if err != nil {
+		return nil, fmt.Errorf("cannot load SAML identity provider metadata: %w", err)
+	}
+
+	roles := make(map[string]bool, len(a.SAMLRoles))
+	for v, acc := range a.SAMLRoles {
+		if acc != "ro" && acc != "rw" {
+			return nil, fmt.Errorf("invalid access for SAML role %q (must be ro or rw): %s", v, acc)
+		}
+		roles[v] = acc == "rw"
+	}
+
+	opts := samlsp.Options{URL: *root, Key: key, Certificate: cert, IDPMetadata: md}
+	if root.Scheme == "https" {
+		// the identity provider posts the response cross-site, which requires the tracking cookie
+		opts.CookieSameSite = http.SameSiteNoneMode
+	}
+	sp, err := samlsp.New(opts)
+	if err != nil {
+		return nil, err
+	}
+	// unlike the tracking cookie, the session cookie must not be sent cross-site,
+	// otherwise other sites could upload files on behalf of the user
+	session := samlsp.DefaultSessionProvider(opts)
+	session.SameSite = http.SameSiteLaxMode
+	sp.Session = session
+	sp.ServiceProvider.MetadataURL = *root.ResolveReference(&url.URL{Path: strings.TrimPrefix(apiPrefix, "/") + "saml/metadata"})
+	sp.ServiceProvider.AcsURL = *root.ResolveReference(&url.URL{Path: strings.TrimPrefix(apiPrefix, "/") + "saml/acs"})
+	sp.ServiceProvider.DefaultRedirectURI = root.Path
+	return &samlAuth{sp: sp, attribute: a.SAMLRoleAttribute, roles: roles}, nil
+}
+
+// loadIDPMetadata reads the metadata of the identity provider from a file or an HTTP(S) URL.
+func loadIDPMetadata(src string) (*saml.EntityDescriptor, error) {
+	if strings.HasPrefix(src, "http://") || strings.HasPrefix(src, "https://") {
+		u, err := url.Parse(src)
+		if err != nil {
+			return nil, err
+		}
+		return samlsp.FetchMetadata(context.Background(), &http.Client{Transport: outboundTransport}, *u)
+	}
+
+	b, err := os.ReadFile(src)
+	if err != nil {
+		return nil, err
+	}
+	return samlsp.ParseMetadata(b)
+}
+
+// register adds the metadata and assertion consumer service endpoints to mux.
+func (sa *samlAuth) register(mux *http.ServeMux) {
+	if sa == nil {
+		return
+	}
+	mux.HandleFunc(apiPrefix+"saml/metadata", sa.sp.ServeMetadata)
+	mux.HandleFunc(apiPrefix+"saml/acs", sa.sp.ServeACS)
+}
+
+// require redirects users without a valid session to the identity provider.
+// Authenticated users are permitted according to their roles (see access).
+// If sa is nil, h is returned as is.
+func (sa *samlAuth) require(h http.Handler) http.Handler {
+	if sa == nil {
+		return h
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s, err := sa.sp.Session.GetSession(r)
+		if errors.Is(err, samlsp.ErrNoSession) {
+			// return to the original URL (including the prefix) after logging in
+			r2 := r.Clone(r.Context())
+			if u, err := url.ParseRequestURI(r.RequestURI); err == nil {
+				r2.URL = u
+			}
+			sa.sp.HandleStartAuthFlow(w, r2)
+			return
+		} else if err != nil {
+			sa.sp.OnError(w, r, err)
+			return
+		}
+
+		claims, _ := s.(samlsp.JWTSessionClaims)
+		readWrite, ok := sa.access(claims.GetAttributes())
+		if ok && (readWrite || r.Method == http.MethodGet || r.Method == http.MethodHead) {
+			id := &identity{name: claims.Subject, groups: claims.GetAttributes()[sa.attribute]}
+			h.ServeHTTP(w, withIdentity(r.WithContext(samlsp.ContextWithSession(r.Context(), s)), id))
+			return
+		}
+
+		log.Warn().Str("request-id", requestIDFrom(r.Context())).Str("user", claims.Subject).
+			Str("method", r.Method).Str("path", r.URL.Path).Msg("SAML user not authorized")
+		renderError(w, r, errAccessDenied, "access denied", http.StatusForbidden)
+	})
+}
+
+// access determines whether the attributes grant any access and if so, whether it includes writing.
+// If no roles are configured, every authenticated user has read-write access.
+func (sa *samlAuth) access(attrs samlsp.Attributes) (readWrite, ok bool) {
+	if len(sa.roles) == 0 {
+		return true, true
+	}
+	for _, v := range attrs[sa.attribute] {
+		if rw, found := sa.roles[v]; found {
+			readWrite, ok = readWrite || rw, true
+		}
+	}
+	return readWrite, ok
+}
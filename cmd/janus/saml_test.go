@@ -0,0 +1,135 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/crewjam/saml"
+	"github.com/crewjam/saml/samlsp"
+	. "github.com/stretchr/testify/require"
+)
+
+const testIDPMetadata = `<EntityDescriptor xmlns="urn:oasis:names:tc:SAML:2.0:metadata" entityID="https://idp.example.com/metadata">
+  <IDPSSODescriptor protocolSupportEnumeration="urn:oasis:names:tc:SAML:2.0:protocol">
+    <SingleSignOnService Binding="urn:oasis:names:tc:SAML:2.0:bindings:HTTP-Redirect" Location="https://idp.example.com/sso"/>
+  </IDPSSODescriptor>
+</EntityDescriptor>`
+
+// newTestSAMLAuth creates a service provider with an RSA key pair and the given roles.
+func newTestSAMLAuth(t *testing.T, roles map[string]string) *samlAuth {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "files.example.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	NoError(t, err)
+
+	d := t.TempDir()
+	a := app{
+		SAMLIDPMetadata:   filepath.Join(d, "idp.xml"),
+		SAMLURL:           "https://files.example.com/pre",
+		SAMLCert:          filepath.Join(d, "sp.crt"),
+		SAMLKey:           filepath.Join(d, "sp.key"),
+		SAMLRoleAttribute: "Role",
+		SAMLRoles:         roles,
+	}
+	NoError(t, os.WriteFile(a.SAMLIDPMetadata, []byte(testIDPMetadata), 0600))
+	NoError(t, os.WriteFile(a.SAMLCert, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	NoError(t, os.WriteFile(a.SAMLKey, pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}), 0600))
+
+	sa, err := newSAMLAuth(a)
+	NoError(t, err)
+	return sa
+}
+
+// samlSession returns a session cookie for a user with the given roles.
+func samlSession(t *testing.T, sa *samlAuth, roles ...string) *http.Cookie {
+	t.Helper()
+	attr := saml.Attribute{Name: "Role"}
+	for _, r := range roles {
+		attr.Values = append(attr.Values, saml.AttributeValue{Value: r})
+	}
+	assertion := &saml.Assertion{
+		Subject:             &saml.Subject{NameID: &saml.NameID{Value: "alice"}},
+		AttributeStatements: []saml.AttributeStatement{{Attributes: []saml.Attribute{attr}}},
+	}
+
+	sp := sa.sp.Session.(samlsp.CookieSessionProvider)
+	s, err := sp.Codec.New(assertion)
+	NoError(t, err)
+	v, err := sp.Codec.Encode(s)
+	NoError(t, err)
+	return &http.Cookie{Name: sp.Name, Value: v}
+}
+
+func Test_newSAMLAuth(t *testing.T) {
+	sa, err := newSAMLAuth(app{})
+	NoError(t, err)
+	Nil(t, sa)
+
+	_, err = newSAMLAuth(app{SAMLIDPMetadata: "idp.xml"})
+	Error(t, err)
+
+	sa = newTestSAMLAuth(t, nil)
+	h := handleAPI(app{saml: sa}, http.NotFoundHandler())
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/_janus/saml/metadata", nil))
+	Equal(t, http.StatusOK, w.Code)
+	Contains(t, w.Body.String(), `Location="https://files.example.com/pre/_janus/saml/acs"`)
+	Equal(t, http.SameSiteLaxMode, sa.sp.Session.(samlsp.CookieSessionProvider).SameSite)
+}
+
+func Test_samlAuth_require(t *testing.T) {
+	sa := newTestSAMLAuth(t, map[string]string{"eng": "rw", "guest": "ro"})
+	h := sa.require(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	serve := func(method string, c *http.Cookie) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, "/pre/a.txt", nil)
+		r.URL.Path = "/a.txt"
+		if c != nil {
+			r.AddCookie(c)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	w := serve(http.MethodGet, nil)
+	Equal(t, http.StatusFound, w.Code)
+	True(t, strings.HasPrefix(w.Header().Get("Location"), "https://idp.example.com/sso?"))
+
+	Equal(t, http.StatusOK, serve(http.MethodPost, samlSession(t, sa, "guest", "eng")).Code)
+	Equal(t, http.StatusOK, serve(http.MethodGet, samlSession(t, sa, "guest")).Code)
+	Equal(t, http.StatusForbidden, serve(http.MethodPost, samlSession(t, sa, "guest")).Code)
+	Equal(t, http.StatusForbidden, serve(http.MethodGet, samlSession(t, sa, "other")).Code)
+}
@@ -0,0 +1,50 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build linux
+
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	. "github.com/stretchr/testify/require"
+)
+
+func Test_sandbox(t *testing.T) {
+	if d := os.Getenv("JANUS_TEST_SANDBOX"); d != "" {
+		// running in a child process, because the sandbox cannot be lifted
+		if err := sandbox([]string{d}, nil); err != nil {
+			os.Exit(2)
+		} else if _, err := os.ReadFile(filepath.Join(d, "allowed")); err != nil {
+			os.Exit(3)
+		} else if _, err := os.ReadDir("/"); err == nil {
+			os.Exit(4)
+		}
+		os.Exit(0)
+	}
+
+	d := t.TempDir()
+	NoError(t, os.WriteFile(filepath.Join(d, "allowed"), nil, 0600))
+	cmd := exec.Command(os.Args[0], "-test.run=^Test_sandbox$")
+	cmd.Env = append(os.Environ(), "JANUS_TEST_SANDBOX="+d)
+	err := cmd.Run()
+	if e, ok := err.(*exec.ExitError); ok && e.ExitCode() == 2 {
+		t.Skip("Landlock is not available (or the binary was built with cgo)")
+	}
+	NoError(t, err)
+}
@@ -0,0 +1,198 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/jessevdk/go-flags"
+)
+
+// locationSection is the beginning of INI sections, whose options apply to a path prefix e.g., "[location /team/]".
+const locationSection = "location "
+
+// scopedOptions are the options, which can be overridden per location.
+// Others affect the server as a whole or hold state, which cannot be split up.
+var scopedOptions = map[string]bool{
+	"enable-upload":              true,
+	"upload-token":               true,
+	"drop-box":                   true,
+	"role":                       true,
+	"retention":                  true,
+	"enable-access-files":        true,
+	"limit":                      true,
+	"listing-cache-size":         true,
+	"file-cache-size":            true,
+	"file-cache-max-file-size":   true,
+	"handle-cache-size":          true,
+	"handle-cache-min-file-size": true,
+	"readahead":                  true,
+	"negative-cache-size":        true,
+	"negative-cache-ttl":         true,
+	"maven":                      true,
+	"append":                     true,
+}
+
+// location holds the options of a config file section, which apply to requests below a path prefix.
+type location struct {
+	prefix string
+	ini    string
+}
+
+// splitLocations separates the location sections of an INI file from the global options.
+func splitLocations(r io.Reader) (global string, locs []location, err error) {
+	g := &strings.Builder{}
+	var bs []*strings.Builder
+	b := g
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		header := strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]")
+		if header {
+			name := strings.TrimSpace(line[1 : len(line)-1])
+			if p := strings.TrimSpace(strings.TrimPrefix(name, locationSection)); p == name {
+				b = g
+			} else if !strings.HasPrefix(p, "/") {
+				return "", nil, fmt.Errorf("location must begin with '/': %q", p)
+			} else {
+				b = &strings.Builder{}
+				bs = append(bs, b)
+				locs = append(locs, location{prefix: p})
+			}
+		}
+
+		if b == g {
+			g.WriteString(s.Text() + "\n")
+			continue
+		}
+		// keep the line numbers of the global options in error messages
+		g.WriteString("\n")
+		if !header {
+			b.WriteString(s.Text() + "\n")
+		}
+	}
+	for i := range locs {
+		locs[i].ini = bs[i].String()
+	}
+	return g.String(), locs, s.Err()
+}
+
+// scope is the application as configured for a location.
+type scope struct {
+	prefix string
+	app    app
+}
+
+// scopes holds the applications of all locations, longest prefix first.
+type scopes []scope
+
+// newScopes applies the options of each location to a copy of the application or, if the location is nested,
+// to a copy of the enclosing location.
+// Only scopedOptions may be set, and state derived from them is created anew.
+func newScopes(a app) (scopes, error) {
+	ls := make([]location, len(a.locations))
+	copy(ls, a.locations)
+	// enclosing locations are configured first, so that nested ones inherit their options
+	sort.SliceStable(ls, func(i, j int) bool { return len(cleanPrefix(ls[i].prefix)) < len(cleanPrefix(ls[j].prefix)) })
+
+	ss := make(scopes, 0, len(ls))
+	for _, l := range ls {
+		s := ss.of(a, cleanPrefix(l.prefix))
+		s.locations, s.scopes = nil, nil
+		p := newParser(&s)
+		if err := flags.NewIniParser(p).Parse(strings.NewReader(l.ini)); err != nil {
+			return nil, fmt.Errorf("location %s: %w", l.prefix, err)
+		}
+		set := setOptions(p)
+		for name := range set {
+			if !scopedOptions[name] {
+				return nil, fmt.Errorf("location %s: option %s cannot be set per location", l.prefix, name)
+			}
+		}
+
+		var err error
+		if set["role"] {
+			if s.roles, err = parseRoles(s.Roles); err != nil {
+				return nil, fmt.Errorf("location %s: %w", l.prefix, err)
+			}
+		}
+		if set["limit"] {
+			if s.limits, err = newIdentityLimits(s.Limits); err != nil {
+				return nil, fmt.Errorf("location %s: %w", l.prefix, err)
+			}
+		}
+
+		// keep the longest prefix first
+		ss = append(scopes{{cleanPrefix(l.prefix), s}}, ss...)
+	}
+	return ss, nil
+}
+
+// cleanPrefix returns the canonical form of a location prefix, which ends with a slash.
+func cleanPrefix(p string) string {
+	if p = path.Clean(p); p != "/" {
+		p += "/"
+	}
+	return p
+}
+
+// index returns the index of the location with the longest prefix matching p, or -1 if there is none.
+// p is cleaned first, hence paths like "/a/./b" or "/a//b" cannot bypass the location "/a/b/".
+func (ss scopes) index(p string) int {
+	p = path.Clean("/" + p)
+	for i, s := range ss {
+		if strings.HasPrefix(p, s.prefix) || p+"/" == s.prefix {
+			return i
+		}
+	}
+	return -1
+}
+
+// of returns the application as configured for the location with the longest prefix matching p.
+// If there is none, a is returned.
+func (ss scopes) of(a app, p string) app {
+	if i := ss.index(p); i >= 0 {
+		return ss[i].app
+	}
+	return a
+}
+
+// handler creates a handler for the application and every location via newHandler,
+// and passes each request to the one of the location with the longest matching prefix.
+// If there are no locations, the handler of the application is returned.
+func (ss scopes) handler(a app, newHandler func(app) http.Handler) http.Handler {
+	def := newHandler(a)
+	if len(ss) == 0 {
+		return def
+	}
+
+	hs := make([]http.Handler, len(ss))
+	for i, s := range ss {
+		hs[i] = newHandler(s.app)
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if i := ss.index(r.URL.Path); i >= 0 {
+			hs[i].ServeHTTP(w, r)
+			return
+		}
+		def.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,110 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/stretchr/testify/require"
+)
+
+func Test_splitLocations(t *testing.T) {
+	global, locs, err := splitLocations(strings.NewReader(`listen = :9090
+[location /incoming/]
+enable-upload = true
+[Application Options]
+prefix = /files
+[ location /team ]
+role = @staff read,write
+`))
+	NoError(t, err)
+	Equal(t, "listen = :9090\n\n\n[Application Options]\nprefix = /files\n\n\n", global)
+	Equal(t, []location{{"/incoming/", "enable-upload = true\n"}, {"/team", "role = @staff read,write\n"}}, locs)
+
+	_, _, err = splitLocations(strings.NewReader("[location team]\n"))
+	EqualError(t, err, `location must begin with '/': "team"`)
+}
+
+func Test_newScopes(t *testing.T) {
+	ss, err := newScopes(app{ReadaheadKB: 256, locations: []location{
+		{"/a", "readahead = 64\n"},
+		{"/a/b/", "role = public read\nretention = 1h\n"},
+	}})
+	NoError(t, err)
+	Len(t, ss, 2)
+	Equal(t, "/a/b/", ss[0].prefix)
+	Len(t, ss[0].app.roles, 1)
+	Equal(t, time.Hour, ss[0].app.Retention)
+	// nested locations inherit the options of the enclosing one
+	Equal(t, 64, ss[0].app.ReadaheadKB)
+	Equal(t, "/a/", ss[1].prefix)
+	Equal(t, 64, ss[1].app.ReadaheadKB)
+
+	_, err = newScopes(app{locations: []location{{"/a/", "listen = :9090\n"}}})
+	EqualError(t, err, "location /a/: option listen cannot be set per location")
+	_, err = newScopes(app{locations: []location{{"/a/", "role = alice rw\n"}}})
+	ErrorContains(t, err, "location /a/: invalid permission")
+}
+
+func Test_scopes_handler(t *testing.T) {
+	a := app{locations: []location{{"/incoming/", "enable-upload = true\n"}, {"/incoming/ci/", "upload-token = s3cr3t\n"}}}
+	ss, err := newScopes(a)
+	NoError(t, err)
+	h := ss.handler(a, func(a app) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte(strconv.FormatBool(a.EnableUpload) + " " + a.UploadToken))
+		})
+	})
+
+	for p, exp := range map[string]string{
+		"/":                 "false ",
+		"/incoming":         "true ",
+		"/incoming/a.txt":   "true ",
+		"/incoming/ci/":     "true s3cr3t",
+		"/incoming-a.txt":   "false ",
+		"/incoming/ci2.txt": "true ",
+		"/incoming/./ci/":   "true s3cr3t",
+		"/incoming//ci/a":   "true s3cr3t",
+		"/x/../incoming/ci": "true s3cr3t",
+	} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, p, nil))
+		Equal(t, exp, w.Body.String(), p)
+	}
+}
+
+func Test_loadConfig_Locations(t *testing.T) {
+	cfg := filepath.Join(t.TempDir(), "janus.ini")
+	NoError(t, os.WriteFile(cfg, []byte("listen = :9090\n[location /incoming/]\nenable-upload = true\n"), 0600))
+
+	a := loadConfig("-c", cfg)
+	var err error
+	Equal(t, ":9090", a.ListenAddress)
+	False(t, a.EnableUpload)
+	Equal(t, []location{{"/incoming/", "enable-upload = true\n"}}, a.locations)
+
+	a.locations[0].ini += "maven = true\n"
+	a.scopes, err = newScopes(a)
+	NoError(t, err)
+	NotContains(t, routedMethods(a), http.MethodPut)
+	Contains(t, routedMethods(a.scopes[0].app), http.MethodPut)
+}
@@ -0,0 +1,200 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"html/template"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// sessionCookie is the name of the cookie holding the session ID.
+const sessionCookie = "janus_session"
+
+// loginTmpl renders the login page, which is also shown after logging out.
+var loginTmpl = template.Must(template.New("login").Parse(`{{if .Msg}}<p>{{call .T .Msg}}</p>{{end}}
+<form action="{{.Action}}" method="POST">
+  <input type="hidden" name="next" value="{{.Next}}">
+  <p><label>{{call .T "User"}} <input name="user" autocomplete="username" required autofocus></label></p>
+  <p><label>{{call .T "Password"}} <input name="password" type="password" autocomplete="current-password" required></label></p>
+  <p><label>{{call .T "Code"}} <input name="code" inputmode="numeric" autocomplete="one-time-code" pattern="[0-9]{6}" placeholder="{{call .T "if enrolled"}}"></label></p>
+  <p><input type="submit" value="{{call .T "Login"}}"></p>
+</form>
+`))
+
+// session is an authenticated browser session.
+type session struct {
+	user    string
+	groups  []string
+	expires time.Time
+}
+
+// sessionStore holds all active sessions in memory, so that they can be revoked on the server side.
+type sessionStore struct {
+	mu       sync.Mutex
+	lifetime time.Duration
+	sessions map[string]session
+}
+
+// newSessionStore creates a store for sessions with the given lifetime.
+func newSessionStore(lifetime time.Duration) *sessionStore {
+	return &sessionStore{lifetime: lifetime, sessions: map[string]session{}}
+}
+
+// create starts a new session for the user (being a member of the given groups) and returns its ID.
+// Expired sessions are removed along the way.
+func (ss *sessionStore) create(user string, now time.Time, groups ...string) (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	id := base64.RawURLEncoding.EncodeToString(b)
+
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	for k, s := range ss.sessions {
+		if now.After(s.expires) {
+			delete(ss.sessions, k)
+		}
+	}
+	ss.sessions[id] = session{user: user, groups: groups, expires: now.Add(ss.lifetime)}
+	return id, nil
+}
+
+// get returns the user of a session, unless it has expired or was revoked.
+func (ss *sessionStore) get(id string, now time.Time) (string, bool) {
+	s, ok := ss.lookup(id, now)
+	return s.user, ok
+}
+
+// lookup returns a session, unless it has expired or was revoked.
+func (ss *sessionStore) lookup(id string, now time.Time) (session, bool) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	s, ok := ss.sessions[id]
+	if ok && now.After(s.expires) {
+		delete(ss.sessions, id)
+		return session{}, false
+	}
+	return s, ok
+}
+
+// revoke ends a session.
+func (ss *sessionStore) revoke(id string) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	delete(ss.sessions, id)
+}
+
+// sessionUser returns the user of the session associated with the request, if any.
+func sessionUser(ss *sessionStore, r *http.Request) (string, bool) {
+	c, err := r.Cookie(sessionCookie)
+	if err != nil {
+		return "", false
+	}
+	return ss.get(c.Value, time.Now())
+}
+
+// loginPage describes the login form.
+type loginPage struct {
+	Action string
+	Next   string
+	Msg    string
+	T      func(string) string
+}
+
+// handleLogin renders the login page and starts a session after successful authentication.
+// Afterwards, the client is redirected to the URL given in the "next" parameter.
+func handleLogin(a app) http.HandlerFunc {
+	action := path.Join(a.Prefix, apiPrefix, "login")
+	return func(w http.ResponseWriter, r *http.Request) {
+		page := loginPage{Action: action, Next: localURL(r.FormValue("next"), a.Prefix)}
+		if r.Method == http.MethodPost {
+			user := r.PostFormValue("user")
+			pass := r.PostFormValue("password") + strings.TrimSpace(r.PostFormValue("code"))
+			if a.accounts.authenticate(user, pass, time.Now()) {
+				startSession(w, r, a, user, page.Next)
+				return
+			}
+
+			log.Warn().Str("request-id", requestIDFrom(r.Context())).Str("user", user).
+				Str("client", clientIP(r)).Msg("Login failed")
+			page.Msg = "Invalid credentials"
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+		renderLoginPage(w, r, a.brand, page)
+	}
+}
+
+// startSession sets the session cookie and redirects the client to next.
+func startSession(w http.ResponseWriter, r *http.Request, a app, user, next string) {
+	id, err := a.sessions.create(user, time.Now())
+	if err != nil {
+		renderError(w, r, err, "cannot create session", http.StatusInternalServerError)
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    id,
+		Path:     a.Prefix,
+		MaxAge:   int(a.sessions.lifetime.Seconds()),
+		Secure:   r.TLS != nil,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	log.Info().Str("request-id", requestIDFrom(r.Context())).Str("user", user).Msg("Logged in")
+	http.Redirect(w, r, next, http.StatusSeeOther)
+}
+
+// handleLogout revokes the current session and renders the login page.
+func handleLogout(a app) http.HandlerFunc {
+	action := path.Join(a.Prefix, apiPrefix, "login")
+	return func(w http.ResponseWriter, r *http.Request) {
+		if c, err := r.Cookie(sessionCookie); err == nil {
+			a.sessions.revoke(c.Value)
+		}
+		http.SetCookie(w, &http.Cookie{Name: sessionCookie, Path: a.Prefix, MaxAge: -1, HttpOnly: true})
+		renderLoginPage(w, r, a.brand, loginPage{Action: action, Next: a.Prefix, Msg: "Logged out"})
+	}
+}
+
+// renderLoginPage sends the login form in the language of the client.
+func renderLoginPage(w http.ResponseWriter, r *http.Request, b *brand, page loginPage) {
+	page.T = func(m string) string { return tr(r, m) }
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	if err := b.writeHead(w, page.T("Login")); err != nil {
+		log.Err(err).Msg("cannot render login page")
+	} else if err := loginTmpl.Execute(w, page); err != nil {
+		log.Err(err).Msg("cannot render login page")
+	}
+}
+
+// localURL returns u if it refers to a path on this server, and def otherwise.
+// This prevents redirecting users to other sites after logging in.
+func localURL(u, def string) string {
+	if !strings.HasPrefix(u, "/") || strings.HasPrefix(u, "//") || strings.HasPrefix(u, "/\\") {
+		return def
+	}
+	return u
+}
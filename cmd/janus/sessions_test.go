@@ -0,0 +1,95 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/stretchr/testify/require"
+)
+
+func Test_sessionStore(t *testing.T) {
+	ss := newSessionStore(time.Hour)
+	now := time.Now()
+	id, err := ss.create("alice", now)
+	NoError(t, err)
+
+	user, ok := ss.get(id, now)
+	True(t, ok)
+	Equal(t, "alice", user)
+	_, ok = ss.get(id, now.Add(2*time.Hour))
+	False(t, ok)
+	_, ok = ss.get(id, now)
+	False(t, ok, "expired session must be removed")
+
+	id, err = ss.create("alice", now)
+	NoError(t, err)
+	ss.revoke(id)
+	_, ok = ss.get(id, now)
+	False(t, ok)
+}
+
+func Test_handleLogin(t *testing.T) {
+	as, err := loadAccounts(writeUsersFile(t, "alice"), "")
+	NoError(t, err)
+	a := app{Prefix: "/", accounts: as, sessions: newSessionStore(time.Hour)}
+	h := handleAPI(a, http.NotFoundHandler())
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/_janus/login?next=/docs/", nil))
+	Equal(t, http.StatusOK, w.Code)
+	Contains(t, w.Body.String(), `name="next" value="/docs/"`)
+
+	login := func(pass string) *httptest.ResponseRecorder {
+		form := url.Values{"user": {"alice"}, "password": {pass}, "next": {"/docs/"}}
+		r := httptest.NewRequest(http.MethodPost, "/_janus/login", strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	Equal(t, http.StatusUnauthorized, login("wrong").Code)
+	w = login("alice")
+	Equal(t, http.StatusSeeOther, w.Code)
+	Equal(t, "/docs/", w.Header().Get("Location"))
+	c := w.Result().Cookies()[0]
+	True(t, c.HttpOnly)
+
+	r := httptest.NewRequest(http.MethodPost, "/_janus/logout", nil)
+	r.AddCookie(c)
+	user, ok := sessionUser(a.sessions, r)
+	True(t, ok)
+	Equal(t, "alice", user)
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	Equal(t, http.StatusOK, w.Code)
+	_, ok = sessionUser(a.sessions, r)
+	False(t, ok)
+}
+
+func Test_localURL(t *testing.T) {
+	Equal(t, "/a?b", localURL("/a?b", "/"))
+	Equal(t, "/", localURL("https://evil.example.com/", "/"))
+	Equal(t, "/", localURL("//evil.example.com/", "/"))
+	Equal(t, "/", localURL("/\\evil.example.com/", "/"))
+	Equal(t, "/", localURL("", "/"))
+}
@@ -0,0 +1,146 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+var (
+	// errInvalidShareLink indicates that a share link was not issued by this server.
+	errInvalidShareLink = errors.New("invalid share link")
+	// errShareLinkExpired indicates that a share link is no longer valid.
+	errShareLinkExpired = errors.New("share link expired")
+)
+
+// shareLinks issues and verifies links, which grant anonymous read access to a single file for a limited time.
+// Links are signed with a random key, hence they become invalid when the server is restarted.
+type shareLinks struct {
+	key      []byte
+	lifetime time.Duration
+}
+
+// newShareLinks creates a shareLinks with a new random key.
+func newShareLinks(lifetime time.Duration) *shareLinks {
+	key := make([]byte, 32)
+	_, _ = rand.Read(key)
+	return &shareLinks{key: key, lifetime: lifetime}
+}
+
+// token returns a signed token for the file p (relative to the server root), which expires at the given time.
+func (sl *shareLinks) token(p string, exp time.Time) string {
+	data := base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatInt(exp.Unix(), 10) + ":" + p))
+	return data + "." + base64.RawURLEncoding.EncodeToString(sl.sign(data))
+}
+
+// sign computes the HMAC of the data.
+func (sl *shareLinks) sign(data string) []byte {
+	m := hmac.New(sha256.New, sl.key)
+	_, _ = m.Write([]byte(data))
+	return m.Sum(nil)
+}
+
+// verify returns the file path of the token, if it is authentic and has not expired.
+func (sl *shareLinks) verify(tok string, now time.Time) (string, error) {
+	data, sig, _ := strings.Cut(tok, ".")
+	s, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil || !hmac.Equal(s, sl.sign(data)) {
+		return "", errInvalidShareLink
+	}
+
+	b, err := base64.RawURLEncoding.DecodeString(data)
+	if err != nil {
+		return "", errInvalidShareLink
+	}
+	exp, p, _ := strings.Cut(string(b), ":")
+	if sec, err := strconv.ParseInt(exp, 10, 64); err != nil {
+		return "", errInvalidShareLink
+	} else if now.Unix() > sec {
+		return "", errShareLinkExpired
+	}
+	return p, nil
+}
+
+// handleShare responds with a share link for the requested file.
+func handleShare(a app) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		root := rootDir(a, r)
+		if fi, err := os.Stat(filepath.Join(root, r.URL.Path)); err != nil || fi.IsDir() {
+			http.NotFound(w, r)
+			return
+		}
+
+		p, err := sharePath(a, r, r.URL.Path)
+		if err != nil {
+			renderError(w, r, err, "cannot create share link", http.StatusInternalServerError)
+			return
+		}
+
+		link := shareURL(a, r, p)
+		if e, ok := r.Context().Value(logger).(*zerolog.Event); ok {
+			e.Str("share", p)
+		}
+		_, _ = renderMsg(w, link+"\n")
+	}
+}
+
+// sharePath returns the path of a file relative to the server root, given its path relative to the
+// root directory of the client (see rootDir).
+func sharePath(a app, r *http.Request, p string) (string, error) {
+	rel, err := filepath.Rel(a.ServerRoot, rootDir(a, r))
+	if err != nil {
+		return "", err
+	}
+	return path.Join("/", filepath.ToSlash(rel), p), nil
+}
+
+// shareURL returns a new share link for the file at p (relative to the server root).
+func shareURL(a app, r *http.Request, p string) string {
+	return externalURL(a, r, path.Join(apiPrefix, "share", a.shares.token(p, time.Now().Add(a.shares.lifetime))))
+}
+
+// handleSharedFile serves the file of a valid share link.
+func handleSharedFile(a app) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		p, err := a.shares.verify(strings.TrimPrefix(r.URL.Path, apiPrefix+"share/"), time.Now())
+		if errors.Is(err, errShareLinkExpired) {
+			renderError(w, r, err, "share link expired", http.StatusGone)
+			return
+		} else if err != nil {
+			renderError(w, r, err, "invalid share link", http.StatusNotFound)
+			return
+		}
+
+		name := filepath.Join(a.ServerRoot, filepath.FromSlash(p))
+		if fi, err := os.Stat(name); err != nil || fi.IsDir() {
+			http.NotFound(w, r)
+			return
+		}
+		http.ServeFile(w, r, name)
+	}
+}
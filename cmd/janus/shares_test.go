@@ -0,0 +1,83 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/stretchr/testify/require"
+)
+
+func Test_shareLinks_verify(t *testing.T) {
+	sl := newShareLinks(time.Hour)
+	now := time.Now()
+	tok := sl.token("/dir/a:b.txt", now.Add(time.Minute))
+
+	p, err := sl.verify(tok, now)
+	NoError(t, err)
+	Equal(t, "/dir/a:b.txt", p)
+
+	_, err = sl.verify(tok, now.Add(2*time.Minute))
+	ErrorIs(t, err, errShareLinkExpired)
+	_, err = newShareLinks(time.Hour).verify(tok, now)
+	ErrorIs(t, err, errInvalidShareLink)
+	_, err = sl.verify("invalid", now)
+	ErrorIs(t, err, errInvalidShareLink)
+}
+
+func Test_handleShare(t *testing.T) {
+	a := app{ServerRoot: t.TempDir(), Prefix: "/files", HomeDirs: true, shares: newShareLinks(time.Hour)}
+	NoError(t, os.MkdirAll(filepath.Join(a.ServerRoot, "alice"), 0700))
+	NoError(t, os.WriteFile(filepath.Join(a.ServerRoot, "alice", "a.txt"), []byte("a"), 0600))
+
+	r := withIdentity(httptest.NewRequest(http.MethodGet, "/a.txt?share", nil), &identity{name: "alice"})
+	w := httptest.NewRecorder()
+	handleShare(a).ServeHTTP(w, r)
+	Equal(t, http.StatusOK, w.Code)
+	link := strings.TrimSpace(w.Body.String())
+	True(t, strings.HasPrefix(link, "http://example.com/files/_janus/share/"), link)
+
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest(http.MethodGet, "/_janus/share/"+link[strings.LastIndex(link, "/")+1:], nil)
+	handleSharedFile(a).ServeHTTP(w, r)
+	Equal(t, http.StatusOK, w.Code)
+	Equal(t, "a", w.Body.String())
+
+	w = httptest.NewRecorder()
+	r = withIdentity(httptest.NewRequest(http.MethodGet, "/?share", nil), &identity{name: "alice"})
+	handleShare(a).ServeHTTP(w, r)
+	Equal(t, http.StatusNotFound, w.Code)
+}
+
+func Test_handleSharedFile(t *testing.T) {
+	a := app{ServerRoot: t.TempDir(), shares: newShareLinks(time.Hour)}
+	NoError(t, os.Mkdir(filepath.Join(a.ServerRoot, "dir"), 0700))
+
+	serve := func(tok string) int {
+		w := httptest.NewRecorder()
+		handleSharedFile(a).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/_janus/share/"+tok, nil))
+		return w.Code
+	}
+	Equal(t, http.StatusNotFound, serve("invalid"))
+	Equal(t, http.StatusGone, serve(a.shares.token("/a.txt", time.Now().Add(-time.Minute))))
+	Equal(t, http.StatusNotFound, serve(a.shares.token("/a.txt", time.Now().Add(time.Minute))))
+	Equal(t, http.StatusNotFound, serve(a.shares.token("/dir", time.Now().Add(time.Minute))))
+}
@@ -0,0 +1,174 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/rs/zerolog/log"
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/armor"
+	"golang.org/x/crypto/openpgp/clearsign"
+)
+
+// signer creates OpenPGP signatures of generated files, so that clients can verify their authenticity.
+type signer interface {
+	// clearSign writes the message along with an inline signature.
+	clearSign(w io.Writer, msg []byte) error
+	// detachSign writes the armored detached signature of the message.
+	detachSign(w io.Writer, msg []byte) error
+	// publicKey returns the armored public key, which verifies the signatures.
+	publicKey() ([]byte, error)
+}
+
+// newSigner creates a signer using either the armored private key file or the key with the given ID,
+// which is managed by gpg and its agent. If both are empty, nil is returned.
+func newSigner(keyFile, keyID string) (signer, error) {
+	switch {
+	case keyFile != "" && keyID != "":
+		return nil, errors.New("signing key and signing key ID are mutually exclusive")
+	case keyFile != "":
+		return newKeySigner(keyFile)
+	case keyID != "":
+		return newGPGSigner(keyID)
+	default:
+		return nil, nil
+	}
+}
+
+// keySigner signs with a private key loaded from a file.
+type keySigner struct {
+	entity *openpgp.Entity
+}
+
+// newKeySigner loads the first key of the armored key ring, which must not be protected by a passphrase.
+func newKeySigner(keyFile string) (*keySigner, error) {
+	f, err := os.Open(filepath.Clean(keyFile))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	es, err := openpgp.ReadArmoredKeyRing(f)
+	if err != nil {
+		return nil, err
+	} else if len(es) == 0 || es[0].PrivateKey == nil {
+		return nil, errors.New("no private key found")
+	} else if es[0].PrivateKey.Encrypted {
+		return nil, errors.New("private key must not be protected by a passphrase (use the gpg agent instead)")
+	}
+	return &keySigner{es[0]}, nil
+}
+
+func (ks *keySigner) clearSign(w io.Writer, msg []byte) error {
+	pw, err := clearsign.Encode(w, ks.entity.PrivateKey, nil)
+	if err != nil {
+		return err
+	} else if _, err := pw.Write(msg); err != nil {
+		return err
+	}
+	return pw.Close()
+}
+
+func (ks *keySigner) detachSign(w io.Writer, msg []byte) error {
+	if err := openpgp.ArmoredDetachSign(w, ks.entity, bytes.NewReader(msg), nil); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+func (ks *keySigner) publicKey() ([]byte, error) {
+	b := &bytes.Buffer{}
+	aw, err := armor.Encode(b, openpgp.PublicKeyType, nil)
+	if err != nil {
+		return nil, err
+	} else if err := ks.entity.Serialize(aw); err != nil {
+		return nil, err
+	} else if err := aw.Close(); err != nil {
+		return nil, err
+	}
+	b.WriteString("\n")
+	return b.Bytes(), nil
+}
+
+// gpgSigner signs by running gpg, which obtains the key from its agent.
+// This way, keys protected by a passphrase or stored on a smart card can be used.
+type gpgSigner struct {
+	keyID string
+}
+
+// newGPGSigner creates a signer for the key with the given ID, which must be known to gpg.
+func newGPGSigner(keyID string) (*gpgSigner, error) {
+	gs := &gpgSigner{keyID}
+	if _, err := gs.gpg(nil, "--list-secret-keys", keyID); err != nil {
+		return nil, err
+	}
+	return gs, nil
+}
+
+func (gs *gpgSigner) clearSign(w io.Writer, msg []byte) error {
+	b, err := gs.gpg(msg, "--local-user", gs.keyID, "--clearsign")
+	if err == nil {
+		_, err = w.Write(b)
+	}
+	return err
+}
+
+func (gs *gpgSigner) detachSign(w io.Writer, msg []byte) error {
+	b, err := gs.gpg(msg, "--local-user", gs.keyID, "--armor", "--detach-sign")
+	if err == nil {
+		_, err = w.Write(b)
+	}
+	return err
+}
+
+func (gs *gpgSigner) publicKey() ([]byte, error) {
+	return gs.gpg(nil, "--armor", "--export", gs.keyID)
+}
+
+// gpg runs gpg non-interactively with the input and returns its output.
+func (gs *gpgSigner) gpg(in []byte, args ...string) ([]byte, error) {
+	cmd := exec.Command("gpg", append([]string{"--batch", "--no-tty"}, args...)...)
+	cmd.Stdin = bytes.NewReader(in)
+	out, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	cmd.Stdout, cmd.Stderr = out, stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("gpg: %w: %s", err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	return out.Bytes(), nil
+}
+
+// handleSigningKey serves the public key, which verifies the signatures created by janus.
+func handleSigningKey(s signer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		b, err := s.publicKey()
+		if err != nil {
+			renderError(w, r, err, "signing key not available", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/pgp-keys")
+		if _, err := w.Write(b); err != nil {
+			log.Err(err).Msg("cannot render message")
+		}
+	}
+}
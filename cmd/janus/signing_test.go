@@ -0,0 +1,148 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	. "github.com/stretchr/testify/require"
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/armor"
+	"golang.org/x/crypto/openpgp/clearsign"
+)
+
+// writeSigningKey generates an OpenPGP key and writes its armored private key to a file.
+func writeSigningKey(t *testing.T) (string, *openpgp.Entity) {
+	t.Helper()
+	e, err := openpgp.NewEntity("janus", "", "janus@example.com", nil)
+	NoError(t, err)
+	b := &bytes.Buffer{}
+	aw, err := armor.Encode(b, openpgp.PrivateKeyType, nil)
+	NoError(t, err)
+	NoError(t, e.SerializePrivate(aw, nil))
+	NoError(t, aw.Close())
+
+	name := filepath.Join(t.TempDir(), "key.asc")
+	NoError(t, os.WriteFile(name, b.Bytes(), 0600))
+	return name, e
+}
+
+// verifySigner checks the signatures created by s with the public key provided by s.
+func verifySigner(t *testing.T, s signer) {
+	t.Helper()
+	pub, err := s.publicKey()
+	NoError(t, err)
+	keys, err := openpgp.ReadArmoredKeyRing(bytes.NewReader(pub))
+	NoError(t, err)
+
+	msg := []byte("Date: today\n")
+	sig := &bytes.Buffer{}
+	NoError(t, s.detachSign(sig, msg))
+	_, err = openpgp.CheckArmoredDetachedSignature(keys, bytes.NewReader(msg), sig)
+	NoError(t, err)
+
+	clear := &bytes.Buffer{}
+	NoError(t, s.clearSign(clear, msg))
+	b, _ := clearsign.Decode(clear.Bytes())
+	NotNil(t, b)
+	Equal(t, msg, b.Plaintext)
+	_, err = openpgp.CheckDetachedSignature(keys, bytes.NewReader(b.Bytes), b.ArmoredSignature.Body)
+	NoError(t, err)
+}
+
+func Test_newSigner(t *testing.T) {
+	s, err := newSigner("", "")
+	NoError(t, err)
+	Nil(t, s)
+
+	_, err = newSigner("key.asc", "ABCDEF")
+	Error(t, err)
+	_, err = newSigner(filepath.Join(t.TempDir(), "missing.asc"), "")
+	Error(t, err)
+
+	keyFile, _ := writeSigningKey(t)
+	s, err = newSigner(keyFile, "")
+	NoError(t, err)
+	IsType(t, &keySigner{}, s)
+}
+
+func Test_keySigner(t *testing.T) {
+	keyFile, _ := writeSigningKey(t)
+	ks, err := newKeySigner(keyFile)
+	NoError(t, err)
+	verifySigner(t, ks)
+
+	pubOnly := filepath.Join(t.TempDir(), "pub.asc")
+	pub, err := ks.publicKey()
+	NoError(t, err)
+	NoError(t, os.WriteFile(pubOnly, pub, 0600))
+	_, err = newKeySigner(pubOnly)
+	Error(t, err)
+}
+
+func Test_gpgSigner(t *testing.T) {
+	if _, err := exec.LookPath("gpg"); err != nil {
+		t.Skip("gpg not installed")
+	}
+	home, err := os.MkdirTemp("", "gnupg")
+	NoError(t, err)
+	t.Cleanup(func() {
+		_ = exec.Command("gpgconf", "--homedir", home, "--kill", "gpg-agent").Run()
+		_ = os.RemoveAll(home)
+	})
+	t.Setenv("GNUPGHOME", home)
+	out, err := exec.Command("gpg", "--batch", "--passphrase", "", "--quick-gen-key", "janus <janus@example.com>", "ed25519", "sign", "never").CombinedOutput()
+	NoError(t, err, string(out))
+
+	_, err = newGPGSigner("unknown@example.com")
+	Error(t, err)
+	gs, err := newGPGSigner("janus@example.com")
+	NoError(t, err)
+
+	pub, err := gs.publicKey()
+	NoError(t, err)
+	Contains(t, string(pub), "BEGIN PGP PUBLIC KEY BLOCK")
+
+	dir := t.TempDir()
+	msg, sig := filepath.Join(dir, "msg"), &bytes.Buffer{}
+	NoError(t, os.WriteFile(msg, []byte("Date: today\n"), 0600))
+	NoError(t, gs.detachSign(sig, []byte("Date: today\n")))
+	NoError(t, os.WriteFile(msg+".asc", sig.Bytes(), 0600))
+	_, err = gs.gpg(nil, "--verify", msg+".asc", msg)
+	NoError(t, err)
+
+	clear := &bytes.Buffer{}
+	NoError(t, gs.clearSign(clear, []byte("Date: today\n")))
+	_, err = gs.gpg(clear.Bytes(), "--verify")
+	NoError(t, err)
+}
+
+func Test_handleSigningKey(t *testing.T) {
+	keyFile, _ := writeSigningKey(t)
+	ks, err := newKeySigner(keyFile)
+	NoError(t, err)
+
+	w := httptest.NewRecorder()
+	handleSigningKey(ks).ServeHTTP(w, httptest.NewRequest(http.MethodGet, apiPrefix+"signing-key", nil))
+	Equal(t, http.StatusOK, w.Code)
+	Equal(t, "application/pgp-keys", w.Header().Get("Content-Type"))
+	Contains(t, w.Body.String(), "BEGIN PGP PUBLIC KEY BLOCK")
+}
@@ -0,0 +1,177 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// maxSitemapURLs is the maximum number of URLs a sitemap may contain according to the protocol.
+const maxSitemapURLs = 50000
+
+// errSitemapFull stops walking the server root when the sitemap reached its maximum size.
+var errSitemapFull = errors.New("sitemap full")
+
+// sitemap generates a sitemap.xml listing all files and directories below the server root.
+// It is regenerated when it is requested after the interval has passed or files were changed via janus.
+type sitemap struct {
+	root     string
+	base     string
+	exclude  []string
+	interval time.Duration
+
+	mu        sync.Mutex
+	data      []byte
+	generated time.Time
+	stale     bool
+}
+
+// sitemapURL is a single entry of a sitemap.
+type sitemapURL struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod"`
+}
+
+// sitemapURLSet is the root element of a sitemap.
+type sitemapURLSet struct {
+	XMLName xml.Name     `xml:"urlset"`
+	XMLNS   string       `xml:"xmlns,attr"`
+	URLs    []sitemapURL `xml:"url"`
+}
+
+// newSitemap creates a sitemap, if a public URL is configured. Otherwise, nil is returned.
+func newSitemap(a app) *sitemap {
+	if a.Sitemap == "" {
+		return nil
+	}
+	return &sitemap{
+		root:     a.ServerRoot,
+		base:     strings.TrimRight(a.Sitemap, "/") + "/",
+		exclude:  a.SitemapExclude,
+		interval: a.SitemapInterval,
+	}
+}
+
+// changed marks the sitemap for regeneration.
+func (s *sitemap) changed() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stale = true
+}
+
+// content returns the sitemap and the time it was generated, regenerating it if necessary.
+func (s *sitemap) content(now time.Time) ([]byte, time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.data != nil && !s.stale && (s.interval <= 0 || now.Sub(s.generated) < s.interval) {
+		return s.data, s.generated, nil
+	}
+
+	b, err := s.generate()
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	s.data, s.generated, s.stale = b, now, false
+	return s.data, s.generated, nil
+}
+
+// generate walks the server root and renders the sitemap.
+// Hidden files and directories as well as excluded paths are omitted.
+func (s *sitemap) generate() ([]byte, error) {
+	set := sitemapURLSet{XMLNS: "http://www.sitemaps.org/schemas/sitemap/0.9"}
+	err := filepath.WalkDir(s.root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(s.root, p)
+		if err != nil {
+			return err
+		}
+
+		u := "/" + filepath.ToSlash(rel)
+		if rel == "." {
+			u = "/"
+		} else if d.IsDir() {
+			u += "/"
+		}
+		if rel != "." && (strings.HasPrefix(d.Name(), ".") || matchPath(s.exclude, u)) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		} else if !d.IsDir() && !d.Type().IsRegular() {
+			return nil
+		}
+
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		} else if len(set.URLs) == maxSitemapURLs {
+			log.Warn().Int("max", maxSitemapURLs).Msg("Sitemap truncated")
+			return errSitemapFull
+		}
+		set.URLs = append(set.URLs, sitemapURL{
+			Loc:     s.base + strings.TrimPrefix((&url.URL{Path: u}).EscapedPath(), "/"),
+			LastMod: fi.ModTime().UTC().Format(time.RFC3339),
+		})
+		return nil
+	})
+	if err != nil && !errors.Is(err, errSitemapFull) {
+		return nil, err
+	}
+
+	b, err := xml.MarshalIndent(set, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), append(b, '\n')...), nil
+}
+
+// serveSitemap serves the generated sitemap at "/sitemap.xml", unless such a file exists.
+func serveSitemap(a app, h http.Handler) http.Handler {
+	if a.sitemap == nil {
+		return h
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/sitemap.xml" || (r.Method != http.MethodGet && r.Method != http.MethodHead) ||
+			exists(filepath.Join(rootDir(a, r), "sitemap.xml")) {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		b, t, err := a.sitemap.content(time.Now())
+		if err != nil {
+			renderError(w, r, err, "cannot generate sitemap", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+		http.ServeContent(w, r, "", t, bytes.NewReader(b))
+	})
+}
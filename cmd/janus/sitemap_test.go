@@ -0,0 +1,111 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/stretchr/testify/require"
+)
+
+func Test_newSitemap(t *testing.T) {
+	Nil(t, newSitemap(app{}))
+	s := newSitemap(app{ServerRoot: "root", Sitemap: "https://files.example.com/pub", SitemapInterval: time.Hour})
+	Equal(t, "https://files.example.com/pub/", s.base)
+	Equal(t, time.Hour, s.interval)
+}
+
+func Test_sitemap_generate(t *testing.T) {
+	root := t.TempDir()
+	NoError(t, os.MkdirAll(filepath.Join(root, "docs"), 0700))
+	NoError(t, os.MkdirAll(filepath.Join(root, "drafts"), 0700))
+	NoError(t, os.MkdirAll(filepath.Join(root, ".git"), 0700))
+	for _, name := range []string{"docs/read me.txt", "drafts/a.txt", ".git/HEAD", ".janusaccess", "x.tmp"} {
+		NoError(t, os.WriteFile(filepath.Join(root, name), nil, 0600))
+	}
+	mod := time.Date(2022, 11, 27, 10, 0, 0, 0, time.UTC)
+	NoError(t, os.Chtimes(filepath.Join(root, "docs", "read me.txt"), mod, mod))
+
+	s := &sitemap{root: root, base: "https://files.example.com/pub/", exclude: []string{"/drafts/", "/*.tmp"}}
+	b, err := s.generate()
+	NoError(t, err)
+	Contains(t, string(b), `<?xml version="1.0" encoding="UTF-8"?>`)
+	Contains(t, string(b), `<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">`)
+	Contains(t, string(b), "<loc>https://files.example.com/pub/</loc>")
+	Contains(t, string(b), "<loc>https://files.example.com/pub/docs/</loc>")
+	Contains(t, string(b), "<url>\n    <loc>https://files.example.com/pub/docs/read%20me.txt</loc>\n"+
+		"    <lastmod>2022-11-27T10:00:00Z</lastmod>\n  </url>")
+	NotContains(t, string(b), "drafts")
+	NotContains(t, string(b), ".git")
+	NotContains(t, string(b), ".janusaccess")
+	NotContains(t, string(b), "x.tmp")
+}
+
+func Test_sitemap_content(t *testing.T) {
+	root := t.TempDir()
+	s := &sitemap{root: root, base: "http://localhost/", interval: time.Hour}
+	now := time.Now()
+	b, gen, err := s.content(now)
+	NoError(t, err)
+	Equal(t, now, gen)
+
+	NoError(t, os.WriteFile(filepath.Join(root, "new.txt"), nil, 0600))
+	b2, gen, err := s.content(now.Add(time.Minute))
+	NoError(t, err)
+	Equal(t, now, gen)
+	Equal(t, b, b2)
+
+	s.changed()
+	b2, _, err = s.content(now.Add(time.Minute))
+	NoError(t, err)
+	Contains(t, string(b2), "new.txt")
+
+	NoError(t, os.Remove(filepath.Join(root, "new.txt")))
+	_, gen, err = s.content(now.Add(2 * time.Hour))
+	NoError(t, err)
+	Equal(t, now.Add(2*time.Hour), gen)
+
+	var nilSitemap *sitemap
+	nilSitemap.changed()
+}
+
+func Test_serveSitemap(t *testing.T) {
+	root := t.TempDir()
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusTeapot) })
+	a := app{ServerRoot: root, Sitemap: "http://localhost/"}
+	Equal(t, http.StatusTeapot, getSitemap(serveSitemap(a, next), "/sitemap.xml").Code)
+
+	a.sitemap = newSitemap(a)
+	h := serveSitemap(a, next)
+	rec := getSitemap(h, "/sitemap.xml")
+	Equal(t, http.StatusOK, rec.Code)
+	Equal(t, "application/xml; charset=utf-8", rec.Header().Get("Content-Type"))
+	Contains(t, rec.Body.String(), "<loc>http://localhost/</loc>")
+	Equal(t, http.StatusTeapot, getSitemap(h, "/docs/sitemap.xml").Code)
+
+	NoError(t, os.WriteFile(filepath.Join(root, "sitemap.xml"), nil, 0600))
+	Equal(t, http.StatusTeapot, getSitemap(h, "/sitemap.xml").Code)
+}
+
+func getSitemap(h http.Handler, p string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, p, nil))
+	return rec
+}
@@ -0,0 +1,67 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"expvar"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Filesystem operations, whose duration is traced.
+const (
+	fsOpen    = "open"
+	fsStat    = "stat"
+	fsReadDir = "readdir"
+	fsCopy    = "copy"
+)
+
+// slowFSThreshold is the duration, after which a filesystem operation is logged as slow (0 disables the log).
+// Like templates, it is set once during startup, because files are accessed from many places without the app.
+var slowFSThreshold time.Duration
+
+// slowFSStats exposes the number of slow filesystem operations by operation.
+var slowFSStats = expvar.NewMap("slow_fs_ops")
+
+// traceFS logs the operation on the named file, if it took at least the threshold, so that slow storage e.g., an
+// overloaded NFS server, can be told apart from a slow server. The request ID correlates it with the access log.
+func traceFS(ctx context.Context, op, name string, d time.Duration) {
+	if slowFSThreshold <= 0 || d < slowFSThreshold {
+		return
+	}
+	slowFSStats.Add(op, 1)
+	log.Warn().Str("request-id", requestIDFrom(ctx)).Str("op", op).Str("path", name).Dur("duration", d).
+		Msg("Slow filesystem operation")
+}
+
+// statFS returns the FileInfo of the named file like os.Stat and traces the duration.
+func statFS(ctx context.Context, name string) (os.FileInfo, error) {
+	start := time.Now()
+	fi, err := os.Stat(name)
+	traceFS(ctx, fsStat, name, time.Since(start))
+	return fi, err
+}
+
+// openFS opens the named file for reading like os.Open and traces the duration.
+func openFS(ctx context.Context, name string) (*os.File, error) {
+	start := time.Now()
+	f, err := os.Open(filepath.Clean(name))
+	traceFS(ctx, fsOpen, name, time.Since(start))
+	return f, err
+}
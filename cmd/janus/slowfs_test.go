@@ -0,0 +1,71 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	. "github.com/stretchr/testify/require"
+)
+
+func Test_traceFS(t *testing.T) {
+	b := &bytes.Buffer{}
+	orig := log.Logger
+	log.Logger = log.Output(b)
+	t.Cleanup(func() { log.Logger, slowFSThreshold = orig, 0 })
+
+	ctx := context.WithValue(context.Background(), requestID, "42")
+	traceFS(ctx, fsStat, "/srv/a.txt", time.Hour)
+	Empty(t, b.String())
+
+	slowFSThreshold = time.Second
+	traceFS(ctx, fsStat, "/srv/a.txt", time.Millisecond)
+	Empty(t, b.String())
+	traceFS(ctx, fsReadDir, "/srv", 2*time.Second)
+	Contains(t, b.String(), `"request-id":"42","op":"readdir","path":"/srv","duration":2000`)
+	Contains(t, b.String(), `"message":"Slow filesystem operation"`)
+}
+
+func Test_statFS_openFS(t *testing.T) {
+	b := &bytes.Buffer{}
+	orig := log.Logger
+	log.Logger = log.Output(b)
+	t.Cleanup(func() { log.Logger, slowFSThreshold = orig, 0 })
+	slowFSThreshold = time.Nanosecond
+
+	name := filepath.Join(t.TempDir(), "a.txt")
+	NoError(t, os.WriteFile(name, []byte("hello"), 0600))
+	fi, err := statFS(context.Background(), name)
+	NoError(t, err)
+	Equal(t, int64(5), fi.Size())
+	Contains(t, b.String(), `"op":"stat"`)
+
+	f, err := openFS(context.Background(), name)
+	NoError(t, err)
+	_, err = copyContext(context.Background(), &bytes.Buffer{}, f)
+	NoError(t, err)
+	NoError(t, f.Close())
+	Contains(t, b.String(), `"op":"open"`)
+	Contains(t, b.String(), `"op":"copy","path":"`+name+`"`)
+
+	_, err = statFS(context.Background(), filepath.Join(t.TempDir(), "missing"))
+	ErrorIs(t, err, os.ErrNotExist)
+}
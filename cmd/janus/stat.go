@@ -0,0 +1,164 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// digestCacheSize is the maximum number of cached file digests.
+const digestCacheSize = 10000
+
+// fileStat is the JSON representation of a file or directory, which lets sync clients plan resumable and verified
+// downloads without requesting every file.
+type fileStat struct {
+	Name         string    `json:"name"`
+	Dir          bool      `json:"dir,omitempty"`
+	Size         int64     `json:"size"`
+	Modified     time.Time `json:"modified"`
+	ETag         string    `json:"etag,omitempty"`
+	AcceptRanges string    `json:"accept_ranges,omitempty"`
+	Digest       string    `json:"digest,omitempty"`
+}
+
+// fileDigests computes SHA-256 digests of files and caches them until a file is modified.
+type fileDigests struct {
+	lru *lru[string, integrityHash]
+}
+
+// newFileDigests creates an empty cache of file digests.
+func newFileDigests() *fileDigests {
+	return &fileDigests{lru: newLRU[string, integrityHash](digestCacheSize, nil)}
+}
+
+// digest returns the digest of the named file in the format of the Repr-Digest header e.g., "sha-256=:<base64>:".
+func (fd *fileDigests) digest(ctx context.Context, name string, fi os.FileInfo) (string, error) {
+	if h, ok := fd.lru.Get(name); ok && h.size == fi.Size() && h.modTime.Equal(fi.ModTime()) {
+		return h.value, nil
+	}
+
+	v, err := fileDigest(ctx, name)
+	if err != nil {
+		return "", err
+	}
+	fd.lru.Add(name, integrityHash{fi.Size(), fi.ModTime(), v})
+	return v, nil
+}
+
+// fileDigest computes the SHA-256 digest of the named file in the format of the Repr-Digest header.
+// Reading stops as soon as the context is done.
+func fileDigest(ctx context.Context, name string) (string, error) {
+	f, err := openFS(ctx, name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	d := sha256.New()
+	if _, err := copyContext(ctx, d, f); err != nil {
+		return "", err
+	}
+	return "sha-256=:" + base64.StdEncoding.EncodeToString(d.Sum(nil)) + ":", nil
+}
+
+// stat describes the named file. The digest is only computed if requested, since it requires reading the file.
+func (fd *fileDigests) stat(ctx context.Context, name string, fi os.FileInfo, digest bool) (fileStat, error) {
+	s := fileStat{Name: fi.Name(), Dir: fi.IsDir(), Modified: fi.ModTime().UTC()}
+	if !fi.Mode().IsRegular() {
+		return s, nil
+	}
+
+	s.Size, s.ETag, s.AcceptRanges = fi.Size(), fileETag(fi), "bytes"
+	if digest {
+		var err error
+		if s.Digest, err = fd.digest(ctx, name, fi); err != nil {
+			return s, err
+		}
+	}
+	return s, nil
+}
+
+// handleStat responds with the metadata of a file, or of all entries of a directory, in JSON.
+// Adding "digest" to the query includes the SHA-256 digest of files.
+func handleStat(a app, fd *fileDigests) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := filepath.Join(rootDir(a, r), r.URL.Path)
+		_, digest := r.URL.Query()["digest"]
+		fi, err := os.Stat(name)
+		if err != nil {
+			renderError(w, r, err, "file not found", http.StatusNotFound)
+			return
+		}
+		if digest {
+			release, ok := a.pools.acquire(w, r, poolChecksum)
+			if !ok {
+				return
+			}
+			defer release()
+		}
+
+		var v interface{}
+		if !fi.IsDir() {
+			if v, err = fd.stat(r.Context(), name, fi, digest); err != nil {
+				renderError(w, r, err, "cannot read file", http.StatusInternalServerError)
+				return
+			}
+		} else {
+			es, err := readDirContext(r.Context(), name)
+			if err != nil {
+				renderError(w, r, err, "cannot read directory", http.StatusInternalServerError)
+				return
+			}
+
+			ss := make([]fileStat, 0, len(es))
+			for _, e := range es {
+				if err := r.Context().Err(); err != nil {
+					renderError(w, r, err, "cannot read directory", http.StatusInternalServerError)
+					return
+				}
+				efi, err := statFS(r.Context(), filepath.Join(name, e.Name()))
+				if err != nil {
+					// the entry was removed in the meantime or is a dangling symlink
+					continue
+				}
+				s, err := fd.stat(r.Context(), filepath.Join(name, e.Name()), efi, digest)
+				if err != nil {
+					renderError(w, r, err, "cannot read file", http.StatusInternalServerError)
+					return
+				}
+				s.Name = e.Name()
+				ss = append(ss, s)
+			}
+			v = ss
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method == http.MethodHead {
+			return
+		}
+		if err := json.NewEncoder(w).Encode(v); err != nil {
+			log.Err(err).Msg("cannot render file metadata")
+		}
+	}
+}
@@ -0,0 +1,86 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/stretchr/testify/require"
+)
+
+func Test_fileDigests_digest(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "a.txt")
+	NoError(t, os.WriteFile(name, []byte("data"), 0600))
+	fi, err := os.Stat(name)
+	NoError(t, err)
+
+	fd := newFileDigests()
+	d, err := fd.digest(context.Background(), name, fi)
+	NoError(t, err)
+	Equal(t, "sha-256=:Om6weQ85rIfJTzhWst0sXREOaBFgImGpqSPTuyOtyLc=:", d)
+
+	// cached until the file is modified
+	NoError(t, os.WriteFile(name, []byte("abcd"), 0600))
+	d, err = fd.digest(context.Background(), name, fi)
+	NoError(t, err)
+	Equal(t, "sha-256=:Om6weQ85rIfJTzhWst0sXREOaBFgImGpqSPTuyOtyLc=:", d)
+}
+
+func Test_handleStat(t *testing.T) {
+	dir := t.TempDir()
+	NoError(t, os.WriteFile(filepath.Join(dir, "a.txt"), []byte("data"), 0600))
+	NoError(t, os.Mkdir(filepath.Join(dir, "sub"), 0700))
+	fi, err := os.Stat(filepath.Join(dir, "a.txt"))
+	NoError(t, err)
+	h := handleRequest(app{ServerRoot: dir})
+
+	get := func(target, accept string, v interface{}) {
+		r := httptest.NewRequest(http.MethodGet, target, nil)
+		r.Header.Set("Accept", accept)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		Equal(t, http.StatusOK, w.Code)
+		Equal(t, "application/json", w.Header().Get("Content-Type"))
+		NoError(t, json.Unmarshal(w.Body.Bytes(), v))
+	}
+
+	var s fileStat
+	get("/a.txt?stat&digest", "", &s)
+	Equal(t, "a.txt", s.Name)
+	Equal(t, int64(4), s.Size)
+	Equal(t, fileETag(fi), s.ETag)
+	Equal(t, "bytes", s.AcceptRanges)
+	Equal(t, "sha-256=:Om6weQ85rIfJTzhWst0sXREOaBFgImGpqSPTuyOtyLc=:", s.Digest)
+
+	var ss []fileStat
+	get("/", "application/json", &ss)
+	Len(t, ss, 2)
+	Equal(t, "a.txt", ss[0].Name)
+	Empty(t, ss[0].Digest)
+	Equal(t, fileETag(fi), ss[0].ETag)
+	Equal(t, "sub", ss[1].Name)
+	True(t, ss[1].Dir)
+	Empty(t, ss[1].AcceptRanges)
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/missing?stat", nil))
+	Equal(t, http.StatusNotFound, w.Code)
+}
@@ -0,0 +1,134 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// statsd sends metrics of every request to a StatsD or DogStatsD server via UDP.
+type statsd struct {
+	conn   net.Conn
+	prefix string
+	dog    bool
+	tags   []string
+}
+
+// newStatsd connects to the StatsD server at addr. If addr is empty, nil is returned.
+// In DogStatsD format, the method and the status class are sent as tags along with the given ones.
+// Otherwise, the status class is part of the metric name.
+func newStatsd(addr, prefix, format string, tags []string) (*statsd, error) {
+	if addr == "" {
+		return nil, nil
+	}
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return &statsd{conn: conn, prefix: prefix, dog: format == "dogstatsd", tags: tags}, nil
+}
+
+// request sends the metrics of a request in a single packet.
+// Since metrics are sent via UDP, lost packets go unnoticed.
+func (s *statsd) request(method string, status int, d time.Duration, sent, received int64) {
+	class := strconv.Itoa(status/100) + "xx"
+	b := &strings.Builder{}
+	if s.dog {
+		tags := "|#" + strings.Join(append([]string{"method:" + strings.ToLower(method), "status:" + class}, s.tags...), ",")
+		fmt.Fprintf(b, "%srequests:1|c%s\n", s.prefix, tags)
+		fmt.Fprintf(b, "%srequest_duration:%d|ms%s\n", s.prefix, d.Milliseconds(), tags)
+		fmt.Fprintf(b, "%sbytes_sent:%d|c%s\n", s.prefix, sent, tags)
+		fmt.Fprintf(b, "%sbytes_received:%d|c%s", s.prefix, received, tags)
+	} else {
+		fmt.Fprintf(b, "%srequests.%s:1|c\n", s.prefix, class)
+		fmt.Fprintf(b, "%srequest_duration:%d|ms\n", s.prefix, d.Milliseconds())
+		fmt.Fprintf(b, "%sbytes_sent:%d|c\n", s.prefix, sent)
+		fmt.Fprintf(b, "%sbytes_received:%d|c", s.prefix, received)
+	}
+	_, _ = s.conn.Write([]byte(b.String()))
+}
+
+// statsWriter counts the bytes of the response body.
+type statsWriter struct {
+	*ctxResponseWriter
+	sent int64
+}
+
+func (w *statsWriter) Write(b []byte) (int, error) {
+	n, err := w.ctxResponseWriter.Write(b)
+	w.sent += int64(n)
+	return n, err
+}
+
+// ReadFrom counts the bytes copied by the underlying ResponseWriter.
+func (w *statsWriter) ReadFrom(src io.Reader) (int64, error) {
+	n, err := w.ctxResponseWriter.ReadFrom(src)
+	w.sent += n
+	return n, err
+}
+
+// statsBody counts the bytes of the request body.
+type statsBody struct {
+	io.ReadCloser
+	received int64
+}
+
+func (b *statsBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.received += int64(n)
+	return n, err
+}
+
+// requestRecorder records the metrics of a request.
+type requestRecorder interface {
+	request(method string, status int, d time.Duration, sent, received int64)
+}
+
+// recorders returns the configured request recorders.
+func recorders(a app) (rs []requestRecorder) {
+	if a.statsd != nil {
+		rs = append(rs, a.statsd)
+	}
+	if a.otlp != nil {
+		rs = append(rs, a.otlp)
+	}
+	return rs
+}
+
+// reportStats passes the metrics of each request to all recorders, after it was handled.
+// If there are no recorders, h is returned as is.
+func reportStats(rs []requestRecorder, h http.Handler) http.Handler {
+	if len(rs) == 0 {
+		return h
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sw := &statsWriter{ctxResponseWriter: &ctxResponseWriter{http.StatusOK, time.Now(), w}}
+		body := &statsBody{ReadCloser: r.Body}
+		if r.Body != nil && r.Body != http.NoBody {
+			r.Body = body
+		}
+		h.ServeHTTP(sw, r)
+		for _, rec := range rs {
+			rec.request(r.Method, sw.status, time.Since(sw.time), sw.sent, body.received)
+		}
+	})
+}
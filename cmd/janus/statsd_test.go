@@ -0,0 +1,97 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/stretchr/testify/require"
+)
+
+// listenStatsd returns a UDP socket receiving metrics.
+func listenStatsd(t *testing.T) net.PacketConn {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	NoError(t, err)
+	t.Cleanup(func() { _ = pc.Close() })
+	return pc
+}
+
+// receive returns the next packet sent to the socket.
+func receive(t *testing.T, pc net.PacketConn) string {
+	NoError(t, pc.SetReadDeadline(time.Now().Add(5*time.Second)))
+	b := make([]byte, 1024)
+	n, _, err := pc.ReadFrom(b)
+	NoError(t, err)
+	return string(b[:n])
+}
+
+func Test_newStatsd(t *testing.T) {
+	s, err := newStatsd("", "janus.", "statsd", nil)
+	NoError(t, err)
+	Nil(t, s)
+
+	_, err = newStatsd("localhost", "janus.", "statsd", nil)
+	Error(t, err)
+}
+
+func Test_reportStats(t *testing.T) {
+	pc := listenStatsd(t)
+	s, err := newStatsd(pc.LocalAddr().String(), "janus.", "statsd", nil)
+	NoError(t, err)
+	h := reportStats([]requestRecorder{s}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(io.Discard, r.Body)
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte("created"))
+	}))
+
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/", strings.NewReader("data")))
+	m := receive(t, pc)
+	Contains(t, m, "janus.requests.2xx:1|c\n")
+	Regexp(t, `janus.request_duration:\d+\|ms\n`, m)
+	Contains(t, m, "janus.bytes_sent:7|c\n")
+	Contains(t, m, "janus.bytes_received:4|c")
+}
+
+func Test_reportStats_DogStatsD(t *testing.T) {
+	pc := listenStatsd(t)
+	s, err := newStatsd(pc.LocalAddr().String(), "files.", "dogstatsd", []string{"env:prod"})
+	NoError(t, err)
+	h := reportStats([]requestRecorder{s}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.(io.ReaderFrom).ReadFrom(strings.NewReader("not found"))
+	}))
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	m := receive(t, pc)
+	Contains(t, m, "files.requests:1|c|#method:get,status:2xx,env:prod\n")
+	Contains(t, m, "files.bytes_sent:9|c|#method:get,status:2xx,env:prod\n")
+	Contains(t, m, "files.bytes_received:0|c|#method:get,status:2xx,env:prod")
+	Equal(t, "not found", w.Body.String())
+}
+
+func Test_reportStats_Disabled(t *testing.T) {
+	h := http.NotFoundHandler()
+	Equal(t, http.StatusNotFound, func() int {
+		w := httptest.NewRecorder()
+		reportStats(nil, h).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+		return w.Code
+	}())
+}
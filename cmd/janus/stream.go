@@ -0,0 +1,97 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"time"
+)
+
+// dirBatchSize is the number of directory entries read at once.
+const dirBatchSize = 1000
+
+// statusClientClosedRequest is logged for requests, whose client disconnected before the response was complete
+// (as introduced by nginx).
+const statusClientClosedRequest = 499
+
+// ctxReader reads from r until the context is done e.g., because the client disconnected.
+// Generating content from files checks the context between reads instead of reading them to the end in vain.
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+	// elapsed is the total duration of the reads, excluding the time spent by the writer.
+	elapsed time.Duration
+}
+
+// Read returns the error of the context, once it is done.
+func (cr *ctxReader) Read(p []byte) (int, error) {
+	if err := cr.ctx.Err(); err != nil {
+		return 0, err
+	}
+	start := time.Now()
+	n, err := cr.r.Read(p)
+	cr.elapsed += time.Since(start)
+	return n, err
+}
+
+// copyContext copies from src to dst like io.Copy, but stops as soon as the context is done.
+// Copying from a file is traced, but only the time spent reading counts.
+func copyContext(ctx context.Context, dst io.Writer, src io.Reader) (int64, error) {
+	cr := &ctxReader{ctx: ctx, r: src}
+	n, err := io.Copy(dst, cr)
+	if f, ok := src.(*os.File); ok {
+		traceFS(ctx, fsCopy, f.Name(), cr.elapsed)
+	}
+	return n, err
+}
+
+// readDirContext reads all entries of the named directory sorted by name like os.ReadDir, but in batches,
+// so that reading a huge directory stops as soon as the context is done.
+func readDirContext(ctx context.Context, name string) ([]os.DirEntry, error) {
+	f, err := openFS(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var es []os.DirEntry
+	start := time.Now()
+	defer func() { traceFS(ctx, fsReadDir, name, time.Since(start)) }()
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		batch, err := f.ReadDir(dirBatchSize)
+		es = append(es, batch...)
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+	}
+	sort.Slice(es, func(i, j int) bool { return es[i].Name() < es[j].Name() })
+	return es, nil
+}
+
+// clientGone reports whether err is caused by the client, which disconnected while the response was generated.
+// Since nobody receives the response anymore, there is no point in rendering an error.
+func clientGone(r *http.Request, err error) bool {
+	return errors.Is(err, context.Canceled) && errors.Is(r.Context().Err(), context.Canceled)
+}
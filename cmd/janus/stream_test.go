@@ -0,0 +1,79 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	. "github.com/stretchr/testify/require"
+)
+
+func Test_copyContext(t *testing.T) {
+	b := &bytes.Buffer{}
+	n, err := copyContext(context.Background(), b, strings.NewReader("hello"))
+	NoError(t, err)
+	Equal(t, int64(5), n)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	n, err = copyContext(ctx, b, strings.NewReader("hello"))
+	ErrorIs(t, err, context.Canceled)
+	Zero(t, n)
+}
+
+func Test_readDirContext(t *testing.T) {
+	d := t.TempDir()
+	for i := 0; i < dirBatchSize+1; i++ {
+		NoError(t, os.WriteFile(filepath.Join(d, strconv.Itoa(i)), nil, 0600))
+	}
+	es, err := readDirContext(context.Background(), d)
+	NoError(t, err)
+	Len(t, es, dirBatchSize+1)
+	Equal(t, "0", es[0].Name())
+	Equal(t, "1", es[1].Name())
+	Equal(t, "10", es[2].Name())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = readDirContext(ctx, d)
+	ErrorIs(t, err, context.Canceled)
+	_, err = readDirContext(context.Background(), filepath.Join(d, "missing"))
+	ErrorIs(t, err, os.ErrNotExist)
+}
+
+func Test_renderError_ClientGone(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	r := httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx)
+	w := httptest.NewRecorder()
+	renderError(w, r, ctx.Err(), "cannot read directory", http.StatusInternalServerError)
+	Equal(t, statusClientClosedRequest, w.Code)
+	Empty(t, w.Body.String())
+
+	// other errors are rendered, even if the client is gone
+	w = httptest.NewRecorder()
+	renderError(w, r, errors.New("boom"), "cannot read directory", http.StatusInternalServerError)
+	Equal(t, http.StatusInternalServerError, w.Code)
+	False(t, clientGone(httptest.NewRequest(http.MethodGet, "/", nil), context.Canceled))
+}
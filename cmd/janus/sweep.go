@@ -0,0 +1,117 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// tempFilePatterns match the temporary files, which are written next to their destination before being renamed.
+var tempFilePatterns = []string{".janus-blob-*", ".janus-link-*", ".janus-deploy-*", ".janus-backup-*", ".janus-asset-*",
+	".janus-upstream-*"}
+
+// multipartPattern matches the files, in which large multipart uploads are buffered in the temp directory.
+const multipartPattern = "multipart-*"
+
+// sweeper removes temporary files left behind by crashes and aborted uploads.
+type sweeper struct {
+	root    string
+	tmpDir  string
+	uploads *resumableUploads
+	age     time.Duration
+}
+
+// newSweeper creates a sweeper, which removes temporary files older than the configured age.
+func newSweeper(a app) sweeper {
+	return sweeper{root: a.ServerRoot, tmpDir: os.TempDir(), uploads: a.uploads, age: a.SweepAge}
+}
+
+// run sweeps immediately and then at the given interval, if positive.
+func (s sweeper) run(interval time.Duration) {
+	s.report(s.sweep(time.Now()))
+	if interval <= 0 {
+		return
+	}
+	for now := range time.NewTicker(interval).C {
+		s.report(s.sweep(now))
+	}
+}
+
+// report logs the number of files and bytes reclaimed.
+func (s sweeper) report(files int, size int64) {
+	e := log.Debug()
+	if files > 0 {
+		e = log.Info()
+	}
+	e.Int("files", files).Int64("bytes", size).Msg("Removed orphaned temporary files")
+}
+
+// sweep removes orphaned temporary files below the server root, in the temp directory and of resumable uploads.
+// It returns the number of files and bytes reclaimed.
+func (s sweeper) sweep(now time.Time) (files int, size int64) {
+	reclaim := func(name string, fi fs.FileInfo) {
+		if err := os.Remove(name); err != nil {
+			log.Warn().Err(err).Str("name", name).Msg("Cannot remove orphaned temporary file")
+			return
+		}
+		files, size = files+1, size+fi.Size()
+	}
+	stale := func(fi fs.FileInfo) bool {
+		return fi.Mode().IsRegular() && now.Sub(fi.ModTime()) > s.age
+	}
+
+	_ = filepath.WalkDir(s.root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			if d != nil && d.IsDir() && d.Name() == uploadsDir && filepath.Dir(p) == filepath.Clean(s.root) {
+				return filepath.SkipDir
+			}
+			return nil
+		} else if !matchesAny(tempFilePatterns, d.Name()) {
+			return nil
+		}
+		if fi, err := d.Info(); err == nil && stale(fi) {
+			reclaim(p, fi)
+		}
+		return nil
+	})
+
+	if es, err := os.ReadDir(s.tmpDir); err == nil {
+		for _, e := range es {
+			if ok, _ := filepath.Match(multipartPattern, e.Name()); !ok {
+				continue
+			} else if fi, err := e.Info(); err == nil && stale(fi) {
+				reclaim(filepath.Join(s.tmpDir, e.Name()), fi)
+			}
+		}
+	}
+
+	n, sz := s.uploads.sweep(now, s.age)
+	return files + n, size + sz
+}
+
+// matchesAny reports whether the file name matches any of the patterns.
+func matchesAny(patterns []string, name string) bool {
+	for _, p := range patterns {
+		if ok, _ := filepath.Match(p, name); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,62 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/stretchr/testify/require"
+)
+
+func Test_sweeper_sweep(t *testing.T) {
+	root, tmp := t.TempDir(), t.TempDir()
+	now := time.Now()
+	write := func(name string, age time.Duration) string {
+		NoError(t, os.MkdirAll(filepath.Dir(name), 0700))
+		NoError(t, os.WriteFile(name, []byte("0123456789"), 0600))
+		NoError(t, os.Chtimes(name, now.Add(-age), now.Add(-age)))
+		return name
+	}
+
+	orphans := []string{
+		write(filepath.Join(root, ".janus-blob-1"), 2*time.Hour),
+		write(filepath.Join(root, "a", "b", ".janus-link-2"), 2*time.Hour),
+		write(filepath.Join(tmp, "multipart-3"), 2*time.Hour),
+	}
+	kept := []string{
+		write(filepath.Join(root, ".janus-deploy-4"), time.Minute),
+		write(filepath.Join(root, "data.txt"), 2*time.Hour),
+		write(filepath.Join(tmp, "other-5"), 2*time.Hour),
+	}
+
+	files, size := sweeper{root: root, tmpDir: tmp, age: time.Hour}.sweep(now)
+	Equal(t, 3, files)
+	Equal(t, int64(30), size)
+	for _, name := range orphans {
+		NoFileExists(t, name)
+	}
+	for _, name := range kept {
+		FileExists(t, name)
+	}
+}
+
+func Test_matchesAny(t *testing.T) {
+	True(t, matchesAny(tempFilePatterns, ".janus-deploy-123"))
+	False(t, matchesAny(tempFilePatterns, "janus-deploy-123"))
+	False(t, matchesAny(nil, "a"))
+}
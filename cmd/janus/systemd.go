@@ -0,0 +1,72 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// sdNotify sends a state notification (e.g., "READY=1") to the service manager.
+// If the process was not started by systemd with Type=notify, sdNotify does nothing.
+func sdNotify(state string) error {
+	name := os.Getenv("NOTIFY_SOCKET")
+	if name == "" {
+		return nil
+	}
+
+	c, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: name, Net: "unixgram"})
+	if err != nil {
+		return err
+	}
+	defer func() { _ = c.Close() }()
+	_, err = c.Write([]byte(state))
+	return err
+}
+
+// sdWatchdogInterval returns the interval, in which the service manager expects keep-alive pings.
+// If the watchdog is not enabled for this process, 0 is returned.
+func sdWatchdogInterval() time.Duration {
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0
+	}
+	us, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || us <= 0 {
+		return 0
+	}
+	return time.Duration(us) * time.Microsecond
+}
+
+// sdWatchdog sends keep-alive pings to the service manager as long as healthy reports no error.
+// Pings are sent twice per watchdog interval, so that a single delayed ping does not trigger a restart.
+func sdWatchdog(healthy func() error) {
+	d := sdWatchdogInterval()
+	if d == 0 {
+		return
+	}
+
+	log.Info().Dur("interval", d).Msg("Enabling systemd watchdog")
+	for range time.Tick(d / 2) {
+		if err := healthy(); err != nil {
+			log.Error().Err(err).Msg("Health check failed, skipping watchdog ping")
+		} else if err = sdNotify("WATCHDOG=1"); err != nil {
+			log.Warn().Err(err).Msg("Cannot notify systemd")
+		}
+	}
+}
@@ -0,0 +1,53 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build unix
+
+package main
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	. "github.com/stretchr/testify/require"
+)
+
+func Test_sdNotify(t *testing.T) {
+	NoError(t, sdNotify("READY=1"))
+
+	p := filepath.Join(t.TempDir(), "notify.sock")
+	c, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: p, Net: "unixgram"})
+	NoError(t, err)
+	defer func() { _ = c.Close() }()
+
+	t.Setenv("NOTIFY_SOCKET", p)
+	NoError(t, sdNotify("READY=1"))
+
+	b := make([]byte, 64)
+	n, err := c.Read(b)
+	NoError(t, err)
+	Equal(t, "READY=1", string(b[:n]))
+}
+
+func Test_sdWatchdogInterval(t *testing.T) {
+	t.Setenv("WATCHDOG_USEC", "2000000")
+	Equal(t, 2*time.Second, sdWatchdogInterval())
+
+	t.Setenv("WATCHDOG_PID", strconv.Itoa(os.Getpid()+1))
+	Zero(t, sdWatchdogInterval())
+}
@@ -0,0 +1,242 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// templates holds the custom templates, if configured.
+// Like outboundTransport, it is set once during startup, because errors are rendered without access to the app.
+var templates *pageTemplates
+
+// templateFuncs are the functions available in custom templates in addition to the built-in ones.
+var templateFuncs = template.FuncMap{
+	"humanBytes": humanBytes,
+	"humanTime":  func(t time.Time) string { return humanTime(t, time.Now()) },
+	"formatTime": func(layout string, t time.Time) string { return t.Format(layout) },
+}
+
+// pageTemplates holds the custom templates of the upload page, directory listings and error pages.
+// Pages without a custom template are rendered as usual.
+type pageTemplates struct {
+	prefix    string
+	brand     *brand
+	upload    *template.Template
+	listing   *template.Template
+	errorPage *template.Template
+}
+
+// pageData holds the variables available in every custom template.
+type pageData struct {
+	Version   string
+	Prefix    string
+	Path      string
+	User      string
+	Groups    []string
+	RequestID string
+	// Head is the beginning of the page including the theme and the brand, as rendered on the built-in pages.
+	Head template.HTML
+	// T translates a message into the language of the client.
+	T func(string) string
+}
+
+// uploadData holds the variables of the upload page.
+type uploadData struct {
+	pageData
+	Action   string
+	Progress string
+}
+
+// listingData holds the variables of directory listings.
+type listingData struct {
+	pageData
+	Entries []listingEntry
+}
+
+// listingEntry describes a file or directory in a listing.
+type listingEntry struct {
+	Name    string
+	URL     string
+	IsDir   bool
+	Size    int64
+	ModTime time.Time
+}
+
+// errorData holds the variables of error pages.
+type errorData struct {
+	pageData
+	Status  int
+	Code    errorCode
+	Message string
+}
+
+// loadTemplates parses the templates "upload.html", "listing.html" and "error.html" in the given directory.
+// Missing templates are not an error, but at least one must exist.
+// If no directory is configured, nil is returned.
+func loadTemplates(dir, prefix string, b *brand) (*pageTemplates, error) {
+	if dir == "" {
+		return nil, nil
+	}
+
+	pt := &pageTemplates{prefix: prefix, brand: b}
+	for name, t := range map[string]**template.Template{
+		"upload.html":  &pt.upload,
+		"listing.html": &pt.listing,
+		"error.html":   &pt.errorPage,
+	} {
+		s, err := os.ReadFile(filepath.Join(dir, name))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		if *t, err = template.New(name).Funcs(templateFuncs).Parse(string(s)); err != nil {
+			return nil, err
+		}
+	}
+	if pt.upload == nil && pt.listing == nil && pt.errorPage == nil {
+		return nil, fmt.Errorf("no template found in %s (expected upload.html, listing.html or error.html)", dir)
+	}
+	return pt, nil
+}
+
+// data returns the variables common to all pages.
+func (pt *pageTemplates) data(r *http.Request, title string) pageData {
+	d := pageData{
+		Version:   version,
+		Prefix:    pt.prefix,
+		Path:      r.URL.Path,
+		RequestID: requestIDFrom(r.Context()),
+		T:         func(m string) string { return tr(r, m) },
+	}
+	if id := identityFrom(r.Context()); id != nil {
+		d.User, d.Groups = id.name, id.groups
+	}
+	head := &bytes.Buffer{}
+	if err := pt.brand.writeHead(head, d.T(title)); err == nil {
+		d.Head = template.HTML(head.String()) //nolint:gosec
+	}
+	return d
+}
+
+// execute renders a template into a buffer first, so that errors do not result in half a page.
+func execute(w http.ResponseWriter, t *template.Template, status int, data interface{}) error {
+	b := &bytes.Buffer{}
+	if err := t.Execute(b, data); err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+// serveUpload renders the custom upload page and reports whether it exists.
+func (pt *pageTemplates) serveUpload(w http.ResponseWriter, r *http.Request, action, progress string) bool {
+	if pt == nil || pt.upload == nil {
+		return false
+	}
+	if err := execute(w, pt.upload, http.StatusOK, uploadData{pt.data(r, "Upload"), action, progress}); err != nil {
+		renderError(w, r, err, "upload page not available", http.StatusInternalServerError)
+	}
+	return true
+}
+
+// serveListing renders the custom listing of the given directory and reports whether it exists.
+// Custom listings are not cached, because they may depend on the user.
+func (pt *pageTemplates) serveListing(w http.ResponseWriter, r *http.Request, dir string) bool {
+	if pt == nil || pt.listing == nil {
+		return false
+	}
+
+	es, err := readDirContext(r.Context(), dir)
+	if err != nil {
+		renderError(w, r, err, "cannot read directory", http.StatusInternalServerError)
+		return true
+	}
+	d := listingData{pageData: pt.data(r, r.URL.Path)}
+	for _, e := range es {
+		fi, err := e.Info()
+		if err != nil {
+			continue
+		}
+		name := e.Name()
+		if e.IsDir() {
+			name += "/"
+		}
+		u := url.URL{Path: name}
+		d.Entries = append(d.Entries, listingEntry{name, u.String(), e.IsDir(), fi.Size(), fi.ModTime()})
+	}
+	if err := execute(w, pt.listing, http.StatusOK, d); err != nil {
+		renderError(w, r, err, "cannot render directory listing", http.StatusInternalServerError)
+	}
+	return true
+}
+
+// renderError renders the custom error page for browsers and reports whether it exists.
+// The error page itself must not fail, hence rendering errors are only logged.
+func (pt *pageTemplates) renderError(w http.ResponseWriter, r *http.Request, code errorCode, m string, status int) bool {
+	if pt == nil || pt.errorPage == nil || !strings.Contains(r.Header.Get("Accept"), "text/html") {
+		return false
+	}
+	d := errorData{pt.data(r, http.StatusText(status)), status, code, tr(r, m)}
+	return execute(w, pt.errorPage, status, d) == nil
+}
+
+// humanBytes formats a size using binary prefixes e.g., "1.5 MiB".
+func humanBytes(n int64) string {
+	if n < 1024 {
+		return fmt.Sprintf("%d B", n)
+	}
+	f, i := float64(n)/1024, 0
+	for f >= 1024 && i < 5 {
+		f /= 1024
+		i++
+	}
+	return fmt.Sprintf("%.1f %ciB", f, "KMGTPE"[i])
+}
+
+// humanTime formats a time relative to now e.g., "5 minutes ago".
+// Times older than a week are formatted as date.
+func humanTime(t, now time.Time) string {
+	d := now.Sub(t)
+	plural := func(n int, unit string) string {
+		if n == 1 {
+			return "1 " + unit + " ago"
+		}
+		return fmt.Sprintf("%d %ss ago", n, unit)
+	}
+	switch {
+	case d < time.Minute:
+		return "just now"
+	case d < time.Hour:
+		return plural(int(d/time.Minute), "minute")
+	case d < 24*time.Hour:
+		return plural(int(d/time.Hour), "hour")
+	case d < 7*24*time.Hour:
+		return plural(int(d/(24*time.Hour)), "day")
+	}
+	return t.Format("2006-01-02")
+}
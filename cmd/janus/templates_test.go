@@ -0,0 +1,122 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/stretchr/testify/require"
+)
+
+// useTemplates loads the given templates for the duration of the test.
+func useTemplates(t *testing.T, files map[string]string) {
+	t.Helper()
+	dir := t.TempDir()
+	for name, s := range files {
+		NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(s), 0600))
+	}
+	pt, err := loadTemplates(dir, "/files/", nil)
+	NoError(t, err)
+	templates = pt
+	t.Cleanup(func() { templates = nil })
+}
+
+func Test_loadTemplates(t *testing.T) {
+	pt, err := loadTemplates("", "/", nil)
+	NoError(t, err)
+	Nil(t, pt)
+
+	dir := t.TempDir()
+	_, err = loadTemplates(dir, "/", nil)
+	ErrorContains(t, err, "no template found")
+
+	NoError(t, os.WriteFile(filepath.Join(dir, "error.html"), []byte("{{.Message"), 0600))
+	_, err = loadTemplates(dir, "/", nil)
+	ErrorContains(t, err, "unclosed action")
+
+	NoError(t, os.WriteFile(filepath.Join(dir, "error.html"), []byte("{{.Message}}"), 0600))
+	pt, err = loadTemplates(dir, "/", nil)
+	NoError(t, err)
+	NotNil(t, pt.errorPage)
+	Nil(t, pt.upload)
+}
+
+func Test_pageTemplates_serveListing(t *testing.T) {
+	useTemplates(t, map[string]string{"listing.html": `{{.Prefix}} {{.Path}} {{.User}}
+{{range .Entries}}{{.Name}} {{.URL}} {{.IsDir}} {{humanBytes .Size}} {{formatTime "2006" .ModTime}}
+{{end}}`})
+	root := t.TempDir()
+	NoError(t, os.Mkdir(filepath.Join(root, "sub"), 0700))
+	NoError(t, os.WriteFile(filepath.Join(root, "a b.txt"), make([]byte, 2048), 0600))
+	mtime := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	NoError(t, os.Chtimes(filepath.Join(root, "a b.txt"), mtime, mtime))
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	handleRequest(app{ServerRoot: root}).ServeHTTP(w, withIdentity(r, &identity{name: "alice"}))
+	Equal(t, http.StatusOK, w.Code)
+	Equal(t, "text/html; charset=utf-8", w.Header().Get("Content-Type"))
+	Contains(t, w.Body.String(), "/files/ / alice\n")
+	Contains(t, w.Body.String(), "a b.txt a%20b.txt false 2.0 KiB 2024\n")
+	Contains(t, w.Body.String(), "sub/ sub/ true")
+}
+
+func Test_pageTemplates_serveUpload(t *testing.T) {
+	useTemplates(t, map[string]string{"upload.html": `{{.Action}} {{call .T "Upload"}} {{.Version}}`})
+	w := httptest.NewRecorder()
+	handleUploadPage(app{ServerRoot: t.TempDir(), Prefix: "/files/"}, nil).
+		ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/?upload", nil))
+	Equal(t, http.StatusOK, w.Code)
+	Equal(t, "/files/ Upload "+version, w.Body.String())
+}
+
+func Test_pageTemplates_renderError(t *testing.T) {
+	useTemplates(t, map[string]string{"error.html": `{{.Status}} {{.Code}} {{.Message}} {{.RequestID}}`})
+	render := func(accept string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("Accept", accept)
+		w := httptest.NewRecorder()
+		renderError(w, r, errors.New("boom"), "file not found", http.StatusNotFound)
+		return w
+	}
+
+	w := render("text/html,application/xhtml+xml")
+	Equal(t, http.StatusNotFound, w.Code)
+	Equal(t, "404 JANUS_NOT_FOUND file not found ", w.Body.String())
+	Equal(t, "Error: file not found\n", render("*/*").Body.String())
+	Contains(t, render("application/json").Body.String(), `"code":"JANUS_NOT_FOUND"`)
+}
+
+func Test_humanBytes(t *testing.T) {
+	Equal(t, "0 B", humanBytes(0))
+	Equal(t, "1023 B", humanBytes(1023))
+	Equal(t, "1.5 KiB", humanBytes(1536))
+	Equal(t, "1.0 GiB", humanBytes(1<<30))
+}
+
+func Test_humanTime(t *testing.T) {
+	now := time.Date(2024, 1, 10, 12, 0, 0, 0, time.UTC)
+	Equal(t, "just now", humanTime(now.Add(-time.Second), now))
+	Equal(t, "1 minute ago", humanTime(now.Add(-time.Minute), now))
+	Equal(t, "5 hours ago", humanTime(now.Add(-5*time.Hour), now))
+	Equal(t, "2 days ago", humanTime(now.Add(-50*time.Hour), now))
+	Equal(t, "2023-12-01", humanTime(time.Date(2023, 12, 1, 0, 0, 0, 0, time.UTC), now))
+}
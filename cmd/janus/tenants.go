@@ -0,0 +1,208 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// tenant is an isolated part of the server, which is served from its own directory below the server root.
+type tenant struct {
+	name        string
+	dir         string
+	tokenHashes [][]byte
+	groups      []string
+	maxRequests int64
+	inflight    int64
+}
+
+// tenants holds all tenants in the order of the tenants file.
+type tenants []*tenant
+
+// loadTenants reads a tenants file, in which each line has the form "<tenant> <dir> [<key>=<value>...]".
+// The directory is relative to the server root. The following keys are supported, and may be repeated:
+//
+//   - token: SHA-256 hash (hex encoded) of a bearer token, which authenticates API clients as the tenant
+//   - group: group of authenticated users, who belong to the tenant
+//   - max-requests: maximum number of simultaneous requests of the tenant
+//
+// Users belong to the tenant with their name as well.
+// Empty lines and lines starting with '#' are ignored. If name is empty, nil is returned.
+func loadTenants(name string) (tenants, error) {
+	if name == "" {
+		return nil, nil
+	}
+
+	b, err := os.ReadFile(filepath.Clean(name))
+	if err != nil {
+		return nil, err
+	}
+	var ts tenants
+	for n, line := range strings.Split(string(b), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		t, err := parseTenant(line)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", name, n+1, err)
+		}
+		ts = append(ts, t)
+	}
+	return ts, nil
+}
+
+// parseTenant parses a single line of a tenants file.
+func parseTenant(line string) (*tenant, error) {
+	fs := strings.Fields(line)
+	if len(fs) < 2 {
+		return nil, fmt.Errorf("invalid entry %q", line)
+	}
+	t := &tenant{name: fs[0], dir: filepath.Clean(filepath.FromSlash(fs[1]))}
+	if filepath.IsAbs(t.dir) || t.dir == "." || t.dir == ".." || strings.HasPrefix(t.dir, ".."+string(filepath.Separator)) {
+		return nil, fmt.Errorf("directory of tenant %s must be below the server root: %q", t.name, fs[1])
+	}
+
+	for _, f := range fs[2:] {
+		k, v, _ := strings.Cut(f, "=")
+		switch k {
+		case "token":
+			h, err := hex.DecodeString(v)
+			if err != nil || len(h) != sha256.Size {
+				return nil, fmt.Errorf("invalid token hash of tenant %s (must be hex encoded SHA-256)", t.name)
+			}
+			t.tokenHashes = append(t.tokenHashes, h)
+		case "group":
+			t.groups = append(t.groups, v)
+		case "max-requests":
+			n, err := strconv.ParseInt(v, 10, 64)
+			if err != nil || n <= 0 {
+				return nil, fmt.Errorf("invalid max-requests of tenant %s: %q", t.name, v)
+			}
+			t.maxRequests = n
+		default:
+			return nil, fmt.Errorf("unknown key of tenant %s: %q", t.name, k)
+		}
+	}
+	return t, nil
+}
+
+// byToken returns the tenant, which the bearer token belongs to, or nil if the token is unknown.
+func (ts tenants) byToken(tok string) *tenant {
+	h := sha256.Sum256([]byte(tok))
+	for _, t := range ts {
+		for _, th := range t.tokenHashes {
+			if subtle.ConstantTimeCompare(h[:], th) == 1 {
+				return t
+			}
+		}
+	}
+	return nil
+}
+
+// of returns the first tenant, which the identity belongs to, or nil if there is none.
+func (ts tenants) of(id *identity) *tenant {
+	if id == nil {
+		return nil
+	}
+	for _, t := range ts {
+		if t.name == id.name {
+			return t
+		}
+		for _, g := range t.groups {
+			if id.inGroup(g) {
+				return t
+			}
+		}
+	}
+	return nil
+}
+
+// authenticateTokens serves requests carrying the bearer token of a tenant via authed, skipping other authentication
+// methods. All other requests are passed to h. If no tenant has a token, h is returned as is.
+func authenticateTokens(ts tenants, authed, h http.Handler) http.Handler {
+	hasTokens := false
+	for _, t := range ts {
+		hasTokens = hasTokens || len(t.tokenHashes) > 0
+	}
+	if !hasTokens {
+		return h
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth := r.Header.Get("Authorization")
+		if !strings.HasPrefix(auth, "Bearer ") {
+			h.ServeHTTP(w, r)
+			return
+		}
+		if t := ts.byToken(strings.TrimPrefix(auth, "Bearer ")); t != nil {
+			authed.ServeHTTP(w, withIdentity(r, &identity{name: t.name}))
+			return
+		}
+
+		log.Warn().Str("request-id", requestIDFrom(r.Context())).Str("client", clientIP(r)).Msg("Invalid tenant token")
+		w.Header().Set("WWW-Authenticate", `Bearer realm="`+realm+`"`)
+		renderError(w, r, errAccessDenied, "invalid token", http.StatusUnauthorized)
+	})
+}
+
+// requireTenant rejects clients, which do not belong to any tenant, limits the simultaneous requests of each tenant
+// and creates the directory of a tenant on first access.
+// If no tenants are configured, h is returned as is.
+func requireTenant(a app, h http.Handler) http.Handler {
+	if len(a.tenants) == 0 {
+		return h
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t := a.tenants.of(identityFrom(r.Context()))
+		if t == nil {
+			renderError(w, r, errAccessDenied, "access denied", http.StatusForbidden)
+			return
+		}
+		if n := atomic.AddInt64(&t.inflight, 1); t.maxRequests > 0 && n > t.maxRequests {
+			atomic.AddInt64(&t.inflight, -1)
+			w.Header().Set("Retry-After", "1")
+			renderError(w, r, errTooManyRequests, "too many concurrent requests", http.StatusTooManyRequests)
+			return
+		}
+		defer atomic.AddInt64(&t.inflight, -1)
+
+		dir := filepath.Join(a.ServerRoot, t.dir)
+		if _, err := os.Stat(dir); os.IsNotExist(err) {
+			if err = os.MkdirAll(dir, 0750); err != nil {
+				renderError(w, r, err, "cannot create tenant directory", http.StatusInternalServerError)
+				return
+			}
+			log.Info().Str("tenant", t.name).Str("dir", dir).Msg("Created tenant directory")
+		}
+		if e, ok := r.Context().Value(logger).(*zerolog.Event); ok {
+			e.Str("tenant", t.name)
+		}
+		h.ServeHTTP(w, r)
+	})
+}
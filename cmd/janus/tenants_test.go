@@ -0,0 +1,171 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/stretchr/testify/require"
+)
+
+// tokenHash returns the hex encoded SHA-256 hash of a token as used in tenants files.
+func tokenHash(tok string) string {
+	h := sha256.Sum256([]byte(tok))
+	return hex.EncodeToString(h[:])
+}
+
+func Test_loadTenants(t *testing.T) {
+	ts, err := loadTenants("")
+	NoError(t, err)
+	Nil(t, ts)
+
+	name := filepath.Join(t.TempDir(), "tenants")
+	NoError(t, os.WriteFile(name, []byte("# tenants\n\n"+
+		"acme tenants/acme token="+tokenHash("s3cr3t")+" group=acme-devs max-requests=2\n"+
+		"alice users/alice\n"), 0600))
+	ts, err = loadTenants(name)
+	NoError(t, err)
+	Len(t, ts, 2)
+	Equal(t, "acme", ts[0].name)
+	Equal(t, filepath.Join("tenants", "acme"), ts[0].dir)
+	Len(t, ts[0].tokenHashes, 1)
+	Equal(t, []string{"acme-devs"}, ts[0].groups)
+	Equal(t, int64(2), ts[0].maxRequests)
+	Equal(t, filepath.Join("users", "alice"), ts[1].dir)
+
+	NoError(t, os.WriteFile(name, []byte("acme\n"), 0600))
+	_, err = loadTenants(name)
+	EqualError(t, err, name+`:1: invalid entry "acme"`)
+	_, err = loadTenants(filepath.Join(t.TempDir(), "missing"))
+	Error(t, err)
+}
+
+func Test_parseTenant(t *testing.T) {
+	for _, line := range []string{
+		"acme /srv/acme",
+		"acme ../acme",
+		"acme .",
+		"acme acme token=abc",
+		"acme acme max-requests=0",
+		"acme acme quota=1",
+	} {
+		_, err := parseTenant(line)
+		Error(t, err, line)
+	}
+}
+
+func Test_tenants_byToken(t *testing.T) {
+	ts, err := tenantsOf("acme acme token="+tokenHash("a")+" token="+tokenHash("b"), "beta beta token="+tokenHash("c"))
+	NoError(t, err)
+	Equal(t, "acme", ts.byToken("b").name)
+	Equal(t, "beta", ts.byToken("c").name)
+	Nil(t, ts.byToken("d"))
+}
+
+func Test_tenants_of(t *testing.T) {
+	ts, err := tenantsOf("acme acme group=devs", "alice alice", "beta beta group=devs")
+	NoError(t, err)
+	Nil(t, ts.of(nil))
+	Nil(t, ts.of(&identity{name: "bob"}))
+	Equal(t, "acme", ts.of(&identity{name: "bob", groups: []string{"ops", "devs"}}).name)
+	Equal(t, "alice", ts.of(&identity{name: "alice"}).name)
+	Equal(t, "acme", ts.of(&identity{name: "alice", groups: []string{"devs"}}).name, "first match wins")
+	Nil(t, tenants(nil).of(&identity{name: "alice"}))
+}
+
+func Test_authenticateTokens(t *testing.T) {
+	authed := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("authed " + identityFrom(r.Context()).name))
+	})
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { _, _ = w.Write([]byte("login")) })
+
+	ts, err := tenantsOf("acme acme group=devs")
+	NoError(t, err)
+	rec := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Authorization", "Bearer s3cr3t")
+	authenticateTokens(ts, authed, h).ServeHTTP(rec, r)
+	Equal(t, "login", rec.Body.String())
+
+	ts, err = tenantsOf("acme acme token=" + tokenHash("s3cr3t"))
+	NoError(t, err)
+	rec = httptest.NewRecorder()
+	authenticateTokens(ts, authed, h).ServeHTTP(rec, r)
+	Equal(t, "authed acme", rec.Body.String())
+
+	r.Header.Set("Authorization", "Bearer wrong")
+	rec = httptest.NewRecorder()
+	authenticateTokens(ts, authed, h).ServeHTTP(rec, r)
+	Equal(t, http.StatusUnauthorized, rec.Code)
+	Equal(t, `Bearer realm="janus"`, rec.Header().Get("WWW-Authenticate"))
+
+	r.Header.Set("Authorization", "Basic YWxpY2U6cGFzcw==")
+	rec = httptest.NewRecorder()
+	authenticateTokens(ts, authed, h).ServeHTTP(rec, r)
+	Equal(t, "login", rec.Body.String())
+}
+
+func Test_requireTenant(t *testing.T) {
+	ts, err := tenantsOf("acme tenants/acme max-requests=1")
+	NoError(t, err)
+	a := app{ServerRoot: t.TempDir(), tenants: ts}
+	var inner http.HandlerFunc
+	h := requireTenant(a, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { inner(w, r) }))
+	serve := func(id *identity) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		if id != nil {
+			r = withIdentity(r, id)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, r)
+		return rec
+	}
+
+	inner = func(w http.ResponseWriter, r *http.Request) { _, _ = w.Write([]byte(rootDir(a, r))) }
+	Equal(t, http.StatusForbidden, serve(nil).Code)
+	Equal(t, http.StatusForbidden, serve(&identity{name: "bob"}).Code)
+	NoDirExists(t, filepath.Join(a.ServerRoot, "tenants", "acme"))
+
+	rec := serve(&identity{name: "acme"})
+	Equal(t, http.StatusOK, rec.Code)
+	Equal(t, filepath.Join(a.ServerRoot, "tenants", "acme"), rec.Body.String())
+	DirExists(t, filepath.Join(a.ServerRoot, "tenants", "acme"))
+
+	inner = func(w http.ResponseWriter, r *http.Request) {
+		nested := serve(&identity{name: "acme"})
+		w.WriteHeader(nested.Code)
+	}
+	Equal(t, http.StatusTooManyRequests, serve(&identity{name: "acme"}).Code)
+	Equal(t, int64(0), ts[0].inflight)
+}
+
+// tenantsOf parses the given lines of a tenants file.
+func tenantsOf(lines ...string) (tenants, error) {
+	var ts tenants
+	for _, l := range lines {
+		t, err := parseTenant(l)
+		if err != nil {
+			return nil, err
+		}
+		ts = append(ts, t)
+	}
+	return ts, nil
+}
@@ -0,0 +1,171 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// limitDuration aborts requests, which are not handled within the given duration.
+// If the response has not been started yet, "503 Service Unavailable" is sent.
+// Otherwise, the response is truncated.
+//
+// Requests matching one of the exempt patterns (see matchPath) are not subject to the deadline.
+// If d is not positive, h is returned as is.
+func limitDuration(d time.Duration, exempt []string, h http.Handler) http.Handler {
+	if d <= 0 {
+		return h
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if matchPath(exempt, r.URL.Path) {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), d)
+		defer cancel()
+
+		tw := &timeoutWriter{w: w, h: http.Header{}}
+		done, panicked := make(chan struct{}), make(chan interface{}, 1)
+		go func() {
+			defer func() {
+				// like http.TimeoutHandler, a panic is passed on, so that it only fails the request
+				if p := recover(); p != nil {
+					panicked <- p
+				}
+			}()
+			h.ServeHTTP(tw, r.WithContext(ctx))
+			close(done)
+		}()
+
+		select {
+		case p := <-panicked:
+			panic(p)
+		case <-done:
+		case <-ctx.Done():
+			tw.timeout(r)
+			log.Warn().Str("request-id", requestIDFrom(r.Context())).Str("path", r.URL.Path).
+				Dur("timeout", d).Msg("Request timed out")
+		}
+	})
+}
+
+// matchPath reports whether p matches any of the given patterns.
+// A pattern ending with a slash matches all paths below it, otherwise path.Match is applied.
+func matchPath(patterns []string, p string) bool {
+	for _, pat := range patterns {
+		if strings.HasSuffix(pat, "/") && strings.HasPrefix(p, pat) {
+			return true
+		} else if ok, _ := path.Match(pat, p); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// timeoutWriter discards all writes after the deadline of a request was exceeded.
+type timeoutWriter struct {
+	mu          sync.Mutex
+	w           http.ResponseWriter
+	h           http.Header
+	wroteHeader bool
+	timedOut    bool
+}
+
+func (tw *timeoutWriter) Header() http.Header {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	return tw.h
+}
+
+func (tw *timeoutWriter) Write(p []byte) (int, error) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	tw.writeHeaderLocked(http.StatusOK)
+	return tw.w.Write(p)
+}
+
+func (tw *timeoutWriter) WriteHeader(status int) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if !tw.timedOut {
+		tw.writeHeaderLocked(status)
+	}
+}
+
+// Flush delegates to the underlying ResponseWriter, if it implements http.Flusher, unless the deadline was exceeded.
+func (tw *timeoutWriter) Flush() {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut {
+		return
+	}
+	tw.writeHeaderLocked(http.StatusOK)
+	if fl, ok := tw.w.(http.Flusher); ok {
+		fl.Flush()
+	}
+}
+
+// ReadFrom delegates to the underlying ResponseWriter, if it implements io.ReaderFrom, so that sendfile(2) can be used.
+// Since the lock is held during the transfer, the deadline takes effect once it is complete.
+func (tw *timeoutWriter) ReadFrom(src io.Reader) (int64, error) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	tw.writeHeaderLocked(http.StatusOK)
+	if rf, ok := tw.w.(io.ReaderFrom); ok {
+		return rf.ReadFrom(src)
+	}
+	return io.Copy(struct{ io.Writer }{tw.w}, src)
+}
+
+func (tw *timeoutWriter) writeHeaderLocked(status int) {
+	if tw.wroteHeader {
+		return
+	}
+
+	for k, v := range tw.h {
+		tw.w.Header()[k] = v
+	}
+	if status >= http.StatusOK {
+		tw.wroteHeader = true
+	}
+	tw.w.WriteHeader(status)
+}
+
+// timeout prevents further writes and sends "503 Service Unavailable", if possible.
+func (tw *timeoutWriter) timeout(r *http.Request) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if !tw.wroteHeader {
+		tw.w.Header().Set("Connection", "close")
+		renderError(tw.w, r, context.DeadlineExceeded, "request timed out", http.StatusServiceUnavailable)
+	}
+	tw.timedOut = true
+}
@@ -0,0 +1,85 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/stretchr/testify/require"
+)
+
+func Test_limitDuration(t *testing.T) {
+	h := limitDuration(10*time.Millisecond, []string{"/stream/"}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/fast" {
+			time.Sleep(50 * time.Millisecond)
+		}
+		w.Header().Set("X-Test", "ok")
+		_, _ = w.Write([]byte("done"))
+	}))
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/fast", nil))
+	Equal(t, http.StatusOK, w.Code)
+	Equal(t, "ok", w.Header().Get("X-Test"))
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/slow", nil))
+	Equal(t, http.StatusServiceUnavailable, w.Code)
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/stream/slow", nil))
+	Equal(t, "done", w.Body.String())
+}
+
+func Test_matchPath(t *testing.T) {
+	pats := []string{"/big/", "/logs/*.log"}
+	True(t, matchPath(pats, "/big/a/b"))
+	True(t, matchPath(pats, "/logs/x.log"))
+	False(t, matchPath(pats, "/logs/a/x.log"))
+	False(t, matchPath(pats, "/small"))
+	False(t, matchPath(nil, "/"))
+}
+
+func Test_limitDuration_Panic(t *testing.T) {
+	h := limitDuration(time.Second, nil, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic(http.ErrAbortHandler)
+	}))
+	PanicsWithValue(t, http.ErrAbortHandler, func() {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	})
+}
+
+func Test_timeoutWriter_Flush(t *testing.T) {
+	w := httptest.NewRecorder()
+	tw := &timeoutWriter{w: w, h: http.Header{}}
+	tw.Header().Set("X-Test", "ok")
+	tw.Flush()
+	True(t, w.Flushed)
+	Equal(t, "ok", w.Header().Get("X-Test"))
+
+	n, err := tw.ReadFrom(strings.NewReader("data"))
+	NoError(t, err)
+	Equal(t, int64(4), n)
+	Equal(t, "data", w.Body.String())
+
+	tw.timeout(httptest.NewRequest(http.MethodGet, "/", nil))
+	_, err = tw.ReadFrom(strings.NewReader("more"))
+	ErrorIs(t, err, http.ErrHandlerTimeout)
+	Equal(t, "data", w.Body.String())
+}
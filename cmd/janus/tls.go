@@ -0,0 +1,301 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"golang.org/x/crypto/acme"
+)
+
+// tlsVersions maps the supported values of the minimum TLS version to their protocol version.
+var tlsVersions = map[string]uint16{"1.2": tls.VersionTLS12, "1.3": tls.VersionTLS13}
+
+// newTLSConfig creates a TLS configuration, which serves the certificates of the given store.
+// During the handshake, the certificate is selected based on the server name requested by the client (SNI).
+// If no certificate matches, the first one is used.
+// If ACME is enabled, the certificates are obtained via ACME instead.
+//
+// If cs is nil and ACME is disabled, nil is returned.
+func newTLSConfig(a app, cs *certStore) (*tls.Config, error) {
+	var getCert func(*tls.ClientHelloInfo) (*tls.Certificate, error)
+	switch {
+	case a.acme != nil:
+		getCert = a.acme.GetCertificate
+	case cs != nil:
+		getCert = cs.getCertificate
+	case len(a.TLSClientCAs) > 0:
+		return nil, errors.New("client certificate authentication requires a server certificate")
+	default:
+		return nil, nil
+	}
+
+	minVer, ok := tlsVersions[a.TLSMinVersion]
+	if !ok {
+		return nil, fmt.Errorf("unsupported TLS version: %s", a.TLSMinVersion)
+	} else if minVer == tls.VersionTLS13 && len(a.TLSCiphers) > 0 {
+		return nil, errors.New("cipher suites cannot be configured for TLS 1.3")
+	}
+	ciphers, err := cipherSuites(a.TLSCiphers)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := &tls.Config{
+		GetCertificate: getCert,
+		MinVersion:     minVer,
+		CipherSuites:   ciphers,
+		NextProtos:     []string{"h2", "http/1.1"},
+	}
+	if a.acme != nil {
+		// TLS-ALPN-01 challenges are answered by the ACME manager during the handshake
+		cfg.NextProtos = append(cfg.NextProtos, acme.ALPNProto)
+	}
+	if len(a.TLSClientCAs) > 0 {
+		if cfg.ClientCAs, err = loadCertPool(a.TLSClientCAs); err != nil {
+			return nil, err
+		}
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	log.Info().Str("min-version", a.TLSMinVersion).Strs("ciphers", enabledCipherSuites(cfg)).
+		Bool("client-auth", cfg.ClientCAs != nil).Msg("TLS policy")
+	return cfg, nil
+}
+
+// loadCertPool reads PEM encoded CA certificates from the given files.
+func loadCertPool(files []string) (*x509.CertPool, error) {
+	pool := x509.NewCertPool()
+	if err := appendCerts(pool, files); err != nil {
+		return nil, err
+	}
+	return pool, nil
+}
+
+// appendCerts adds the PEM encoded CA certificates in the given files to the pool.
+func appendCerts(pool *x509.CertPool, files []string) error {
+	for _, f := range files {
+		b, err := os.ReadFile(f)
+		if err != nil {
+			return err
+		} else if !pool.AppendCertsFromPEM(b) {
+			return fmt.Errorf("no certificate found in %s", f)
+		}
+	}
+	return nil
+}
+
+// cipherSuites looks up the IDs of the given TLS 1.2 cipher suites by their (case-insensitive) names.
+// Insecure cipher suites are not supported.
+func cipherSuites(names []string) ([]uint16, error) {
+	var ids []uint16
+	for _, n := range names {
+		var cs *tls.CipherSuite
+		for _, c := range tls.CipherSuites() {
+			if strings.EqualFold(c.Name, strings.TrimSpace(n)) && supportsVersion(c, tls.VersionTLS12) {
+				cs = c
+				break
+			}
+		}
+		if cs == nil {
+			return nil, fmt.Errorf("unsupported TLS 1.2 cipher suite: %s", n)
+		}
+		ids = append(ids, cs.ID)
+	}
+	return ids, nil
+}
+
+// enabledCipherSuites returns the names of all cipher suites, which can be negotiated with the given configuration.
+// The cipher suites of TLS 1.3 are always enabled.
+func enabledCipherSuites(cfg *tls.Config) (names []string) {
+	for _, c := range tls.CipherSuites() {
+		if supportsVersion(c, tls.VersionTLS13) || cfg.MinVersion <= tls.VersionTLS12 && len(cfg.CipherSuites) == 0 {
+			names = append(names, c.Name)
+		}
+	}
+	for _, id := range cfg.CipherSuites {
+		names = append(names, tls.CipherSuiteName(id))
+	}
+	return names
+}
+
+// supportsVersion reports whether the cipher suite can be used with the given TLS version.
+func supportsVersion(c *tls.CipherSuite, version uint16) bool {
+	for _, v := range c.SupportedVersions {
+		if v == version {
+			return true
+		}
+	}
+	return false
+}
+
+// certStore holds the certificates loaded from the configured files and replaces them, once the files change.
+type certStore struct {
+	mu        sync.RWMutex
+	certFiles []string
+	keyFiles  []string
+	certs     []tls.Certificate
+	modTimes  []time.Time
+	reloaded  chan struct{}
+}
+
+// newCertStore loads the given certificates and key pairs.
+// If no certificate is configured, nil is returned.
+func newCertStore(certFiles, keyFiles []string) (*certStore, error) {
+	if len(certFiles) == 0 && len(keyFiles) == 0 {
+		return nil, nil
+	} else if len(certFiles) != len(keyFiles) {
+		return nil, errors.New("number of TLS certificates and keys must match")
+	}
+
+	cs := &certStore{certFiles: certFiles, keyFiles: keyFiles}
+	if err := cs.reload(); err != nil {
+		return nil, err
+	}
+	cs.reloaded = make(chan struct{}, 1)
+	return cs, nil
+}
+
+// getCertificate returns the first certificate supported by the client, or the first one if none matches.
+func (cs *certStore) getCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+	for i := range cs.certs {
+		if hello.SupportsCertificate(&cs.certs[i]) == nil {
+			return &cs.certs[i], nil
+		}
+	}
+	return &cs.certs[0], nil
+}
+
+// reload loads all certificates and key pairs.
+// The current certificates are only replaced, if all of them were loaded successfully.
+func (cs *certStore) reload() error {
+	certs := make([]tls.Certificate, len(cs.certFiles))
+	modTimes := make([]time.Time, len(cs.certFiles))
+	for i := range cs.certFiles {
+		modTimes[i] = modTime(cs.certFiles[i], cs.keyFiles[i])
+		c, err := loadKeyPair(cs.certFiles[i], cs.keyFiles[i])
+		if err != nil {
+			return err
+		}
+		certs[i] = c
+	}
+
+	cs.mu.Lock()
+	cs.certs, cs.modTimes = certs, modTimes
+	cs.mu.Unlock()
+
+	select {
+	case cs.reloaded <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// modified reports whether any certificate or key file changed since it was loaded.
+func (cs *certStore) modified() bool {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+	for i := range cs.certFiles {
+		if !modTime(cs.certFiles[i], cs.keyFiles[i]).Equal(cs.modTimes[i]) {
+			return true
+		}
+	}
+	return false
+}
+
+// watch reloads the certificates whenever one of the reload signals is received,
+// or when the files have been modified (checked at the given interval, if positive).
+// It does not return.
+func (cs *certStore) watch(interval time.Duration) {
+	sig := make(chan os.Signal, 1)
+	if len(reloadSignals) > 0 {
+		signal.Notify(sig, reloadSignals...)
+	}
+	var tick <-chan time.Time
+	if interval > 0 {
+		tick = time.NewTicker(interval).C
+	}
+
+	for {
+		select {
+		case sg := <-sig:
+			log.Info().Stringer("signal", sg).Msg("Reloading TLS certificates")
+		case <-tick:
+			if !cs.modified() {
+				continue
+			}
+			log.Info().Msg("Reloading modified TLS certificates")
+		}
+		if err := cs.reload(); err != nil {
+			log.Error().Err(err).Msg("Cannot reload TLS certificates, keeping the current ones")
+		}
+	}
+}
+
+// modTime returns the latest modification time of the given files.
+// Files, which cannot be accessed, are ignored.
+func modTime(names ...string) (t time.Time) {
+	for _, n := range names {
+		if fi, err := os.Stat(n); err == nil && fi.ModTime().After(t) {
+			t = fi.ModTime()
+		}
+	}
+	return t
+}
+
+// loadKeyPair reads and parses a certificate (chain) and its private key from PEM encoded files.
+func loadKeyPair(certFile, keyFile string) (tls.Certificate, error) {
+	c, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return c, err
+	}
+	if c.Leaf, err = x509.ParseCertificate(c.Certificate[0]); err != nil {
+		return c, err
+	}
+
+	log.Info().Str("cert", certFile).Str("subject", c.Leaf.Subject.CommonName).Strs("names", c.Leaf.DNSNames).
+		Time("expires", c.Leaf.NotAfter).Msg("Loaded TLS certificate")
+	return c, nil
+}
+
+// tlsListeners wraps the given Listeners, so that they accept TLS connections only.
+// If cfg is nil, ls is returned as is.
+func tlsListeners(ls []net.Listener, cfg *tls.Config) []net.Listener {
+	if cfg == nil {
+		return ls
+	}
+
+	tlsLs := make([]net.Listener, len(ls))
+	for i, l := range ls {
+		tlsLs[i] = tls.NewListener(l, cfg)
+	}
+	return tlsLs
+}
+
+// closeConn closes a connection without sending any response.
+func closeConn(c net.Conn) {
+	_ = c.Close()
+}
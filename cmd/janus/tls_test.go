@@ -0,0 +1,226 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/stretchr/testify/require"
+)
+
+// writeTestCert creates a self-signed certificate for the given DNS name
+// and returns the paths of the PEM encoded certificate and key files.
+func writeTestCert(t *testing.T, name string) (certFile, keyFile string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	NoError(t, err)
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IsCA:         true,
+
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	NoError(t, err)
+	kb, err := x509.MarshalECPrivateKey(key)
+	NoError(t, err)
+
+	d := t.TempDir()
+	certFile, keyFile = filepath.Join(d, name+".crt"), filepath.Join(d, name+".key")
+	NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: kb}), 0600))
+	return certFile, keyFile
+}
+
+// handshake connects to l using the given server name and returns the certificate presented by the server.
+func handshake(t *testing.T, l net.Listener, serverName string) *x509.Certificate {
+	t.Helper()
+	go func() {
+		if c, err := l.Accept(); err == nil {
+			_ = c.(*tls.Conn).Handshake()
+			_ = c.Close()
+		}
+	}()
+
+	c, err := tls.Dial("tcp", l.Addr().String(), &tls.Config{ServerName: serverName, InsecureSkipVerify: true}) //nolint:gosec
+	NoError(t, err)
+	defer func() { _ = c.Close() }()
+	return c.ConnectionState().PeerCertificates[0]
+}
+
+func Test_newTLSConfig_SNI(t *testing.T) {
+	c1, k1 := writeTestCert(t, "a.example.com")
+	c2, k2 := writeTestCert(t, "b.example.com")
+	cs, err := newCertStore([]string{c1, c2}, []string{k1, k2})
+	NoError(t, err)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	NoError(t, err)
+	cfg, err := newTLSConfig(app{TLSMinVersion: "1.2"}, cs)
+	NoError(t, err)
+	l := tlsListeners([]net.Listener{ln}, cfg)[0]
+	defer func() { _ = l.Close() }()
+
+	Equal(t, "b.example.com", handshake(t, l, "b.example.com").Subject.CommonName)
+	Equal(t, "a.example.com", handshake(t, l, "a.example.com").Subject.CommonName)
+	Equal(t, "a.example.com", handshake(t, l, "unknown.example.com").Subject.CommonName)
+}
+
+func Test_newCertStore_Invalid(t *testing.T) {
+	cs, err := newCertStore(nil, nil)
+	NoError(t, err)
+	Nil(t, cs)
+	cfg, err := newTLSConfig(app{}, cs)
+	NoError(t, err)
+	Nil(t, cfg)
+
+	_, err = newCertStore([]string{"a.crt"}, nil)
+	Error(t, err)
+	_, err = newCertStore([]string{"a.crt"}, []string{"a.key"})
+	Error(t, err)
+}
+
+func Test_certStore_reload(t *testing.T) {
+	c1, k1 := writeTestCert(t, "a.example.com")
+	c2, k2 := writeTestCert(t, "b.example.com")
+	cs, err := newCertStore([]string{c1}, []string{k1})
+	NoError(t, err)
+	False(t, cs.modified())
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	NoError(t, err)
+	cfg, err := newTLSConfig(app{TLSMinVersion: "1.2"}, cs)
+	NoError(t, err)
+	l := tlsListeners([]net.Listener{ln}, cfg)[0]
+	defer func() { _ = l.Close() }()
+	Equal(t, "a.example.com", handshake(t, l, "a.example.com").Subject.CommonName)
+
+	// renew the certificate in place
+	for src, dst := range map[string]string{c2: c1, k2: k1} {
+		b, err := os.ReadFile(src)
+		NoError(t, err)
+		NoError(t, os.WriteFile(dst, b, 0600))
+		NoError(t, os.Chtimes(dst, time.Now(), time.Now().Add(time.Minute)))
+	}
+	True(t, cs.modified())
+	NoError(t, cs.reload())
+	False(t, cs.modified())
+	Equal(t, "b.example.com", handshake(t, l, "a.example.com").Subject.CommonName)
+
+	// keep the current certificate if the new one is broken
+	NoError(t, os.WriteFile(c1, []byte("invalid"), 0600))
+	Error(t, cs.reload())
+	Equal(t, "b.example.com", handshake(t, l, "a.example.com").Subject.CommonName)
+}
+
+func Test_newTLSConfig_Policy(t *testing.T) {
+	c, k := writeTestCert(t, "a.example.com")
+	cs, err := newCertStore([]string{c}, []string{k})
+	NoError(t, err)
+
+	cfg, err := newTLSConfig(app{TLSMinVersion: "1.3"}, cs)
+	NoError(t, err)
+	Equal(t, uint16(tls.VersionTLS13), cfg.MinVersion)
+	Equal(t, []string{"TLS_AES_128_GCM_SHA256", "TLS_AES_256_GCM_SHA384", "TLS_CHACHA20_POLY1305_SHA256"}, enabledCipherSuites(cfg))
+
+	cfg, err = newTLSConfig(app{TLSMinVersion: "1.2", TLSCiphers: []string{"tls_ecdhe_ecdsa_with_aes_256_gcm_sha384"}}, cs)
+	NoError(t, err)
+	Equal(t, []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384}, cfg.CipherSuites)
+	Contains(t, enabledCipherSuites(cfg), "TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384")
+	NotContains(t, enabledCipherSuites(cfg), "TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256")
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	NoError(t, err)
+	l := tlsListeners([]net.Listener{ln}, cfg)[0]
+	defer func() { _ = l.Close() }()
+	go func() {
+		if c, err := l.Accept(); err == nil {
+			_ = c.(*tls.Conn).Handshake()
+			_ = c.Close()
+		}
+	}()
+	_, err = tls.Dial("tcp", ln.Addr().String(), &tls.Config{
+		InsecureSkipVerify: true, //nolint:gosec
+		MaxVersion:         tls.VersionTLS12,
+		CipherSuites:       []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256},
+	})
+	Error(t, err)
+
+	_, err = newTLSConfig(app{TLSMinVersion: "1.3", TLSCiphers: []string{"TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384"}}, cs)
+	Error(t, err)
+	_, err = newTLSConfig(app{TLSMinVersion: "1.2", TLSCiphers: []string{"TLS_RSA_WITH_RC4_128_SHA"}}, cs)
+	Error(t, err)
+	_, err = newTLSConfig(app{TLSMinVersion: "1.2", TLSCiphers: []string{"TLS_AES_128_GCM_SHA256"}}, cs)
+	Error(t, err)
+}
+
+func Test_newTLSConfig_ClientCA(t *testing.T) {
+	c, k := writeTestCert(t, "a.example.com")
+	cc, ck := writeTestCert(t, "client")
+	cs, err := newCertStore([]string{c}, []string{k})
+	NoError(t, err)
+	cfg, err := newTLSConfig(app{TLSMinVersion: "1.2", TLSClientCAs: []string{cc}}, cs)
+	NoError(t, err)
+	Equal(t, tls.RequireAndVerifyClientCert, cfg.ClientAuth)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	NoError(t, err)
+	l := tlsListeners([]net.Listener{ln}, cfg)[0]
+	defer func() { _ = l.Close() }()
+
+	clientCert, err := tls.LoadX509KeyPair(cc, ck)
+	NoError(t, err)
+	errc := make(chan error, 1)
+	go func() {
+		c, err := l.Accept()
+		if err != nil {
+			errc <- err
+			return
+		}
+		defer func() { _ = c.Close() }()
+		errc <- c.(*tls.Conn).Handshake()
+	}()
+	conn, err := tls.Dial("tcp", ln.Addr().String(), &tls.Config{
+		InsecureSkipVerify: true, //nolint:gosec
+		Certificates:       []tls.Certificate{clientCert},
+	})
+	NoError(t, err)
+	_ = conn.Close()
+	NoError(t, <-errc)
+
+	_, err = newTLSConfig(app{TLSMinVersion: "1.2", TLSClientCAs: []string{k}}, cs)
+	Error(t, err)
+	_, err = newTLSConfig(app{TLSClientCAs: []string{cc}}, nil)
+	Error(t, err)
+}
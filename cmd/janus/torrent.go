@@ -0,0 +1,206 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1" //nolint:gosec
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+)
+
+const (
+	// torrentCacheSize is the maximum number of cached torrents.
+	torrentCacheSize = 1000
+	// minPieceLength and maxPieceLength limit the size of the pieces a file is split into.
+	minPieceLength = 256 * 1024
+	maxPieceLength = 16 * 1024 * 1024
+	// targetPieces is the number of pieces aimed at, which keeps torrents of large files small.
+	targetPieces = 1500
+)
+
+// errNotAFile indicates that a torrent was requested for a directory.
+var errNotAFile = errors.New("not a file")
+
+// torrentFile is the torrent of a file at a certain point in time.
+type torrentFile struct {
+	size    int64
+	modTime time.Time
+	data    []byte
+}
+
+// torrents generates torrents, which refer to janus as web seed (BEP 19), and caches them until a file is modified.
+type torrents struct {
+	trackers []string
+	lru      *lru[string, torrentFile]
+}
+
+// newTorrents creates an empty cache of torrents announced to the given trackers.
+func newTorrents(trackers []string) *torrents {
+	return &torrents{trackers: trackers, lru: newLRU[string, torrentFile](torrentCacheSize, nil)}
+}
+
+// torrent returns the torrent of the named file, which is downloaded from the web seed u.
+// Hashing the pieces stops as soon as the context is done.
+func (ts *torrents) torrent(ctx context.Context, name string, fi os.FileInfo, u string) ([]byte, error) {
+	key := name + "\x00" + u
+	if t, ok := ts.lru.Get(key); ok && t.size == fi.Size() && t.modTime.Equal(fi.ModTime()) {
+		return t.data, nil
+	}
+
+	f, err := openFS(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	pl := pieceLength(fi.Size())
+	pieces := &bytes.Buffer{}
+	buf := make([]byte, pl)
+	cr := &ctxReader{ctx: ctx, r: f}
+	defer func() { traceFS(ctx, fsCopy, name, cr.elapsed) }()
+	for {
+		n, err := io.ReadFull(cr, buf)
+		if n > 0 {
+			sum := sha1.Sum(buf[:n])
+			pieces.Write(sum[:])
+		}
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+	}
+
+	meta := map[string]interface{}{
+		"created by":    "janus " + version,
+		"creation date": fi.ModTime().Unix(),
+		"url-list":      []string{u},
+		"info": map[string]interface{}{
+			"length":       fi.Size(),
+			"name":         fi.Name(),
+			"piece length": pl,
+			"pieces":       pieces.String(),
+		},
+	}
+	if len(ts.trackers) > 0 {
+		meta["announce"] = ts.trackers[0]
+	}
+	if len(ts.trackers) > 1 {
+		tiers := make([]interface{}, len(ts.trackers))
+		for i, t := range ts.trackers {
+			tiers[i] = []string{t}
+		}
+		meta["announce-list"] = tiers
+	}
+
+	b := &bytes.Buffer{}
+	if err := bencode(b, meta); err != nil {
+		return nil, err
+	}
+	ts.lru.Add(key, torrentFile{fi.Size(), fi.ModTime(), b.Bytes()})
+	return b.Bytes(), nil
+}
+
+// pieceLength chooses a power of two as piece length, such that the file consists of about targetPieces pieces.
+func pieceLength(size int64) int64 {
+	pl := int64(minPieceLength)
+	for pl < maxPieceLength && (size+pl-1)/pl > targetPieces {
+		pl *= 2
+	}
+	return pl
+}
+
+// bencode encodes strings, integers, lists and dictionaries as defined by BEP 3.
+func bencode(b *bytes.Buffer, v interface{}) error {
+	switch v := v.(type) {
+	case string:
+		b.WriteString(strconv.Itoa(len(v)) + ":" + v)
+	case int64:
+		b.WriteString("i" + strconv.FormatInt(v, 10) + "e")
+	case int:
+		b.WriteString("i" + strconv.Itoa(v) + "e")
+	case []string:
+		b.WriteByte('l')
+		for _, s := range v {
+			_ = bencode(b, s)
+		}
+		b.WriteByte('e')
+	case []interface{}:
+		b.WriteByte('l')
+		for _, e := range v {
+			if err := bencode(b, e); err != nil {
+				return err
+			}
+		}
+		b.WriteByte('e')
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		b.WriteByte('d')
+		for _, k := range keys {
+			_ = bencode(b, k)
+			if err := bencode(b, v[k]); err != nil {
+				return err
+			}
+		}
+		b.WriteByte('e')
+	default:
+		return fmt.Errorf("cannot bencode %T", v)
+	}
+	return nil
+}
+
+// handleTorrent responds with a torrent of the requested file, which lists the file's URL as web seed.
+func handleTorrent(a app) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := filepath.Join(rootDir(a, r), filepath.FromSlash(r.URL.Path))
+		fi, err := os.Stat(name)
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		} else if fi.IsDir() {
+			renderError(w, r, errNotAFile, "torrents are available for files only", http.StatusBadRequest)
+			return
+		}
+		release, ok := a.pools.acquire(w, r, poolChecksum)
+		if !ok {
+			return
+		}
+		defer release()
+
+		b, err := a.torrents.torrent(r.Context(), name, fi, externalURL(a, r, r.URL.Path))
+		if err != nil {
+			renderError(w, r, err, "cannot create torrent", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/x-bittorrent")
+		w.Header().Set("Content-Disposition", `attachment; filename="`+url.PathEscape(fi.Name())+`.torrent"`)
+		_, _ = w.Write(b)
+	}
+}
@@ -0,0 +1,101 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1" //nolint:gosec
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/stretchr/testify/require"
+)
+
+func Test_bencode(t *testing.T) {
+	b := &bytes.Buffer{}
+	NoError(t, bencode(b, map[string]interface{}{
+		"spam": []string{"a", "b"},
+		"cow":  "moo",
+		"n":    int64(-3),
+		"l":    []interface{}{1, []string{"x"}},
+	}))
+	Equal(t, "d3:cow3:moo1:lli1el1:xee1:ni-3e4:spaml1:a1:bee", b.String())
+
+	Error(t, bencode(&bytes.Buffer{}, 1.5))
+	Error(t, bencode(&bytes.Buffer{}, []interface{}{true}))
+}
+
+func Test_pieceLength(t *testing.T) {
+	Equal(t, int64(minPieceLength), pieceLength(0))
+	Equal(t, int64(minPieceLength), pieceLength(targetPieces*minPieceLength))
+	Equal(t, int64(2*minPieceLength), pieceLength(targetPieces*minPieceLength+1))
+	Equal(t, int64(maxPieceLength), pieceLength(1<<50))
+}
+
+func Test_torrents_torrent(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "big.iso")
+	NoError(t, os.WriteFile(name, []byte("data"), 0600))
+	fi, err := os.Stat(name)
+	NoError(t, err)
+
+	ts := newTorrents([]string{"http://t1/announce", "http://t2/announce"})
+	b, err := ts.torrent(context.Background(), name, fi, "http://example.com/big.iso")
+	NoError(t, err)
+	sum := sha1.Sum([]byte("data")) //nolint:gosec
+	Contains(t, string(b), "8:announce18:http://t1/announce13:announce-listll18:http://t1/announceel18:http://t2/announceee")
+	Contains(t, string(b), "4:infod6:lengthi4e4:name7:big.iso12:piece lengthi262144e6:pieces20:"+string(sum[:])+"e")
+	Contains(t, string(b), "8:url-listl26:http://example.com/big.isoe")
+
+	NoError(t, os.WriteFile(name, []byte("more"), 0600))
+	NoError(t, os.Chtimes(name, fi.ModTime(), fi.ModTime()))
+	c, err := ts.torrent(context.Background(), name, fi, "http://example.com/big.iso")
+	NoError(t, err)
+	Equal(t, b, c, "cached until the file is modified")
+
+	mod := fi.ModTime().Add(time.Second)
+	NoError(t, os.Chtimes(name, mod, mod))
+	fi, err = os.Stat(name)
+	NoError(t, err)
+	c, err = ts.torrent(context.Background(), name, fi, "http://example.com/big.iso")
+	NoError(t, err)
+	NotEqual(t, b, c)
+}
+
+func Test_handleTorrent(t *testing.T) {
+	root := t.TempDir()
+	NoError(t, os.MkdirAll(filepath.Join(root, "iso"), 0700))
+	NoError(t, os.WriteFile(filepath.Join(root, "iso", "big file.iso"), []byte("data"), 0600))
+	a := app{ServerRoot: root, Prefix: "/files/", torrents: newTorrents(nil)}
+
+	w := httptest.NewRecorder()
+	handleTorrent(a).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "http://example.com/iso/big%20file.iso?torrent", nil))
+	Equal(t, http.StatusOK, w.Code)
+	Equal(t, "application/x-bittorrent", w.Header().Get("Content-Type"))
+	Equal(t, `attachment; filename="big%20file.iso.torrent"`, w.Header().Get("Content-Disposition"))
+	Contains(t, w.Body.String(), "8:url-listl43:http://example.com/files/iso/big%20file.isoe")
+	NotContains(t, w.Body.String(), "announce")
+
+	w = httptest.NewRecorder()
+	handleTorrent(a).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/iso/?torrent", nil))
+	Equal(t, http.StatusBadRequest, w.Code)
+	w = httptest.NewRecorder()
+	handleTorrent(a).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/missing.iso?torrent", nil))
+	Equal(t, http.StatusNotFound, w.Code)
+}
@@ -0,0 +1,52 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/stretchr/testify/require"
+)
+
+func Test_totpCode(t *testing.T) {
+	// test vectors from RFC 6238 (truncated to 6 digits)
+	secret := []byte("12345678901234567890")
+	Equal(t, "287082", totpCode(secret, 59/totpPeriod))
+	Equal(t, "081804", totpCode(secret, 1111111109/totpPeriod))
+	Equal(t, "005924", totpCode(secret, 1234567890/totpPeriod))
+}
+
+func Test_verifyTOTP(t *testing.T) {
+	secret, err := newTOTPSecret()
+	NoError(t, err)
+	now := time.Unix(1_700_000_000, 0)
+
+	_, ok := verifyTOTP(secret, totpCode(secret, now.Unix()/totpPeriod), now)
+	True(t, ok)
+	_, ok = verifyTOTP(secret, totpCode(secret, now.Unix()/totpPeriod-1), now)
+	True(t, ok)
+	_, ok = verifyTOTP(secret, totpCode(secret, now.Unix()/totpPeriod-2), now)
+	False(t, ok)
+	_, ok = verifyTOTP(secret, "", now)
+	False(t, ok)
+}
+
+func Test_totpURI(t *testing.T) {
+	uri := totpURI("janus", "alice", []byte("12345678901234567890"))
+	True(t, strings.HasPrefix(uri, "otpauth://totp/janus:alice?"))
+	Contains(t, uri, "secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ")
+}
@@ -0,0 +1,76 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+// uploadResult is the JSON representation of an uploaded file, which lets automation capture its URL.
+type uploadResult struct {
+	Path    string `json:"path"`
+	Size    int64  `json:"size"`
+	Digest  string `json:"digest"`
+	Version string `json:"version"`
+	URL     string `json:"url,omitempty"`
+}
+
+// renderUploaded confirms the upload of the file at p (relative to the prefix) with the given status code.
+// Clients accepting JSON receive an uploadResult, others a message in their language.
+// Since downloads are denied in drop box mode, the URL is omitted there.
+func renderUploaded(a app, w http.ResponseWriter, r *http.Request, p string, status int) {
+	name := path.Base(p)
+	if !strings.Contains(r.Header.Get("Accept"), "application/json") {
+		w.WriteHeader(status)
+		_, _ = renderMsg(w, fmt.Sprintf(tr(r, "%s uploaded successfully."), name)+"\n")
+		return
+	}
+
+	f := filepath.Join(rootDir(a, r), filepath.FromSlash(p))
+	fi, err := os.Stat(f)
+	if err != nil {
+		renderError(w, r, err, "cannot read file", http.StatusInternalServerError)
+		return
+	}
+	release, ok := a.pools.acquire(w, r, poolChecksum)
+	if !ok {
+		return
+	}
+	digest, err := fileDigest(r.Context(), f)
+	release()
+	if err != nil {
+		renderError(w, r, err, "cannot read file", http.StatusInternalServerError)
+		return
+	}
+
+	res := uploadResult{Path: publicPath(a, p), Size: fi.Size(), Digest: digest, Version: fileETag(fi)}
+	if !a.DropBox {
+		res.URL = externalURL(a, r, p)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", res.Version)
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(res); err != nil {
+		log.Err(err).Msg("cannot render upload result")
+	}
+}
@@ -0,0 +1,63 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	. "github.com/stretchr/testify/require"
+)
+
+func Test_renderUploaded(t *testing.T) {
+	dir := t.TempDir()
+	upload := func(a app, accept string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "http://files.example.com/docs/", bytes.NewBufferString(
+			"--xxx\r\nContent-Disposition: form-data; name=\"file\"; filename=\"a.txt\"\r\n\r\nabc\r\n--xxx--\r\n"))
+		r.Header.Set("Content-Type", "multipart/form-data; boundary=xxx")
+		r.Header.Set("Accept", accept)
+		w := httptest.NewRecorder()
+		handleRequest(a).ServeHTTP(w, r)
+		return w
+	}
+	NoError(t, os.Mkdir(filepath.Join(dir, "docs"), 0755))
+
+	w := upload(app{ServerRoot: dir, EnableUpload: true}, "text/plain")
+	Equal(t, http.StatusOK, w.Code)
+	Equal(t, "a.txt uploaded successfully.\n", w.Body.String())
+
+	w = upload(app{ServerRoot: dir, EnableUpload: true, Prefix: "/files/"}, "application/json")
+	Equal(t, http.StatusOK, w.Code)
+	Equal(t, "application/json", w.Header().Get("Content-Type"))
+	var res uploadResult
+	NoError(t, json.NewDecoder(w.Body).Decode(&res))
+	Equal(t, "/files/docs/a.txt", res.Path)
+	Equal(t, int64(3), res.Size)
+	Equal(t, "sha-256=:ungWv48Bz+pBQUDeXa4iI7ADYaOWF3qctBD/YfIAFa0=:", res.Digest)
+	Equal(t, w.Header().Get("ETag"), res.Version)
+	Equal(t, "http://files.example.com/files/docs/a.txt", res.URL)
+
+	w = upload(app{ServerRoot: dir, DropBox: true}, "application/json")
+	var dropped uploadResult
+	NoError(t, json.NewDecoder(w.Body).Decode(&dropped))
+	True(t, strings.HasPrefix(dropped.Path, "/docs/a"))
+	Empty(t, dropped.URL)
+}
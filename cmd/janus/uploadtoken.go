@@ -0,0 +1,61 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/subtle"
+	"net/http"
+
+	"github.com/rs/zerolog/log"
+)
+
+// uploadTokenHeader is the request header carrying the upload token.
+const uploadTokenHeader = "X-Janus-Token"
+
+// requireUploadToken permits requests other than GET and HEAD only if they carry the token, either in the
+// X-Janus-Token header or in the "token" query parameter, which lets the upload form pass it on.
+// The query parameter is removed, so that the token does not end up in redirects.
+// Otherwise, "401 Unauthorized" is sent.
+// If the token is empty, h is returned as is.
+func requireUploadToken(token string, h http.Handler) http.Handler {
+	if token == "" {
+		return h
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		q := r.URL.Query()
+		tok := r.Header.Get(uploadTokenHeader)
+		if tok == "" {
+			tok = q.Get("token")
+		}
+		if subtle.ConstantTimeCompare([]byte(tok), []byte(token)) == 1 {
+			if _, ok := q["token"]; ok {
+				q.Del("token")
+				r.URL.RawQuery = q.Encode()
+			}
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		log.Warn().Str("request-id", requestIDFrom(r.Context())).Str("client", clientIP(r)).
+			Str("method", r.Method).Str("path", r.URL.Path).Msg("Invalid upload token")
+		renderError(w, r, errAccessDenied, "upload token required", http.StatusUnauthorized)
+	})
+}
@@ -0,0 +1,66 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	. "github.com/stretchr/testify/require"
+)
+
+func Test_requireUploadToken(t *testing.T) {
+	h := requireUploadToken("s3cr3t", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.URL.RawQuery))
+	}))
+	serve := func(method, target, header string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, target, nil)
+		if header != "" {
+			r.Header.Set("X-Janus-Token", header)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	Equal(t, http.StatusOK, serve(http.MethodGet, "/a.txt", "").Code)
+	Equal(t, http.StatusOK, serve(http.MethodHead, "/a.txt", "").Code)
+	Equal(t, http.StatusOK, serve(http.MethodPost, "/", "s3cr3t").Code)
+	Equal(t, http.StatusOK, serve(http.MethodPut, "/a.txt", "s3cr3t").Code)
+
+	w := serve(http.MethodPost, "/?token=s3cr3t&x=1", "")
+	Equal(t, http.StatusOK, w.Code)
+	Equal(t, "x=1", w.Body.String())
+
+	Equal(t, http.StatusUnauthorized, serve(http.MethodPost, "/", "").Code)
+	Equal(t, http.StatusUnauthorized, serve(http.MethodPut, "/a.txt", "wrong").Code)
+	Equal(t, http.StatusUnauthorized, serve(http.MethodDelete, "/a.txt?token=wrong", "").Code)
+
+	h = requireUploadToken("", http.NotFoundHandler())
+	Equal(t, http.StatusNotFound, serve(http.MethodPost, "/", "").Code)
+}
+
+func Test_handleUploadPage_Token(t *testing.T) {
+	h := handleRequest(app{ServerRoot: t.TempDir(), Prefix: "/", EnableUpload: true, UploadToken: "s3cr3t"})
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/?upload&token=s3cr3t", nil))
+	Equal(t, http.StatusOK, w.Code)
+	Contains(t, w.Body.String(), `action="/?token=s3cr3t"`)
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/?upload", nil))
+	Contains(t, w.Body.String(), `action="/"`)
+}
@@ -0,0 +1,151 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"expvar"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// upstreamTimeout is the maximum duration of fetching a file, which is long enough for large downloads,
+// but makes sure that stalled ones eventually release the file.
+const upstreamTimeout = time.Hour
+
+// upstreamStats counts the files fetched from the upstream server, the ones it does not have and the failed fetches.
+var upstreamStats = expvar.NewMap("mirror_upstream")
+
+// errUpstream indicates that a file could not be fetched from the upstream server.
+var errUpstream = errors.New("upstream server failed")
+
+// upstream fetches files, which are missing in the server root, from an upstream HTTP server and stores them below
+// the server root, so that janus acts as pull-through mirror e.g., for release downloads.
+// Concurrent requests for the same file wait for a single download.
+type upstream struct {
+	base    *url.URL
+	client  *http.Client
+	fetches fileMutexes
+}
+
+// newUpstream creates an upstream for the base URL of the mirror-upstream option.
+// If no upstream is configured, nil is returned.
+func newUpstream(a app) (*upstream, error) {
+	if a.MirrorUpstream == "" {
+		return nil, nil
+	}
+	u, err := url.Parse(a.MirrorUpstream)
+	if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") || u.RawQuery != "" {
+		return nil, fmt.Errorf("invalid upstream URL %q", a.MirrorUpstream)
+	} else if a.Chroot {
+		return nil, errors.New("mirror upstream cannot be combined with chroot")
+	}
+	return &upstream{base: u, client: &http.Client{Transport: outboundTransport, Timeout: upstreamTimeout,
+		CheckRedirect: sameUpstreamPath}}, nil
+}
+
+// sameUpstreamPath permits redirects to another host or scheme, but rejects those changing the path.
+// Otherwise, the content of another resource, e.g., the listing of "/dir/" when "/dir" was requested, would be stored.
+func sameUpstreamPath(req *http.Request, via []*http.Request) error {
+	if len(via) >= 10 {
+		return errors.New("stopped after 10 redirects")
+	} else if req.URL.Path != via[0].URL.Path {
+		return http.ErrUseLastResponse
+	}
+	return nil
+}
+
+// fetch downloads the requested file from the upstream server to name, if it is missing.
+// Directories are not mirrored, and files unknown to the upstream server are left missing, hence result in 404.
+// The file is written to a temporary file first, so that other requests never serve a partial download.
+// If u is nil, fetch does nothing.
+func (u *upstream) fetch(r *http.Request, name string) error {
+	if u == nil || (r.Method != http.MethodGet && r.Method != http.MethodHead) || strings.HasSuffix(r.URL.Path, "/") {
+		return nil
+	}
+	if _, err := os.Stat(name); !errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	unlock := u.fetches.lock(name)
+	defer unlock()
+	if _, err := os.Stat(name); !errors.Is(err, os.ErrNotExist) {
+		// fetched by a concurrent request
+		return nil
+	}
+
+	src := *u.base
+	src.Path = path.Join("/", u.base.Path, r.URL.Path)
+	req, err := http.NewRequestWithContext(r.Context(), http.MethodGet, src.String(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", "janus/"+version)
+	resp, err := u.client.Do(req)
+	if err != nil {
+		return u.failed(r, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone {
+		upstreamStats.Add("missing", 1)
+		return nil
+	} else if resp.StatusCode != http.StatusOK {
+		return u.failed(r, errors.New(resp.Status))
+	}
+
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(name), ".janus-upstream-*")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.Remove(f.Name()) }()
+	defer f.Close()
+
+	n, err := io.Copy(f, resp.Body)
+	if err != nil {
+		return u.failed(r, err)
+	} else if err := f.Close(); err != nil {
+		return err
+	}
+	if t, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil {
+		_ = os.Chtimes(f.Name(), t, t)
+	}
+	if err := os.Rename(f.Name(), name); err != nil {
+		return err
+	}
+	upstreamStats.Add("fetched", 1)
+	log.Info().Str("request-id", requestIDFrom(r.Context())).Str("url", src.String()).Int64("size", n).
+		Msg("Fetched file from upstream")
+	return nil
+}
+
+// failed counts a failed fetch and returns the error, unless the client disconnected in the meantime.
+func (u *upstream) failed(r *http.Request, err error) error {
+	if err := r.Context().Err(); err != nil {
+		return err
+	}
+	upstreamStats.Add("failed", 1)
+	return fmt.Errorf("%w: %s", errUpstream, err)
+}
@@ -0,0 +1,105 @@
+// Copyright 2021 The Janus authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "github.com/stretchr/testify/require"
+)
+
+func Test_newUpstream(t *testing.T) {
+	u, err := newUpstream(app{})
+	NoError(t, err)
+	Nil(t, u)
+
+	u, err = newUpstream(app{MirrorUpstream: "https://origin.example.com/releases/"})
+	NoError(t, err)
+	Equal(t, "/releases/", u.base.Path)
+
+	for _, s := range []string{"origin.example.com", "ftp://origin.example.com", "https://origin.example.com/?a=b"} {
+		_, err = newUpstream(app{MirrorUpstream: s})
+		EqualError(t, err, `invalid upstream URL "`+s+`"`)
+	}
+	_, err = newUpstream(app{MirrorUpstream: "https://origin.example.com", Chroot: true})
+	EqualError(t, err, "mirror upstream cannot be combined with chroot")
+}
+
+func Test_handleRequest_MirrorUpstream(t *testing.T) {
+	mtime := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	var fetches int32
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&fetches, 1)
+		switch r.URL.Path {
+		case "/releases/v1/app.tgz":
+			w.Header().Set("Last-Modified", mtime.Format(http.TimeFormat))
+			_, _ = w.Write([]byte("app"))
+		case "/releases/broken.tgz":
+			w.WriteHeader(http.StatusInternalServerError)
+		case "/releases/dir":
+			http.Redirect(w, r, "/releases/dir/", http.StatusMovedPermanently)
+		case "/releases/dir/":
+			_, _ = w.Write([]byte("<html>listing</html>"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(origin.Close)
+
+	root := t.TempDir()
+	u, err := newUpstream(app{MirrorUpstream: origin.URL + "/releases"})
+	NoError(t, err)
+	h := handleRequest(app{ServerRoot: root, upstream: u})
+	serve := func(method, target string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(method, target, nil))
+		return w
+	}
+
+	w := serve(http.MethodGet, "/v1/app.tgz")
+	Equal(t, http.StatusOK, w.Code)
+	Equal(t, "app", w.Body.String())
+	Equal(t, mtime.Format(http.TimeFormat), w.Header().Get("Last-Modified"))
+	b, err := os.ReadFile(filepath.Join(root, "v1", "app.tgz"))
+	NoError(t, err)
+	Equal(t, "app", string(b))
+
+	// subsequent requests are served from disk
+	Equal(t, "app", serve(http.MethodGet, "/v1/app.tgz").Body.String())
+	Equal(t, int32(1), atomic.LoadInt32(&fetches))
+
+	Equal(t, http.StatusNotFound, serve(http.MethodGet, "/missing.tgz").Code)
+	w = serve(http.MethodGet, "/broken.tgz")
+	Equal(t, http.StatusBadGateway, w.Code)
+	Equal(t, "JANUS_UPSTREAM_FAILED", w.Header().Get("X-Janus-Error"))
+	NoFileExists(t, filepath.Join(root, "broken.tgz"))
+
+	// directories are not fetched
+	Equal(t, http.StatusNotFound, serve(http.MethodGet, "/v2/").Code)
+	Equal(t, int32(3), atomic.LoadInt32(&fetches))
+	entries, err := os.ReadDir(root)
+	NoError(t, err)
+	Len(t, entries, 1)
+
+	// redirects changing the path are not followed
+	Equal(t, http.StatusBadGateway, serve(http.MethodGet, "/dir").Code)
+	NoFileExists(t, filepath.Join(root, "dir"))
+}